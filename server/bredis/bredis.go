@@ -112,3 +112,36 @@ func (c *Client) CheckRateLimit(identifier string, limit int64, window time.Dura
 func (c *Client) ResetRateLimit(identifier string) {
 	_ = c.Delete("rl:" + identifier)
 }
+
+// Publish JSON-encodes value and sends it to every subscriber of channel
+func (c *Client) Publish(channel string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return c.Client.Publish(c.ctx, c.key(channel), data).Err()
+}
+
+// Subscribe listens on channel until ctx ends or the returned PubSub is closed
+func (c *Client) Subscribe(ctx context.Context, channel string) *redis.PubSub {
+	return c.Client.Subscribe(ctx, c.key(channel))
+}
+
+// PushCapped prepends value to a list, trims it to max entries and refreshes its TTL
+func (c *Client) PushCapped(key string, value interface{}, max int64, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	pipe := c.Client.TxPipeline()
+	pipe.LPush(c.ctx, c.key(key), data)
+	pipe.LTrim(c.ctx, c.key(key), 0, max-1)
+	pipe.Expire(c.ctx, c.key(key), ttl)
+	_, err = pipe.Exec(c.ctx)
+	return err
+}
+
+// GetList returns the raw entries of a list, newest first for lists built with PushCapped
+func (c *Client) GetList(key string) ([]string, error) {
+	return c.Client.LRange(c.ctx, c.key(key), 0, -1).Result()
+}
@@ -0,0 +1,10 @@
+-- Migration: Add checksum column to file_uploads table
+-- Created at: 2026-10-18
+
+-- +migrate Up
+ALTER TABLE file_uploads ADD COLUMN IF NOT EXISTS checksum VARCHAR(64);
+CREATE INDEX IF NOT EXISTS idx_file_uploads_checksum ON file_uploads(checksum);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_file_uploads_checksum;
+ALTER TABLE file_uploads DROP COLUMN IF EXISTS checksum;
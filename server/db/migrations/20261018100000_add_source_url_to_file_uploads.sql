@@ -0,0 +1,8 @@
+-- Migration: Add source_url column to file_uploads table
+-- Created at: 2026-10-18
+
+-- +migrate Up
+ALTER TABLE file_uploads ADD COLUMN IF NOT EXISTS source_url TEXT;
+
+-- +migrate Down
+ALTER TABLE file_uploads DROP COLUMN IF EXISTS source_url;
@@ -0,0 +1,16 @@
+-- Migration: Add scan status column to file_uploads table
+-- Created at: 2026-10-18
+
+-- +migrate Up
+-- Existing rows predate scanning and are treated as clean
+ALTER TABLE file_uploads ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'clean';
+ALTER TABLE file_uploads ADD CONSTRAINT chk_file_uploads_status
+    CHECK (status IN ('pending', 'clean', 'infected', 'quarantined'));
+CREATE INDEX IF NOT EXISTS idx_file_uploads_status ON file_uploads(status);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_file_uploads_filename ON file_uploads(filename);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_file_uploads_filename;
+DROP INDEX IF EXISTS idx_file_uploads_status;
+ALTER TABLE file_uploads DROP CONSTRAINT IF EXISTS chk_file_uploads_status;
+ALTER TABLE file_uploads DROP COLUMN IF EXISTS status;
@@ -0,0 +1,34 @@
+-- Migration: Create jobs table for background processing
+-- Created at: 2026-10-18
+
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS jobs (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(100) NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}',
+    status VARCHAR(20) NOT NULL DEFAULT 'queued',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 5,
+    last_error TEXT,
+    run_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT chk_jobs_status CHECK (status IN ('queued', 'running', 'done', 'dead'))
+);
+
+-- Workers only ever look for runnable or stuck jobs
+CREATE INDEX IF NOT EXISTS idx_jobs_runnable ON jobs(run_at) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS idx_jobs_running ON jobs(locked_at) WHERE status = 'running';
+
+ALTER TABLE file_uploads ADD COLUMN IF NOT EXISTS processing_state VARCHAR(20) NOT NULL DEFAULT 'completed';
+ALTER TABLE file_uploads ADD CONSTRAINT chk_file_uploads_processing_state
+    CHECK (processing_state IN ('queued', 'processing', 'completed', 'failed'));
+
+-- +migrate Down
+ALTER TABLE file_uploads DROP CONSTRAINT IF EXISTS chk_file_uploads_processing_state;
+ALTER TABLE file_uploads DROP COLUMN IF EXISTS processing_state;
+DROP INDEX IF EXISTS idx_jobs_running;
+DROP INDEX IF EXISTS idx_jobs_runnable;
+DROP TABLE IF EXISTS jobs;
@@ -0,0 +1,29 @@
+-- Migration: Create upload_shares table for public share links
+-- Created at: 2026-10-18
+
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS upload_shares (
+    id BIGSERIAL PRIMARY KEY,
+    upload_id INTEGER NOT NULL REFERENCES file_uploads(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- Only a SHA-256 of the token is stored; the hint helps owners tell links apart
+    token_hash CHAR(64) NOT NULL,
+    token_hint VARCHAR(8) NOT NULL,
+    password_hash VARCHAR(255),
+    expires_at TIMESTAMP WITH TIME ZONE,
+    max_views INTEGER,
+    view_count INTEGER NOT NULL DEFAULT 0,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    last_viewed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT chk_upload_shares_max_views CHECK (max_views IS NULL OR max_views > 0)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_upload_shares_token_hash ON upload_shares(token_hash);
+CREATE INDEX IF NOT EXISTS idx_upload_shares_upload_id ON upload_shares(upload_id);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_upload_shares_upload_id;
+DROP INDEX IF EXISTS idx_upload_shares_token_hash;
+DROP TABLE IF EXISTS upload_shares;
@@ -0,0 +1,36 @@
+-- Migration: Create albums and album_items tables
+-- Created at: 2026-10-18
+
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS albums (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    -- Deleting the cover image just clears the cover
+    cover_upload_id INTEGER REFERENCES file_uploads(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_albums_user_id ON albums(user_id, created_at);
+
+-- Membership only: removing an album or an item never touches file_uploads
+CREATE TABLE IF NOT EXISTS album_items (
+    album_id BIGINT NOT NULL REFERENCES albums(id) ON DELETE CASCADE,
+    upload_id INTEGER NOT NULL REFERENCES file_uploads(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    added_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (album_id, upload_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_album_items_position ON album_items(album_id, position);
+CREATE INDEX IF NOT EXISTS idx_album_items_upload_id ON album_items(upload_id);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_album_items_upload_id;
+DROP INDEX IF EXISTS idx_album_items_position;
+DROP TABLE IF EXISTS album_items;
+DROP INDEX IF EXISTS idx_albums_user_id;
+DROP TABLE IF EXISTS albums;
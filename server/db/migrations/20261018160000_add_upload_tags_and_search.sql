@@ -0,0 +1,39 @@
+-- Migration: Add tags, caption and full-text search to file_uploads
+-- Created at: 2026-10-18
+
+-- +migrate Up
+ALTER TABLE file_uploads ADD COLUMN IF NOT EXISTS caption TEXT;
+ALTER TABLE file_uploads ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE file_uploads ADD COLUMN IF NOT EXISTS search_vector TSVECTOR;
+
+-- A trigger rather than a generated column: array_to_string is not immutable.
+-- The 'simple' config keeps filenames and tags unstemmed so exact words match.
+CREATE OR REPLACE FUNCTION file_uploads_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('simple', coalesce(NEW.original_filename, '')), 'A') ||
+        setweight(to_tsvector('simple', array_to_string(NEW.tags, ' ')), 'A') ||
+        setweight(to_tsvector('simple', coalesce(NEW.caption, '')), 'B');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_file_uploads_search_vector ON file_uploads;
+CREATE TRIGGER trg_file_uploads_search_vector
+    BEFORE INSERT OR UPDATE OF original_filename, caption, tags ON file_uploads
+    FOR EACH ROW EXECUTE FUNCTION file_uploads_search_vector_update();
+
+-- Backfill existing rows through the trigger
+UPDATE file_uploads SET tags = tags;
+
+CREATE INDEX IF NOT EXISTS idx_file_uploads_search_vector ON file_uploads USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_file_uploads_tags ON file_uploads USING GIN (tags);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_file_uploads_tags;
+DROP INDEX IF EXISTS idx_file_uploads_search_vector;
+DROP TRIGGER IF EXISTS trg_file_uploads_search_vector ON file_uploads;
+DROP FUNCTION IF EXISTS file_uploads_search_vector_update();
+ALTER TABLE file_uploads DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE file_uploads DROP COLUMN IF EXISTS tags;
+ALTER TABLE file_uploads DROP COLUMN IF EXISTS caption;
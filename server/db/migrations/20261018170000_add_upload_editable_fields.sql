@@ -0,0 +1,52 @@
+-- Migration: Add owner-editable fields and a version column to file_uploads
+-- Created at: 2026-10-18
+
+-- +migrate Up
+ALTER TABLE file_uploads ADD COLUMN IF NOT EXISTS display_name VARCHAR(255);
+ALTER TABLE file_uploads ADD COLUMN IF NOT EXISTS alt_text TEXT;
+ALTER TABLE file_uploads ADD COLUMN IF NOT EXISTS visibility VARCHAR(10) NOT NULL DEFAULT 'private'
+    CHECK (visibility IN ('private', 'public'));
+-- Bumped on every metadata change; exposed as the ETag for If-Match
+ALTER TABLE file_uploads ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE file_uploads ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+
+UPDATE file_uploads SET updated_at = created_at;
+
+-- The display name replaces the original filename in search when set
+CREATE OR REPLACE FUNCTION file_uploads_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('simple', coalesce(NEW.display_name, NEW.original_filename, '')), 'A') ||
+        setweight(to_tsvector('simple', array_to_string(NEW.tags, ' ')), 'A') ||
+        setweight(to_tsvector('simple', coalesce(NEW.caption, '')), 'B') ||
+        setweight(to_tsvector('simple', coalesce(NEW.alt_text, '')), 'C');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_file_uploads_search_vector ON file_uploads;
+CREATE TRIGGER trg_file_uploads_search_vector
+    BEFORE INSERT OR UPDATE OF original_filename, display_name, caption, alt_text, tags ON file_uploads
+    FOR EACH ROW EXECUTE FUNCTION file_uploads_search_vector_update();
+
+-- +migrate Down
+CREATE OR REPLACE FUNCTION file_uploads_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('simple', coalesce(NEW.original_filename, '')), 'A') ||
+        setweight(to_tsvector('simple', array_to_string(NEW.tags, ' ')), 'A') ||
+        setweight(to_tsvector('simple', coalesce(NEW.caption, '')), 'B');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_file_uploads_search_vector ON file_uploads;
+CREATE TRIGGER trg_file_uploads_search_vector
+    BEFORE INSERT OR UPDATE OF original_filename, caption, tags ON file_uploads
+    FOR EACH ROW EXECUTE FUNCTION file_uploads_search_vector_update();
+
+ALTER TABLE file_uploads DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE file_uploads DROP COLUMN IF EXISTS version;
+ALTER TABLE file_uploads DROP COLUMN IF EXISTS visibility;
+ALTER TABLE file_uploads DROP COLUMN IF EXISTS alt_text;
+ALTER TABLE file_uploads DROP COLUMN IF EXISTS display_name;
@@ -0,0 +1,27 @@
+-- Migration: Create archives table for asynchronous exports
+-- Created at: 2026-10-18
+
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS archives (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- Snapshot of the selection; uploads deleted before the build are skipped
+    upload_ids BIGINT[] NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'building', 'ready', 'failed')),
+    total_size BIGINT NOT NULL DEFAULT 0,
+    file_path TEXT,
+    file_size BIGINT,
+    error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_archives_user_id ON archives(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_archives_expires_at ON archives(expires_at) WHERE status = 'ready';
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_archives_expires_at;
+DROP INDEX IF EXISTS idx_archives_user_id;
+DROP TABLE IF EXISTS archives;
@@ -0,0 +1,15 @@
+-- Migration: Add wrapped data keys for envelope-encrypted uploads
+-- Created at: 2026-10-18
+
+-- +migrate Up
+-- NULL for files stored before encryption was enabled
+ALTER TABLE file_uploads ADD COLUMN IF NOT EXISTS encrypted_key TEXT;
+ALTER TABLE file_uploads ADD COLUMN IF NOT EXISTS encryption_key_id VARCHAR(64);
+
+CREATE INDEX IF NOT EXISTS idx_file_uploads_encryption_key_id ON file_uploads(encryption_key_id)
+    WHERE encryption_key_id IS NOT NULL;
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_file_uploads_encryption_key_id;
+ALTER TABLE file_uploads DROP COLUMN IF EXISTS encryption_key_id;
+ALTER TABLE file_uploads DROP COLUMN IF EXISTS encrypted_key;
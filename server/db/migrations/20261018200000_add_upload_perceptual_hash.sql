@@ -0,0 +1,14 @@
+-- Migration: Add perceptual hashes for near-duplicate detection
+-- Created at: 2026-10-18
+
+-- +migrate Up
+-- 64-bit dHash stored as BIGINT; NULL when the image could not be decoded
+ALTER TABLE file_uploads ADD COLUMN IF NOT EXISTS perceptual_hash BIGINT;
+
+-- Hamming distance cannot use an index, so lookups scan one user's hashed rows
+CREATE INDEX IF NOT EXISTS idx_file_uploads_user_perceptual_hash ON file_uploads(user_id, perceptual_hash)
+    WHERE perceptual_hash IS NOT NULL;
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_file_uploads_user_perceptual_hash;
+ALTER TABLE file_uploads DROP COLUMN IF EXISTS perceptual_hash;
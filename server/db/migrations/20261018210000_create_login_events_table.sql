@@ -0,0 +1,19 @@
+-- Migration: Create login_events table to keep a login history per user
+-- Created at: 2026-10-18
+
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS login_events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_ip VARCHAR(45),
+    user_agent TEXT,
+    -- Failed attempts are only recorded for usernames that exist
+    success BOOLEAN NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_events_user_id ON login_events(user_id, created_at);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_login_events_user_id;
+DROP TABLE IF EXISTS login_events;
@@ -0,0 +1,29 @@
+-- Migration: Create account_deletions table for scheduled account deletion
+-- Created at: 2026-10-18
+
+-- +migrate Up
+-- No foreign key to users: the row is the record of a deletion and outlives the account
+CREATE TABLE IF NOT EXISTS account_deletions (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    -- The account itself, or the admin who asked for the deletion
+    requested_by INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'scheduled'
+        CHECK (status IN ('scheduled', 'cancelled', 'completed')),
+    scheduled_for TIMESTAMP WITH TIME ZONE NOT NULL,
+    files_removed INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    cancelled_at TIMESTAMP WITH TIME ZONE,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_account_deletions_scheduled_user ON account_deletions(user_id)
+    WHERE status = 'scheduled';
+CREATE INDEX IF NOT EXISTS idx_account_deletions_due ON account_deletions(scheduled_for)
+    WHERE status = 'scheduled';
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_account_deletions_due;
+DROP INDEX IF EXISTS idx_account_deletions_scheduled_user;
+DROP TABLE IF EXISTS account_deletions;
@@ -0,0 +1,48 @@
+-- Migration: Create append-only audit_events table with a hash chain
+-- Created at: 2026-10-18
+
+-- +migrate Up
+-- Each row's hash covers its own fields and the previous row's hash, so editing
+-- or removing a row breaks every hash after it (see -cmd verify-audit).
+-- actor_id has no foreign key: the trail must outlive deleted accounts.
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    action VARCHAR(64) NOT NULL,
+    actor_id INTEGER,
+    client_ip VARCHAR(45),
+    user_agent TEXT,
+    target_type VARCHAR(32),
+    target_id VARCHAR(255),
+    -- Kept as the exact JSON text that was hashed; JSONB would reorder keys
+    metadata TEXT,
+    prev_hash CHAR(64) NOT NULL,
+    hash CHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events(action, id DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events(actor_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_events_target ON audit_events(target_type, target_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events(created_at);
+
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_audit_events_append_only ON audit_events;
+CREATE TRIGGER trg_audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+DROP TRIGGER IF EXISTS trg_audit_events_no_truncate ON audit_events;
+CREATE TRIGGER trg_audit_events_no_truncate
+    BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
+
+-- +migrate Down
+DROP TRIGGER IF EXISTS trg_audit_events_no_truncate ON audit_events;
+DROP TRIGGER IF EXISTS trg_audit_events_append_only ON audit_events;
+DROP FUNCTION IF EXISTS audit_events_append_only();
+DROP TABLE IF EXISTS audit_events;
@@ -0,0 +1,15 @@
+-- Migration: Allow account deletions to be claimed by a purge
+-- Created at: 2026-10-18
+
+-- +migrate Up
+-- A purge moves its deletion to 'purging' first, so a cancellation or a second
+-- purge racing for the same row finds it no longer scheduled
+ALTER TABLE account_deletions DROP CONSTRAINT IF EXISTS account_deletions_status_check;
+ALTER TABLE account_deletions ADD CONSTRAINT account_deletions_status_check
+    CHECK (status IN ('scheduled', 'purging', 'cancelled', 'completed'));
+
+-- +migrate Down
+UPDATE account_deletions SET status = 'scheduled' WHERE status = 'purging';
+ALTER TABLE account_deletions DROP CONSTRAINT IF EXISTS account_deletions_status_check;
+ALTER TABLE account_deletions ADD CONSTRAINT account_deletions_status_check
+    CHECK (status IN ('scheduled', 'cancelled', 'completed'));
@@ -0,0 +1,17 @@
+-- Migration: Record the claim time and purge list of account deletions
+-- Created at: 2026-10-18
+
+-- +migrate Up
+-- A purge that dies after claiming its deletion leaves the row in 'purging';
+-- once claimed_at is old enough another purge takes it over. The uploads and
+-- files are listed before the user row is deleted (its cascade removes the
+-- rows that point at them), so a purge that is taken over still knows what to
+-- remove. purge_files is NULL until they have been listed.
+ALTER TABLE account_deletions ADD COLUMN claimed_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE account_deletions ADD COLUMN upload_ids BIGINT[];
+ALTER TABLE account_deletions ADD COLUMN purge_files TEXT[];
+
+-- +migrate Down
+ALTER TABLE account_deletions DROP COLUMN IF EXISTS purge_files;
+ALTER TABLE account_deletions DROP COLUMN IF EXISTS upload_ids;
+ALTER TABLE account_deletions DROP COLUMN IF EXISTS claimed_at;
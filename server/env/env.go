@@ -25,6 +25,28 @@ type ENV struct {
 	TimeZoneName   string `yaml:"time_zone_name"`
 
 	Features *Features `yaml:"features"`
+
+	Upload *Upload `yaml:"upload"`
+
+	Jobs *Jobs `yaml:"jobs"`
+
+	Webhooks *Webhooks `yaml:"webhooks"`
+
+	Archive *Archive `yaml:"archive"`
+
+	Export *Export `yaml:"export"`
+
+	Transform *Transform `yaml:"transform"`
+
+	Stream *Stream `yaml:"stream"`
+
+	Reconcile *Reconcile `yaml:"reconcile"`
+	Janitor   *Janitor   `yaml:"janitor"`
+
+	Encryption *Encryption `yaml:"encryption"`
+
+	Account *Account `yaml:"account"`
+	Admin   *Admin   `yaml:"admin"`
 }
 
 type BackendHost struct {
@@ -42,6 +64,115 @@ type Features struct {
 	EnableTokenRevoke  bool `yaml:"enable_token_revoke"`
 }
 
+type Upload struct {
+	StoragePath         string   `yaml:"storage_path"`
+	AllowedContentTypes []string `yaml:"allowed_content_types"`
+
+	MaxImageWidth      int     `yaml:"max_image_width"`
+	MaxImageHeight     int     `yaml:"max_image_height"`
+	MaxImageMegapixels float64 `yaml:"max_image_megapixels"`
+	MaxImageFrames     int     `yaml:"max_image_frames"`
+	DecodeMemoryMB     int     `yaml:"decode_memory_mb"`
+
+	RemoteFetchTimeout   string `yaml:"remote_fetch_timeout"`
+	RemoteMaxRedirects   int    `yaml:"remote_max_redirects"`
+	RemoteAllowPrivateIP bool   `yaml:"remote_allow_private_ip"`
+
+	ScannerAddress string `yaml:"scanner_address"`
+	ScannerTimeout string `yaml:"scanner_timeout"`
+
+	SimilarityThreshold int `yaml:"similarity_threshold"`
+}
+
+type Jobs struct {
+	Workers      int    `yaml:"workers"`
+	PollInterval string `yaml:"poll_interval"`
+	MaxAttempts  int    `yaml:"max_attempts"`
+	LockTimeout  string `yaml:"lock_timeout"`
+}
+
+type Webhooks struct {
+	Timeout        string          `yaml:"timeout"`
+	AllowPrivateIP bool            `yaml:"allow_private_ip"`
+	Global         []GlobalWebhook `yaml:"global"`
+}
+
+type Archive struct {
+	MaxItems  int    `yaml:"max_items"`
+	MaxSyncMB int    `yaml:"max_sync_mb"`
+	MaxMB     int    `yaml:"max_mb"`
+	LinkTTL   string `yaml:"link_ttl"`
+	Retention string `yaml:"retention"`
+}
+
+// Export configures personal data exports (POST /api/me/export)
+type Export struct {
+	LinkTTL   string `yaml:"link_ttl"`
+	Retention string `yaml:"retention"`
+}
+
+type Transform struct {
+	// Sizes is the allowlist for the w and h parameters
+	Sizes    []int  `yaml:"sizes"`
+	MemoryMB int    `yaml:"memory_mb"`
+	LinkTTL  string `yaml:"link_ttl"`
+}
+
+// Stream configures the /api/events server-sent event stream
+type Stream struct {
+	Heartbeat   string `yaml:"heartbeat"`
+	HistorySize int    `yaml:"history_size"`
+	HistoryTTL  string `yaml:"history_ttl"`
+}
+
+type Reconcile struct {
+	// Interval enables the periodic check when set; Fix lets it delete drift instead of only reporting it
+	Interval        string `yaml:"interval"`
+	Fix             bool   `yaml:"fix"`
+	VerifyChecksums bool   `yaml:"verify_checksums"`
+	GracePeriod     string `yaml:"grace_period"`
+}
+
+type Account struct {
+	// DeletionGrace is how long a requested account deletion can be cancelled
+	DeletionGrace string `yaml:"deletion_grace"`
+}
+
+// Admin lists the accounts allowed to use /api/admin
+type Admin struct {
+	UserIDs []int64 `yaml:"user_ids"`
+}
+
+// Janitor bounds the temp files under the storage root that were never committed
+type Janitor struct {
+	// Interval between runs; "0" disables the periodic janitor
+	Interval  string `yaml:"interval"`
+	MinAge    string `yaml:"min_age"`
+	MaxAge    string `yaml:"max_age"`
+	MaxSizeMB int    `yaml:"max_size_mb"`
+}
+
+// Encryption configures envelope encryption of stored files. The primary key
+// wraps new data keys; previous keys only unwrap until rotate-encryption-key has run.
+type Encryption struct {
+	EncryptionKey `yaml:",inline"`
+	PreviousKeys  []EncryptionKey `yaml:"previous_keys"`
+}
+
+// EncryptionKey is a base64-encoded 32-byte master key, inline or in a file
+type EncryptionKey struct {
+	KeyID         string `yaml:"key_id"`
+	MasterKey     string `yaml:"master_key"`
+	MasterKeyFile string `yaml:"master_key_file"`
+}
+
+// GlobalWebhook receives events for every user
+type GlobalWebhook struct {
+	URL    string   `yaml:"url"`
+	Secret string   `yaml:"secret"`
+	Events []string `yaml:"events"`
+}
+
 func (env *ENV) GetJWTDuration() time.Duration {
 	if env == nil || env.JWTTokenDuration == "" {
 		return 24 * time.Hour
@@ -71,6 +202,14 @@ func (env *ENV) GetServerPort() string {
 	return env.Backend.Port
 }
 
+// GetSocketHost is the listen address of the WebSocket server; empty disables it
+func (env *ENV) GetSocketHost() string {
+	if env == nil || env.Backend == nil {
+		return ""
+	}
+	return env.Backend.SocketHost
+}
+
 func (env *ENV) GetAPIBaseURL() string {
 	if env == nil || env.Frontend == nil || env.Frontend.APIBaseURL == "" {
 		return "http://localhost:8080"
@@ -78,6 +217,402 @@ func (env *ENV) GetAPIBaseURL() string {
 	return env.Frontend.APIBaseURL
 }
 
+func (env *ENV) GetUploadStoragePath() string {
+	if env == nil || env.Upload == nil || env.Upload.StoragePath == "" {
+		return "tmp"
+	}
+	return env.Upload.StoragePath
+}
+
+// GetAllowedContentTypes returns nil when not configured so callers can apply their own default
+func (env *ENV) GetAllowedContentTypes() []string {
+	if env == nil || env.Upload == nil {
+		return nil
+	}
+	return env.Upload.AllowedContentTypes
+}
+
+func (env *ENV) GetMaxImageWidth() int {
+	if env == nil || env.Upload == nil || env.Upload.MaxImageWidth <= 0 {
+		return 10000
+	}
+	return env.Upload.MaxImageWidth
+}
+
+func (env *ENV) GetMaxImageHeight() int {
+	if env == nil || env.Upload == nil || env.Upload.MaxImageHeight <= 0 {
+		return 10000
+	}
+	return env.Upload.MaxImageHeight
+}
+
+func (env *ENV) GetMaxImagePixels() int64 {
+	if env == nil || env.Upload == nil || env.Upload.MaxImageMegapixels <= 0 {
+		return 40 * 1000 * 1000
+	}
+	return int64(env.Upload.MaxImageMegapixels * 1000 * 1000)
+}
+
+func (env *ENV) GetMaxImageFrames() int {
+	if env == nil || env.Upload == nil || env.Upload.MaxImageFrames <= 0 {
+		return 100
+	}
+	return env.Upload.MaxImageFrames
+}
+
+// GetDecodeMemoryBudget is the decoded-pixel memory shared by all upload decodes in
+// flight; no image may need more than this with all of its frames decoded
+func (env *ENV) GetDecodeMemoryBudget() int64 {
+	if env == nil || env.Upload == nil || env.Upload.DecodeMemoryMB <= 0 {
+		return 256 * 1024 * 1024
+	}
+	return int64(env.Upload.DecodeMemoryMB) * 1024 * 1024
+}
+
+// GetSimilarityThreshold is the largest perceptual-hash Hamming distance still treated as a near-duplicate
+func (env *ENV) GetSimilarityThreshold() int {
+	if env == nil || env.Upload == nil || env.Upload.SimilarityThreshold <= 0 {
+		return 10
+	}
+	return env.Upload.SimilarityThreshold
+}
+
+func (env *ENV) GetRemoteFetchTimeout() time.Duration {
+	if env == nil || env.Upload == nil || env.Upload.RemoteFetchTimeout == "" {
+		return 15 * time.Second
+	}
+	duration, err := time.ParseDuration(env.Upload.RemoteFetchTimeout)
+	if err != nil {
+		return 15 * time.Second
+	}
+	return duration
+}
+
+func (env *ENV) GetRemoteMaxRedirects() int {
+	if env == nil || env.Upload == nil || env.Upload.RemoteMaxRedirects <= 0 {
+		return 3
+	}
+	return env.Upload.RemoteMaxRedirects
+}
+
+// AllowRemotePrivateIP disables SSRF protection for URL imports; only meant for tests
+func (env *ENV) AllowRemotePrivateIP() bool {
+	return env != nil && env.Upload != nil && env.Upload.RemoteAllowPrivateIP
+}
+
+// GetScannerAddress is the clamd address; empty disables scanning
+func (env *ENV) GetScannerAddress() string {
+	if env == nil || env.Upload == nil {
+		return ""
+	}
+	return env.Upload.ScannerAddress
+}
+
+func (env *ENV) GetScannerTimeout() time.Duration {
+	if env == nil || env.Upload == nil || env.Upload.ScannerTimeout == "" {
+		return 30 * time.Second
+	}
+	duration, err := time.ParseDuration(env.Upload.ScannerTimeout)
+	if err != nil {
+		return 30 * time.Second
+	}
+	return duration
+}
+
+// GetJobWorkers is the number of background worker goroutines; 0 keeps post-upload work inline
+func (env *ENV) GetJobWorkers() int {
+	if env == nil || env.Jobs == nil || env.Jobs.Workers < 0 {
+		return 2
+	}
+	return env.Jobs.Workers
+}
+
+func (env *ENV) GetJobPollInterval() time.Duration {
+	if env == nil || env.Jobs == nil || env.Jobs.PollInterval == "" {
+		return time.Second
+	}
+	duration, err := time.ParseDuration(env.Jobs.PollInterval)
+	if err != nil {
+		return time.Second
+	}
+	return duration
+}
+
+func (env *ENV) GetJobMaxAttempts() int {
+	if env == nil || env.Jobs == nil || env.Jobs.MaxAttempts <= 0 {
+		return 5
+	}
+	return env.Jobs.MaxAttempts
+}
+
+func (env *ENV) GetJobLockTimeout() time.Duration {
+	if env == nil || env.Jobs == nil || env.Jobs.LockTimeout == "" {
+		return 5 * time.Minute
+	}
+	duration, err := time.ParseDuration(env.Jobs.LockTimeout)
+	if err != nil {
+		return 5 * time.Minute
+	}
+	return duration
+}
+
+func (env *ENV) GetWebhookTimeout() time.Duration {
+	if env == nil || env.Webhooks == nil || env.Webhooks.Timeout == "" {
+		return 10 * time.Second
+	}
+	duration, err := time.ParseDuration(env.Webhooks.Timeout)
+	if err != nil {
+		return 10 * time.Second
+	}
+	return duration
+}
+
+// AllowWebhookPrivateIP lets webhooks target internal addresses; only meant for development
+func (env *ENV) AllowWebhookPrivateIP() bool {
+	return env != nil && env.Webhooks != nil && env.Webhooks.AllowPrivateIP
+}
+
+func (env *ENV) GetGlobalWebhooks() []GlobalWebhook {
+	if env == nil || env.Webhooks == nil {
+		return nil
+	}
+	return env.Webhooks.Global
+}
+
+func (env *ENV) GetTransformSizes() []int {
+	if env == nil || env.Transform == nil || len(env.Transform.Sizes) == 0 {
+		return nil
+	}
+	return env.Transform.Sizes
+}
+
+// GetTransformMemory is the decoded-pixel memory shared by all transforms in flight
+func (env *ENV) GetTransformMemory() int64 {
+	if env == nil || env.Transform == nil || env.Transform.MemoryMB <= 0 {
+		return env.GetDecodeMemoryBudget()
+	}
+	return int64(env.Transform.MemoryMB) * 1024 * 1024
+}
+
+// GetTransformLinkTTL is how long a signed transform URL works; defaults to 24 hours
+func (env *ENV) GetTransformLinkTTL() time.Duration {
+	if env == nil || env.Transform == nil || env.Transform.LinkTTL == "" {
+		return 24 * time.Hour
+	}
+	duration, err := time.ParseDuration(env.Transform.LinkTTL)
+	if err != nil || duration <= 0 {
+		return 24 * time.Hour
+	}
+	return duration
+}
+
+func (env *ENV) GetStreamHeartbeat() time.Duration {
+	if env == nil || env.Stream == nil || env.Stream.Heartbeat == "" {
+		return 25 * time.Second
+	}
+	duration, err := time.ParseDuration(env.Stream.Heartbeat)
+	if err != nil || duration <= 0 {
+		return 25 * time.Second
+	}
+	return duration
+}
+
+// GetStreamHistorySize is the number of recent events kept per user for Last-Event-ID resume
+func (env *ENV) GetStreamHistorySize() int {
+	if env == nil || env.Stream == nil || env.Stream.HistorySize <= 0 {
+		return 100
+	}
+	return env.Stream.HistorySize
+}
+
+func (env *ENV) GetStreamHistoryTTL() time.Duration {
+	if env == nil || env.Stream == nil || env.Stream.HistoryTTL == "" {
+		return time.Hour
+	}
+	duration, err := time.ParseDuration(env.Stream.HistoryTTL)
+	if err != nil || duration <= 0 {
+		return time.Hour
+	}
+	return duration
+}
+
+func (env *ENV) GetArchiveMaxItems() int {
+	if env == nil || env.Archive == nil || env.Archive.MaxItems <= 0 {
+		return 1000
+	}
+	return env.Archive.MaxItems
+}
+
+// GetArchiveMaxSyncBytes is the largest export streamed in the response; anything bigger is built by a job
+func (env *ENV) GetArchiveMaxSyncBytes() int64 {
+	if env == nil || env.Archive == nil || env.Archive.MaxSyncMB <= 0 {
+		return 100 << 20
+	}
+	return int64(env.Archive.MaxSyncMB) << 20
+}
+
+func (env *ENV) GetArchiveMaxBytes() int64 {
+	if env == nil || env.Archive == nil || env.Archive.MaxMB <= 0 {
+		return 2 << 30
+	}
+	return int64(env.Archive.MaxMB) << 20
+}
+
+func (env *ENV) GetArchiveLinkTTL() time.Duration {
+	if env == nil || env.Archive == nil || env.Archive.LinkTTL == "" {
+		return time.Hour
+	}
+	duration, err := time.ParseDuration(env.Archive.LinkTTL)
+	if err != nil {
+		return time.Hour
+	}
+	return duration
+}
+
+func (env *ENV) GetArchiveRetention() time.Duration {
+	if env == nil || env.Archive == nil || env.Archive.Retention == "" {
+		return 24 * time.Hour
+	}
+	duration, err := time.ParseDuration(env.Archive.Retention)
+	if err != nil {
+		return 24 * time.Hour
+	}
+	return duration
+}
+
+func (env *ENV) GetExportLinkTTL() time.Duration {
+	if env == nil || env.Export == nil || env.Export.LinkTTL == "" {
+		return time.Hour
+	}
+	duration, err := time.ParseDuration(env.Export.LinkTTL)
+	if err != nil {
+		return time.Hour
+	}
+	return duration
+}
+
+// GetExportRetention is how long a built export is kept before its file is deleted
+func (env *ENV) GetExportRetention() time.Duration {
+	if env == nil || env.Export == nil || env.Export.Retention == "" {
+		return 24 * time.Hour
+	}
+	duration, err := time.ParseDuration(env.Export.Retention)
+	if err != nil {
+		return 24 * time.Hour
+	}
+	return duration
+}
+
+// GetReconcileInterval is 0 (disabled) unless a valid interval is configured
+func (env *ENV) GetReconcileInterval() time.Duration {
+	if env == nil || env.Reconcile == nil || env.Reconcile.Interval == "" {
+		return 0
+	}
+	duration, err := time.ParseDuration(env.Reconcile.Interval)
+	if err != nil || duration < 0 {
+		return 0
+	}
+	return duration
+}
+
+func (env *ENV) ReconcileFix() bool {
+	return env != nil && env.Reconcile != nil && env.Reconcile.Fix
+}
+
+func (env *ENV) ReconcileVerifyChecksums() bool {
+	return env != nil && env.Reconcile != nil && env.Reconcile.VerifyChecksums
+}
+
+func (env *ENV) GetReconcileGracePeriod() time.Duration {
+	if env == nil || env.Reconcile == nil || env.Reconcile.GracePeriod == "" {
+		return time.Hour
+	}
+	duration, err := time.ParseDuration(env.Reconcile.GracePeriod)
+	if err != nil {
+		return time.Hour
+	}
+	return duration
+}
+
+// GetJanitorInterval defaults to 10m; an explicit zero disables the periodic janitor
+func (env *ENV) GetJanitorInterval() time.Duration {
+	if env == nil || env.Janitor == nil || env.Janitor.Interval == "" {
+		return 10 * time.Minute
+	}
+	duration, err := time.ParseDuration(env.Janitor.Interval)
+	if err != nil {
+		return 10 * time.Minute
+	}
+	if duration < 0 {
+		return 0
+	}
+	return duration
+}
+
+func (env *ENV) GetJanitorMinAge() time.Duration {
+	if env == nil || env.Janitor == nil || env.Janitor.MinAge == "" {
+		return 10 * time.Minute
+	}
+	duration, err := time.ParseDuration(env.Janitor.MinAge)
+	if err != nil || duration < 0 {
+		return 10 * time.Minute
+	}
+	return duration
+}
+
+func (env *ENV) GetJanitorMaxAge() time.Duration {
+	if env == nil || env.Janitor == nil || env.Janitor.MaxAge == "" {
+		return time.Hour
+	}
+	duration, err := time.ParseDuration(env.Janitor.MaxAge)
+	if err != nil || duration <= 0 {
+		return time.Hour
+	}
+	return duration
+}
+
+func (env *ENV) GetJanitorMaxBytes() int64 {
+	if env == nil || env.Janitor == nil || env.Janitor.MaxSizeMB <= 0 {
+		return 512 * 1024 * 1024
+	}
+	return int64(env.Janitor.MaxSizeMB) * 1024 * 1024
+}
+
+// GetAccountDeletionGrace defaults to 7 days; "0" purges accounts as soon as deletion is requested
+func (env *ENV) GetAccountDeletionGrace() time.Duration {
+	if env == nil || env.Account == nil || env.Account.DeletionGrace == "" {
+		return 7 * 24 * time.Hour
+	}
+	duration, err := time.ParseDuration(env.Account.DeletionGrace)
+	if err != nil || duration < 0 {
+		return 7 * 24 * time.Hour
+	}
+	return duration
+}
+
+func (env *ENV) IsAdmin(userID int64) bool {
+	if env == nil || env.Admin == nil {
+		return false
+	}
+	for _, id := range env.Admin.UserIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// GetEncryption returns nil unless a master key is configured
+func (env *ENV) GetEncryption() *Encryption {
+	if env == nil || env.Encryption == nil {
+		return nil
+	}
+	if env.Encryption.MasterKey == "" && env.Encryption.MasterKeyFile == "" {
+		return nil
+	}
+	return env.Encryption
+}
+
 func (env *ENV) IsDevelopment() bool {
 	return env != nil && env.Environment == "development"
 }
@@ -121,6 +656,12 @@ func (env *ENV) SetDefaults() {
 	if env.TimeZoneOffset == 0 {
 		env.TimeZoneOffset = 7
 	}
+	if env.Upload == nil {
+		env.Upload = &Upload{}
+	}
+	if env.Upload.StoragePath == "" {
+		env.Upload.StoragePath = "tmp"
+	}
 	if env.Features == nil {
 		env.Features = &Features{
 			EnableRegistration: true,
@@ -0,0 +1,141 @@
+// Package envelope implements envelope encryption for stored files: each file
+// is encrypted with its own random data key, and only the data key, wrapped
+// by a master key, is kept in the database.
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeySize is the length of master and data keys (AES-256)
+const KeySize = 32
+
+var (
+	ErrInvalidKey     = errors.New("encryption key must be 32 bytes")
+	ErrUnknownKey     = errors.New("no master key with that id")
+	ErrUnwrapFailed   = errors.New("data key could not be unwrapped")
+	ErrCorrupt        = errors.New("encrypted file is corrupt or truncated")
+	ErrNotConfigured  = errors.New("file is encrypted but no encryption key is configured")
+	ErrDuplicateKeyID = errors.New("master key ids must be unique")
+)
+
+// MasterKey is a key-encryption key; its ID is stored next to every data key it wraps
+type MasterKey struct {
+	ID  string
+	Key []byte
+}
+
+// Keyring holds the primary master key used for new files plus older keys
+// that can still unwrap existing data keys until they are rotated
+type Keyring struct {
+	primary string
+	keys    map[string][]byte
+}
+
+func NewKeyring(primary MasterKey, previous ...MasterKey) (*Keyring, error) {
+	k := &Keyring{primary: primary.ID, keys: make(map[string][]byte)}
+	for _, mk := range append([]MasterKey{primary}, previous...) {
+		if len(mk.Key) != KeySize {
+			return nil, fmt.Errorf("master key %q: %w", mk.ID, ErrInvalidKey)
+		}
+		if _, exists := k.keys[mk.ID]; exists || mk.ID == "" {
+			return nil, ErrDuplicateKeyID
+		}
+		k.keys[mk.ID] = mk.Key
+	}
+	return k, nil
+}
+
+// PrimaryID is the id of the key that wraps new data keys
+func (k *Keyring) PrimaryID() string {
+	return k.primary
+}
+
+// NewDataKey returns a fresh data key and its wrapped form under the primary key
+func (k *Keyring) NewDataKey() (dataKey []byte, wrapped string, err error) {
+	dataKey = make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, "", err
+	}
+	wrapped, err = k.Wrap(dataKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return dataKey, wrapped, nil
+}
+
+// Wrap seals a data key under the primary key. The key id is bound as
+// additional data so a wrapped key cannot be relabelled.
+func (k *Keyring) Wrap(dataKey []byte) (string, error) {
+	aead, err := newGCM(k.keys[k.primary])
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, dataKey, []byte(k.primary))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Unwrap opens a data key wrapped under the master key keyID
+func (k *Keyring) Unwrap(keyID, wrapped string) ([]byte, error) {
+	master, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, ErrUnwrapFailed
+	}
+
+	aead, err := newGCM(master)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrUnwrapFailed
+	}
+	dataKey, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(keyID))
+	if err != nil {
+		return nil, ErrUnwrapFailed
+	}
+	return dataKey, nil
+}
+
+// LoadKey reads a base64-encoded key, either inline or from a file
+func LoadKey(inline, file string) ([]byte, error) {
+	encoded := inline
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		encoded = string(data)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("master key is not valid base64: %w", err)
+	}
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,239 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Files are a short header followed by independently sealed chunks, so any
+// byte range can be decrypted by reading only the chunks it covers. Each
+// chunk's nonce is its index plus a flag marking the last chunk, which makes
+// reordered, dropped or truncated chunks fail authentication.
+const (
+	ChunkSize = 64 * 1024
+
+	headerSize = 8
+	tagSize    = 16
+	nonceSize  = 12
+)
+
+var magic = []byte("ENV1")
+
+func chunkNonce(index uint64, last bool) []byte {
+	nonce := make([]byte, nonceSize)
+	binary.BigEndian.PutUint64(nonce, index)
+	if last {
+		nonce[8] = 1
+	}
+	return nonce
+}
+
+// Writer encrypts everything written to it. Close must be called to seal the
+// final chunk; it does not close the underlying writer.
+type Writer struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	buf    []byte
+	index  uint64
+	err    error
+	header bool
+}
+
+func NewWriter(w io.Writer, dataKey []byte) (*Writer, error) {
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, aead: aead, buf: make([]byte, 0, ChunkSize)}, nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	written := 0
+	for len(p) > 0 {
+		// A full buffer is only sealed once more data arrives, so the last
+		// chunk is never an empty one after an exact multiple of ChunkSize
+		if len(w.buf) == ChunkSize {
+			if w.err = w.seal(false); w.err != nil {
+				return written, w.err
+			}
+		}
+		n := copy(w.buf[len(w.buf):ChunkSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	w.err = w.seal(true)
+	if w.err == nil {
+		w.err = errors.New("envelope: write after close")
+		return nil
+	}
+	return w.err
+}
+
+func (w *Writer) seal(last bool) error {
+	if !w.header {
+		header := make([]byte, headerSize)
+		copy(header, magic)
+		binary.BigEndian.PutUint32(header[4:], ChunkSize)
+		if _, err := w.w.Write(header); err != nil {
+			return err
+		}
+		w.header = true
+	}
+
+	sealed := w.aead.Seal(nil, chunkNonce(w.index, last), w.buf, nil)
+	if _, err := w.w.Write(sealed); err != nil {
+		return err
+	}
+	w.index++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// EncryptedSize is the on-disk size of a plaintext of the given length
+func EncryptedSize(plainSize int64) int64 {
+	chunks := (plainSize + ChunkSize - 1) / ChunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	return headerSize + plainSize + chunks*tagSize
+}
+
+// PlainSize is the plaintext length of an encrypted file of the given size
+func PlainSize(encryptedSize int64) (int64, error) {
+	body := encryptedSize - headerSize
+	if body < tagSize {
+		return 0, ErrCorrupt
+	}
+	chunks := (body + ChunkSize + tagSize - 1) / (ChunkSize + tagSize)
+	return body - chunks*tagSize, nil
+}
+
+// Reader decrypts an encrypted file with random access. It implements
+// io.ReadSeeker over the plaintext, so it can be handed to http.ServeContent.
+type Reader struct {
+	src    io.ReaderAt
+	aead   cipher.AEAD
+	size   int64
+	chunks int64
+	offset int64
+
+	// The most recently decrypted chunk, since reads are usually sequential
+	cached      int64
+	cachedPlain []byte
+}
+
+// NewReader checks the header of src, whose total length is encryptedSize
+func NewReader(src io.ReaderAt, encryptedSize int64, dataKey []byte) (*Reader, error) {
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, headerSize)
+	if _, err := src.ReadAt(header, 0); err != nil {
+		return nil, ErrCorrupt
+	}
+	if !bytes.Equal(header[:4], magic) || binary.BigEndian.Uint32(header[4:]) != ChunkSize {
+		return nil, ErrCorrupt
+	}
+
+	size, err := PlainSize(encryptedSize)
+	if err != nil {
+		return nil, err
+	}
+	chunks := (size + ChunkSize - 1) / ChunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+
+	return &Reader{src: src, aead: aead, size: size, chunks: chunks, cached: -1}, nil
+}
+
+// Size is the plaintext length
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+func (r *Reader) chunk(index int64) ([]byte, error) {
+	if index == r.cached {
+		return r.cachedPlain, nil
+	}
+
+	plainLen := int64(ChunkSize)
+	if index == r.chunks-1 {
+		plainLen = r.size - index*ChunkSize
+	}
+	sealed := make([]byte, plainLen+tagSize)
+	offset := headerSize + index*(ChunkSize+tagSize)
+	if n, err := r.src.ReadAt(sealed, offset); int64(n) != int64(len(sealed)) {
+		if err == nil || err == io.EOF {
+			err = ErrCorrupt
+		}
+		return nil, err
+	}
+
+	plain, err := r.aead.Open(sealed[:0], chunkNonce(uint64(index), index == r.chunks-1), sealed, nil)
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	r.cached, r.cachedPlain = index, plain
+	return plain, nil
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("envelope: negative offset")
+	}
+
+	read := 0
+	for read < len(p) {
+		pos := off + int64(read)
+		if pos >= r.size {
+			return read, io.EOF
+		}
+		plain, err := r.chunk(pos / ChunkSize)
+		if err != nil {
+			return read, err
+		}
+		read += copy(p[read:], plain[pos%ChunkSize:])
+	}
+	return read, nil
+}
+
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("envelope: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("envelope: negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
@@ -19,6 +19,9 @@ var cmdFlag = flag.String("cmd", "", "Command mode")
 var db = flag.String("db", "", "Database command: migrate, rollback, generate, status")
 var migrationName = flag.String("name", "", "Migration name (for generate)")
 var steps = flag.Int("steps", 1, "Number of migrations to rollback")
+var dryRun = flag.Bool("dry-run", false, "Report what a command would change without changing it")
+var userID = flag.Int64("user-id", 0, "User to act on (for export-user)")
+var output = flag.String("out", "", "Output file (for export-user)")
 
 func main() {
 	flag.Parse()
@@ -45,7 +48,7 @@ func main() {
 
 	if *cmdFlag != "" {
 		instance := models.NewModels(true)
-		instance.RunCmd(*cmdFlag)
+		instance.RunCmd(*cmdFlag, models.CmdOptions{DryRun: *dryRun, UserID: *userID, Output: *output})
 		return
 	}
 
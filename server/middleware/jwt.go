@@ -33,3 +33,20 @@ func JWTMiddleware(validateFn ValidateTokenFunc) echo.MiddlewareFunc {
 		}
 	}
 }
+
+// TokenFromQuery copies a bearer token from the given query parameter into the
+// Authorization header when the header is absent, for clients such as browser
+// WebSockets that cannot set headers. Chain it before JWTMiddleware.
+func TokenFromQuery(param string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.Header.Get("Authorization") == "" {
+				if token := c.QueryParam(param); token != "" {
+					req.Header.Set("Authorization", "Bearer "+token)
+				}
+			}
+			return next(c)
+		}
+	}
+}
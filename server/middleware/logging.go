@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -46,6 +47,10 @@ func RecoverWithLogger() echo.MiddlewareFunc {
 		return func(c echo.Context) error {
 			defer func() {
 				if r := recover(); r != nil {
+					// Handlers abort a half-written response this way; net/http drops the connection
+					if r == http.ErrAbortHandler {
+						panic(r)
+					}
 					req := c.Request()
 					log.Error().
 						Interface("panic", r).
@@ -0,0 +1,66 @@
+package account
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	StatusScheduled = "scheduled"
+	// StatusPurging marks a deletion claimed by a purge; it can no longer be cancelled
+	StatusPurging   = "purging"
+	StatusCancelled = "cancelled"
+	StatusCompleted = "completed"
+)
+
+// Deletion is a requested account deletion. It can be cancelled until
+// ScheduledFor, then the account is purged; the row is kept as the record of it.
+type Deletion struct {
+	ID       int64  `json:"id"`
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	// RequestedBy is the account itself, or the admin who asked for the deletion
+	RequestedBy  int64      `json:"requested_by"`
+	Status       string     `json:"status"`
+	ScheduledFor time.Time  `json:"scheduled_for"`
+	FilesRemoved int        `json:"files_removed"`
+	CreatedAt    time.Time  `json:"created_at"`
+	CancelledAt  *time.Time `json:"cancelled_at,omitempty"`
+	ClaimedAt    *time.Time `json:"claimed_at,omitempty"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+	// UploadIDs and PurgeFiles are what the purge removes, listed before the
+	// user row goes; PurgeFiles is nil until then
+	UploadIDs  []int64  `json:"-"`
+	PurgeFiles []string `json:"-"`
+}
+
+type Repository interface {
+	CreateDeletion(d *Deletion) (*Deletion, error)
+	GetDeletion(id int64) (*Deletion, bool)
+	// ScheduledDeletion returns the user's deletion that is still waiting to run
+	ScheduledDeletion(userID int64) (*Deletion, bool)
+	// DueDeletions lists scheduled deletions whose grace period ended before
+	// now, and purging ones claimed before staleBefore
+	DueDeletions(now, staleBefore time.Time) ([]*Deletion, error)
+	// CancelDeletion returns ErrNoDeletion unless the deletion was still scheduled
+	CancelDeletion(id int64) error
+	// ClaimDeletion moves a scheduled deletion to purging, or takes over one
+	// whose purge claimed it before staleBefore; claimed is false when it was
+	// cancelled, completed or another purge holds it
+	ClaimDeletion(id int64, staleBefore time.Time) (d *Deletion, claimed bool, err error)
+	// RecordPurge stores what a claimed deletion removes
+	RecordPurge(id int64, uploadIDs []int64, files []string) error
+	// ReleaseDeletion returns a claimed deletion to scheduled after a failed purge
+	ReleaseDeletion(id int64) error
+	CompleteDeletion(id int64, filesRemoved int) error
+	// ListExportFiles returns the built archives and data exports stored for the user
+	ListExportFiles(userID int64) ([]string, error)
+}
+
+var (
+	ErrPasswordRequired  = errors.New("password is required")
+	ErrIncorrectPassword = errors.New("password is incorrect")
+	ErrNoDeletion        = errors.New("no account deletion is scheduled")
+	// ErrNotClaimed means the deletion was cancelled or is being purged elsewhere
+	ErrNotClaimed = errors.New("account deletion is no longer scheduled")
+)
@@ -0,0 +1,250 @@
+package account
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"elotus_test/server/models/audit"
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/events"
+	"elotus_test/server/models/jobs"
+	"elotus_test/server/models/upload"
+	"elotus_test/server/models/user"
+	"elotus_test/server/response"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var timeNow = time.Now
+
+// DefaultClaimTimeout is used when Config.ClaimTimeout is not set
+const DefaultClaimTimeout = 15 * time.Minute
+
+type Config struct {
+	// Grace is how long a deletion can be cancelled; zero purges right away
+	Grace time.Duration
+	// ClaimTimeout is how long a purge may hold a deletion before another
+	// purge takes it over, assuming the first one died
+	ClaimTimeout time.Duration
+}
+
+func DefaultConfig() *Config {
+	return &Config{Grace: 7 * 24 * time.Hour, ClaimTimeout: DefaultClaimTimeout}
+}
+
+// TokenRevoker ends every session of an account before it is removed
+type TokenRevoker interface {
+	RevokeUserTokens(userID int64) error
+}
+
+type Handler struct {
+	config       *Config
+	deletionRepo Repository
+	userRepo     user.Repository
+	uploadRepo   upload.Repository
+	tokens       TokenRevoker
+	jobQueue     *jobs.Queue
+	events       *events.Bus
+	auditLog     *audit.Log
+
+	forgetters []func(userID int64)
+}
+
+func NewHandler(config *Config, deletionRepo Repository, userRepo user.Repository, uploadRepo upload.Repository, tokens TokenRevoker) *Handler {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	return &Handler{
+		config:       config,
+		deletionRepo: deletionRepo,
+		userRepo:     userRepo,
+		uploadRepo:   uploadRepo,
+		tokens:       tokens,
+	}
+}
+
+func (h *Handler) SetEventBus(bus *events.Bus) {
+	h.events = bus
+}
+
+func (h *Handler) SetAuditLog(auditLog *audit.Log) {
+	h.auditLog = auditLog
+}
+
+// OnPurge registers a callback that drops per-user cached state (Redis keys,
+// in-memory history) once an account is gone. Register before serving requests.
+func (h *Handler) OnPurge(forget func(userID int64)) {
+	h.forgetters = append(h.forgetters, forget)
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+// DeleteAccount schedules deletion of the caller's account after the grace
+// period. The password is checked again so a stolen token cannot do it.
+func (h *Handler) DeleteAccount(c echo.Context) error {
+	claims := c.Get("user").(*auth.TokenClaims)
+
+	var req DeleteAccountRequest
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+	if req.Password == "" {
+		return response.ValidationError(c, ErrPasswordRequired.Error())
+	}
+
+	u, found := h.userRepo.GetUserByID(claims.UserID)
+	if !found {
+		return response.NotFound(c, "User not found")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(req.Password)); err != nil {
+		return response.Forbidden(c, ErrIncorrectPassword.Error())
+	}
+
+	return h.respondScheduled(c, u, claims.UserID, h.config.Grace)
+}
+
+// GetDeletion reports the caller's scheduled deletion
+func (h *Handler) GetDeletion(c echo.Context) error {
+	claims := c.Get("user").(*auth.TokenClaims)
+
+	d, found := h.deletionRepo.ScheduledDeletion(claims.UserID)
+	if !found {
+		return response.NotFound(c, ErrNoDeletion.Error())
+	}
+	return response.Success(c, d)
+}
+
+// CancelDeletion keeps the caller's account
+func (h *Handler) CancelDeletion(c echo.Context) error {
+	claims := c.Get("user").(*auth.TokenClaims)
+	return h.respondCancelled(c, claims.UserID, claims.UserID)
+}
+
+type AdminDeleteRequest struct {
+	// Immediate skips the grace period
+	Immediate bool `json:"immediate"`
+}
+
+// AdminDeleteUser schedules deletion of any account, or purges it now
+func (h *Handler) AdminDeleteUser(c echo.Context) error {
+	claims := c.Get("user").(*auth.TokenClaims)
+
+	var id int64
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	var req AdminDeleteRequest
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	u, found := h.userRepo.GetUserByID(id)
+	if !found {
+		return response.NotFound(c, "User not found")
+	}
+
+	grace := h.config.Grace
+	if req.Immediate {
+		grace = 0
+	}
+	return h.respondScheduled(c, u, claims.UserID, grace)
+}
+
+// AdminCancelDeletion cancels a scheduled deletion of any account
+func (h *Handler) AdminCancelDeletion(c echo.Context) error {
+	claims := c.Get("user").(*auth.TokenClaims)
+
+	var id int64
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+	return h.respondCancelled(c, id, claims.UserID)
+}
+
+func (h *Handler) respondScheduled(c echo.Context, u *user.User, requestedBy int64, grace time.Duration) error {
+	d, created, err := h.schedule(u, requestedBy, grace)
+	if err != nil {
+		log.Printf("[Account] Error deleting user %d: %v", u.ID, err)
+		return response.InternalError(c, "Failed to delete account")
+	}
+	h.auditLog.Record(c, audit.Entry{
+		Action:     audit.ActionDeletionRequested,
+		ActorID:    requestedBy,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.ID(u.ID),
+		Metadata: map[string]interface{}{
+			"deletion_id":   d.ID,
+			"scheduled_for": d.ScheduledFor,
+			"immediate":     grace <= 0,
+			"admin":         requestedBy != u.ID,
+		},
+	})
+
+	// An account already scheduled keeps its deletion, unless it is purged now
+	switch {
+	case grace <= 0:
+		d, err = h.Purge(c.Request().Context(), d)
+		if errors.Is(err, ErrNotClaimed) {
+			return response.Conflict(c, err.Error())
+		}
+		if err != nil {
+			log.Printf("[Account] Error deleting user %d: %v", u.ID, err)
+			return response.InternalError(c, "Failed to delete account")
+		}
+		return response.Success(c, d)
+	case created:
+		h.enqueue(d, d.ScheduledFor)
+	}
+	return response.Accepted(c, d)
+}
+
+func (h *Handler) respondCancelled(c echo.Context, userID, cancelledBy int64) error {
+	d, found := h.deletionRepo.ScheduledDeletion(userID)
+	if !found {
+		return response.NotFound(c, ErrNoDeletion.Error())
+	}
+	if err := h.deletionRepo.CancelDeletion(d.ID); err != nil {
+		// A purge claimed the deletion after it was looked up
+		if errors.Is(err, ErrNoDeletion) {
+			return response.Conflict(c, ErrNotClaimed.Error())
+		}
+		return response.InternalError(c, "Failed to cancel account deletion")
+	}
+	log.Printf("[Account] Deletion %d of user %d cancelled by user %d", d.ID, userID, cancelledBy)
+	h.auditLog.Record(c, audit.Entry{
+		Action:     audit.ActionDeletionCancelled,
+		ActorID:    cancelledBy,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.ID(userID),
+		Metadata:   map[string]interface{}{"deletion_id": d.ID, "admin": cancelledBy != userID},
+	})
+
+	if current, found := h.deletionRepo.GetDeletion(d.ID); found {
+		d = current
+	}
+	return response.Success(c, d)
+}
+
+// schedule records a deletion of u to run after grace, or returns the one
+// already scheduled
+func (h *Handler) schedule(u *user.User, requestedBy int64, grace time.Duration) (*Deletion, bool, error) {
+	if d, found := h.deletionRepo.ScheduledDeletion(u.ID); found {
+		return d, false, nil
+	}
+
+	d, err := h.deletionRepo.CreateDeletion(&Deletion{
+		UserID:       u.ID,
+		Username:     u.Username,
+		RequestedBy:  requestedBy,
+		Status:       StatusScheduled,
+		ScheduledFor: timeNow().Add(grace).UTC(),
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	log.Printf("[Account] Deletion %d of user %d (%s) requested by user %d, scheduled for %s",
+		d.ID, u.ID, u.Username, requestedBy, d.ScheduledFor.Format(time.RFC3339))
+	return d, true, nil
+}
@@ -0,0 +1,187 @@
+package account
+
+import (
+	"database/sql"
+	"time"
+
+	"elotus_test/server/bsql"
+
+	"github.com/lib/pq"
+)
+
+type PostgresRepository struct {
+	db *bsql.DB
+}
+
+func NewPostgresRepository(db *bsql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+const deletionColumns = `id, user_id, username, requested_by, status, scheduled_for, files_removed,
+		created_at, cancelled_at, claimed_at, completed_at, upload_ids, purge_files`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanDeletion(row rowScanner) (*Deletion, error) {
+	d := &Deletion{}
+	var cancelledAt, claimedAt, completedAt sql.NullTime
+
+	err := row.Scan(
+		&d.ID, &d.UserID, &d.Username, &d.RequestedBy, &d.Status, &d.ScheduledFor, &d.FilesRemoved,
+		&d.CreatedAt, &cancelledAt, &claimedAt, &completedAt, pq.Array(&d.UploadIDs), pq.Array(&d.PurgeFiles),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if cancelledAt.Valid {
+		d.CancelledAt = &cancelledAt.Time
+	}
+	if claimedAt.Valid {
+		d.ClaimedAt = &claimedAt.Time
+	}
+	if completedAt.Valid {
+		d.CompletedAt = &completedAt.Time
+	}
+	return d, nil
+}
+
+func (r *PostgresRepository) CreateDeletion(d *Deletion) (*Deletion, error) {
+	err := r.db.QueryRow(`
+		INSERT INTO account_deletions (user_id, username, requested_by, status, scheduled_for, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`,
+		d.UserID, d.Username, d.RequestedBy, d.Status, d.ScheduledFor, time.Now(),
+	).Scan(&d.ID, &d.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (r *PostgresRepository) GetDeletion(id int64) (*Deletion, bool) {
+	d, err := scanDeletion(r.db.QueryRow(`SELECT `+deletionColumns+` FROM account_deletions WHERE id = $1`, id))
+	if err != nil {
+		return nil, false
+	}
+	return d, true
+}
+
+func (r *PostgresRepository) ScheduledDeletion(userID int64) (*Deletion, bool) {
+	d, err := scanDeletion(r.db.QueryRow(
+		`SELECT `+deletionColumns+` FROM account_deletions WHERE user_id = $1 AND status = $2`,
+		userID, StatusScheduled,
+	))
+	if err != nil {
+		return nil, false
+	}
+	return d, true
+}
+
+func (r *PostgresRepository) DueDeletions(now, staleBefore time.Time) ([]*Deletion, error) {
+	rows, err := r.db.Query(`
+		SELECT `+deletionColumns+` FROM account_deletions
+		WHERE (status = $1 AND scheduled_for <= $2) OR (status = $3 AND claimed_at < $4)
+		ORDER BY scheduled_for, id`,
+		StatusScheduled, now, StatusPurging, staleBefore,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deletions []*Deletion
+	for rows.Next() {
+		d, err := scanDeletion(rows)
+		if err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, d)
+	}
+	return deletions, rows.Err()
+}
+
+func (r *PostgresRepository) CancelDeletion(id int64) error {
+	result, err := r.db.Exec(
+		`UPDATE account_deletions SET status = $1, cancelled_at = $2 WHERE id = $3 AND status = $4`,
+		StatusCancelled, time.Now(), id, StatusScheduled,
+	)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return ErrNoDeletion
+	}
+	return nil
+}
+
+// ClaimDeletion is a single conditional update, so of a purge job, -cmd
+// purge-accounts and a cancellation racing for the same row only one wins
+func (r *PostgresRepository) ClaimDeletion(id int64, staleBefore time.Time) (*Deletion, bool, error) {
+	d, err := scanDeletion(r.db.QueryRow(`
+		UPDATE account_deletions SET status = $1, claimed_at = $2
+		WHERE id = $3 AND (status = $4 OR (status = $1 AND claimed_at < $5))
+		RETURNING `+deletionColumns,
+		StatusPurging, time.Now(), id, StatusScheduled, staleBefore,
+	))
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return d, true, nil
+}
+
+func (r *PostgresRepository) RecordPurge(id int64, uploadIDs []int64, files []string) error {
+	if files == nil {
+		files = []string{}
+	}
+	_, err := r.db.Exec(
+		`UPDATE account_deletions SET upload_ids = $1, purge_files = $2 WHERE id = $3 AND status = $4`,
+		pq.Array(uploadIDs), pq.Array(files), id, StatusPurging,
+	)
+	return err
+}
+
+func (r *PostgresRepository) ReleaseDeletion(id int64) error {
+	_, err := r.db.Exec(`
+		UPDATE account_deletions SET status = $1, claimed_at = NULL, upload_ids = NULL, purge_files = NULL
+		WHERE id = $2 AND status = $3`,
+		StatusScheduled, id, StatusPurging,
+	)
+	return err
+}
+
+func (r *PostgresRepository) CompleteDeletion(id int64, filesRemoved int) error {
+	_, err := r.db.Exec(
+		`UPDATE account_deletions SET status = $1, files_removed = $2, completed_at = $3 WHERE id = $4 AND status = $5`,
+		StatusCompleted, filesRemoved, time.Now(), id, StatusPurging,
+	)
+	return err
+}
+
+func (r *PostgresRepository) ListExportFiles(userID int64) ([]string, error) {
+	rows, err := r.db.Query(`
+		SELECT file_path FROM archives WHERE user_id = $1 AND file_path IS NOT NULL
+		UNION ALL
+		SELECT file_path FROM data_exports WHERE user_id = $1 AND file_path IS NOT NULL`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, rows.Err()
+}
@@ -0,0 +1,227 @@
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"time"
+
+	"elotus_test/server/models/audit"
+	"elotus_test/server/models/events"
+	"elotus_test/server/models/jobs"
+
+	"github.com/labstack/echo/v4"
+)
+
+// JobPurgeAccount is the job kind that purges an account once its grace period ends
+const JobPurgeAccount = "account.purge"
+
+type purgePayload struct {
+	DeletionID int64 `json:"deletion_id"`
+}
+
+// SetJobQueue runs purges when their grace period ends. Without a queue,
+// due deletions are purged by -cmd purge-accounts.
+func (h *Handler) SetJobQueue(queue *jobs.Queue) {
+	h.jobQueue = queue
+	queue.Register(JobPurgeAccount, h.PurgeAccountJob)
+}
+
+func (h *Handler) enqueue(d *Deletion, runAt time.Time) {
+	if h.jobQueue == nil {
+		log.Printf("[Account] No job queue; deletion %d runs with -cmd purge-accounts after %s", d.ID, runAt)
+		return
+	}
+	if _, err := h.jobQueue.EnqueueAt(JobPurgeAccount, purgePayload{DeletionID: d.ID}, runAt); err != nil {
+		log.Printf("[Account] Error scheduling deletion %d, it runs with -cmd purge-accounts: %v", d.ID, err)
+	}
+}
+
+// claimTimeout is how long a purge holds its claim before another purge may
+// take the deletion over
+func (h *Handler) claimTimeout() time.Duration {
+	if h.config.ClaimTimeout > 0 {
+		return h.config.ClaimTimeout
+	}
+	return DefaultClaimTimeout
+}
+
+// PurgeAccountJob is the queue handler for JobPurgeAccount. A deletion that
+// was cancelled or purged in the meantime is left alone; one held by another
+// purge is checked again once that claim goes stale, in case the purge died.
+func (h *Handler) PurgeAccountJob(ctx context.Context, job *jobs.Job) error {
+	var payload purgePayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+
+	d, found := h.deletionRepo.GetDeletion(payload.DeletionID)
+	if !found {
+		return nil
+	}
+	_, err := h.Purge(ctx, d)
+	if errors.Is(err, ErrNotClaimed) {
+		if current, found := h.deletionRepo.GetDeletion(d.ID); found && current.Status == StatusPurging && current.ClaimedAt != nil {
+			h.enqueue(current, current.ClaimedAt.Add(h.claimTimeout()))
+		}
+		return nil
+	}
+	return err
+}
+
+// PurgeDue purges every deletion whose grace period has ended, and takes over
+// those whose purge died, and returns how many accounts were removed
+func (h *Handler) PurgeDue(ctx context.Context) (int, error) {
+	now := timeNow()
+	due, err := h.deletionRepo.DueDeletions(now, now.Add(-h.claimTimeout()))
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, d := range due {
+		_, err := h.Purge(ctx, d)
+		if errors.Is(err, ErrNotClaimed) {
+			// Cancelled since the listing, or purged by the job queue
+			continue
+		}
+		if err != nil {
+			return purged, fmt.Errorf("deletion %d: %w", d.ID, err)
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// Purge removes the account: tokens are revoked, the user row is deleted
+// (cascading to uploads, albums, shares, webhooks, archives and exports), then
+// the files on disk and cached state go. The deletion is claimed first, so it
+// runs once however many purges race for it and never after a cancellation
+// won; ErrNotClaimed is returned when the claim is lost. If the account cannot
+// be deleted the claim is released so the purge can be retried. A purge that
+// dies after that point leaves the deletion claimed; once the claim is older
+// than the claim timeout another purge takes it over and finishes from the
+// uploads and files recorded on the deletion, every step being safe to repeat.
+func (h *Handler) Purge(ctx context.Context, d *Deletion) (*Deletion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	d, claimed, err := h.deletionRepo.ClaimDeletion(d.ID, timeNow().Add(-h.claimTimeout()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim deletion: %w", err)
+	}
+	if !claimed {
+		return nil, ErrNotClaimed
+	}
+
+	resumed := d.PurgeFiles != nil
+	if resumed {
+		log.Printf("[Account] Taking over deletion %d of user %d from a purge that did not finish", d.ID, d.UserID)
+	}
+	if err := h.deleteAccount(d); err != nil {
+		// Once the files are recorded the user row may already be gone, so a
+		// taken-over purge keeps its claim and is retried when it goes stale
+		if !resumed {
+			if releaseErr := h.deletionRepo.ReleaseDeletion(d.ID); releaseErr != nil {
+				log.Printf("[Account] Error releasing deletion %d: %v", d.ID, releaseErr)
+			}
+		}
+		return nil, err
+	}
+
+	// The rows are gone, so a file that cannot be removed is only logged; upload
+	// files without a row are reclaimed by the janitor
+	removed := 0
+	for _, path := range d.PurgeFiles {
+		switch err := os.Remove(path); {
+		case err == nil:
+			removed++
+		case !errors.Is(err, fs.ErrNotExist):
+			log.Printf("[Account] Error removing %s of user %d: %v", path, d.UserID, err)
+		}
+	}
+
+	// tokens.revoked reaches the sockets on other replicas; user.deleted drops transform variants
+	h.events.Publish(events.TokensRevoked, d.UserID, echo.Map{
+		"user_id":        d.UserID,
+		"revoked_before": timeNow().UTC(),
+	})
+	h.events.Publish(events.UserDeleted, d.UserID, echo.Map{
+		"user_id":    d.UserID,
+		"username":   d.Username,
+		"upload_ids": d.UploadIDs,
+	})
+	for _, forget := range h.forgetters {
+		forget(d.UserID)
+	}
+
+	if err := h.deletionRepo.CompleteDeletion(d.ID, removed); err != nil {
+		return nil, err
+	}
+	log.Printf("[Account] Purged user %d (%s) for deletion %d: %d uploads, %d files removed",
+		d.UserID, d.Username, d.ID, len(d.UploadIDs), removed)
+	// Runs from the job queue, so there is no actor; the request event has one
+	metadata := map[string]interface{}{
+		"deletion_id":   d.ID,
+		"username":      d.Username,
+		"requested_by":  d.RequestedBy,
+		"uploads":       len(d.UploadIDs),
+		"files_removed": removed,
+	}
+	if resumed {
+		metadata["resumed"] = true
+	}
+	h.auditLog.Emit(audit.Entry{
+		Action:     audit.ActionAccountPurged,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.ID(d.UserID),
+		Metadata:   metadata,
+	})
+
+	if current, found := h.deletionRepo.GetDeletion(d.ID); found {
+		d = current
+	}
+	return d, nil
+}
+
+// deleteAccount records what the user owns on disk on the deletion, unless a
+// purge that was taken over already did, then revokes their tokens and deletes
+// the user row
+func (h *Handler) deleteAccount(d *Deletion) error {
+	if d.PurgeFiles == nil {
+		uploads, err := h.uploadRepo.GetFileUploadsByUserID(d.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to list uploads: %w", err)
+		}
+		exportFiles, err := h.deletionRepo.ListExportFiles(d.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to list exports: %w", err)
+		}
+
+		uploadIDs := make([]int64, 0, len(uploads))
+		files := make([]string, 0, len(uploads)+len(exportFiles))
+		for _, u := range uploads {
+			uploadIDs = append(uploadIDs, u.ID)
+			if u.TempPath != "" {
+				files = append(files, u.TempPath)
+			}
+		}
+		files = append(files, exportFiles...)
+		if err := h.deletionRepo.RecordPurge(d.ID, uploadIDs, files); err != nil {
+			return fmt.Errorf("failed to record purge: %w", err)
+		}
+		d.UploadIDs, d.PurgeFiles = uploadIDs, files
+	}
+
+	if err := h.tokens.RevokeUserTokens(d.UserID); err != nil {
+		return fmt.Errorf("failed to revoke tokens: %w", err)
+	}
+	if err := h.userRepo.DeleteUser(d.UserID); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package album
+
+import (
+	"errors"
+	"time"
+)
+
+type Album struct {
+	ID            int64     `json:"id"`
+	UserID        int64     `json:"user_id"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	CoverUploadID *int64    `json:"cover_upload_id"`
+	ItemCount     int       `json:"item_count"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type Item struct {
+	UploadID int64     `json:"upload_id"`
+	Position int       `json:"position"`
+	AddedAt  time.Time `json:"added_at"`
+}
+
+type Repository interface {
+	CreateAlbum(album *Album) (*Album, error)
+	GetAlbum(id int64) (*Album, bool)
+	ListAlbumsByUser(userID int64, limit, offset int) ([]*Album, int, error)
+	UpdateAlbum(album *Album) error
+	// DeleteAlbum removes the album and its memberships; the uploads themselves are kept
+	DeleteAlbum(id int64) error
+
+	// AddItems appends uploads to the end of the album, skipping ones already in it
+	AddItems(albumID int64, uploadIDs []int64) error
+	RemoveItem(albumID, uploadID int64) error
+	ListItems(albumID int64, limit, offset int) ([]*Item, int, error)
+	ItemIDs(albumID int64) ([]int64, error)
+	// ReorderItems sets positions to match the order of uploadIDs
+	ReorderItems(albumID int64, uploadIDs []int64) error
+}
+
+const (
+	MaxNameLength        = 100
+	MaxDescriptionLength = 2000
+	MaxItemsPerRequest   = 100
+)
+
+var (
+	ErrInvalidName        = errors.New("album name must be between 1 and 100 characters")
+	ErrDescriptionTooLong = errors.New("album description must be at most 2000 characters")
+	ErrInvalidOrder       = errors.New("order must list every upload in the album exactly once")
+)
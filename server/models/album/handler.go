@@ -0,0 +1,354 @@
+package album
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/upload"
+	"elotus_test/server/pagination"
+	"elotus_test/server/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+type Handler struct {
+	albumRepo  Repository
+	uploadRepo upload.Repository
+}
+
+func NewHandler(albumRepo Repository, uploadRepo upload.Repository) *Handler {
+	return &Handler{
+		albumRepo:  albumRepo,
+		uploadRepo: uploadRepo,
+	}
+}
+
+type CreateAlbumRequest struct {
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	CoverUploadID *int64 `json:"cover_upload_id"`
+}
+
+// UpdateAlbumRequest only changes the fields that are present; send "clear_cover" to remove the cover
+type UpdateAlbumRequest struct {
+	Name          *string `json:"name"`
+	Description   *string `json:"description"`
+	CoverUploadID *int64  `json:"cover_upload_id"`
+	ClearCover    bool    `json:"clear_cover"`
+}
+
+type ItemsRequest struct {
+	UploadIDs []int64 `json:"upload_ids"`
+}
+
+func validateAlbum(name, description string) error {
+	if n := utf8.RuneCountInString(name); n == 0 || n > MaxNameLength {
+		return ErrInvalidName
+	}
+	if utf8.RuneCountInString(description) > MaxDescriptionLength {
+		return ErrDescriptionTooLong
+	}
+	return nil
+}
+
+// ownsUploads reports whether every id is an upload of userID
+func (h *Handler) ownsUploads(userID int64, ids []int64) (bool, error) {
+	uploads, err := h.uploadRepo.GetFileUploadsByIDs(ids)
+	if err != nil {
+		return false, err
+	}
+
+	owned := make(map[int64]bool, len(uploads))
+	for _, u := range uploads {
+		if u.UserID == userID {
+			owned[u.ID] = true
+		}
+	}
+	for _, id := range ids {
+		if !owned[id] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (h *Handler) CreateAlbum(c echo.Context) error {
+	claims := c.Get("user").(*auth.TokenClaims)
+
+	var req CreateAlbumRequest
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if err := validateAlbum(req.Name, req.Description); err != nil {
+		return response.ValidationError(c, err.Error())
+	}
+
+	if req.CoverUploadID != nil {
+		ok, err := h.ownsUploads(claims.UserID, []int64{*req.CoverUploadID})
+		if err != nil {
+			return response.InternalError(c, "Failed to check cover image")
+		}
+		if !ok {
+			return response.ValidationError(c, "cover_upload_id must be one of your uploads")
+		}
+	}
+
+	a, err := h.albumRepo.CreateAlbum(&Album{
+		UserID:        claims.UserID,
+		Name:          req.Name,
+		Description:   req.Description,
+		CoverUploadID: req.CoverUploadID,
+	})
+	if err != nil {
+		return response.InternalError(c, "Failed to create album")
+	}
+
+	return response.Created(c, a)
+}
+
+func (h *Handler) ListAlbums(c echo.Context) error {
+	claims := c.Get("user").(*auth.TokenClaims)
+
+	page, err := pagination.FromRequest(c)
+	if err != nil {
+		return response.ValidationError(c, err.Error())
+	}
+
+	albums, total, err := h.albumRepo.ListAlbumsByUser(claims.UserID, page.PerPage, page.Offset())
+	if err != nil {
+		return response.InternalError(c, "Failed to get albums")
+	}
+	if albums == nil {
+		albums = []*Album{}
+	}
+
+	return response.SuccessWithMeta(c, albums, page.Meta(total))
+}
+
+func (h *Handler) GetAlbum(c echo.Context) error {
+	a, err := h.ownedAlbum(c)
+	if a == nil {
+		return err
+	}
+	return response.Success(c, a)
+}
+
+func (h *Handler) UpdateAlbum(c echo.Context) error {
+	a, err := h.ownedAlbum(c)
+	if a == nil {
+		return err
+	}
+
+	var req UpdateAlbumRequest
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	if req.Name != nil {
+		a.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		a.Description = *req.Description
+	}
+	if err := validateAlbum(a.Name, a.Description); err != nil {
+		return response.ValidationError(c, err.Error())
+	}
+
+	switch {
+	case req.ClearCover:
+		a.CoverUploadID = nil
+	case req.CoverUploadID != nil:
+		ok, err := h.ownsUploads(a.UserID, []int64{*req.CoverUploadID})
+		if err != nil {
+			return response.InternalError(c, "Failed to check cover image")
+		}
+		if !ok {
+			return response.ValidationError(c, "cover_upload_id must be one of your uploads")
+		}
+		a.CoverUploadID = req.CoverUploadID
+	}
+
+	if err := h.albumRepo.UpdateAlbum(a); err != nil {
+		return response.InternalError(c, "Failed to update album")
+	}
+
+	return response.Success(c, a)
+}
+
+func (h *Handler) DeleteAlbum(c echo.Context) error {
+	a, err := h.ownedAlbum(c)
+	if a == nil {
+		return err
+	}
+
+	if err := h.albumRepo.DeleteAlbum(a.ID); err != nil {
+		return response.InternalError(c, "Failed to delete album")
+	}
+
+	return response.Success(c, echo.Map{
+		"message": "Album deleted",
+		"id":      a.ID,
+	})
+}
+
+func (h *Handler) ListItems(c echo.Context) error {
+	a, err := h.ownedAlbum(c)
+	if a == nil {
+		return err
+	}
+
+	page, err := pagination.FromRequest(c)
+	if err != nil {
+		return response.ValidationError(c, err.Error())
+	}
+
+	items, total, err := h.albumRepo.ListItems(a.ID, page.PerPage, page.Offset())
+	if err != nil {
+		return response.InternalError(c, "Failed to get album items")
+	}
+
+	ids := make([]int64, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.UploadID)
+	}
+	uploads, err := h.uploadRepo.GetFileUploadsByIDs(ids)
+	if err != nil {
+		return response.InternalError(c, "Failed to get album items")
+	}
+	byID := make(map[int64]*upload.FileUpload, len(uploads))
+	for _, u := range uploads {
+		byID[u.ID] = u
+	}
+
+	list := make([]echo.Map, 0, len(items))
+	for _, item := range items {
+		u, ok := byID[item.UploadID]
+		if !ok {
+			continue
+		}
+		list = append(list, echo.Map{
+			"position": item.Position,
+			"added_at": item.AddedAt,
+			"upload":   upload.Details(u),
+		})
+	}
+
+	return response.SuccessWithMeta(c, list, page.Meta(total))
+}
+
+func (h *Handler) AddItems(c echo.Context) error {
+	a, err := h.ownedAlbum(c)
+	if a == nil {
+		return err
+	}
+
+	var req ItemsRequest
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+	if len(req.UploadIDs) == 0 || len(req.UploadIDs) > MaxItemsPerRequest {
+		return response.ValidationError(c, fmt.Sprintf("upload_ids must contain between 1 and %d ids", MaxItemsPerRequest))
+	}
+
+	ok, err := h.ownsUploads(a.UserID, req.UploadIDs)
+	if err != nil {
+		return response.InternalError(c, "Failed to check uploads")
+	}
+	if !ok {
+		return response.ValidationError(c, "upload_ids must all be your uploads")
+	}
+
+	if err := h.albumRepo.AddItems(a.ID, req.UploadIDs); err != nil {
+		return response.InternalError(c, "Failed to add items")
+	}
+
+	a, _ = h.albumRepo.GetAlbum(a.ID)
+	return response.Success(c, a)
+}
+
+func (h *Handler) RemoveItem(c echo.Context) error {
+	a, err := h.ownedAlbum(c)
+	if a == nil {
+		return err
+	}
+
+	var uploadID int64
+	fmt.Sscanf(c.Param("uploadId"), "%d", &uploadID)
+
+	if err := h.albumRepo.RemoveItem(a.ID, uploadID); err != nil {
+		return response.InternalError(c, "Failed to remove item")
+	}
+
+	return response.Success(c, echo.Map{
+		"message":   "Item removed from album",
+		"upload_id": uploadID,
+	})
+}
+
+// ReorderItems takes the complete list of upload ids in their new order
+func (h *Handler) ReorderItems(c echo.Context) error {
+	a, err := h.ownedAlbum(c)
+	if a == nil {
+		return err
+	}
+
+	var req ItemsRequest
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	current, err := h.albumRepo.ItemIDs(a.ID)
+	if err != nil {
+		return response.InternalError(c, "Failed to get album items")
+	}
+	if !samePermutation(current, req.UploadIDs) {
+		return response.ValidationError(c, ErrInvalidOrder.Error())
+	}
+
+	if err := h.albumRepo.ReorderItems(a.ID, req.UploadIDs); err != nil {
+		return response.InternalError(c, "Failed to reorder items")
+	}
+
+	return response.Success(c, echo.Map{
+		"message":    "Album reordered",
+		"upload_ids": req.UploadIDs,
+	})
+}
+
+func samePermutation(current, order []int64) bool {
+	if len(current) != len(order) {
+		return false
+	}
+	seen := make(map[int64]bool, len(current))
+	for _, id := range current {
+		seen[id] = true
+	}
+	for _, id := range order {
+		if !seen[id] {
+			return false
+		}
+		delete(seen, id)
+	}
+	return true
+}
+
+// ownedAlbum loads the :id album for the current user. A nil album means the
+// error response has already been written.
+func (h *Handler) ownedAlbum(c echo.Context) (*Album, error) {
+	claims := c.Get("user").(*auth.TokenClaims)
+
+	var id int64
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	a, found := h.albumRepo.GetAlbum(id)
+	if !found {
+		return nil, response.NotFound(c, "Album not found")
+	}
+	if a.UserID != claims.UserID {
+		return nil, response.Forbidden(c, "Access denied")
+	}
+	return a, nil
+}
@@ -0,0 +1,206 @@
+package album
+
+import (
+	"database/sql"
+	"time"
+
+	"elotus_test/server/bsql"
+
+	"github.com/lib/pq"
+)
+
+type PostgresRepository struct {
+	db *bsql.DB
+}
+
+func NewPostgresRepository(db *bsql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+const albumColumns = `a.id, a.user_id, a.name, a.description, a.cover_upload_id,
+		(SELECT COUNT(*) FROM album_items i WHERE i.album_id = a.id), a.created_at, a.updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAlbum(row rowScanner) (*Album, error) {
+	a := &Album{}
+	var description sql.NullString
+	var coverUploadID sql.NullInt64
+
+	err := row.Scan(&a.ID, &a.UserID, &a.Name, &description, &coverUploadID, &a.ItemCount, &a.CreatedAt, &a.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	a.Description = description.String
+	if coverUploadID.Valid {
+		a.CoverUploadID = &coverUploadID.Int64
+	}
+	return a, nil
+}
+
+func (r *PostgresRepository) CreateAlbum(a *Album) (*Album, error) {
+	now := time.Now()
+	err := r.db.QueryRow(`
+		INSERT INTO albums (user_id, name, description, cover_upload_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		RETURNING id, created_at, updated_at`,
+		a.UserID, a.Name, a.Description, a.CoverUploadID, now,
+	).Scan(&a.ID, &a.CreatedAt, &a.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (r *PostgresRepository) GetAlbum(id int64) (*Album, bool) {
+	a, err := scanAlbum(r.db.QueryRow(`SELECT `+albumColumns+` FROM albums a WHERE a.id = $1`, id))
+	if err != nil {
+		return nil, false
+	}
+	return a, true
+}
+
+func (r *PostgresRepository) ListAlbumsByUser(userID int64, limit, offset int) ([]*Album, int, error) {
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM albums WHERE user_id = $1`, userID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query(`
+		SELECT `+albumColumns+`
+		FROM albums a
+		WHERE a.user_id = $1
+		ORDER BY a.created_at DESC, a.id DESC
+		LIMIT $2 OFFSET $3`, userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var albums []*Album
+	for rows.Next() {
+		a, err := scanAlbum(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		albums = append(albums, a)
+	}
+	return albums, total, rows.Err()
+}
+
+func (r *PostgresRepository) UpdateAlbum(a *Album) error {
+	return r.db.QueryRow(`
+		UPDATE albums SET name = $1, description = $2, cover_upload_id = $3, updated_at = NOW()
+		WHERE id = $4
+		RETURNING updated_at`,
+		a.Name, a.Description, a.CoverUploadID, a.ID,
+	).Scan(&a.UpdatedAt)
+}
+
+func (r *PostgresRepository) DeleteAlbum(id int64) error {
+	_, err := r.db.Exec(`DELETE FROM albums WHERE id = $1`, id)
+	return err
+}
+
+func (r *PostgresRepository) AddItems(albumID int64, uploadIDs []int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the album row so concurrent appends get distinct positions
+	if _, err := tx.Exec(`SELECT id FROM albums WHERE id = $1 FOR UPDATE`, albumID); err != nil {
+		return err
+	}
+
+	var next int
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(position) + 1, 0) FROM album_items WHERE album_id = $1`, albumID).Scan(&next); err != nil {
+		return err
+	}
+
+	for _, uploadID := range uploadIDs {
+		result, err := tx.Exec(`
+			INSERT INTO album_items (album_id, upload_id, position, added_at)
+			VALUES ($1, $2, $3, NOW())
+			ON CONFLICT (album_id, upload_id) DO NOTHING`, albumID, uploadID, next)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			next++
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE albums SET updated_at = NOW() WHERE id = $1`, albumID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *PostgresRepository) RemoveItem(albumID, uploadID int64) error {
+	_, err := r.db.Exec(`DELETE FROM album_items WHERE album_id = $1 AND upload_id = $2`, albumID, uploadID)
+	return err
+}
+
+func (r *PostgresRepository) ListItems(albumID int64, limit, offset int) ([]*Item, int, error) {
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM album_items WHERE album_id = $1`, albumID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query(`
+		SELECT upload_id, position, added_at
+		FROM album_items
+		WHERE album_id = $1
+		ORDER BY position, added_at
+		LIMIT $2 OFFSET $3`, albumID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var items []*Item
+	for rows.Next() {
+		item := &Item{}
+		if err := rows.Scan(&item.UploadID, &item.Position, &item.AddedAt); err != nil {
+			return nil, 0, err
+		}
+		items = append(items, item)
+	}
+	return items, total, rows.Err()
+}
+
+func (r *PostgresRepository) ItemIDs(albumID int64) ([]int64, error) {
+	rows, err := r.db.Query(`SELECT upload_id FROM album_items WHERE album_id = $1 ORDER BY position`, albumID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (r *PostgresRepository) ReorderItems(albumID int64, uploadIDs []int64) error {
+	_, err := r.db.Exec(`
+		UPDATE album_items i SET position = o.position - 1
+		FROM unnest($2::bigint[]) WITH ORDINALITY AS o(upload_id, position)
+		WHERE i.album_id = $1 AND i.upload_id = o.upload_id`,
+		albumID, pq.Array(uploadIDs))
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(`UPDATE albums SET updated_at = NOW() WHERE id = $1`, albumID)
+	return err
+}
@@ -0,0 +1,47 @@
+package archive
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	StatusPending  = "pending"
+	StatusBuilding = "building"
+	StatusReady    = "ready"
+	StatusFailed   = "failed"
+)
+
+// Archive is an export that was too large to stream and is built by a job
+type Archive struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	UploadIDs   []int64    `json:"upload_ids"`
+	Status      string     `json:"status"`
+	TotalSize   int64      `json:"total_size"`
+	FilePath    string     `json:"-"`
+	FileSize    int64      `json:"file_size,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	// ExpiresAt is when the built file stops being downloadable
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type Repository interface {
+	CreateArchive(a *Archive) (*Archive, error)
+	GetArchive(id int64) (*Archive, bool)
+	UpdateArchiveStatus(id int64, status string) error
+	MarkArchiveReady(id int64, filePath string, fileSize int64, expiresAt time.Time) error
+	MarkArchiveFailed(id int64, reason string) error
+}
+
+var (
+	ErrNoSelection      = errors.New("one of ids, album_id, q or tags is required")
+	ErrTooManySources   = errors.New("ids, album_id and filters cannot be combined")
+	ErrTooManyItems     = errors.New("too many uploads in archive")
+	ErrArchiveTooLarge  = errors.New("archive exceeds the maximum export size")
+	ErrNothingToExport  = errors.New("no uploads match the selection")
+	ErrInvalidSignature = errors.New("download link is invalid")
+	ErrLinkExpired      = errors.New("download link has expired")
+)
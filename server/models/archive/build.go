@@ -0,0 +1,109 @@
+package archive
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"elotus_test/server/models/jobs"
+	"elotus_test/server/models/upload"
+)
+
+// JobBuildArchive is the job kind that writes an async archive to storage
+const JobBuildArchive = "archive.build"
+
+type buildArchivePayload struct {
+	ArchiveID int64 `json:"archive_id"`
+}
+
+// SetJobQueue moves large archive builds off the request path
+func (h *Handler) SetJobQueue(queue *jobs.Queue) {
+	h.jobQueue = queue
+	queue.Register(JobBuildArchive, h.BuildArchiveJob)
+}
+
+// BuildArchiveJob is the queue handler for JobBuildArchive
+func (h *Handler) BuildArchiveJob(ctx context.Context, job *jobs.Job) error {
+	var payload buildArchivePayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+
+	a, found := h.archiveRepo.GetArchive(payload.ArchiveID)
+	if !found || a.Status == StatusReady {
+		return nil
+	}
+
+	err := h.build(ctx, a)
+	if err != nil && job.LastAttempt() {
+		if markErr := h.archiveRepo.MarkArchiveFailed(a.ID, err.Error()); markErr != nil {
+			return markErr
+		}
+	}
+	return err
+}
+
+// build writes the archive next to its final name and renames it into place,
+// so a crash never leaves a truncated file marked ready
+func (h *Handler) build(ctx context.Context, a *Archive) error {
+	if err := h.archiveRepo.UpdateArchiveStatus(a.ID, StatusBuilding); err != nil {
+		return err
+	}
+
+	uploads, err := h.uploadRepo.GetFileUploadsByIDs(a.UploadIDs)
+	if err != nil {
+		return err
+	}
+	byID := make(map[int64]*upload.FileUpload, len(uploads))
+	for _, u := range uploads {
+		byID[u.ID] = u
+	}
+
+	// Keep the selection order; skip anything deleted or quarantined since the request
+	selected := make([]*upload.FileUpload, 0, len(a.UploadIDs))
+	for _, id := range a.UploadIDs {
+		if u, ok := byID[id]; ok && u.UserID == a.UserID && u.Status == upload.StatusClean {
+			selected = append(selected, u)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(h.config.StorageDir, 0700); err != nil {
+		return err
+	}
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	finalPath := filepath.Join(h.config.StorageDir, fmt.Sprintf("archive-%d-%s.zip", a.ID, hex.EncodeToString(suffix)))
+	partPath := finalPath + ".part"
+
+	f, err := os.OpenFile(partPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	err = writeZip(f, h.keyring, selected)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(partPath, finalPath)
+	}
+	if err != nil {
+		os.Remove(partPath)
+		return err
+	}
+
+	info, err := os.Stat(finalPath)
+	if err != nil {
+		return err
+	}
+	return h.archiveRepo.MarkArchiveReady(a.ID, finalPath, info.Size(), timeNow().Add(h.config.Retention))
+}
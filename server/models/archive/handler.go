@@ -0,0 +1,372 @@
+package archive
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"elotus_test/server/envelope"
+	"elotus_test/server/models/album"
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/jobs"
+	"elotus_test/server/models/upload"
+	"elotus_test/server/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+var timeNow = time.Now
+
+type Config struct {
+	// MaxItems caps the number of uploads in one export
+	MaxItems int
+	// Selections up to MaxSyncBytes are streamed in the response; larger ones are built by a job
+	MaxSyncBytes int64
+	MaxBytes     int64
+	// LinkTTL is the lifetime of a signed download link; Retention is how long a built archive is kept
+	LinkTTL    time.Duration
+	Retention  time.Duration
+	StorageDir string
+	SigningKey []byte
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		MaxItems:     1000,
+		MaxSyncBytes: 100 << 20,
+		MaxBytes:     2 << 30,
+		LinkTTL:      time.Hour,
+		Retention:    24 * time.Hour,
+		StorageDir:   "tmp/archives",
+	}
+}
+
+type Handler struct {
+	config      *Config
+	archiveRepo Repository
+	uploadRepo  upload.Repository
+	albumRepo   album.Repository
+	jobQueue    *jobs.Queue
+	keyring     *envelope.Keyring
+}
+
+func NewHandler(config *Config, archiveRepo Repository, uploadRepo upload.Repository, albumRepo album.Repository) *Handler {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	return &Handler{
+		config:      config,
+		archiveRepo: archiveRepo,
+		uploadRepo:  uploadRepo,
+		albumRepo:   albumRepo,
+	}
+}
+
+// SetKeyring lets exports include uploads that were stored encrypted
+func (h *Handler) SetKeyring(keyring *envelope.Keyring) {
+	h.keyring = keyring
+}
+
+// CreateArchiveRequest selects uploads by exactly one of: explicit IDs, an
+// album, or search filters (q and/or tags, as in /api/uploads/search)
+type CreateArchiveRequest struct {
+	IDs     []int64  `json:"ids,omitempty"`
+	AlbumID int64    `json:"album_id,omitempty"`
+	Query   string   `json:"q,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+// CreateArchive exports the selected uploads as a ZIP. Small selections are
+// streamed straight from storage; larger ones get 202 and an archive to poll.
+func (h *Handler) CreateArchive(c echo.Context) error {
+	claims := c.Get("user").(*auth.TokenClaims)
+
+	var req CreateArchiveRequest
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	uploads, err := h.selectUploads(c, claims.UserID, &req)
+	if uploads == nil {
+		return err
+	}
+
+	var total int64
+	for _, u := range uploads {
+		total += u.FileSize
+	}
+	if total > h.config.MaxBytes {
+		return response.Error(c, http.StatusRequestEntityTooLarge, response.ErrCodeArchiveTooLarge,
+			fmt.Sprintf("%s (max: %d bytes, selected: %d bytes)", ErrArchiveTooLarge.Error(), h.config.MaxBytes, total))
+	}
+
+	if total > h.config.MaxSyncBytes {
+		return h.createAsync(c, claims.UserID, uploads, total)
+	}
+	return h.stream(c, uploads)
+}
+
+// selectUploads resolves the request to the caller's uploads in a stable order.
+// Explicit IDs must all exist, belong to the caller and be servable; album and
+// filter selections quietly skip uploads that are not clean.
+func (h *Handler) selectUploads(c echo.Context, userID int64, req *CreateArchiveRequest) ([]*upload.FileUpload, error) {
+	sources := 0
+	if len(req.IDs) > 0 {
+		sources++
+	}
+	if req.AlbumID != 0 {
+		sources++
+	}
+	if req.Query != "" || len(req.Tags) > 0 {
+		sources++
+	}
+	if sources == 0 {
+		return nil, response.ValidationError(c, ErrNoSelection.Error())
+	}
+	if sources > 1 {
+		return nil, response.ValidationError(c, ErrTooManySources.Error())
+	}
+
+	var (
+		ids    []int64
+		strict bool
+	)
+	switch {
+	case len(req.IDs) > 0:
+		seen := make(map[int64]bool, len(req.IDs))
+		for _, id := range req.IDs {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		strict = true
+
+	case req.AlbumID != 0:
+		a, found := h.albumRepo.GetAlbum(req.AlbumID)
+		if !found {
+			return nil, response.NotFound(c, "Album not found")
+		}
+		if a.UserID != userID {
+			return nil, response.Forbidden(c, "Access denied")
+		}
+		albumIDs, err := h.albumRepo.ItemIDs(a.ID)
+		if err != nil {
+			return nil, response.InternalError(c, "Failed to get album items")
+		}
+		ids = albumIDs
+
+	default:
+		tags, err := upload.NormalizeTags(req.Tags)
+		if err != nil {
+			return nil, response.ValidationError(c, err.Error())
+		}
+		result, err := h.uploadRepo.SearchFileUploads(userID, upload.SearchQuery{
+			Text:  req.Query,
+			Tags:  tags,
+			Limit: h.config.MaxItems + 1,
+		})
+		if err != nil {
+			return nil, response.InternalError(c, "Failed to search uploads")
+		}
+		for _, u := range result.Uploads {
+			ids = append(ids, u.ID)
+		}
+	}
+
+	if len(ids) > h.config.MaxItems {
+		return nil, response.ValidationError(c, fmt.Sprintf("%s (max: %d)", ErrTooManyItems.Error(), h.config.MaxItems))
+	}
+
+	found, err := h.uploadRepo.GetFileUploadsByIDs(ids)
+	if err != nil {
+		return nil, response.InternalError(c, "Failed to get uploads")
+	}
+	byID := make(map[int64]*upload.FileUpload, len(found))
+	for _, u := range found {
+		byID[u.ID] = u
+	}
+
+	selected := make([]*upload.FileUpload, 0, len(ids))
+	for _, id := range ids {
+		u, ok := byID[id]
+		if !ok {
+			if strict {
+				return nil, response.NotFound(c, fmt.Sprintf("Upload %d not found", id))
+			}
+			continue
+		}
+		if u.UserID != userID {
+			return nil, response.Forbidden(c, fmt.Sprintf("Access denied to upload %d", id))
+		}
+		if u.Status != upload.StatusClean {
+			if strict {
+				return nil, response.Conflict(c, fmt.Sprintf("Upload %d is not available for export", id))
+			}
+			continue
+		}
+		// Check up front: once streaming starts there is no way to report an error
+		if _, err := os.Stat(u.TempPath); err != nil {
+			return nil, response.Conflict(c, fmt.Sprintf("File for upload %d is missing", id))
+		}
+		selected = append(selected, u)
+	}
+
+	if len(selected) == 0 {
+		return nil, response.ValidationError(c, ErrNothingToExport.Error())
+	}
+	return selected, nil
+}
+
+func (h *Handler) stream(c echo.Context, uploads []*upload.FileUpload) error {
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "application/zip")
+	res.Header().Set(echo.HeaderContentDisposition,
+		fmt.Sprintf(`attachment; filename="uploads-%s.zip"`, timeNow().Format("20060102-150405")))
+	res.Header().Set("Cache-Control", "private, no-store")
+	res.WriteHeader(http.StatusOK)
+
+	if err := writeZip(res, h.keyring, uploads); err != nil {
+		// The status line is already sent; aborting the connection is the only
+		// way left to tell the client the archive is incomplete
+		log.Printf("[Archive] Error streaming archive: %v", err)
+		panic(http.ErrAbortHandler)
+	}
+	return nil
+}
+
+func (h *Handler) createAsync(c echo.Context, userID int64, uploads []*upload.FileUpload, total int64) error {
+	ids := make([]int64, len(uploads))
+	for i, u := range uploads {
+		ids[i] = u.ID
+	}
+
+	a, err := h.archiveRepo.CreateArchive(&Archive{
+		UserID:    userID,
+		UploadIDs: ids,
+		Status:    StatusPending,
+		TotalSize: total,
+	})
+	if err != nil {
+		return response.InternalError(c, "Failed to create archive")
+	}
+
+	h.schedule(c.Request().Context(), a)
+
+	if current, found := h.archiveRepo.GetArchive(a.ID); found {
+		a = current
+	}
+	return response.Accepted(c, h.details(a))
+}
+
+// GetArchive reports an async archive's progress; once it is ready the
+// response carries a signed download link
+func (h *Handler) GetArchive(c echo.Context) error {
+	claims := c.Get("user").(*auth.TokenClaims)
+
+	var id int64
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	a, found := h.archiveRepo.GetArchive(id)
+	if !found {
+		return response.NotFound(c, "Archive not found")
+	}
+	if a.UserID != claims.UserID {
+		return response.Forbidden(c, "Access denied")
+	}
+
+	return response.Success(c, h.details(a))
+}
+
+func (h *Handler) details(a *Archive) echo.Map {
+	data := echo.Map{
+		"id":           a.ID,
+		"status":       a.Status,
+		"item_count":   len(a.UploadIDs),
+		"total_size":   a.TotalSize,
+		"created_at":   a.CreatedAt,
+		"completed_at": a.CompletedAt,
+		"expires_at":   a.ExpiresAt,
+		"status_url":   fmt.Sprintf("/api/archives/%d", a.ID),
+	}
+	if a.Error != "" {
+		data["error"] = a.Error
+	}
+
+	now := timeNow()
+	if a.Status == StatusReady && a.ExpiresAt != nil && now.Before(*a.ExpiresAt) {
+		expires := now.Add(h.config.LinkTTL)
+		if a.ExpiresAt.Before(expires) {
+			expires = *a.ExpiresAt
+		}
+		data["file_size"] = a.FileSize
+		data["download_url"] = fmt.Sprintf("/archives/%d/download?expires=%d&signature=%s",
+			a.ID, expires.Unix(), Sign(h.config.SigningKey, a.ID, expires.Unix()))
+		data["download_expires_at"] = time.Unix(expires.Unix(), 0).UTC()
+	}
+	return data
+}
+
+// Sign returns the hex HMAC-SHA256 authorising a download of archive id until expires
+func Sign(key []byte, id int64, expires int64) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "archive:%d:%d", id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Download serves a built archive to anyone holding a valid signed link
+func (h *Handler) Download(c echo.Context) error {
+	var id int64
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+	expires, err := strconv.ParseInt(c.QueryParam("expires"), 10, 64)
+	if err != nil {
+		return response.Forbidden(c, ErrInvalidSignature.Error())
+	}
+
+	// Verify before touching the database so the link reveals nothing about other archives
+	expected := Sign(h.config.SigningKey, id, expires)
+	if !hmac.Equal([]byte(expected), []byte(c.QueryParam("signature"))) {
+		return response.Forbidden(c, ErrInvalidSignature.Error())
+	}
+
+	now := timeNow()
+	if now.Unix() > expires {
+		return response.Error(c, http.StatusGone, response.ErrCodeArchiveLinkExpired, ErrLinkExpired.Error())
+	}
+
+	a, found := h.archiveRepo.GetArchive(id)
+	if !found || a.Status != StatusReady {
+		return response.NotFound(c, "Archive not found")
+	}
+	if a.ExpiresAt != nil && now.After(*a.ExpiresAt) {
+		return response.Error(c, http.StatusGone, response.ErrCodeArchiveLinkExpired, ErrLinkExpired.Error())
+	}
+
+	c.Response().Header().Set("Cache-Control", "private, no-store")
+	return c.Attachment(a.FilePath, fmt.Sprintf("uploads-%d.zip", a.ID))
+}
+
+// schedule hands the archive to the job queue, building it inline when there is none
+func (h *Handler) schedule(ctx context.Context, a *Archive) {
+	if h.jobQueue != nil {
+		_, err := h.jobQueue.Enqueue(JobBuildArchive, buildArchivePayload{ArchiveID: a.ID})
+		if err == nil {
+			return
+		}
+		log.Printf("[Archive] Error enqueueing archive %d, building inline: %v", a.ID, err)
+	}
+
+	if err := h.build(ctx, a); err != nil {
+		log.Printf("[Archive] Build failed for archive %d: %v", a.ID, err)
+		if err := h.archiveRepo.MarkArchiveFailed(a.ID, err.Error()); err != nil {
+			log.Printf("[Archive] Error marking archive %d failed: %v", a.ID, err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package archive
+
+import (
+	"database/sql"
+	"time"
+
+	"elotus_test/server/bsql"
+
+	"github.com/lib/pq"
+)
+
+type PostgresRepository struct {
+	db *bsql.DB
+}
+
+func NewPostgresRepository(db *bsql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+const archiveColumns = `id, user_id, upload_ids, status, total_size, file_path, file_size, error,
+		created_at, completed_at, expires_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanArchive(row rowScanner) (*Archive, error) {
+	a := &Archive{}
+	var filePath, errorMessage sql.NullString
+	var fileSize sql.NullInt64
+	var completedAt, expiresAt sql.NullTime
+
+	err := row.Scan(
+		&a.ID, &a.UserID, pq.Array(&a.UploadIDs), &a.Status, &a.TotalSize,
+		&filePath, &fileSize, &errorMessage, &a.CreatedAt, &completedAt, &expiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	a.FilePath = filePath.String
+	a.FileSize = fileSize.Int64
+	a.Error = errorMessage.String
+	if completedAt.Valid {
+		a.CompletedAt = &completedAt.Time
+	}
+	if expiresAt.Valid {
+		a.ExpiresAt = &expiresAt.Time
+	}
+	return a, nil
+}
+
+func (r *PostgresRepository) CreateArchive(a *Archive) (*Archive, error) {
+	err := r.db.QueryRow(`
+		INSERT INTO archives (user_id, upload_ids, status, total_size, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`,
+		a.UserID, pq.Array(a.UploadIDs), a.Status, a.TotalSize, time.Now(),
+	).Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (r *PostgresRepository) GetArchive(id int64) (*Archive, bool) {
+	a, err := scanArchive(r.db.QueryRow(`SELECT `+archiveColumns+` FROM archives WHERE id = $1`, id))
+	if err != nil {
+		return nil, false
+	}
+	return a, true
+}
+
+func (r *PostgresRepository) UpdateArchiveStatus(id int64, status string) error {
+	_, err := r.db.Exec(`UPDATE archives SET status = $1 WHERE id = $2`, status, id)
+	return err
+}
+
+func (r *PostgresRepository) MarkArchiveReady(id int64, filePath string, fileSize int64, expiresAt time.Time) error {
+	_, err := r.db.Exec(`
+		UPDATE archives
+		SET status = $1, file_path = $2, file_size = $3, error = NULL, completed_at = $4, expires_at = $5
+		WHERE id = $6`,
+		StatusReady, filePath, fileSize, time.Now(), expiresAt, id,
+	)
+	return err
+}
+
+func (r *PostgresRepository) MarkArchiveFailed(id int64, reason string) error {
+	_, err := r.db.Exec(
+		`UPDATE archives SET status = $1, error = $2, completed_at = $3 WHERE id = $4`,
+		StatusFailed, reason, time.Now(), id,
+	)
+	return err
+}
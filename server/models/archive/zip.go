@@ -0,0 +1,88 @@
+package archive
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"elotus_test/server/envelope"
+	"elotus_test/server/models/upload"
+)
+
+// entryNames hands out unique ZIP entry names. Names are compared
+// case-insensitively since most unzip targets are case-insensitive filesystems.
+type entryNames struct {
+	used map[string]bool
+}
+
+func newEntryNames() *entryNames {
+	return &entryNames{used: make(map[string]bool)}
+}
+
+// next returns name, or "name (n).ext" for the first n that is still free
+func (n *entryNames) next(name string) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	candidate := name
+	for i := 1; n.used[strings.ToLower(candidate)]; i++ {
+		candidate = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+	n.used[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+// entryName is the upload's original filename reduced to a safe base name
+func entryName(u *upload.FileUpload) string {
+	name := strings.ReplaceAll(u.OriginalFilename, `\`, "/")
+	name = strings.TrimLeft(path.Base(name), ".")
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+
+	if name == "" || name == "/" {
+		return u.Filename
+	}
+	return name
+}
+
+// writeZip streams the uploads' files into w as a ZIP, decrypting encrypted
+// files on the way. Images are already compressed, so entries are stored
+// rather than deflated.
+func writeZip(w io.Writer, keyring *envelope.Keyring, uploads []*upload.FileUpload) error {
+	zw := zip.NewWriter(w)
+	names := newEntryNames()
+
+	for _, u := range uploads {
+		entry, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     names.next(entryName(u)),
+			Method:   zip.Store,
+			Modified: u.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := copyBlob(entry, keyring, u); err != nil {
+			return fmt.Errorf("upload %d: %w", u.ID, err)
+		}
+	}
+
+	return zw.Close()
+}
+
+func copyBlob(dst io.Writer, keyring *envelope.Keyring, u *upload.FileUpload) error {
+	blob, err := upload.OpenBlob(keyring, u)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	_, err = io.Copy(dst, blob)
+	return err
+}
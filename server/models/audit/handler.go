@@ -0,0 +1,76 @@
+package audit
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"elotus_test/server/pagination"
+	"elotus_test/server/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+type Handler struct {
+	repo Repository
+}
+
+func NewHandler(repo Repository) *Handler {
+	return &Handler{repo: repo}
+}
+
+// ListEvents is the admin view of the trail, newest first. Filters:
+// ?action=&actor_id=&target_type=&target_id=&ip=&since=&until= (RFC 3339).
+func (h *Handler) ListEvents(c echo.Context) error {
+	page, err := pagination.FromRequest(c)
+	if err != nil {
+		return response.ValidationError(c, err.Error())
+	}
+	filter, err := filterFromRequest(c)
+	if err != nil {
+		return response.ValidationError(c, err.Error())
+	}
+
+	events, total, err := h.repo.ListEvents(filter, page.PerPage, page.Offset())
+	if err != nil {
+		return response.InternalError(c, "Failed to list audit events")
+	}
+	if events == nil {
+		events = []*Event{}
+	}
+	return response.SuccessWithMeta(c, events, page.Meta(total))
+}
+
+func filterFromRequest(c echo.Context) (Filter, error) {
+	filter := Filter{
+		Action:     c.QueryParam("action"),
+		TargetType: c.QueryParam("target_type"),
+		TargetID:   c.QueryParam("target_id"),
+		ClientIP:   c.QueryParam("ip"),
+	}
+
+	if v := c.QueryParam("actor_id"); v != "" {
+		actorID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || actorID < 1 {
+			return filter, fmt.Errorf("actor_id must be a positive integer")
+		}
+		filter.ActorID = actorID
+	}
+
+	for _, bound := range []struct {
+		name string
+		dest **time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		v := c.QueryParam(bound.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, fmt.Errorf("%s must be an RFC 3339 time", bound.name)
+		}
+		*bound.dest = &t
+	}
+
+	return filter, nil
+}
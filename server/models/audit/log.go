@@ -0,0 +1,77 @@
+package audit
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+var timeNow = time.Now
+
+// Entry is what a handler reports; the log fills in the time and the chain
+type Entry struct {
+	Action     string
+	ActorID    int64
+	ClientIP   string
+	UserAgent  string
+	TargetType string
+	TargetID   string
+	Metadata   map[string]interface{}
+}
+
+// ID formats a numeric target ID
+func ID(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+// Log writes audit events for handlers
+type Log struct {
+	repo Repository
+}
+
+func NewLog(repo Repository) *Log {
+	return &Log{repo: repo}
+}
+
+// Emit appends the entry to the trail. It is a no-op on a nil log, and a
+// failure to write is logged rather than failing the action being audited.
+func (l *Log) Emit(entry Entry) {
+	if l == nil {
+		return
+	}
+
+	e := &Event{
+		Action:     entry.Action,
+		ActorID:    entry.ActorID,
+		ClientIP:   entry.ClientIP,
+		UserAgent:  entry.UserAgent,
+		TargetType: entry.TargetType,
+		TargetID:   entry.TargetID,
+		CreatedAt:  timeNow(),
+	}
+	if len(entry.Metadata) > 0 {
+		metadata, err := json.Marshal(entry.Metadata)
+		if err != nil {
+			log.Printf("[Audit] Error encoding metadata for %s: %v", entry.Action, err)
+		} else {
+			e.Metadata = metadata
+		}
+	}
+
+	if _, err := l.repo.Append(e); err != nil {
+		log.Printf("[Audit] Error recording %s by %d: %v", entry.Action, entry.ActorID, err)
+	}
+}
+
+// Record emits the entry with the client IP and user agent of the request
+func (l *Log) Record(c echo.Context, entry Entry) {
+	if l == nil {
+		return
+	}
+	entry.ClientIP = c.RealIP()
+	entry.UserAgent = c.Request().UserAgent()
+	l.Emit(entry)
+}
@@ -0,0 +1,170 @@
+package audit
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"elotus_test/server/bsql"
+)
+
+// appendLockKey is the advisory lock that serializes appends across servers
+const appendLockKey = 0x61756469 // "audi"
+
+type PostgresRepository struct {
+	db *bsql.DB
+}
+
+func NewPostgresRepository(db *bsql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+const eventColumns = `id, action, actor_id, client_ip, user_agent, target_type, target_id, metadata, prev_hash, hash, created_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanEvent(row rowScanner) (*Event, error) {
+	e := &Event{}
+	var actorID sql.NullInt64
+	var clientIP, userAgent, targetType, targetID, metadata sql.NullString
+
+	err := row.Scan(
+		&e.ID, &e.Action, &actorID, &clientIP, &userAgent, &targetType, &targetID, &metadata,
+		&e.PrevHash, &e.Hash, &e.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	e.ActorID = actorID.Int64
+	e.ClientIP = clientIP.String
+	e.UserAgent = userAgent.String
+	e.TargetType = targetType.String
+	e.TargetID = targetID.String
+	if metadata.Valid {
+		e.Metadata = []byte(metadata.String)
+	}
+	return e, nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func (r *PostgresRepository) Append(e *Event) (*Event, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Held until commit, so the next append sees this event as the newest
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, appendLockKey); err != nil {
+		return nil, err
+	}
+
+	prevHash := GenesisHash
+	err = tx.QueryRow(`SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1`).Scan(&prevHash)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	e.Seal(prevHash)
+
+	err = tx.QueryRow(`
+		INSERT INTO audit_events (action, actor_id, client_ip, user_agent, target_type, target_id, metadata, prev_hash, hash, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id`,
+		e.Action, sql.NullInt64{Int64: e.ActorID, Valid: e.ActorID != 0},
+		nullString(e.ClientIP), nullString(e.UserAgent), nullString(e.TargetType), nullString(e.TargetID),
+		nullString(string(e.Metadata)), e.PrevHash, e.Hash, e.CreatedAt,
+	).Scan(&e.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (r *PostgresRepository) ListEvents(filter Filter, limit, offset int) ([]*Event, int, error) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Action != "" {
+		add("action = $%d", filter.Action)
+	}
+	if filter.ActorID != 0 {
+		add("actor_id = $%d", filter.ActorID)
+	}
+	if filter.TargetType != "" {
+		add("target_type = $%d", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		add("target_id = $%d", filter.TargetID)
+	}
+	if filter.ClientIP != "" {
+		add("client_ip = $%d", filter.ClientIP)
+	}
+	if filter.Since != nil {
+		add("created_at >= $%d", *filter.Since)
+	}
+	if filter.Until != nil {
+		add("created_at < $%d", *filter.Until)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM audit_events `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, limit, offset)
+	rows, err := r.db.Query(fmt.Sprintf(`
+		SELECT `+eventColumns+` FROM audit_events
+		%s
+		ORDER BY id DESC
+		LIMIT $%d OFFSET $%d`, where, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	events, err := scanEvents(rows)
+	return events, total, err
+}
+
+func (r *PostgresRepository) EventsAfter(afterID int64, limit int) ([]*Event, error) {
+	rows, err := r.db.Query(`
+		SELECT `+eventColumns+` FROM audit_events
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2`, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanEvents(rows)
+}
+
+func scanEvents(rows *sql.Rows) ([]*Event, error) {
+	var events []*Event
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,21 @@
+package auth
+
+import (
+	"elotus_test/server/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RequireAdmin only lets through callers for whom isAdmin is true. Chain it
+// after the JWT middleware.
+func RequireAdmin(isAdmin func(userID int64) bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims, ok := c.Get("user").(*TokenClaims)
+			if !ok || !isAdmin(claims.UserID) {
+				return response.Forbidden(c, "Admin access required")
+			}
+			return next(c)
+		}
+	}
+}
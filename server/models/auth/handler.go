@@ -1,10 +1,13 @@
 package auth
 
 import (
+	"log"
 	"time"
 
 	"elotus_test/server/bredis"
 	"elotus_test/server/bsql"
+	"elotus_test/server/models/audit"
+	"elotus_test/server/models/events"
 	"elotus_test/server/models/user"
 	"elotus_test/server/response"
 	"elotus_test/server/validation"
@@ -18,6 +21,8 @@ type Handler struct {
 	userRepo   user.Repository
 	jwtService *JWTService
 	redis      *bredis.Client
+	events     *events.Bus
+	auditLog   *audit.Log
 }
 
 func NewHandler(db *bsql.DB, userRepo user.Repository, jwtService *JWTService, redis *bredis.Client) *Handler {
@@ -29,6 +34,14 @@ func NewHandler(db *bsql.DB, userRepo user.Repository, jwtService *JWTService, r
 	}
 }
 
+func (h *Handler) SetEventBus(bus *events.Bus) {
+	h.events = bus
+}
+
+func (h *Handler) SetAuditLog(auditLog *audit.Log) {
+	h.auditLog = auditLog
+}
+
 type RegisterRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
@@ -80,6 +93,18 @@ func (h *Handler) Register(c echo.Context) error {
 		return response.InternalError(c, "Failed to create user")
 	}
 
+	h.events.Publish(events.UserRegistered, u.ID, echo.Map{
+		"id":         u.ID,
+		"username":   u.Username,
+		"created_at": u.CreatedAt,
+	})
+	h.auditLog.Record(c, audit.Entry{
+		Action:     audit.ActionRegister,
+		ActorID:    u.ID,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.ID(u.ID),
+	})
+
 	return response.Created(c, echo.Map{
 		"message": "User registered successfully",
 		"user": echo.Map{
@@ -103,16 +128,20 @@ func (h *Handler) Login(c echo.Context) error {
 	if h.redis != nil {
 		result := h.redis.CheckRateLimit("login:user:"+req.Username, loginRateLimitMax, loginRateLimitWindow)
 		if !result.Allowed {
+			h.auditLoginFailed(c, req.Username, 0, "rate_limited")
 			return response.TooManyRequests(c, "Too many login attempts for this account", result.RetryAfter.Seconds())
 		}
 	}
 
 	u, exists := h.userRepo.GetUserByUsername(req.Username)
 	if !exists {
+		h.auditLoginFailed(c, req.Username, 0, "unknown_user")
 		return response.Unauthorized(c, "Invalid username or password")
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(req.Password)); err != nil {
+		h.recordLogin(c, u.ID, false)
+		h.auditLoginFailed(c, req.Username, u.ID, "wrong_password")
 		return response.Unauthorized(c, "Invalid username or password")
 	}
 
@@ -126,6 +155,13 @@ func (h *Handler) Login(c echo.Context) error {
 	}
 
 	_ = h.userRepo.UpdateLastLogin(u.ID)
+	h.recordLogin(c, u.ID, true)
+	h.auditLog.Record(c, audit.Entry{
+		Action:     audit.ActionLogin,
+		ActorID:    u.ID,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.ID(u.ID),
+	})
 
 	return response.Success(c, echo.Map{
 		"token":      token,
@@ -133,6 +169,27 @@ func (h *Handler) Login(c echo.Context) error {
 	})
 }
 
+// recordLogin adds the attempt to the user's login history; a failure to record
+// never blocks the login itself
+func (h *Handler) recordLogin(c echo.Context, userID int64, success bool) {
+	if err := h.userRepo.RecordLogin(userID, c.RealIP(), c.Request().UserAgent(), success); err != nil {
+		log.Printf("[Auth] Error recording login for user %d: %v", userID, err)
+	}
+}
+
+// auditLoginFailed records a rejected login; userID is zero when the username
+// does not exist, so the attempt has no target account
+func (h *Handler) auditLoginFailed(c echo.Context, username string, userID int64, reason string) {
+	entry := audit.Entry{
+		Action:   audit.ActionLoginFailed,
+		Metadata: map[string]interface{}{"username": username, "reason": reason},
+	}
+	if userID != 0 {
+		entry.TargetType, entry.TargetID = audit.TargetUser, audit.ID(userID)
+	}
+	h.auditLog.Record(c, entry)
+}
+
 func (h *Handler) RevokeToken(c echo.Context) error {
 	claims := c.Get("user").(*TokenClaims)
 
@@ -141,6 +198,7 @@ func (h *Handler) RevokeToken(c echo.Context) error {
 		if err := h.jwtService.RevokeUserTokens(claims.UserID); err != nil {
 			return response.InternalError(c, "Failed to revoke tokens")
 		}
+		h.publishRevoked(c, claims.UserID, time.Now())
 		return response.Success(c, echo.Map{
 			"message": "All tokens have been revoked",
 		})
@@ -150,6 +208,7 @@ func (h *Handler) RevokeToken(c echo.Context) error {
 		if err := h.jwtService.RevokeUserTokensBefore(claims.UserID, *req.RevokeBeforeTime); err != nil {
 			return response.InternalError(c, "Failed to revoke tokens")
 		}
+		h.publishRevoked(c, claims.UserID, *req.RevokeBeforeTime)
 		return response.Success(c, echo.Map{
 			"message": "Tokens issued before " + req.RevokeBeforeTime.Format(time.RFC3339) + " have been revoked",
 		})
@@ -158,11 +217,26 @@ func (h *Handler) RevokeToken(c echo.Context) error {
 	if err := h.jwtService.RevokeUserTokens(claims.UserID); err != nil {
 		return response.InternalError(c, "Failed to revoke tokens")
 	}
+	h.publishRevoked(c, claims.UserID, time.Now())
 	return response.Success(c, echo.Map{
 		"message": "All tokens have been revoked",
 	})
 }
 
+func (h *Handler) publishRevoked(c echo.Context, userID int64, before time.Time) {
+	h.events.Publish(events.TokensRevoked, userID, echo.Map{
+		"user_id":        userID,
+		"revoked_before": before.UTC(),
+	})
+	h.auditLog.Record(c, audit.Entry{
+		Action:     audit.ActionTokensRevoked,
+		ActorID:    userID,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.ID(userID),
+		Metadata:   map[string]interface{}{"revoked_before": before.UTC()},
+	})
+}
+
 func (h *Handler) Protected(c echo.Context) error {
 	claims := c.Get("user").(*TokenClaims)
 
@@ -13,12 +13,21 @@ import (
 type TokenRevocationStore struct {
 	db    *bsql.DB
 	redis *bredis.Client
+
+	listeners []func(userID int64)
 }
 
 func NewTokenRevocationStore(db *bsql.DB, redis *bredis.Client) *TokenRevocationStore {
 	return &TokenRevocationStore{db: db, redis: redis}
 }
 
+// OnRevoke registers a callback run after a user's tokens are revoked, so
+// long-lived connections can be re-checked without waiting for their next
+// request. Register listeners before the server starts handling requests.
+func (s *TokenRevocationStore) OnRevoke(listener func(userID int64)) {
+	s.listeners = append(s.listeners, listener)
+}
+
 func (s *TokenRevocationStore) cacheKey(userID int64) string {
 	return fmt.Sprintf("revoke:%d", userID)
 }
@@ -37,6 +46,10 @@ func (s *TokenRevocationStore) RevokeUserTokensBefore(userID int64, before time.
 		_ = s.redis.Delete(s.cacheKey(userID))
 	}
 
+	for _, listener := range s.listeners {
+		listener(userID)
+	}
+
 	return nil
 }
 
@@ -44,6 +57,13 @@ func (s *TokenRevocationStore) RevokeAllUserTokens(userID int64) error {
 	return s.RevokeUserTokensBefore(userID, time.Now())
 }
 
+// Forget drops the cached revocation time of a deleted user
+func (s *TokenRevocationStore) Forget(userID int64) {
+	if s.redis != nil {
+		_ = s.redis.Delete(s.cacheKey(userID))
+	}
+}
+
 // IsTokenRevoked checks if a token is revoked.
 // A token is revoked if it was issued BEFORE the user's last_revoked_token_at timestamp.
 func (s *TokenRevocationStore) IsTokenRevoked(userID int64, issuedAt time.Time) bool {
@@ -62,6 +82,10 @@ func (s *TokenRevocationStore) IsTokenRevoked(userID int64, issuedAt time.Time)
 		userID,
 	).Scan(&lastRevokedAt)
 
+	if err == sql.ErrNoRows {
+		// The account has been deleted, so none of its tokens are valid
+		return true
+	}
 	if err != nil || !lastRevokedAt.Valid {
 		return false
 	}
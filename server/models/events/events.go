@@ -0,0 +1,91 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const (
+	UploadCreated = "upload.created"
+	// UploadProcessed fires when background processing of an upload finishes.
+	// Uploads processed inline are already final in their upload.created event.
+	UploadProcessed = "upload.processed"
+	UploadDeleted   = "upload.deleted"
+	// UploadProgress carries the progress record of an upload sent with an
+	// upload ID. It is streamed to the uploader but cannot be subscribed to.
+	UploadProgress = "upload.progress"
+	UserRegistered = "user.registered"
+	// UserDeleted fires once a deleted account has been purged
+	UserDeleted   = "user.deleted"
+	TokensRevoked = "tokens.revoked"
+)
+
+// Types lists every event that can be subscribed to
+var Types = []string{UploadCreated, UploadProcessed, UploadDeleted, UserRegistered, UserDeleted, TokensRevoked}
+
+type Event struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	UserID     int64       `json:"user_id"`
+	Data       interface{} `json:"data"`
+	OccurredAt time.Time   `json:"occurred_at"`
+}
+
+type Handler func(event Event)
+
+// Bus fans events out to in-process subscribers. Handlers run synchronously on
+// the publishing goroutine, so they should hand slow work to the job queue.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+func (b *Bus) Subscribe(handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+// Publish is a no-op on a nil bus so handlers can emit events unconditionally
+func (b *Bus) Publish(eventType string, userID int64, data interface{}) {
+	if b == nil {
+		return
+	}
+
+	event := Event{
+		ID:         newEventID(),
+		Type:       eventType,
+		UserID:     userID,
+		Data:       data,
+		OccurredAt: time.Now().UTC(),
+	}
+
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+func IsKnownType(eventType string) bool {
+	for _, t := range Types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func newEventID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return "evt_" + hex.EncodeToString(b)
+}
@@ -0,0 +1,20 @@
+package janitor
+
+import (
+	"elotus_test/server/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+type Handler struct {
+	janitor *Janitor
+}
+
+func NewHandler(janitor *Janitor) *Handler {
+	return &Handler{janitor: janitor}
+}
+
+// GetStats reports the janitor's running totals since the process started
+func (h *Handler) GetStats(c echo.Context) error {
+	return response.Success(c, h.janitor.Stats())
+}
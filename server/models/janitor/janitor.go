@@ -0,0 +1,303 @@
+package janitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"elotus_test/server/models/upload"
+)
+
+const (
+	ReasonExpired = "expired"
+	ReasonOverCap = "over_cap"
+)
+
+// partialSuffix marks files still being written (archives, transform variants);
+// one left behind means the writer died before renaming it into place
+const partialSuffix = ".part"
+
+const listBatchSize = 500
+
+type Config struct {
+	// Root is the upload storage root; archives and transform caches live under it
+	Root string
+	// Interval between runs; zero disables the periodic janitor
+	Interval time.Duration
+	// MinAge protects files that may still belong to a request in flight
+	MinAge time.Duration
+	// MaxAge is how long an uncommitted file may stay before it is removed
+	MaxAge time.Duration
+	// MaxBytes caps the total size of uncommitted files; the oldest go first
+	MaxBytes int64
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Root:     "tmp",
+		Interval: 10 * time.Minute,
+		MinAge:   10 * time.Minute,
+		MaxAge:   time.Hour,
+		MaxBytes: 512 * 1024 * 1024,
+	}
+}
+
+// RemovedFile is one file the janitor reclaimed (or would have, in a dry run)
+type RemovedFile struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Reason  string    `json:"reason"`
+}
+
+type Report struct {
+	DryRun       bool `json:"dry_run"`
+	FilesScanned int  `json:"files_scanned"`
+	// TempFiles and TempBytes count uncommitted files left after the run
+	TempFiles      int           `json:"temp_files"`
+	TempBytes      int64         `json:"temp_bytes"`
+	Removed        []RemovedFile `json:"removed"`
+	ReclaimedBytes int64         `json:"reclaimed_bytes"`
+	Errors         int           `json:"errors"`
+}
+
+// WriteSummary prints the report for the clean-tmp command
+func (r *Report) WriteSummary(w io.Writer) {
+	mode := "clean"
+	if r.DryRun {
+		mode = "dry run"
+	}
+	fmt.Fprintf(w, "Temp file cleanup (%s)\n", mode)
+	fmt.Fprintf(w, "  Files scanned:    %d\n", r.FilesScanned)
+	fmt.Fprintf(w, "  Removed:          %d (%d bytes)\n", len(r.Removed), r.ReclaimedBytes)
+	fmt.Fprintf(w, "  Uncommitted left: %d (%d bytes)\n", r.TempFiles, r.TempBytes)
+	fmt.Fprintf(w, "  Errors:           %d\n", r.Errors)
+
+	for _, file := range r.Removed {
+		fmt.Fprintf(w, "  %s: %s (%d bytes, modified %s)\n", file.Reason, file.Path, file.Size, file.ModTime.Format(time.RFC3339))
+	}
+}
+
+// Stats are running totals since the process started
+type Stats struct {
+	Runs           int64 `json:"runs"`
+	FilesReclaimed int64 `json:"files_reclaimed"`
+	BytesReclaimed int64 `json:"bytes_reclaimed"`
+	// TempBytes is the uncommitted total seen by the last run
+	TempBytes int64 `json:"temp_bytes"`
+}
+
+// Janitor removes temp files that were never committed: upload blobs that no
+// file_uploads row points at, and partial writes left behind by a crash.
+// Files another subsystem owns (archives, exports, transform variants) are left alone.
+type Janitor struct {
+	config     *Config
+	uploadRepo upload.Repository
+
+	runs           atomic.Int64
+	filesReclaimed atomic.Int64
+	bytesReclaimed atomic.Int64
+	tempBytes      atomic.Int64
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+func NewJanitor(config *Config, uploadRepo upload.Repository) *Janitor {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	return &Janitor{config: config, uploadRepo: uploadRepo}
+}
+
+func (j *Janitor) Stats() Stats {
+	return Stats{
+		Runs:           j.runs.Load(),
+		FilesReclaimed: j.filesReclaimed.Load(),
+		BytesReclaimed: j.bytesReclaimed.Load(),
+		TempBytes:      j.tempBytes.Load(),
+	}
+}
+
+// Start runs the janitor every Interval until Stop; it is a no-op when the interval is zero
+func (j *Janitor) Start() {
+	if j.config.Interval <= 0 || j.stop != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	j.stop = cancel
+	j.done = make(chan struct{})
+
+	go func() {
+		defer close(j.done)
+		ticker := time.NewTicker(j.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			report, err := j.Run(ctx, false)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("[Janitor] Run failed: %v", err)
+				continue
+			}
+			if report != nil && len(report.Removed) > 0 {
+				log.Printf("[Janitor] Reclaimed %d files (%d bytes); %d uncommitted files (%d bytes) remain",
+					len(report.Removed), report.ReclaimedBytes, report.TempFiles, report.TempBytes)
+			}
+		}
+	}()
+}
+
+// Stop ends the periodic loop and waits for a run in progress to finish
+func (j *Janitor) Stop() {
+	if j.stop == nil {
+		return
+	}
+	j.stop()
+	<-j.done
+}
+
+type tempFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// Run removes uncommitted files older than MaxAge, then the oldest of the rest
+// until their total fits MaxBytes. Files younger than MinAge are never touched.
+func (j *Janitor) Run(ctx context.Context, dryRun bool) (*Report, error) {
+	report := &Report{DryRun: dryRun, Removed: []RemovedFile{}}
+
+	committed, err := j.committedPaths(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	candidates, total, err := j.scan(ctx, committed, report)
+	if err != nil {
+		return report, err
+	}
+
+	now := time.Now()
+	sort.Slice(candidates, func(a, b int) bool { return candidates[a].modTime.Before(candidates[b].modTime) })
+	for _, file := range candidates {
+		reason := ""
+		switch {
+		case now.Sub(file.modTime) < j.config.MinAge:
+			// May still belong to a request in flight
+		case now.Sub(file.modTime) > j.config.MaxAge:
+			reason = ReasonExpired
+		case j.config.MaxBytes > 0 && total > j.config.MaxBytes:
+			reason = ReasonOverCap
+		}
+		if reason == "" {
+			continue
+		}
+
+		if !dryRun {
+			if err := os.Remove(file.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				log.Printf("[Janitor] Error removing %s: %v", file.path, err)
+				report.Errors++
+				continue
+			}
+		}
+		total -= file.size
+		report.ReclaimedBytes += file.size
+		report.Removed = append(report.Removed, RemovedFile{Path: file.path, Size: file.size, ModTime: file.modTime, Reason: reason})
+	}
+
+	report.TempFiles = len(candidates) - len(report.Removed)
+	report.TempBytes = total
+
+	if !dryRun {
+		j.runs.Add(1)
+		j.filesReclaimed.Add(int64(len(report.Removed)))
+		j.bytesReclaimed.Add(report.ReclaimedBytes)
+		j.tempBytes.Store(report.TempBytes)
+	}
+	return report, nil
+}
+
+// committedPaths is the set of blob paths that have a file_uploads row. It is
+// read before the walk, so a file committed in between is younger than MinAge.
+func (j *Janitor) committedPaths(ctx context.Context) (map[string]bool, error) {
+	committed := make(map[string]bool)
+	var afterID int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		uploads, err := j.uploadRepo.ListFileUploadsAfter(afterID, listBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(uploads) == 0 {
+			return committed, nil
+		}
+		afterID = uploads[len(uploads)-1].ID
+		for _, u := range uploads {
+			committed[filepath.Clean(u.TempPath)] = true
+		}
+	}
+}
+
+// scan collects the uncommitted files under the storage root and their total size
+func (j *Janitor) scan(ctx context.Context, committed map[string]bool, report *Report) ([]tempFile, int64, error) {
+	root := filepath.Clean(j.config.Root)
+	mediaDirs := make([]string, len(upload.MediaFolders))
+	for i, folder := range upload.MediaFolders {
+		mediaDirs[i] = filepath.Join(root, folder) + string(filepath.Separator)
+	}
+
+	var candidates []tempFile
+	var total int64
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return ctx.Err()
+		}
+		report.FilesScanned++
+
+		uncommitted := strings.HasSuffix(path, partialSuffix)
+		if !uncommitted {
+			for _, dir := range mediaDirs {
+				if strings.HasPrefix(path, dir) {
+					uncommitted = !committed[filepath.Clean(path)]
+					break
+				}
+			}
+		}
+		if !uncommitted {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			// Removed while we were walking
+			return nil
+		}
+		candidates = append(candidates, tempFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	return candidates, total, err
+}
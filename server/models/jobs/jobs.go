@@ -0,0 +1,50 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusDead    = "dead"
+)
+
+type Job struct {
+	ID          int64           `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	LastError   string          `json:"last_error,omitempty"`
+	RunAt       time.Time       `json:"run_at"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// LastAttempt reports whether a failure of the current attempt sends the job to the dead-letter state
+func (j *Job) LastAttempt() bool {
+	return j.Attempts >= j.MaxAttempts
+}
+
+// HandlerFunc processes a single job; returning an error schedules a retry
+type HandlerFunc func(ctx context.Context, job *Job) error
+
+type Repository interface {
+	Enqueue(kind string, payload []byte, maxAttempts int, runAt time.Time) (*Job, error)
+	// Claim locks the next runnable job, or a running job whose lock is older than staleAfter.
+	// It returns nil when there is nothing to do.
+	Claim(staleAfter time.Duration) (*Job, error)
+	Complete(id int64) error
+	Retry(id int64, runAt time.Time, lastError string) error
+	Bury(id int64, lastError string) error
+}
+
+var (
+	ErrQueueStopped = errors.New("job queue is stopped")
+	ErrUnknownKind  = errors.New("no handler registered for job kind")
+)
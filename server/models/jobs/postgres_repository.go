@@ -0,0 +1,106 @@
+package jobs
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"elotus_test/server/bsql"
+)
+
+type PostgresRepository struct {
+	db *bsql.DB
+}
+
+func NewPostgresRepository(db *bsql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+const jobColumns = `id, kind, payload, status, attempts, max_attempts, last_error, run_at, created_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanJob(row rowScanner) (*Job, error) {
+	job := &Job{}
+	var payload []byte
+	var lastError sql.NullString
+
+	err := row.Scan(
+		&job.ID,
+		&job.Kind,
+		&payload,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&lastError,
+		&job.RunAt,
+		&job.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Payload = payload
+	job.LastError = lastError.String
+	return job, nil
+}
+
+func (r *PostgresRepository) Enqueue(kind string, payload []byte, maxAttempts int, runAt time.Time) (*Job, error) {
+	query := `
+		INSERT INTO jobs (kind, payload, status, max_attempts, run_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		RETURNING ` + jobColumns
+
+	return scanJob(r.db.QueryRow(query, kind, payload, StatusQueued, maxAttempts, runAt))
+}
+
+// Claim uses FOR UPDATE SKIP LOCKED so concurrent workers never pick the same row
+func (r *PostgresRepository) Claim(staleAfter time.Duration) (*Job, error) {
+	query := `
+		UPDATE jobs SET
+			status = $1,
+			attempts = attempts + 1,
+			locked_at = NOW(),
+			updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE (status = $2 AND run_at <= NOW())
+				OR (status = $1 AND locked_at < NOW() - $3::interval)
+			ORDER BY run_at, id
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING ` + jobColumns
+
+	job, err := scanJob(r.db.QueryRow(query, StatusRunning, StatusQueued, fmt.Sprintf("%d milliseconds", staleAfter.Milliseconds())))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return job, err
+}
+
+func (r *PostgresRepository) Complete(id int64) error {
+	_, err := r.db.Exec(
+		`UPDATE jobs SET status = $1, locked_at = NULL, updated_at = NOW() WHERE id = $2`,
+		StatusDone, id,
+	)
+	return err
+}
+
+func (r *PostgresRepository) Retry(id int64, runAt time.Time, lastError string) error {
+	_, err := r.db.Exec(
+		`UPDATE jobs SET status = $1, run_at = $2, last_error = $3, locked_at = NULL, updated_at = NOW() WHERE id = $4`,
+		StatusQueued, runAt, lastError, id,
+	)
+	return err
+}
+
+func (r *PostgresRepository) Bury(id int64, lastError string) error {
+	_, err := r.db.Exec(
+		`UPDATE jobs SET status = $1, last_error = $2, locked_at = NULL, updated_at = NOW() WHERE id = $3`,
+		StatusDead, lastError, id,
+	)
+	return err
+}
@@ -0,0 +1,233 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	Workers      int
+	PollInterval time.Duration
+	MaxAttempts  int
+	// LockTimeout is how long a running job may go without finishing before another worker reclaims it
+	LockTimeout time.Duration
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Workers:      2,
+		PollInterval: time.Second,
+		MaxAttempts:  5,
+		LockTimeout:  5 * time.Minute,
+		BaseBackoff:  5 * time.Second,
+		MaxBackoff:   10 * time.Minute,
+	}
+}
+
+// Queue runs registered handlers for jobs stored in the repository
+type Queue struct {
+	config   *Config
+	repo     Repository
+	handlers map[string]HandlerFunc
+
+	mu      sync.Mutex
+	started bool
+	stopped bool
+	stop    chan struct{}
+	wake    chan struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func NewQueue(config *Config, repo Repository) *Queue {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Queue{
+		config:   config,
+		repo:     repo,
+		handlers: make(map[string]HandlerFunc),
+		stop:     make(chan struct{}),
+		wake:     make(chan struct{}, 1),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Register must be called before Start
+func (q *Queue) Register(kind string, handler HandlerFunc) {
+	q.handlers[kind] = handler
+}
+
+// Enqueue stores a job that becomes runnable immediately
+func (q *Queue) Enqueue(kind string, payload interface{}) (*Job, error) {
+	return q.EnqueueAt(kind, payload, time.Now())
+}
+
+func (q *Queue) EnqueueAt(kind string, payload interface{}, runAt time.Time) (*Job, error) {
+	if _, ok := q.handlers[kind]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKind, kind)
+	}
+
+	q.mu.Lock()
+	stopped := q.stopped
+	q.mu.Unlock()
+	if stopped {
+		return nil, ErrQueueStopped
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	job, err := q.repo.Enqueue(kind, data, q.config.MaxAttempts, runAt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Nudge an idle worker instead of waiting for the next poll
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	return job, nil
+}
+
+func (q *Queue) Start() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.started || q.stopped {
+		return
+	}
+	q.started = true
+
+	workers := q.config.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.work(i + 1)
+	}
+	log.Printf("[Jobs] Started %d workers", workers)
+}
+
+// Shutdown stops claiming new jobs and waits for in-flight jobs to finish.
+// If ctx expires first, running handlers are cancelled and ctx.Err() is returned.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.stopped {
+		q.stopped = true
+		close(q.stop)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		q.cancel()
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (q *Queue) work(worker int) {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+
+		job, err := q.repo.Claim(q.config.LockTimeout)
+		if err != nil {
+			log.Printf("[Jobs] Worker %d claim error: %v", worker, err)
+		}
+		if job != nil {
+			q.process(job)
+			continue
+		}
+
+		select {
+		case <-q.stop:
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (q *Queue) process(job *Job) {
+	err := q.run(job)
+	if err == nil {
+		if err := q.repo.Complete(job.ID); err != nil {
+			log.Printf("[Jobs] Error completing job %d: %v", job.ID, err)
+		}
+		return
+	}
+
+	if job.LastAttempt() {
+		log.Printf("[Jobs] Job %d (%s) dead after %d attempts: %v", job.ID, job.Kind, job.Attempts, err)
+		if err := q.repo.Bury(job.ID, err.Error()); err != nil {
+			log.Printf("[Jobs] Error burying job %d: %v", job.ID, err)
+		}
+		return
+	}
+
+	runAt := time.Now().Add(q.backoff(job.Attempts))
+	log.Printf("[Jobs] Job %d (%s) attempt %d failed, retrying at %s: %v", job.ID, job.Kind, job.Attempts, runAt.Format(time.RFC3339), err)
+	if err := q.repo.Retry(job.ID, runAt, err.Error()); err != nil {
+		log.Printf("[Jobs] Error rescheduling job %d: %v", job.ID, err)
+	}
+}
+
+func (q *Queue) run(job *Job) (err error) {
+	handler, ok := q.handlers[job.Kind]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownKind, job.Kind)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	return handler(q.ctx, job)
+}
+
+// backoff doubles the delay after every failed attempt, up to MaxBackoff
+func (q *Queue) backoff(attempts int) time.Duration {
+	delay := q.config.BaseBackoff
+	for i := 1; i < attempts && delay < q.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > q.config.MaxBackoff {
+		delay = q.config.MaxBackoff
+	}
+	return delay
+}
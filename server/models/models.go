@@ -4,15 +4,30 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"elotus_test/server/bredis"
 	"elotus_test/server/bsql"
 	"elotus_test/server/cmd"
 	"elotus_test/server/env"
+	"elotus_test/server/envelope"
 	"elotus_test/server/logger"
+	"elotus_test/server/models/account"
+	"elotus_test/server/models/album"
+	"elotus_test/server/models/archive"
+	"elotus_test/server/models/audit"
 	"elotus_test/server/models/auth"
+	"elotus_test/server/models/events"
+	"elotus_test/server/models/janitor"
+	"elotus_test/server/models/jobs"
+	"elotus_test/server/models/share"
+	"elotus_test/server/models/socket"
+	"elotus_test/server/models/stream"
+	"elotus_test/server/models/takeout"
+	"elotus_test/server/models/transform"
 	"elotus_test/server/models/upload"
 	"elotus_test/server/models/user"
+	"elotus_test/server/models/webhook"
 	"elotus_test/server/psql"
 
 	"github.com/labstack/echo/v4"
@@ -29,6 +44,51 @@ type Models struct {
 	jwtService    *auth.JWTService
 	authHandler   *auth.Handler
 	uploadHandler *upload.Handler
+	jobQueue      *jobs.Queue
+
+	eventBus       *events.Bus
+	webhookStore   webhook.Repository
+	webhookHandler *webhook.Handler
+
+	shareStore   share.Repository
+	shareHandler *share.Handler
+
+	albumStore   album.Repository
+	albumHandler *album.Handler
+
+	archiveStore   archive.Repository
+	archiveHandler *archive.Handler
+
+	exportStore   takeout.Repository
+	exportHandler *takeout.Handler
+
+	accountStore   account.Repository
+	accountHandler *account.Handler
+
+	auditStore   audit.Repository
+	auditLog     *audit.Log
+	auditHandler *audit.Handler
+
+	transformHandler *transform.Handler
+
+	streamBroker  *stream.Broker
+	streamHandler *stream.Handler
+
+	socketHub  *socket.Hub
+	socketEcho *echo.Echo
+
+	stopReconcile context.CancelFunc
+	reconcileDone <-chan struct{}
+
+	janitor        *janitor.Janitor
+	janitorHandler *janitor.Handler
+}
+
+// CmdOptions carries the command-line flags shared by -cmd commands
+type CmdOptions struct {
+	DryRun bool
+	UserID int64
+	Output string
 }
 
 type RedisConfig struct {
@@ -84,6 +144,12 @@ func NewModels(cmdMode bool) *Models {
 	logger.Info("📂 Initializing repositories...")
 	m.userStore = user.NewPostgresRepository(m.db)
 	m.uploadStore = upload.NewPostgresRepository(m.db)
+	m.shareStore = share.NewPostgresRepository(m.db)
+	m.albumStore = album.NewPostgresRepository(m.db)
+	m.archiveStore = archive.NewPostgresRepository(m.db)
+	m.exportStore = takeout.NewPostgresRepository(m.db)
+	m.accountStore = account.NewPostgresRepository(m.db)
+	m.auditStore = audit.NewPostgresRepository(m.db)
 	logger.Info("✅ Repositories initialized!")
 
 	logger.Info("")
@@ -101,14 +167,148 @@ func NewModels(cmdMode bool) *Models {
 	logger.Info("🎯 Initializing handlers...")
 	m.authHandler = auth.NewHandler(m.db, m.userStore, m.jwtService, m.bredisClient)
 	m.uploadHandler = upload.NewHandler(m.db, m.uploadStore, m.bredisClient)
+	m.shareHandler = share.NewHandler(m.shareStore, m.uploadStore)
+	m.albumHandler = album.NewHandler(m.albumStore, m.uploadStore)
+	archiveConfig := archive.DefaultConfig()
+	archiveConfig.MaxItems = env.E.GetArchiveMaxItems()
+	archiveConfig.MaxSyncBytes = env.E.GetArchiveMaxSyncBytes()
+	archiveConfig.MaxBytes = env.E.GetArchiveMaxBytes()
+	archiveConfig.LinkTTL = env.E.GetArchiveLinkTTL()
+	archiveConfig.Retention = env.E.GetArchiveRetention()
+	archiveConfig.StorageDir = filepath.Join(cmd.ResolvePath(env.E.GetUploadStoragePath()), "archives")
+	archiveConfig.SigningKey = []byte(env.E.JWTSigningKey)
+	m.archiveHandler = archive.NewHandler(archiveConfig, m.archiveStore, m.uploadStore, m.albumStore)
+	exportConfig := takeout.DefaultConfig()
+	exportConfig.LinkTTL = env.E.GetExportLinkTTL()
+	exportConfig.Retention = env.E.GetExportRetention()
+	exportConfig.StorageDir = filepath.Join(cmd.ResolvePath(env.E.GetUploadStoragePath()), "exports")
+	exportConfig.SigningKey = []byte(env.E.JWTSigningKey)
+	m.exportHandler = takeout.NewHandler(exportConfig, m.exportStore, m.userStore, m.uploadStore)
+	accountConfig := account.DefaultConfig()
+	accountConfig.Grace = env.E.GetAccountDeletionGrace()
+	m.accountHandler = account.NewHandler(accountConfig, m.accountStore, m.userStore, m.uploadStore, m.jwtService)
+	m.accountHandler.OnPurge(revocationStore.Forget)
+	m.accountHandler.OnPurge(m.uploadHandler.Forget)
+	m.auditLog = audit.NewLog(m.auditStore)
+	m.auditHandler = audit.NewHandler(m.auditStore)
+	m.authHandler.SetAuditLog(m.auditLog)
+	m.uploadHandler.SetAuditLog(m.auditLog)
+	m.accountHandler.SetAuditLog(m.auditLog)
+	transformConfig := transform.DefaultConfig()
+	if sizes := env.E.GetTransformSizes(); sizes != nil {
+		transformConfig.Sizes = sizes
+	}
+	transformConfig.StorageDir = filepath.Join(cmd.ResolvePath(env.E.GetUploadStoragePath()), "transforms")
+	transformConfig.SigningKey = []byte(env.E.JWTSigningKey)
+	transformConfig.DecodeMemory = env.E.GetTransformMemory()
+	transformConfig.LinkTTL = env.E.GetTransformLinkTTL()
+	m.transformHandler = transform.NewHandler(transformConfig, m.uploadStore)
+	janitorConfig := janitor.DefaultConfig()
+	janitorConfig.Root = cmd.ResolvePath(env.E.GetUploadStoragePath())
+	janitorConfig.Interval = env.E.GetJanitorInterval()
+	janitorConfig.MinAge = env.E.GetJanitorMinAge()
+	janitorConfig.MaxAge = env.E.GetJanitorMaxAge()
+	janitorConfig.MaxBytes = env.E.GetJanitorMaxBytes()
+	m.janitor = janitor.NewJanitor(janitorConfig, m.uploadStore)
+	m.janitorHandler = janitor.NewHandler(m.janitor)
+	if keyring := loadKeyring(); keyring != nil {
+		m.uploadHandler.SetKeyring(keyring)
+		m.shareHandler.SetKeyring(keyring)
+		m.archiveHandler.SetKeyring(keyring)
+		m.exportHandler.SetKeyring(keyring)
+		m.transformHandler.SetKeyring(keyring)
+		logger.Infof("   Upload encryption: AES-256-GCM (key %s)", keyring.PrimaryID())
+	}
+	if addr := env.E.GetScannerAddress(); addr != "" {
+		network, address := upload.ParseScannerAddress(addr)
+		m.uploadHandler.SetScanner(upload.NewClamdScanner(network, address, env.E.GetScannerTimeout()))
+		logger.Infof("   Upload scanner: clamd (%s %s)", network, address)
+	}
 	logger.Info("✅ Handlers initialized!")
 
+	if workers := env.E.GetJobWorkers(); workers > 0 {
+		logger.Info("")
+		logger.Info("⚙️  Initializing job queue...")
+		jobConfig := jobs.DefaultConfig()
+		jobConfig.Workers = workers
+		jobConfig.PollInterval = env.E.GetJobPollInterval()
+		jobConfig.MaxAttempts = env.E.GetJobMaxAttempts()
+		jobConfig.LockTimeout = env.E.GetJobLockTimeout()
+		m.jobQueue = jobs.NewQueue(jobConfig, jobs.NewPostgresRepository(m.db))
+		m.uploadHandler.SetJobQueue(m.jobQueue)
+		m.archiveHandler.SetJobQueue(m.jobQueue)
+		m.exportHandler.SetJobQueue(m.jobQueue)
+		m.accountHandler.SetJobQueue(m.jobQueue)
+		logger.Infof("   Workers: %d", workers)
+		logger.Infof("   Max Attempts: %d", jobConfig.MaxAttempts)
+		logger.Info("✅ Job queue initialized!")
+	}
+
+	logger.Info("")
+	logger.Info("🪝 Initializing webhooks...")
+	m.eventBus = events.NewBus()
+	m.webhookStore = webhook.NewPostgresRepository(m.db)
+	for _, g := range env.E.GetGlobalWebhooks() {
+		if err := webhook.ValidateURL(g.URL); err != nil {
+			logger.Warnf("⚠️  Skipping global webhook %s: %v", g.URL, err)
+			continue
+		}
+		if err := webhook.ValidateEvents(g.Events); err != nil {
+			logger.Warnf("⚠️  Skipping global webhook %s: %v", g.URL, err)
+			continue
+		}
+		err := m.webhookStore.SyncGlobalSubscription(&webhook.Subscription{URL: g.URL, Secret: g.Secret, Events: g.Events})
+		if err != nil {
+			logger.Errorf("Failed to register global webhook %s: %v", g.URL, err)
+		}
+	}
+	client := webhook.NewClient(env.E.GetWebhookTimeout(), env.E.AllowWebhookPrivateIP())
+	dispatcher := webhook.NewDispatcher(m.webhookStore, m.jobQueue, client)
+	m.eventBus.Subscribe(dispatcher.HandleEvent)
+	m.webhookHandler = webhook.NewHandler(m.webhookStore, dispatcher)
+	m.authHandler.SetEventBus(m.eventBus)
+	m.uploadHandler.SetEventBus(m.eventBus)
+	m.accountHandler.SetEventBus(m.eventBus)
+	m.eventBus.Subscribe(m.transformHandler.HandleEvent)
+	logger.Infof("   Global subscriptions: %d", len(env.E.GetGlobalWebhooks()))
+	logger.Info("✅ Webhooks initialized!")
+
+	logger.Info("")
+	logger.Info("📡 Initializing event stream...")
+	streamConfig := stream.DefaultConfig()
+	streamConfig.Heartbeat = env.E.GetStreamHeartbeat()
+	streamConfig.HistorySize = env.E.GetStreamHistorySize()
+	streamConfig.HistoryTTL = env.E.GetStreamHistoryTTL()
+	m.streamBroker = stream.NewBroker(streamConfig, m.bredisClient)
+	m.eventBus.Subscribe(m.streamBroker.HandleEvent)
+	m.streamHandler = stream.NewHandler(m.streamBroker)
+	m.accountHandler.OnPurge(m.streamBroker.Forget)
+	m.uploadHandler.SetStreamBroker(m.streamBroker)
+	logger.Infof("   Heartbeat: %s", streamConfig.Heartbeat)
+	logger.Infof("   History: %d events for %s", streamConfig.HistorySize, streamConfig.HistoryTTL)
+	logger.Info("✅ Event stream initialized!")
+
+	logger.Info("")
+	logger.Info("🔌 Initializing WebSocket hub...")
+	socketConfig := socket.DefaultConfig()
+	socketConfig.Heartbeat = env.E.GetStreamHeartbeat()
+	m.socketHub = socket.NewHub(socketConfig, m.streamBroker, m.jwtService.ValidateToken)
+	revocationStore.OnRevoke(m.socketHub.RevokeUser)
+	logger.Infof("   Heartbeat: %s", socketConfig.Heartbeat)
+	logger.Info("✅ WebSocket hub initialized!")
+
 	logger.Info("")
 	logger.Info("════════════════════════════════════════════════════════")
 	logger.Info("✅ Server initialization completed!")
 	logger.Info("════════════════════════════════════════════════════════")
 
 	if !cmdMode {
+		if m.jobQueue != nil {
+			m.jobQueue.Start()
+		}
+		m.startReconcile()
+		m.startJanitor()
+		m.streamBroker.Start()
 		m.SetupRoutes()
 	}
 
@@ -169,8 +369,123 @@ func (m *Models) initRedis() *bredis.Client {
 	return client
 }
 
-func (m *Models) RunCmd(c string) {
+// loadKeyring builds the envelope-encryption keyring from config, or returns nil when encryption is off
+func loadKeyring() *envelope.Keyring {
+	config := env.E.GetEncryption()
+	if config == nil {
+		return nil
+	}
+
+	load := func(k env.EncryptionKey) envelope.MasterKey {
+		file := k.MasterKeyFile
+		if file != "" {
+			file = cmd.ResolvePath(file)
+		}
+		key, err := envelope.LoadKey(k.MasterKey, file)
+		if err != nil {
+			logger.Fatalf("Failed to load encryption key %q: %v", k.KeyID, err)
+		}
+		return envelope.MasterKey{ID: k.KeyID, Key: key}
+	}
+
+	primary := load(config.EncryptionKey)
+	var previous []envelope.MasterKey
+	for _, k := range config.PreviousKeys {
+		previous = append(previous, load(k))
+	}
+
+	keyring, err := envelope.NewKeyring(primary, previous...)
+	if err != nil {
+		logger.Fatalf("Invalid encryption keys: %v", err)
+	}
+	return keyring
+}
+
+func (m *Models) startReconcile() {
+	interval := env.E.GetReconcileInterval()
+	if interval <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.stopReconcile = cancel
+	m.reconcileDone = m.uploadHandler.RunPeriodicReconcile(ctx, interval, upload.ReconcileOptions{
+		DryRun:          !env.E.ReconcileFix(),
+		VerifyChecksums: env.E.ReconcileVerifyChecksums(),
+		GracePeriod:     env.E.GetReconcileGracePeriod(),
+	})
+	logger.Infof("🧹 Upload reconciliation every %v (fix: %v)", interval, env.E.ReconcileFix())
+}
+
+func (m *Models) startJanitor() {
+	interval := env.E.GetJanitorInterval()
+	if interval <= 0 {
+		return
+	}
+	m.janitor.Start()
+	logger.Infof("🧹 Temp file janitor every %v (max age: %v, max size: %d MB)",
+		interval, env.E.GetJanitorMaxAge(), env.E.GetJanitorMaxBytes()/(1024*1024))
+}
+
+func (m *Models) RunCmd(c string, opts CmdOptions) {
 	switch c {
+	case "reconcile-uploads":
+		report, err := m.uploadHandler.ReconcileUploads(context.Background(), upload.ReconcileOptions{
+			DryRun: opts.DryRun,
+			// Run by hand, so always verify contents
+			VerifyChecksums: true,
+			GracePeriod:     env.E.GetReconcileGracePeriod(),
+		})
+		if report != nil {
+			report.WriteSummary(os.Stdout)
+		}
+		if err != nil {
+			logger.Fatalf("Reconciliation failed: %v", err)
+		}
+	case "clean-tmp":
+		report, err := m.janitor.Run(context.Background(), opts.DryRun)
+		if report != nil {
+			report.WriteSummary(os.Stdout)
+		}
+		if err != nil {
+			logger.Fatalf("Temp file cleanup failed: %v", err)
+		}
+	case "export-user":
+		if opts.UserID <= 0 {
+			logger.Fatalf("export-user requires -user-id")
+		}
+		output := opts.Output
+		if output == "" {
+			output = fmt.Sprintf("export-user-%d.zip", opts.UserID)
+		}
+		if err := m.exportHandler.WriteExportFile(context.Background(), output, opts.UserID); err != nil {
+			logger.Fatalf("Export failed: %v", err)
+		}
+		logger.Infof("Exported user %d to %s", opts.UserID, output)
+	case "purge-accounts":
+		purged, err := m.accountHandler.PurgeDue(context.Background())
+		logger.Infof("Purged %d accounts past their deletion grace period", purged)
+		if err != nil {
+			logger.Fatalf("Account purge failed: %v", err)
+		}
+	case "verify-audit":
+		report, err := audit.Verify(context.Background(), m.auditStore)
+		if report != nil {
+			report.WriteSummary(os.Stdout)
+		}
+		if err != nil {
+			logger.Fatalf("Audit verification failed: %v", err)
+		}
+		if !report.OK() {
+			logger.Fatalf("Audit chain is broken at %d events", len(report.Breaks))
+		}
+	case "rotate-encryption-key":
+		report, err := m.uploadHandler.RotateEncryptionKeys(context.Background(), opts.DryRun)
+		if err != nil {
+			logger.Fatalf("Key rotation failed: %v", err)
+		}
+		logger.Infof("Re-wrapped %d data keys under %q (already current: %d, plaintext: %d, errors: %d, dry run: %v)",
+			report.Rewrapped, env.E.GetEncryption().KeyID, report.Current, report.Plaintext, report.Errors, report.DryRun)
 	default:
 		logger.Warnf("Unknown command: %s", c)
 	}
@@ -179,6 +494,19 @@ func (m *Models) RunCmd(c string) {
 func (m *Models) Shutdown(ctx context.Context) error {
 	logger.Info("Closing connections...")
 
+	// Open event streams never finish on their own, so end them before the server waits on connections
+	if m.streamBroker != nil {
+		m.streamBroker.Close()
+	}
+
+	if m.socketEcho != nil {
+		m.socketHub.Close()
+		if err := m.socketEcho.Shutdown(ctx); err != nil {
+			logger.Errorf("Error shutting down socket server: %v", err)
+		}
+		logger.Info("✅ Socket server stopped")
+	}
+
 	if m.echo != nil {
 		if err := m.echo.Shutdown(ctx); err != nil {
 			logger.Errorf("Error shutting down HTTP server: %v", err)
@@ -186,6 +514,25 @@ func (m *Models) Shutdown(ctx context.Context) error {
 		logger.Info("✅ HTTP server stopped")
 	}
 
+	if m.stopReconcile != nil {
+		m.stopReconcile()
+		<-m.reconcileDone
+	}
+
+	if m.janitor != nil {
+		m.janitor.Stop()
+		stats := m.janitor.Stats()
+		logger.Infof("✅ Janitor stopped (reclaimed %d files, %d bytes)", stats.FilesReclaimed, stats.BytesReclaimed)
+	}
+
+	// Workers finish their current job before the connections they use are closed
+	if m.jobQueue != nil {
+		if err := m.jobQueue.Shutdown(ctx); err != nil {
+			logger.Errorf("Error draining job queue: %v", err)
+		}
+		logger.Info("✅ Job queue drained")
+	}
+
 	if m.bredisClient != nil {
 		if err := m.bredisClient.Close(); err != nil {
 			logger.Errorf("Error closing Redis: %v", err)
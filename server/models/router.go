@@ -10,6 +10,7 @@ import (
 	"elotus_test/server/env"
 	"elotus_test/server/logger"
 	custommiddleware "elotus_test/server/middleware"
+	"elotus_test/server/models/auth"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -42,8 +43,13 @@ func (m *Models) SetupRoutes() {
 
 	e.GET("/config.js", configHandler)
 
-	mediaPath := cmd.ResolvePath("tmp")
-	e.Static("/media", mediaPath)
+	e.GET("/media/*", m.uploadHandler.ServeMedia)
+	e.GET("/s/:token", m.shareHandler.Serve, custommiddleware.RateLimitByIP(m.bredisClient, 60, time.Minute))
+	e.GET("/archives/:id/download", m.archiveHandler.Download, custommiddleware.RateLimitByIP(m.bredisClient, 60, time.Minute))
+	e.GET("/exports/:id/download", m.exportHandler.Download, custommiddleware.RateLimitByIP(m.bredisClient, 60, time.Minute))
+
+	// Signed like archive links so variants can be embedded without a bearer token
+	e.GET("/api/uploads/:id/transform", m.transformHandler.Serve, custommiddleware.RateLimitByIP(m.bredisClient, 300, time.Minute))
 
 	e.POST("/upload", m.uploadHandler.Upload, jwtMiddleware)
 
@@ -52,9 +58,56 @@ func (m *Models) SetupRoutes() {
 	{
 		protected.POST("/revoke", m.authHandler.RevokeToken)
 		protected.GET("/protected", m.authHandler.Protected)
+		protected.DELETE("/me", m.accountHandler.DeleteAccount, authRateLimit)
+		protected.GET("/me/deletion", m.accountHandler.GetDeletion)
+		protected.DELETE("/me/deletion", m.accountHandler.CancelDeletion)
+		protected.POST("/me/export", m.exportHandler.RequestExport)
+		protected.GET("/me/exports/:id", m.exportHandler.GetExport)
+		protected.GET("/events", m.streamHandler.Events)
 		protected.POST("/upload", m.uploadHandler.Upload)
+		protected.POST("/uploads/batch", m.uploadHandler.UploadBatch)
+		protected.POST("/uploads/from-url", m.uploadHandler.ImportFromURL)
 		protected.GET("/uploads", m.uploadHandler.GetUserUploads)
+		protected.GET("/uploads/search", m.uploadHandler.SearchUploads)
+		protected.GET("/uploads/progress/:uploadId", m.uploadHandler.UploadProgress)
+		protected.POST("/uploads/archive", m.archiveHandler.CreateArchive)
 		protected.GET("/uploads/:id", m.uploadHandler.GetUploadByID)
+		protected.PATCH("/uploads/:id", m.uploadHandler.UpdateUpload)
+		protected.DELETE("/uploads/:id", m.uploadHandler.DeleteUpload)
+		protected.PUT("/uploads/:id/tags", m.uploadHandler.SetTags)
+		protected.PUT("/uploads/:id/caption", m.uploadHandler.SetCaption)
+		protected.GET("/uploads/:id/similar", m.uploadHandler.SimilarUploads)
+		protected.POST("/uploads/:id/transform-url", m.transformHandler.SignURL)
+		protected.POST("/uploads/:id/shares", m.shareHandler.CreateShare)
+		protected.GET("/uploads/:id/shares", m.shareHandler.ListShares)
+		protected.DELETE("/uploads/:id/shares/:shareId", m.shareHandler.RevokeShare)
+
+		protected.POST("/albums", m.albumHandler.CreateAlbum)
+		protected.GET("/albums", m.albumHandler.ListAlbums)
+		protected.GET("/albums/:id", m.albumHandler.GetAlbum)
+		protected.PATCH("/albums/:id", m.albumHandler.UpdateAlbum)
+		protected.DELETE("/albums/:id", m.albumHandler.DeleteAlbum)
+		protected.GET("/albums/:id/items", m.albumHandler.ListItems)
+		protected.POST("/albums/:id/items", m.albumHandler.AddItems)
+		protected.PUT("/albums/:id/items/order", m.albumHandler.ReorderItems)
+		protected.DELETE("/albums/:id/items/:uploadId", m.albumHandler.RemoveItem)
+
+		protected.GET("/archives/:id", m.archiveHandler.GetArchive)
+
+		protected.POST("/webhooks", m.webhookHandler.CreateSubscription)
+		protected.GET("/webhooks", m.webhookHandler.ListSubscriptions)
+		protected.DELETE("/webhooks/:id", m.webhookHandler.DeleteSubscription)
+		protected.GET("/webhooks/:id/deliveries", m.webhookHandler.ListDeliveries)
+		protected.POST("/webhooks/:id/deliveries/:deliveryId/replay", m.webhookHandler.ReplayDelivery)
+	}
+
+	admin := e.Group("/api/admin")
+	admin.Use(jwtMiddleware, auth.RequireAdmin(env.E.IsAdmin))
+	{
+		admin.DELETE("/users/:id", m.accountHandler.AdminDeleteUser)
+		admin.DELETE("/users/:id/deletion", m.accountHandler.AdminCancelDeletion)
+		admin.GET("/audit", m.auditHandler.ListEvents)
+		admin.GET("/janitor", m.janitorHandler.GetStats)
 	}
 
 	htmlPath := cmd.ResolvePath("html")
@@ -69,9 +122,49 @@ func (m *Models) SetupRoutes() {
 	logger.Info("  POST /upload        - Upload image (requires auth, field: 'data')")
 	logger.Info("  POST /api/revoke    - Revoke tokens (requires auth)")
 	logger.Info("  GET  /api/protected - Protected endpoint (requires auth)")
+	logger.Info("  DELETE /api/me      - Schedule deletion of your account (requires auth and password)")
+	logger.Info("  GET|DELETE /api/me/deletion - Scheduled account deletion status, or cancel it (requires auth)")
+	logger.Info("  POST /api/me/export - Export all of your data as a ZIP (requires auth)")
+	logger.Info("  GET  /api/me/exports/:id - Data export status and download link (requires auth)")
+	logger.Info("  GET  /api/events    - Server-sent event stream, resumable with Last-Event-ID (requires auth)")
 	logger.Info("  POST /api/upload    - Upload image file (requires auth, max 8MB)")
-	logger.Info("  GET  /api/uploads   - Get all uploads for user (requires auth)")
+	logger.Info("  POST /api/uploads/batch - Upload multiple images (requires auth, field: 'data')")
+	logger.Info("  POST /api/uploads/from-url - Import image from a remote URL (requires auth)")
+	logger.Info("  GET  /api/uploads   - Get uploads for user, paginated (requires auth)")
+	logger.Info("  GET  /api/uploads/search - Full-text search over uploads with tag facets (requires auth)")
+	logger.Info("  GET  /api/uploads/progress/:uploadId - Progress of an upload sent with X-Upload-ID, JSON or SSE (requires auth)")
+	logger.Info("  POST /api/uploads/archive - Export uploads as a ZIP (requires auth)")
 	logger.Info("  GET  /api/uploads/:id - Get specific upload (requires auth)")
+	logger.Info("  PATCH /api/uploads/:id - Edit display name, caption, alt text, visibility (requires auth, If-Match)")
+	logger.Info("  DELETE /api/uploads/:id - Delete an upload (requires auth)")
+	logger.Info("  PUT  /api/uploads/:id/tags - Replace upload tags (requires auth)")
+	logger.Info("  PUT  /api/uploads/:id/caption - Set upload caption (requires auth)")
+	logger.Info("  GET  /api/uploads/:id/similar - Visually similar uploads (requires auth)")
+	logger.Info("  POST /api/uploads/:id/transform-url - Sign a resize/crop URL (requires auth)")
+	logger.Info("  GET  /api/uploads/:id/transform - Resized variant (signed, no auth)")
+	logger.Info("  POST /api/uploads/:id/shares - Create share link (requires auth)")
+	logger.Info("  GET  /api/uploads/:id/shares - List share links (requires auth)")
+	logger.Info("  DELETE /api/uploads/:id/shares/:shareId - Revoke share link (requires auth)")
+	logger.Info("  POST /api/albums    - Create album (requires auth)")
+	logger.Info("  GET  /api/albums    - List albums, paginated (requires auth)")
+	logger.Info("  GET|PATCH|DELETE /api/albums/:id - Get, update or delete album (requires auth)")
+	logger.Info("  GET|POST /api/albums/:id/items - List or add album items (requires auth)")
+	logger.Info("  PUT  /api/albums/:id/items/order - Reorder album items (requires auth)")
+	logger.Info("  DELETE /api/albums/:id/items/:uploadId - Remove item from album (requires auth)")
+	logger.Info("  GET  /api/archives/:id - Archive export status and download link (requires auth)")
+	logger.Info("  POST /api/webhooks  - Create webhook subscription (requires auth)")
+	logger.Info("  GET  /api/webhooks  - List webhook subscriptions (requires auth)")
+	logger.Info("  DELETE /api/webhooks/:id - Delete webhook subscription (requires auth)")
+	logger.Info("  GET  /api/webhooks/:id/deliveries - Webhook delivery log (requires auth)")
+	logger.Info("  POST /api/webhooks/:id/deliveries/:deliveryId/replay - Replay failed delivery (requires auth)")
+	logger.Info("  DELETE /api/admin/users/:id - Schedule or run deletion of an account (requires admin)")
+	logger.Info("  DELETE /api/admin/users/:id/deletion - Cancel a scheduled account deletion (requires admin)")
+	logger.Info("  GET  /api/admin/audit - Query the audit trail (requires admin)")
+	logger.Info("  GET  /api/admin/janitor - Temp file janitor totals (requires admin)")
+	logger.Info("  GET  /media/*       - Serve scanned-clean uploads")
+	logger.Info("  GET  /s/:token      - Open a public share link")
+	logger.Info("  GET  /archives/:id/download - Download an archive via signed link")
+	logger.Info("  GET  /exports/:id/download - Download a data export via signed link")
 	logger.Info("  GET  /health        - Health check")
 
 	go func() {
@@ -79,6 +172,33 @@ func (m *Models) SetupRoutes() {
 			logger.Errorf("Server stopped: %v", err)
 		}
 	}()
+
+	m.setupSocketServer(jwtMiddleware)
+}
+
+// setupSocketServer serves WebSockets on their own listener when host_socket is set
+func (m *Models) setupSocketServer(jwtMiddleware echo.MiddlewareFunc) {
+	socketAddr := env.E.GetSocketHost()
+	if socketAddr == "" {
+		return
+	}
+
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	m.socketEcho = e
+
+	e.Use(custommiddleware.RecoverWithLogger())
+	e.GET("/ws", m.socketHub.Connect, custommiddleware.TokenFromQuery("token"), jwtMiddleware)
+
+	logger.Infof("Socket server starting on %s...", socketAddr)
+	logger.Info("  GET  /ws            - WebSocket notifications (requires auth, header or ?token=)")
+
+	go func() {
+		if err := e.Start(socketAddr); err != nil && err.Error() != "http: Server closed" {
+			logger.Errorf("Socket server stopped: %v", err)
+		}
+	}()
 }
 
 func configHandler(c echo.Context) error {
@@ -0,0 +1,270 @@
+package share
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"time"
+
+	"elotus_test/server/envelope"
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/upload"
+	"elotus_test/server/response"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// HeaderPassword carries the password for protected share links
+const HeaderPassword = "X-Share-Password"
+
+const (
+	minPasswordLength = 4
+	maxPasswordLength = 72 // bcrypt ignores anything longer
+)
+
+var timeNow = time.Now
+
+type Handler struct {
+	shareRepo  Repository
+	uploadRepo upload.Repository
+	keyring    *envelope.Keyring
+}
+
+func NewHandler(shareRepo Repository, uploadRepo upload.Repository) *Handler {
+	return &Handler{
+		shareRepo:  shareRepo,
+		uploadRepo: uploadRepo,
+	}
+}
+
+// SetKeyring lets shared links serve uploads that were stored encrypted
+func (h *Handler) SetKeyring(keyring *envelope.Keyring) {
+	h.keyring = keyring
+}
+
+type CreateShareRequest struct {
+	// ExpiresIn is a lifetime in seconds; ExpiresAt wins when both are set
+	ExpiresIn int        `json:"expires_in,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	MaxViews  *int       `json:"max_views,omitempty"`
+	Password  string     `json:"password,omitempty"`
+}
+
+func shareDetails(s *Share) echo.Map {
+	status := "active"
+	if err := s.Check(timeNow()); err != nil {
+		status = map[error]string{
+			ErrShareRevoked:   "revoked",
+			ErrShareExpired:   "expired",
+			ErrShareExhausted: "exhausted",
+		}[err]
+	}
+
+	return echo.Map{
+		"id":             s.ID,
+		"upload_id":      s.UploadID,
+		"token_hint":     s.TokenHint,
+		"has_password":   s.HasPassword(),
+		"expires_at":     s.ExpiresAt,
+		"max_views":      s.MaxViews,
+		"view_count":     s.ViewCount,
+		"status":         status,
+		"revoked_at":     s.RevokedAt,
+		"last_viewed_at": s.LastViewedAt,
+		"created_at":     s.CreatedAt,
+	}
+}
+
+func (h *Handler) CreateShare(c echo.Context) error {
+	file, err := h.ownedUpload(c)
+	if file == nil {
+		return err
+	}
+
+	var req CreateShareRequest
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	now := timeNow()
+	expiresAt := req.ExpiresAt
+	if expiresAt == nil && req.ExpiresIn != 0 {
+		if req.ExpiresIn < 0 {
+			return response.ValidationError(c, "expires_in must be positive")
+		}
+		t := now.Add(time.Duration(req.ExpiresIn) * time.Second)
+		expiresAt = &t
+	}
+	if expiresAt != nil && !expiresAt.After(now) {
+		return response.ValidationError(c, "expires_at must be in the future")
+	}
+	if req.MaxViews != nil && *req.MaxViews < 1 {
+		return response.ValidationError(c, "max_views must be at least 1")
+	}
+
+	var passwordHash string
+	if req.Password != "" {
+		if len(req.Password) < minPasswordLength || len(req.Password) > maxPasswordLength {
+			return response.ValidationError(c, fmt.Sprintf("password must be between %d and %d characters", minPasswordLength, maxPasswordLength))
+		}
+		hashed, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return response.InternalError(c, "Failed to process password")
+		}
+		passwordHash = string(hashed)
+	}
+
+	token, tokenHash, err := NewToken()
+	if err != nil {
+		return response.InternalError(c, "Failed to generate share token")
+	}
+
+	saved, err := h.shareRepo.CreateShare(&Share{
+		UploadID:     file.ID,
+		UserID:       file.UserID,
+		TokenHash:    tokenHash,
+		TokenHint:    token[:6],
+		PasswordHash: passwordHash,
+		ExpiresAt:    expiresAt,
+		MaxViews:     req.MaxViews,
+	})
+	if err != nil {
+		return response.InternalError(c, "Failed to create share")
+	}
+
+	// The token itself is never stored, so this is the only time it is returned
+	data := shareDetails(saved)
+	data["token"] = token
+	data["url"] = "/s/" + token
+	return response.Created(c, data)
+}
+
+func (h *Handler) ListShares(c echo.Context) error {
+	file, err := h.ownedUpload(c)
+	if file == nil {
+		return err
+	}
+
+	shares, err := h.shareRepo.ListSharesByUpload(file.ID)
+	if err != nil {
+		return response.InternalError(c, "Failed to get shares")
+	}
+
+	list := make([]echo.Map, 0, len(shares))
+	for _, s := range shares {
+		list = append(list, shareDetails(s))
+	}
+
+	return response.SuccessWithMeta(c, list, &response.Meta{Total: len(list)})
+}
+
+func (h *Handler) RevokeShare(c echo.Context) error {
+	file, err := h.ownedUpload(c)
+	if file == nil {
+		return err
+	}
+
+	var shareID int64
+	fmt.Sscanf(c.Param("shareId"), "%d", &shareID)
+
+	s, found := h.shareRepo.GetShareByID(shareID)
+	if !found || s.UploadID != file.ID {
+		return response.NotFound(c, "Share not found")
+	}
+
+	if err := h.shareRepo.RevokeShare(s.ID); err != nil {
+		return response.InternalError(c, "Failed to revoke share")
+	}
+
+	return response.Success(c, echo.Map{
+		"message": "Share revoked",
+		"id":      s.ID,
+	})
+}
+
+// Serve is the public endpoint behind a share link
+func (h *Handler) Serve(c echo.Context) error {
+	s, found := h.shareRepo.GetShareByTokenHash(HashToken(c.Param("token")))
+	if !found {
+		return response.NotFound(c, "Share not found")
+	}
+	if err := s.Check(timeNow()); err != nil {
+		return shareGone(c, err)
+	}
+
+	if s.HasPassword() {
+		password := c.Request().Header.Get(HeaderPassword)
+		if password == "" {
+			return response.Error(c, http.StatusUnauthorized, response.ErrCodeSharePasswordRequired, "This share link requires a password")
+		}
+		if bcrypt.CompareHashAndPassword([]byte(s.PasswordHash), []byte(password)) != nil {
+			return response.Error(c, http.StatusUnauthorized, response.ErrCodeSharePasswordInvalid, "Incorrect share password")
+		}
+	}
+
+	file, found := h.uploadRepo.GetFileUploadByID(s.UploadID)
+	if !found || file.Status != upload.StatusClean {
+		return response.NotFound(c, "Share not found")
+	}
+
+	counted, err := h.shareRepo.RecordView(s.ID)
+	if err != nil {
+		log.Printf("[Share] Error recording view for share %d: %v", s.ID, err)
+		return response.InternalError(c, "Failed to open share")
+	}
+	if !counted {
+		// Another request used the last view (or the share changed) since we loaded it
+		if latest, ok := h.shareRepo.GetShareByID(s.ID); ok {
+			if err := latest.Check(timeNow()); err != nil {
+				return shareGone(c, err)
+			}
+		}
+		return shareGone(c, ErrShareExhausted)
+	}
+
+	header := c.Response().Header()
+	header.Set("Cache-Control", "private, no-store")
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("X-Robots-Tag", "noindex")
+	header.Set("Content-Type", file.ContentType)
+	header.Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": file.OriginalFilename}))
+
+	blob, err := upload.OpenBlob(h.keyring, file)
+	if err != nil {
+		log.Printf("[Share] Error opening upload %d: %v", file.ID, err)
+		return response.NotFound(c, "Share not found")
+	}
+	defer blob.Close()
+
+	http.ServeContent(c.Response(), c.Request(), file.Filename, file.CreatedAt, blob)
+	return nil
+}
+
+func shareGone(c echo.Context, err error) error {
+	code := map[error]string{
+		ErrShareRevoked:   response.ErrCodeShareRevoked,
+		ErrShareExpired:   response.ErrCodeShareExpired,
+		ErrShareExhausted: response.ErrCodeShareExhausted,
+	}[err]
+	return response.Error(c, http.StatusGone, code, err.Error())
+}
+
+// ownedUpload loads the :id upload for the current user. A nil upload means
+// the error response has already been written.
+func (h *Handler) ownedUpload(c echo.Context) (*upload.FileUpload, error) {
+	claims := c.Get("user").(*auth.TokenClaims)
+
+	var id int64
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	u, found := h.uploadRepo.GetFileUploadByID(id)
+	if !found {
+		return nil, response.NotFound(c, "Upload not found")
+	}
+	if u.UserID != claims.UserID {
+		return nil, response.Forbidden(c, "Access denied")
+	}
+	return u, nil
+}
@@ -0,0 +1,146 @@
+package share
+
+import (
+	"database/sql"
+	"time"
+
+	"elotus_test/server/bsql"
+)
+
+type PostgresRepository struct {
+	db *bsql.DB
+}
+
+func NewPostgresRepository(db *bsql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+const shareColumns = `id, upload_id, user_id, token_hash, token_hint, password_hash,
+		expires_at, max_views, view_count, revoked_at, last_viewed_at, created_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanShare(row rowScanner) (*Share, error) {
+	s := &Share{}
+	var passwordHash sql.NullString
+	var expiresAt, revokedAt, lastViewedAt sql.NullTime
+	var maxViews sql.NullInt64
+
+	err := row.Scan(
+		&s.ID,
+		&s.UploadID,
+		&s.UserID,
+		&s.TokenHash,
+		&s.TokenHint,
+		&passwordHash,
+		&expiresAt,
+		&maxViews,
+		&s.ViewCount,
+		&revokedAt,
+		&lastViewedAt,
+		&s.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	s.PasswordHash = passwordHash.String
+	if expiresAt.Valid {
+		s.ExpiresAt = &expiresAt.Time
+	}
+	if maxViews.Valid {
+		n := int(maxViews.Int64)
+		s.MaxViews = &n
+	}
+	if revokedAt.Valid {
+		s.RevokedAt = &revokedAt.Time
+	}
+	if lastViewedAt.Valid {
+		s.LastViewedAt = &lastViewedAt.Time
+	}
+	return s, nil
+}
+
+func (r *PostgresRepository) CreateShare(s *Share) (*Share, error) {
+	err := r.db.QueryRow(`
+		INSERT INTO upload_shares (upload_id, user_id, token_hash, token_hint, password_hash, expires_at, max_views, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at`,
+		s.UploadID,
+		s.UserID,
+		s.TokenHash,
+		s.TokenHint,
+		sql.NullString{String: s.PasswordHash, Valid: s.PasswordHash != ""},
+		s.ExpiresAt,
+		s.MaxViews,
+		time.Now(),
+	).Scan(&s.ID, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (r *PostgresRepository) GetShareByID(id int64) (*Share, bool) {
+	s, err := scanShare(r.db.QueryRow(`SELECT `+shareColumns+` FROM upload_shares WHERE id = $1`, id))
+	if err != nil {
+		return nil, false
+	}
+	return s, true
+}
+
+func (r *PostgresRepository) GetShareByTokenHash(tokenHash string) (*Share, bool) {
+	s, err := scanShare(r.db.QueryRow(`SELECT `+shareColumns+` FROM upload_shares WHERE token_hash = $1`, tokenHash))
+	if err != nil {
+		return nil, false
+	}
+	return s, true
+}
+
+func (r *PostgresRepository) ListSharesByUpload(uploadID int64) ([]*Share, error) {
+	rows, err := r.db.Query(`
+		SELECT `+shareColumns+`
+		FROM upload_shares
+		WHERE upload_id = $1
+		ORDER BY created_at DESC`, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []*Share
+	for rows.Next() {
+		s, err := scanShare(rows)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, s)
+	}
+	return shares, rows.Err()
+}
+
+func (r *PostgresRepository) RevokeShare(id int64) error {
+	_, err := r.db.Exec(`UPDATE upload_shares SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`, id)
+	return err
+}
+
+func (r *PostgresRepository) RecordView(id int64) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE upload_shares SET
+			view_count = view_count + 1,
+			last_viewed_at = NOW()
+		WHERE id = $1
+			AND revoked_at IS NULL
+			AND (expires_at IS NULL OR expires_at > NOW())
+			AND (max_views IS NULL OR view_count < max_views)`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
@@ -0,0 +1,76 @@
+package share
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+type Share struct {
+	ID           int64      `json:"id"`
+	UploadID     int64      `json:"upload_id"`
+	UserID       int64      `json:"user_id"`
+	TokenHash    string     `json:"-"`
+	TokenHint    string     `json:"token_hint"`
+	PasswordHash string     `json:"-"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	MaxViews     *int       `json:"max_views,omitempty"`
+	ViewCount    int        `json:"view_count"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	LastViewedAt *time.Time `json:"last_viewed_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+func (s *Share) HasPassword() bool {
+	return s.PasswordHash != ""
+}
+
+// Check reports why a share can no longer be used, or nil if it can
+func (s *Share) Check(now time.Time) error {
+	switch {
+	case s.RevokedAt != nil:
+		return ErrShareRevoked
+	case s.ExpiresAt != nil && !now.Before(*s.ExpiresAt):
+		return ErrShareExpired
+	case s.MaxViews != nil && s.ViewCount >= *s.MaxViews:
+		return ErrShareExhausted
+	}
+	return nil
+}
+
+type Repository interface {
+	CreateShare(share *Share) (*Share, error)
+	GetShareByID(id int64) (*Share, bool)
+	GetShareByTokenHash(tokenHash string) (*Share, bool)
+	ListSharesByUpload(uploadID int64) ([]*Share, error)
+	RevokeShare(id int64) error
+	// RecordView counts a view only while the share is still usable, so concurrent
+	// requests cannot push it past its view limit. It returns false otherwise.
+	RecordView(id int64) (bool, error)
+}
+
+var (
+	ErrShareRevoked   = errors.New("share link has been revoked")
+	ErrShareExpired   = errors.New("share link has expired")
+	ErrShareExhausted = errors.New("share link has reached its view limit")
+)
+
+const tokenBytes = 32
+
+// NewToken returns a random URL-safe token and the hash that is stored in its place
+func NewToken() (token, hash string, err error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
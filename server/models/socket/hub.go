@@ -0,0 +1,315 @@
+package socket
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/events"
+	"elotus_test/server/models/stream"
+	"elotus_test/server/response"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// MessageEvent carries a streamed event in Data
+	MessageEvent = "event"
+	// MessagePing is sent by clients; the server answers with MessagePong and the same ID
+	MessagePing      = "ping"
+	MessagePong      = "pong"
+	MessageHeartbeat = "heartbeat"
+	// MessageRevoked and MessageExpired are sent just before the server closes the socket
+	MessageRevoked = "revoked"
+	MessageExpired = "expired"
+	MessageError   = "error"
+)
+
+var ErrHubClosed = errors.New("socket server is shutting down")
+
+// Message is the JSON envelope for every frame in either direction
+type Message struct {
+	Type string      `json:"type"`
+	ID   string      `json:"id,omitempty"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+type ValidateFunc func(token string) (*auth.TokenClaims, error)
+
+type Config struct {
+	Heartbeat    time.Duration
+	WriteTimeout time.Duration
+	// MaxMessageSize bounds client frames; clients only ever send pings
+	MaxMessageSize int
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Heartbeat:      25 * time.Second,
+		WriteTimeout:   10 * time.Second,
+		MaxMessageSize: 4096,
+	}
+}
+
+type client struct {
+	userID int64
+	token  string
+	// recheck asks the connection to validate its token again
+	recheck chan struct{}
+}
+
+// Hub serves WebSocket connections that receive the same events as the SSE
+// stream. Each connection subscribes to the stream broker, so events raised
+// on other replicas arrive through Redis like they do for SSE.
+type Hub struct {
+	config   *Config
+	broker   *stream.Broker
+	validate ValidateFunc
+
+	mu      sync.Mutex
+	clients map[int64]map[*client]struct{}
+	closed  bool
+	done    chan struct{}
+	active  sync.WaitGroup
+}
+
+func NewHub(config *Config, broker *stream.Broker, validate ValidateFunc) *Hub {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	return &Hub{
+		config:   config,
+		broker:   broker,
+		validate: validate,
+		clients:  make(map[int64]map[*client]struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Connect upgrades an authenticated request to a WebSocket. It runs behind
+// the JWT middleware; the token is kept so the connection can be re-checked
+// whenever the user's tokens are revoked.
+func (h *Hub) Connect(c echo.Context) error {
+	claims := c.Get("user").(*auth.TokenClaims)
+	token := bearerToken(c.Request())
+
+	cl, err := h.register(claims.UserID, token)
+	if err != nil {
+		return response.Error(c, http.StatusServiceUnavailable, response.ErrCodeInternalError, err.Error())
+	}
+	defer h.unregister(cl)
+
+	// Subscribing before the handshake means nothing published after the
+	// client sees the upgrade can be missed
+	sub, err := h.broker.Subscribe(claims.UserID)
+	if err != nil {
+		return response.Error(c, http.StatusServiceUnavailable, response.ErrCodeInternalError, err.Error())
+	}
+	defer h.broker.Unsubscribe(sub)
+
+	var expires time.Time
+	if claims.ExpiresAt != nil {
+		expires = claims.ExpiresAt.Time
+	}
+
+	// Origins are not checked: the bearer token is the only credential, so a
+	// foreign page cannot ride on the user's cookies
+	server := websocket.Server{Handler: func(ws *websocket.Conn) {
+		h.serve(ws, cl, sub, expires)
+	}}
+	server.ServeHTTP(c.Response(), c.Request())
+	return nil
+}
+
+// bearerToken reads the token JWTMiddleware has already validated
+func bearerToken(req *http.Request) string {
+	parts := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+func (h *Hub) register(userID int64, token string) (*client, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, ErrHubClosed
+	}
+	cl := &client{userID: userID, token: token, recheck: make(chan struct{}, 1)}
+	if h.clients[userID] == nil {
+		h.clients[userID] = make(map[*client]struct{})
+	}
+	h.clients[userID][cl] = struct{}{}
+	h.active.Add(1)
+	return cl, nil
+}
+
+func (h *Hub) unregister(cl *client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.clients[cl.userID], cl)
+	if len(h.clients[cl.userID]) == 0 {
+		delete(h.clients, cl.userID)
+	}
+	h.active.Done()
+}
+
+// RevokeUser re-validates every open socket of the user; it is registered
+// with the token revocation store so revoked sockets close immediately
+func (h *Hub) RevokeUser(userID int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for cl := range h.clients[userID] {
+		select {
+		case cl.recheck <- struct{}{}:
+		default:
+			// A re-check is already pending
+		}
+	}
+}
+
+// Connections is the number of open sockets for a user
+func (h *Hub) Connections(userID int64) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients[userID])
+}
+
+// Close ends every open socket and waits for them to finish, since the HTTP
+// server does not track hijacked connections during shutdown
+func (h *Hub) Close() {
+	h.mu.Lock()
+	if !h.closed {
+		h.closed = true
+		close(h.done)
+	}
+	h.mu.Unlock()
+
+	h.active.Wait()
+}
+
+func (h *Hub) serve(ws *websocket.Conn, cl *client, sub *stream.Subscriber, expires time.Time) {
+	defer ws.Close()
+	ws.MaxPayloadBytes = h.config.MaxMessageSize
+
+	stop := make(chan struct{})
+	defer close(stop)
+	incoming := make(chan Message)
+	go h.read(ws, incoming, stop)
+
+	heartbeat := time.NewTicker(h.config.Heartbeat)
+	defer heartbeat.Stop()
+
+	var expired <-chan time.Time
+	if !expires.IsZero() {
+		timer := time.NewTimer(time.Until(expires))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		select {
+		case <-h.done:
+			return
+
+		case msg, ok := <-incoming:
+			if !ok {
+				return
+			}
+			if err := h.send(ws, reply(msg)); err != nil {
+				return
+			}
+
+		case event, ok := <-sub.Events():
+			if !ok {
+				// Dropped for falling behind, or the server is shutting down
+				return
+			}
+			if err := h.send(ws, Message{Type: MessageEvent, ID: event.ID, Data: event}); err != nil {
+				return
+			}
+			// Revocations made on another replica arrive as events
+			if event.Type == events.TokensRevoked && h.revoked(cl) {
+				_ = h.send(ws, Message{Type: MessageRevoked})
+				return
+			}
+
+		case <-cl.recheck:
+			if h.revoked(cl) {
+				_ = h.send(ws, Message{Type: MessageRevoked})
+				return
+			}
+
+		case <-expired:
+			_ = h.send(ws, Message{Type: MessageExpired})
+			return
+
+		case <-heartbeat.C:
+			if err := h.send(ws, Message{Type: MessageHeartbeat}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// read forwards client messages until the connection fails or serve returns
+func (h *Hub) read(ws *websocket.Conn, incoming chan<- Message, stop <-chan struct{}) {
+	defer close(incoming)
+
+	for {
+		var data []byte
+		err := websocket.Message.Receive(ws, &data)
+		var msg Message
+		switch {
+		case errors.Is(err, websocket.ErrFrameTooLarge):
+			msg = Message{Type: MessageError, Data: echo.Map{"message": "Message too large"}}
+		case err != nil:
+			return
+		default:
+			if json.Unmarshal(data, &msg) != nil || msg.Type == "" {
+				msg = Message{Type: MessageError, Data: echo.Map{"message": "Invalid message"}}
+			}
+		}
+
+		select {
+		case incoming <- msg:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// reply answers one client message; errors detected while reading are passed through
+func reply(msg Message) Message {
+	switch msg.Type {
+	case MessagePing:
+		return Message{Type: MessagePong, ID: msg.ID, Data: echo.Map{"time": time.Now().UTC()}}
+	case MessageError:
+		return msg
+	default:
+		return Message{Type: MessageError, ID: msg.ID, Data: echo.Map{"message": "Unknown message type: " + msg.Type}}
+	}
+}
+
+func (h *Hub) revoked(cl *client) bool {
+	if _, err := h.validate(cl.token); err != nil {
+		log.Printf("[Socket] Closing socket for user %d: %v", cl.userID, err)
+		return true
+	}
+	return false
+}
+
+func (h *Hub) send(ws *websocket.Conn, msg Message) error {
+	_ = ws.SetWriteDeadline(time.Now().Add(h.config.WriteTimeout))
+	return websocket.JSON.Send(ws, msg)
+}
@@ -0,0 +1,289 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"elotus_test/server/bredis"
+	"elotus_test/server/models/events"
+)
+
+// redisChannel carries every streamed event between replicas
+const redisChannel = "events:stream"
+
+// subscriberBuffer is how far a client may fall behind before it is dropped;
+// it reconnects with Last-Event-ID and catches up from the history
+const subscriberBuffer = 64
+
+var ErrBrokerClosed = errors.New("event stream is shutting down")
+
+// Streamed lists the event types pushed to clients; anything else stays server-side
+var Streamed = map[string]bool{
+	events.UploadCreated:   true,
+	events.UploadProcessed: true,
+	events.UploadDeleted:   true,
+	events.UploadProgress:  true,
+	events.TokensRevoked:   true,
+}
+
+// Live lists streamed events that only matter as they happen. They are not kept
+// for Last-Event-ID replay, so a burst of them never pushes other events out of
+// the history.
+var Live = map[string]bool{
+	events.UploadProgress: true,
+}
+
+type Config struct {
+	// HistorySize is the number of recent events kept per user for Last-Event-ID resume
+	HistorySize int
+	HistoryTTL  time.Duration
+	Heartbeat   time.Duration
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		HistorySize: 100,
+		HistoryTTL:  time.Hour,
+		Heartbeat:   25 * time.Second,
+	}
+}
+
+// Subscriber receives one user's events until it is unsubscribed or dropped
+type Subscriber struct {
+	userID int64
+	events chan events.Event
+}
+
+func (s *Subscriber) Events() <-chan events.Event {
+	return s.events
+}
+
+// Broker fans events out to connected clients. With Redis every event goes
+// through a pub/sub channel, so each replica delivers events raised on any
+// other, and the replay history is shared; without it both stay in process.
+type Broker struct {
+	config *Config
+	redis  *bredis.Client
+
+	mu          sync.Mutex
+	subscribers map[int64]map[*Subscriber]struct{}
+	history     map[int64][]events.Event
+	closed      bool
+
+	stopListening context.CancelFunc
+	listenDone    chan struct{}
+}
+
+func NewBroker(config *Config, redis *bredis.Client) *Broker {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	return &Broker{
+		config:      config,
+		redis:       redis,
+		subscribers: make(map[int64]map[*Subscriber]struct{}),
+		history:     make(map[int64][]events.Event),
+	}
+}
+
+// Start begins relaying events published by other replicas; it is a no-op without Redis
+func (b *Broker) Start() {
+	if b.redis == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	b.stopListening = cancel
+	b.listenDone = make(chan struct{})
+
+	pubsub := b.redis.Subscribe(ctx, redisChannel)
+	go func() {
+		defer close(b.listenDone)
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				var event events.Event
+				if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+					log.Printf("[Stream] Dropping malformed event: %v", err)
+					continue
+				}
+				b.deliver(event)
+			}
+		}
+	}()
+}
+
+// HandleEvent is the event bus subscriber. Events are recorded for resume
+// before they are delivered, so a client that reconnects never misses one.
+func (b *Broker) HandleEvent(event events.Event) {
+	if !Streamed[event.Type] || event.UserID == 0 {
+		return
+	}
+
+	if b.redis == nil {
+		if !Live[event.Type] {
+			b.mu.Lock()
+			history := append(b.history[event.UserID], event)
+			if len(history) > b.config.HistorySize {
+				history = history[len(history)-b.config.HistorySize:]
+			}
+			b.history[event.UserID] = history
+			b.mu.Unlock()
+		}
+
+		b.deliver(event)
+		return
+	}
+
+	if !Live[event.Type] {
+		if err := b.redis.PushCapped(historyKey(event.UserID), event, int64(b.config.HistorySize), b.config.HistoryTTL); err != nil {
+			log.Printf("[Stream] Error recording event %s: %v", event.ID, err)
+		}
+	}
+	if err := b.redis.Publish(redisChannel, event); err != nil {
+		log.Printf("[Stream] Error publishing event %s: %v", event.ID, err)
+	}
+}
+
+func historyKey(userID int64) string {
+	return fmt.Sprintf("events:history:%d", userID)
+}
+
+// Heartbeat is how often an idle stream should send a keep-alive
+func (b *Broker) Heartbeat() time.Duration {
+	return b.config.Heartbeat
+}
+
+// Forget drops the replay history of a deleted user
+func (b *Broker) Forget(userID int64) {
+	if b.redis != nil {
+		if err := b.redis.Delete(historyKey(userID)); err != nil {
+			log.Printf("[Stream] Error clearing history for user %d: %v", userID, err)
+		}
+		return
+	}
+
+	b.mu.Lock()
+	delete(b.history, userID)
+	b.mu.Unlock()
+}
+
+// deliver hands an event to the user's local subscribers, dropping any that are too far behind
+func (b *Broker) deliver(event events.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subscribers[event.UserID] {
+		select {
+		case sub.events <- event:
+		default:
+			log.Printf("[Stream] Dropping slow subscriber for user %d", sub.userID)
+			b.remove(sub)
+		}
+	}
+}
+
+func (b *Broker) Subscribe(userID int64) (*Subscriber, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrBrokerClosed
+	}
+	sub := &Subscriber{userID: userID, events: make(chan events.Event, subscriberBuffer)}
+	if b.subscribers[userID] == nil {
+		b.subscribers[userID] = make(map[*Subscriber]struct{})
+	}
+	b.subscribers[userID][sub] = struct{}{}
+	return sub, nil
+}
+
+func (b *Broker) Unsubscribe(sub *Subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(sub)
+}
+
+// remove closes the subscriber's channel once; b.mu must be held
+func (b *Broker) remove(sub *Subscriber) {
+	subs, ok := b.subscribers[sub.userID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(b.subscribers, sub.userID)
+	}
+	close(sub.events)
+}
+
+// Since returns the user's events after lastID, oldest first. found is false
+// when lastID has aged out of the history and the client must resync.
+func (b *Broker) Since(userID int64, lastID string) ([]events.Event, bool) {
+	history, err := b.recent(userID)
+	if err != nil {
+		log.Printf("[Stream] Error reading history for user %d: %v", userID, err)
+		return nil, false
+	}
+	for i, event := range history {
+		if event.ID == lastID {
+			return history[i+1:], true
+		}
+	}
+	return nil, false
+}
+
+// recent returns the retained events for a user, oldest first
+func (b *Broker) recent(userID int64) ([]events.Event, error) {
+	if b.redis == nil {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return append([]events.Event(nil), b.history[userID]...), nil
+	}
+
+	entries, err := b.redis.GetList(historyKey(userID))
+	if err != nil {
+		return nil, err
+	}
+	history := make([]events.Event, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		var event events.Event
+		if err := json.Unmarshal([]byte(entries[i]), &event); err == nil {
+			history = append(history, event)
+		}
+	}
+	return history, nil
+}
+
+// Close ends every open stream so the HTTP server can shut down without
+// waiting on long-lived connections
+func (b *Broker) Close() {
+	b.mu.Lock()
+	b.closed = true
+	for _, subs := range b.subscribers {
+		for sub := range subs {
+			b.remove(sub)
+		}
+	}
+	b.mu.Unlock()
+
+	if b.stopListening != nil {
+		b.stopListening()
+		<-b.listenDone
+	}
+}
@@ -0,0 +1,111 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/events"
+	"elotus_test/server/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+// reconnectDelay is the retry hint sent to EventSource clients
+const reconnectDelay = 3 * time.Second
+
+type Handler struct {
+	broker *Broker
+}
+
+func NewHandler(broker *Broker) *Handler {
+	return &Handler{broker: broker}
+}
+
+// Events streams the caller's events as server-sent events. A Last-Event-ID
+// header replays what was missed; if that event is no longer retained a
+// "reset" event tells the client to re-fetch its state instead. The stream
+// ends after a token revocation so the client has to re-authenticate.
+func (h *Handler) Events(c echo.Context) error {
+	claims := c.Get("user").(*auth.TokenClaims)
+
+	sub, err := h.broker.Subscribe(claims.UserID)
+	if err != nil {
+		return response.Error(c, http.StatusServiceUnavailable, response.ErrCodeInternalError, err.Error())
+	}
+	defer h.broker.Unsubscribe(sub)
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+	// Stops nginx-style proxies from buffering the stream
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	fmt.Fprintf(res, "retry: %d\n\n", reconnectDelay.Milliseconds())
+
+	// Subscribing first means nothing falls between the replay and live delivery;
+	// events that show up in both are skipped the second time
+	replayed := make(map[string]bool)
+	if lastID := c.Request().Header.Get("Last-Event-ID"); lastID != "" {
+		missed, found := h.broker.Since(claims.UserID, lastID)
+		if !found {
+			fmt.Fprint(res, "event: reset\ndata: {\"reason\":\"history_unavailable\"}\n\n")
+		}
+		for _, event := range missed {
+			replayed[event.ID] = true
+			if err := writeEvent(res, event); err != nil {
+				return nil
+			}
+			if event.Type == events.TokensRevoked {
+				res.Flush()
+				return nil
+			}
+		}
+	}
+	res.Flush()
+
+	heartbeat := time.NewTicker(h.broker.Heartbeat())
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+
+		case event, ok := <-sub.Events():
+			if !ok {
+				// Dropped for falling behind, or the server is shutting down
+				return nil
+			}
+			if replayed[event.ID] {
+				continue
+			}
+			if err := writeEvent(res, event); err != nil {
+				return nil
+			}
+			res.Flush()
+			if event.Type == events.TokensRevoked {
+				return nil
+			}
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(res, ": ping\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		}
+	}
+}
+
+func writeEvent(w io.Writer, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
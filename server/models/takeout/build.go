@@ -0,0 +1,137 @@
+package takeout
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"elotus_test/server/models/jobs"
+)
+
+const (
+	// JobBuildExport writes a requested export to storage
+	JobBuildExport = "takeout.build"
+	// JobPurgeExport removes a built export once its retention has run out
+	JobPurgeExport = "takeout.purge"
+)
+
+type exportPayload struct {
+	ExportID int64 `json:"export_id"`
+}
+
+// SetJobQueue moves export builds off the request path and schedules their removal
+func (h *Handler) SetJobQueue(queue *jobs.Queue) {
+	h.jobQueue = queue
+	queue.Register(JobBuildExport, h.BuildExportJob)
+	queue.Register(JobPurgeExport, h.PurgeExportJob)
+}
+
+// BuildExportJob is the queue handler for JobBuildExport
+func (h *Handler) BuildExportJob(ctx context.Context, job *jobs.Job) error {
+	var payload exportPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+
+	e, found := h.exportRepo.GetExport(payload.ExportID)
+	if !found || !e.InProgress() {
+		return nil
+	}
+
+	err := h.build(ctx, e)
+	if err != nil && job.LastAttempt() {
+		if markErr := h.exportRepo.MarkExportFailed(e.ID, err.Error()); markErr != nil {
+			return markErr
+		}
+	}
+	return err
+}
+
+// PurgeExportJob is the queue handler for JobPurgeExport. The file holds
+// personal data, so it is deleted rather than left for the link to lapse.
+func (h *Handler) PurgeExportJob(ctx context.Context, job *jobs.Job) error {
+	var payload exportPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+
+	e, found := h.exportRepo.GetExport(payload.ExportID)
+	if !found || e.Status != StatusReady {
+		return nil
+	}
+	return h.purge(e)
+}
+
+func (h *Handler) purge(e *Export) error {
+	if e.FilePath != "" {
+		if err := os.Remove(e.FilePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return h.exportRepo.MarkExportExpired(e.ID)
+}
+
+// build writes the export next to its final name and renames it into place,
+// so a crash never leaves a truncated file marked ready
+func (h *Handler) build(ctx context.Context, e *Export) error {
+	if err := h.exportRepo.UpdateExportStatus(e.ID, StatusBuilding); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(h.config.StorageDir, 0700); err != nil {
+		return err
+	}
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	finalPath := filepath.Join(h.config.StorageDir, fmt.Sprintf("export-%d-%s.zip", e.ID, hex.EncodeToString(suffix)))
+	if err := h.WriteExportFile(ctx, finalPath, e.UserID); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(finalPath)
+	if err != nil {
+		return err
+	}
+	expiresAt := timeNow().Add(h.config.Retention)
+	if err := h.exportRepo.MarkExportReady(e.ID, finalPath, info.Size(), expiresAt); err != nil {
+		return err
+	}
+
+	if h.jobQueue != nil {
+		if _, err := h.jobQueue.EnqueueAt(JobPurgeExport, exportPayload{ExportID: e.ID}, expiresAt.Add(time.Minute)); err != nil {
+			log.Printf("[Takeout] Error scheduling removal of export %d: %v", e.ID, err)
+		}
+	}
+	return nil
+}
+
+// WriteExportFile writes the user's export to path through a ".part" file, so
+// path only ever holds a complete ZIP. It backs both the job and the CLI.
+func (h *Handler) WriteExportFile(ctx context.Context, path string, userID int64) error {
+	partPath := path + ".part"
+	f, err := os.OpenFile(partPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	err = h.WriteExport(ctx, f, userID)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(partPath, path)
+	}
+	if err != nil {
+		os.Remove(partPath)
+	}
+	return err
+}
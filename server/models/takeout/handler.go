@@ -0,0 +1,196 @@
+package takeout
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"elotus_test/server/envelope"
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/jobs"
+	"elotus_test/server/models/upload"
+	"elotus_test/server/models/user"
+	"elotus_test/server/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+var timeNow = time.Now
+
+type Config struct {
+	// LinkTTL is the lifetime of a signed download link; Retention is how long a built export is kept
+	LinkTTL    time.Duration
+	Retention  time.Duration
+	StorageDir string
+	SigningKey []byte
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		LinkTTL:    time.Hour,
+		Retention:  24 * time.Hour,
+		StorageDir: "tmp/exports",
+	}
+}
+
+type Handler struct {
+	config     *Config
+	exportRepo Repository
+	userRepo   user.Repository
+	uploadRepo upload.Repository
+	jobQueue   *jobs.Queue
+	keyring    *envelope.Keyring
+}
+
+func NewHandler(config *Config, exportRepo Repository, userRepo user.Repository, uploadRepo upload.Repository) *Handler {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	return &Handler{
+		config:     config,
+		exportRepo: exportRepo,
+		userRepo:   userRepo,
+		uploadRepo: uploadRepo,
+	}
+}
+
+// SetKeyring lets exports include uploads that were stored encrypted
+func (h *Handler) SetKeyring(keyring *envelope.Keyring) {
+	h.keyring = keyring
+}
+
+// RequestExport starts building a copy of the caller's data and answers 202
+// with an export to poll. While one is still building it is returned instead
+// of starting another.
+func (h *Handler) RequestExport(c echo.Context) error {
+	claims := c.Get("user").(*auth.TokenClaims)
+
+	if latest, found := h.exportRepo.LatestExport(claims.UserID); found && latest.InProgress() {
+		return response.Accepted(c, h.details(latest))
+	}
+
+	e, err := h.exportRepo.CreateExport(&Export{UserID: claims.UserID, Status: StatusPending})
+	if err != nil {
+		return response.InternalError(c, "Failed to create export")
+	}
+
+	h.schedule(c.Request().Context(), e)
+
+	if current, found := h.exportRepo.GetExport(e.ID); found {
+		e = current
+	}
+	return response.Accepted(c, h.details(e))
+}
+
+// GetExport reports an export's progress; once it is ready the response
+// carries a signed download link
+func (h *Handler) GetExport(c echo.Context) error {
+	claims := c.Get("user").(*auth.TokenClaims)
+
+	var id int64
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	e, found := h.exportRepo.GetExport(id)
+	if !found {
+		return response.NotFound(c, "Export not found")
+	}
+	if e.UserID != claims.UserID {
+		return response.Forbidden(c, "Access denied")
+	}
+
+	return response.Success(c, h.details(e))
+}
+
+func (h *Handler) details(e *Export) echo.Map {
+	data := echo.Map{
+		"id":           e.ID,
+		"status":       e.Status,
+		"created_at":   e.CreatedAt,
+		"completed_at": e.CompletedAt,
+		"expires_at":   e.ExpiresAt,
+		"status_url":   fmt.Sprintf("/api/me/exports/%d", e.ID),
+	}
+	if e.Error != "" {
+		data["error"] = e.Error
+	}
+
+	now := timeNow()
+	if e.Status == StatusReady && e.ExpiresAt != nil && now.Before(*e.ExpiresAt) {
+		expires := now.Add(h.config.LinkTTL)
+		if e.ExpiresAt.Before(expires) {
+			expires = *e.ExpiresAt
+		}
+		data["file_size"] = e.FileSize
+		data["download_url"] = fmt.Sprintf("/exports/%d/download?expires=%d&signature=%s",
+			e.ID, expires.Unix(), Sign(h.config.SigningKey, e.ID, expires.Unix()))
+		data["download_expires_at"] = time.Unix(expires.Unix(), 0).UTC()
+	}
+	return data
+}
+
+// Sign returns the hex HMAC-SHA256 authorising a download of export id until
+// expires. The prefix keeps an archive signature from being replayed here.
+func Sign(key []byte, id int64, expires int64) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "export:%d:%d", id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Download serves a built export to anyone holding a valid signed link
+func (h *Handler) Download(c echo.Context) error {
+	var id int64
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+	expires, err := strconv.ParseInt(c.QueryParam("expires"), 10, 64)
+	if err != nil {
+		return response.Forbidden(c, ErrInvalidSignature.Error())
+	}
+
+	// Verify before touching the database so the link reveals nothing about other exports
+	expected := Sign(h.config.SigningKey, id, expires)
+	if !hmac.Equal([]byte(expected), []byte(c.QueryParam("signature"))) {
+		return response.Forbidden(c, ErrInvalidSignature.Error())
+	}
+
+	now := timeNow()
+	if now.Unix() > expires {
+		return response.Error(c, http.StatusGone, response.ErrCodeExportLinkExpired, ErrLinkExpired.Error())
+	}
+
+	e, found := h.exportRepo.GetExport(id)
+	if !found {
+		return response.NotFound(c, "Export not found")
+	}
+	if e.Status == StatusExpired || (e.ExpiresAt != nil && now.After(*e.ExpiresAt)) {
+		return response.Error(c, http.StatusGone, response.ErrCodeExportLinkExpired, ErrLinkExpired.Error())
+	}
+	if e.Status != StatusReady {
+		return response.NotFound(c, "Export not found")
+	}
+
+	c.Response().Header().Set("Cache-Control", "private, no-store")
+	return c.Attachment(e.FilePath, fmt.Sprintf("export-%d.zip", e.ID))
+}
+
+// schedule hands the export to the job queue, building it inline when there is none
+func (h *Handler) schedule(ctx context.Context, e *Export) {
+	if h.jobQueue != nil {
+		_, err := h.jobQueue.Enqueue(JobBuildExport, exportPayload{ExportID: e.ID})
+		if err == nil {
+			return
+		}
+		log.Printf("[Takeout] Error enqueueing export %d, building inline: %v", e.ID, err)
+	}
+
+	if err := h.build(ctx, e); err != nil {
+		log.Printf("[Takeout] Build failed for export %d: %v", e.ID, err)
+		if err := h.exportRepo.MarkExportFailed(e.ID, err.Error()); err != nil {
+			log.Printf("[Takeout] Error marking export %d failed: %v", e.ID, err)
+		}
+	}
+}
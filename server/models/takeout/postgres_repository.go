@@ -0,0 +1,109 @@
+package takeout
+
+import (
+	"database/sql"
+	"time"
+
+	"elotus_test/server/bsql"
+)
+
+type PostgresRepository struct {
+	db *bsql.DB
+}
+
+func NewPostgresRepository(db *bsql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+const exportColumns = `id, user_id, status, file_path, file_size, error, created_at, completed_at, expires_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanExport(row rowScanner) (*Export, error) {
+	e := &Export{}
+	var filePath, errorMessage sql.NullString
+	var fileSize sql.NullInt64
+	var completedAt, expiresAt sql.NullTime
+
+	err := row.Scan(
+		&e.ID, &e.UserID, &e.Status, &filePath, &fileSize, &errorMessage,
+		&e.CreatedAt, &completedAt, &expiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	e.FilePath = filePath.String
+	e.FileSize = fileSize.Int64
+	e.Error = errorMessage.String
+	if completedAt.Valid {
+		e.CompletedAt = &completedAt.Time
+	}
+	if expiresAt.Valid {
+		e.ExpiresAt = &expiresAt.Time
+	}
+	return e, nil
+}
+
+func (r *PostgresRepository) CreateExport(e *Export) (*Export, error) {
+	err := r.db.QueryRow(`
+		INSERT INTO data_exports (user_id, status, created_at)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`,
+		e.UserID, e.Status, time.Now(),
+	).Scan(&e.ID, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (r *PostgresRepository) GetExport(id int64) (*Export, bool) {
+	e, err := scanExport(r.db.QueryRow(`SELECT `+exportColumns+` FROM data_exports WHERE id = $1`, id))
+	if err != nil {
+		return nil, false
+	}
+	return e, true
+}
+
+func (r *PostgresRepository) LatestExport(userID int64) (*Export, bool) {
+	e, err := scanExport(r.db.QueryRow(`
+		SELECT `+exportColumns+` FROM data_exports
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1`, userID))
+	if err != nil {
+		return nil, false
+	}
+	return e, true
+}
+
+func (r *PostgresRepository) UpdateExportStatus(id int64, status string) error {
+	_, err := r.db.Exec(`UPDATE data_exports SET status = $1 WHERE id = $2`, status, id)
+	return err
+}
+
+func (r *PostgresRepository) MarkExportReady(id int64, filePath string, fileSize int64, expiresAt time.Time) error {
+	_, err := r.db.Exec(`
+		UPDATE data_exports
+		SET status = $1, file_path = $2, file_size = $3, error = NULL, completed_at = $4, expires_at = $5
+		WHERE id = $6`,
+		StatusReady, filePath, fileSize, time.Now(), expiresAt, id,
+	)
+	return err
+}
+
+func (r *PostgresRepository) MarkExportFailed(id int64, reason string) error {
+	_, err := r.db.Exec(
+		`UPDATE data_exports SET status = $1, error = $2, completed_at = $3 WHERE id = $4`,
+		StatusFailed, reason, time.Now(), id,
+	)
+	return err
+}
+
+func (r *PostgresRepository) MarkExportExpired(id int64) error {
+	_, err := r.db.Exec(`UPDATE data_exports SET status = $1, file_path = NULL WHERE id = $2`, StatusExpired, id)
+	return err
+}
@@ -0,0 +1,51 @@
+package takeout
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	StatusPending  = "pending"
+	StatusBuilding = "building"
+	StatusReady    = "ready"
+	StatusFailed   = "failed"
+	// StatusExpired exports had their file removed once the retention ran out
+	StatusExpired = "expired"
+)
+
+// Export is a copy of everything stored about one user, built by a job for a
+// data-access request
+type Export struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Status      string     `json:"status"`
+	FilePath    string     `json:"-"`
+	FileSize    int64      `json:"file_size,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	// ExpiresAt is when the built file stops being downloadable
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// InProgress reports whether the export is still waiting for or being built
+func (e *Export) InProgress() bool {
+	return e.Status == StatusPending || e.Status == StatusBuilding
+}
+
+type Repository interface {
+	CreateExport(e *Export) (*Export, error)
+	GetExport(id int64) (*Export, bool)
+	// LatestExport returns the user's most recently requested export
+	LatestExport(userID int64) (*Export, bool)
+	UpdateExportStatus(id int64, status string) error
+	MarkExportReady(id int64, filePath string, fileSize int64, expiresAt time.Time) error
+	MarkExportFailed(id int64, reason string) error
+	MarkExportExpired(id int64) error
+}
+
+var (
+	ErrInvalidSignature = errors.New("download link is invalid")
+	ErrLinkExpired      = errors.New("download link has expired")
+)
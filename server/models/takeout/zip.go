@@ -0,0 +1,131 @@
+package takeout
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"time"
+
+	"elotus_test/server/models/upload"
+	"elotus_test/server/models/user"
+)
+
+const (
+	noteWithheld = "file withheld: it did not pass the malware scan"
+	noteMissing  = "file is missing from storage"
+)
+
+// exportedUpload is one file_uploads row as written to uploads.json, with
+// where its original file sits in the ZIP or why it is not there
+type exportedUpload struct {
+	*upload.FileUpload
+	ExportFile string `json:"export_file,omitempty"`
+	ExportNote string `json:"export_note,omitempty"`
+}
+
+type manifest struct {
+	UserID      int64     `json:"user_id"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Logins      int       `json:"logins"`
+	Uploads     int       `json:"uploads"`
+	Files       int       `json:"files"`
+}
+
+// WriteExport writes everything stored about the user to w as a ZIP:
+// profile.json, logins.json, uploads.json (every file_uploads row, including
+// the recorded client IP and user agent) and the original files under files/.
+// Files that are not clean are listed but withheld.
+func (h *Handler) WriteExport(ctx context.Context, w io.Writer, userID int64) error {
+	u, found := h.userRepo.GetUserByID(userID)
+	if !found {
+		return user.ErrUserNotFound
+	}
+	logins, err := h.userRepo.ListLogins(userID)
+	if err != nil {
+		return fmt.Errorf("failed to list logins: %w", err)
+	}
+	uploads, err := h.uploadRepo.GetFileUploadsByUserID(userID)
+	if err != nil {
+		return fmt.Errorf("failed to list uploads: %w", err)
+	}
+
+	zw := zip.NewWriter(w)
+	if err := writeJSON(zw, "profile.json", u); err != nil {
+		return err
+	}
+	if err := writeJSON(zw, "logins.json", logins); err != nil {
+		return err
+	}
+
+	exported := make([]exportedUpload, 0, len(uploads))
+	files := 0
+	for _, fu := range uploads {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		entry := exportedUpload{FileUpload: fu}
+		if fu.Status != upload.StatusClean {
+			entry.ExportNote = noteWithheld
+		} else {
+			name := fmt.Sprintf("files/%d-%s", fu.ID, path.Base(fu.Filename))
+			switch err := h.writeBlob(zw, name, fu); {
+			case errors.Is(err, fs.ErrNotExist):
+				entry.ExportNote = noteMissing
+			case err != nil:
+				return fmt.Errorf("upload %d: %w", fu.ID, err)
+			default:
+				entry.ExportFile = name
+				files++
+			}
+		}
+		exported = append(exported, entry)
+	}
+
+	if err := writeJSON(zw, "uploads.json", exported); err != nil {
+		return err
+	}
+	err = writeJSON(zw, "manifest.json", manifest{
+		UserID:      userID,
+		GeneratedAt: timeNow().UTC(),
+		Logins:      len(logins),
+		Uploads:     len(uploads),
+		Files:       files,
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeJSON(zw *zip.Writer, name string, v interface{}) error {
+	entry, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: timeNow()})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(entry)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeBlob opens the file before creating its entry, so a missing file
+// leaves no empty entry behind. Images are already compressed and are stored.
+func (h *Handler) writeBlob(zw *zip.Writer, name string, fu *upload.FileUpload) error {
+	blob, err := upload.OpenBlob(h.keyring, fu)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	entry, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: fu.CreatedAt})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, blob)
+	return err
+}
@@ -0,0 +1,185 @@
+package transform
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"elotus_test/server/envelope"
+)
+
+// encryptedMagic starts a cached variant written under a keyring. The line
+// carries the key id and wrapped data key; the envelope stream follows it.
+const encryptedMagic = "ENVK "
+
+// maxHeaderLine bounds the header line so a corrupt file is not read whole
+const maxHeaderLine = 512
+
+// flightGroup collapses concurrent calls with the same key into one
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done chan struct{}
+	err  error
+}
+
+// do runs fn unless a call for key is already in flight, in which case it
+// waits for that call and returns its error
+func (g *flightGroup) do(key string, fn func() error) error {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		<-call.done
+		return call.err
+	}
+	call := &flightCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	call.err = fn()
+	close(call.done)
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	return call.err
+}
+
+func (h *Handler) uploadCacheDir(uploadID int64) string {
+	return filepath.Join(h.config.StorageDir, fmt.Sprintf("%d", uploadID))
+}
+
+func (h *Handler) cachePath(uploadID int64, p *Params, format string, quality int) string {
+	return filepath.Join(h.uploadCacheDir(uploadID),
+		fmt.Sprintf("%dx%d_%s_q%d.%s", p.Width, p.Height, p.Fit, quality, format))
+}
+
+// writeCache stores a rendered variant next to its final name and renames it
+// into place, so readers never see a partial file
+func (h *Handler) writeCache(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	partial := fmt.Sprintf("%s.%s.part", path, randomSuffix())
+	out, err := os.OpenFile(partial, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if h.keyring == nil {
+		_, err = out.Write(data)
+	} else {
+		err = writeEncrypted(out, h.keyring, data)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(partial, path)
+	}
+	if err != nil {
+		os.Remove(partial)
+	}
+	return err
+}
+
+func writeEncrypted(out io.Writer, keyring *envelope.Keyring, data []byte) error {
+	dataKey, wrapped, err := keyring.NewDataKey()
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(out, "%s%s %s\n", encryptedMagic, keyring.PrimaryID(), wrapped); err != nil {
+		return err
+	}
+	w, err := envelope.NewWriter(out, dataKey)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// cachedVariant is an open cache file; reads are over the decrypted image
+type cachedVariant struct {
+	io.ReadSeeker
+	file *os.File
+}
+
+func (v *cachedVariant) Close() error {
+	return v.file.Close()
+}
+
+// openCache opens a cached variant. Anything that cannot be read back (a
+// missing file, a key that has since been retired, an encrypted file with
+// encryption turned off) is reported as an error and treated as a miss.
+func (h *Handler) openCache(path string) (*cachedVariant, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	head := make([]byte, len(encryptedMagic))
+	if _, err := io.ReadFull(f, head); err != nil || !bytes.Equal(head, []byte(encryptedMagic)) {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &cachedVariant{ReadSeeker: f, file: f}, nil
+	}
+
+	reader, err := h.decryptCache(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &cachedVariant{ReadSeeker: reader, file: f}, nil
+}
+
+func (h *Handler) decryptCache(f *os.File, size int64) (*envelope.Reader, error) {
+	if h.keyring == nil {
+		return nil, envelope.ErrNotConfigured
+	}
+
+	line, err := bufio.NewReader(io.LimitReader(f, maxHeaderLine)).ReadString('\n')
+	if err != nil {
+		return nil, envelope.ErrCorrupt
+	}
+	keyID, wrapped, ok := strings.Cut(strings.TrimSuffix(line, "\n"), " ")
+	if !ok {
+		return nil, envelope.ErrCorrupt
+	}
+	dataKey, err := h.keyring.Unwrap(keyID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := int64(len(encryptedMagic) + len(line))
+	return envelope.NewReader(io.NewSectionReader(f, offset, size-offset), size-offset, dataKey)
+}
+
+func randomSuffix() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
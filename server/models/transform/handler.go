@@ -0,0 +1,257 @@
+package transform
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"elotus_test/server/envelope"
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/events"
+	"elotus_test/server/models/upload"
+	"elotus_test/server/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+var timeNow = time.Now
+
+type Config struct {
+	// Sizes is the allowlist for w and h
+	Sizes      []int
+	StorageDir string
+	SigningKey []byte
+	// DecodeMemory is shared by all renders in flight; requests beyond it get 503
+	DecodeMemory int64
+	// LinkTTL is the lifetime of a signed transform URL
+	LinkTTL time.Duration
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Sizes:        []int{64, 128, 256, 320, 480, 640, 800, 1024, 1280, 1600, 1920, 2048},
+		StorageDir:   "tmp/transforms",
+		DecodeMemory: 256 * 1024 * 1024,
+		LinkTTL:      24 * time.Hour,
+	}
+}
+
+type Handler struct {
+	config     *Config
+	uploadRepo upload.Repository
+	keyring    *envelope.Keyring
+	budget     *upload.MemoryBudget
+	flights    flightGroup
+	renders    atomic.Int64
+}
+
+func NewHandler(config *Config, uploadRepo upload.Repository) *Handler {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	return &Handler{
+		config:     config,
+		uploadRepo: uploadRepo,
+		budget:     upload.NewMemoryBudget(config.DecodeMemory),
+	}
+}
+
+// SetKeyring lets encrypted uploads be transformed; cached variants are encrypted too
+func (h *Handler) SetKeyring(keyring *envelope.Keyring) {
+	h.keyring = keyring
+}
+
+// Renders is the number of variants rendered since start (cache hits excluded)
+func (h *Handler) Renders() int64 {
+	return h.renders.Load()
+}
+
+// HandleEvent drops cached variants once their upload, or its owner's account, is deleted
+func (h *Handler) HandleEvent(event events.Event) {
+	data, ok := event.Data.(echo.Map)
+	if !ok {
+		return
+	}
+
+	var ids []int64
+	switch event.Type {
+	case events.UploadDeleted:
+		if id, ok := data["id"].(int64); ok {
+			ids = append(ids, id)
+		}
+	case events.UserDeleted:
+		ids, _ = data["upload_ids"].([]int64)
+	}
+
+	for _, id := range ids {
+		if err := os.RemoveAll(h.uploadCacheDir(id)); err != nil {
+			log.Printf("[Transform] Error removing variants of upload %d: %v", id, err)
+		}
+	}
+}
+
+// SignURL returns a signed transform URL for one of the caller's uploads.
+// Parameters are validated here so a signed URL is always renderable.
+func (h *Handler) SignURL(c echo.Context) error {
+	claims := c.Get("user").(*auth.TokenClaims)
+
+	var id int64
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	u, found := h.uploadRepo.GetFileUploadByID(id)
+	if !found {
+		return response.NotFound(c, "Upload not found")
+	}
+	if u.UserID != claims.UserID {
+		return response.Forbidden(c, "Access denied")
+	}
+
+	var req struct {
+		Width   int    `json:"w"`
+		Height  int    `json:"h"`
+		Fit     string `json:"fit"`
+		Format  string `json:"format"`
+		Quality int    `json:"q"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	values := (&Params{Width: req.Width, Height: req.Height, Fit: req.Fit, Format: req.Format, Quality: req.Quality}).Query()
+	if req.Fit == "" {
+		values.Del("fit")
+	}
+	p, err := ParseParams(values, h.config.Sizes)
+	if err != nil {
+		return h.paramsError(c, err)
+	}
+
+	expires := timeNow().Add(h.config.LinkTTL).Unix()
+	query := p.Query()
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", Sign(h.config.SigningKey, u.ID, p, expires))
+	return response.Success(c, echo.Map{
+		"url":        fmt.Sprintf("/api/uploads/%d/transform?%s", u.ID, query.Encode()),
+		"w":          p.Width,
+		"h":          p.Height,
+		"fit":        p.Fit,
+		"format":     p.Format,
+		"expires_at": time.Unix(expires, 0).UTC(),
+	})
+}
+
+func (h *Handler) paramsError(c echo.Context, err error) error {
+	if errors.Is(err, ErrSizeNotAllowed) {
+		return response.ValidationError(c, fmt.Sprintf("%s: %v", err.Error(), h.config.Sizes))
+	}
+	return response.ValidationError(c, err.Error())
+}
+
+// Serve renders (or serves from cache) a resized variant of an upload. The
+// signature is the only credential, so signed URLs work in <img> tags until
+// they expire.
+func (h *Handler) Serve(c echo.Context) error {
+	var id int64
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	p, err := ParseParams(c.QueryParams(), h.config.Sizes)
+	if err != nil {
+		return h.paramsError(c, err)
+	}
+	expires, err := strconv.ParseInt(c.QueryParam("expires"), 10, 64)
+	if err != nil {
+		return response.Forbidden(c, ErrInvalidSignature.Error())
+	}
+	// Verify before touching the database so a guessed URL reveals nothing
+	if !hmac.Equal([]byte(Sign(h.config.SigningKey, id, p, expires)), []byte(c.QueryParam("signature"))) {
+		return response.Forbidden(c, ErrInvalidSignature.Error())
+	}
+	now := timeNow()
+	if now.Unix() > expires {
+		return response.Error(c, http.StatusGone, response.ErrCodeTransformLinkExpired, ErrLinkExpired.Error())
+	}
+
+	u, found := h.uploadRepo.GetFileUploadByID(id)
+	if !found || u.Status != upload.StatusClean {
+		return response.NotFound(c, "Upload not found")
+	}
+
+	format, quality := p.output(u.ContentType)
+	path := h.cachePath(u.ID, p, format, quality)
+
+	variant, err := h.openCache(path)
+	if err != nil {
+		err = h.flights.do(path, func() error { return h.renderToCache(u, p, format, quality, path) })
+		if err == nil {
+			variant, err = h.openCache(path)
+		}
+	}
+	if err != nil {
+		return h.renderError(c, u.ID, err)
+	}
+	defer variant.Close()
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, mime.TypeByExtension("."+format))
+	header.Set("X-Content-Type-Options", "nosniff")
+	// The URL pins the upload and every parameter, and uploads are never
+	// rewritten, so the variant can be kept until the link expires; shared
+	// caches may only keep variants of public uploads
+	maxAge := expires - now.Unix()
+	if u.Visibility == upload.VisibilityPublic {
+		header.Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", maxAge))
+	} else {
+		header.Set("Cache-Control", fmt.Sprintf("private, max-age=%d", maxAge))
+	}
+	header.Set("ETag", fmt.Sprintf(`"%.16s-%s"`, u.Checksum, filepath.Base(path)))
+
+	http.ServeContent(c.Response(), c.Request(), "", u.CreatedAt, variant)
+	return nil
+}
+
+// renderToCache decodes the source under the shared memory budget and stores the variant
+func (h *Handler) renderToCache(u *upload.FileUpload, p *Params, format string, quality int, path string) error {
+	blob, err := upload.OpenBlob(h.keyring, u)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	img, _, release, err := upload.DecodeImage(blob, h.budget)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	started := time.Now()
+	data, err := p.render(img, format, quality)
+	if err != nil {
+		return err
+	}
+	h.renders.Add(1)
+	log.Printf("[Transform] Rendered upload %d as %s in %v", u.ID, p.Query().Encode(), time.Since(started))
+
+	return h.writeCache(path, data)
+}
+
+func (h *Handler) renderError(c echo.Context, uploadID int64, err error) error {
+	switch {
+	case errors.Is(err, upload.ErrDecodeBudgetExceeded):
+		c.Response().Header().Set("Retry-After", "1")
+		return response.Error(c, http.StatusServiceUnavailable, response.ErrCodeDecodeBudgetExceeded,
+			"Too many transforms in progress, retry shortly")
+	case errors.Is(err, os.ErrNotExist):
+		return response.NotFound(c, "Upload file not found")
+	default:
+		log.Printf("[Transform] Error rendering upload %d: %v", uploadID, err)
+		return response.Error(c, http.StatusUnprocessableEntity, response.ErrCodeMalformedImage, "Image could not be transformed")
+	}
+}
@@ -0,0 +1,224 @@
+package transform
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"net/url"
+	"strconv"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	// FitContain scales the image to fit inside w x h, keeping its aspect ratio
+	FitContain = "contain"
+	// FitCover fills w x h exactly, cropping the overflow around the centre
+	FitCover = "cover"
+	// FitFill stretches the image to exactly w x h
+	FitFill = "fill"
+
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+
+	DefaultQuality = 80
+)
+
+var (
+	ErrNoDimensions      = errors.New("w or h is required")
+	ErrSizeNotAllowed    = errors.New("w and h must be one of the allowed sizes")
+	ErrInvalidFit        = errors.New("fit must be contain, cover or fill")
+	ErrFitNeedsBoth      = errors.New("fit=cover and fit=fill need both w and h")
+	ErrInvalidFormat     = errors.New("format must be jpeg or png")
+	ErrInvalidQuality    = errors.New("q must be between 1 and 100")
+	ErrQualityNotApplied = errors.New("q only applies to jpeg output")
+	ErrInvalidSignature  = errors.New("transform signature is invalid")
+	ErrLinkExpired       = errors.New("transform link has expired")
+)
+
+// Params describes one variant. Format is empty when the output should follow
+// the source (jpeg stays jpeg, everything else becomes png); Quality is 0 when
+// the default applies.
+type Params struct {
+	Width   int
+	Height  int
+	Fit     string
+	Format  string
+	Quality int
+}
+
+// ParseParams validates w, h, fit, format and q against the size allowlist
+func ParseParams(values url.Values, sizes []int) (*Params, error) {
+	p := &Params{Fit: FitContain}
+
+	var err error
+	if p.Width, err = parseSize(values.Get("w"), sizes); err != nil {
+		return nil, err
+	}
+	if p.Height, err = parseSize(values.Get("h"), sizes); err != nil {
+		return nil, err
+	}
+	if p.Width == 0 && p.Height == 0 {
+		return nil, ErrNoDimensions
+	}
+
+	if fit := values.Get("fit"); fit != "" {
+		p.Fit = fit
+	}
+	switch p.Fit {
+	case FitContain:
+	case FitCover, FitFill:
+		if p.Width == 0 || p.Height == 0 {
+			return nil, ErrFitNeedsBoth
+		}
+	default:
+		return nil, ErrInvalidFit
+	}
+
+	switch format := values.Get("format"); format {
+	case "":
+	case "jpg", FormatJPEG:
+		p.Format = FormatJPEG
+	case FormatPNG:
+		p.Format = FormatPNG
+	default:
+		return nil, ErrInvalidFormat
+	}
+
+	if q := values.Get("q"); q != "" {
+		p.Quality, err = strconv.Atoi(q)
+		if err != nil || p.Quality < 1 || p.Quality > 100 {
+			return nil, ErrInvalidQuality
+		}
+		if p.Format == FormatPNG {
+			return nil, ErrQualityNotApplied
+		}
+	}
+
+	return p, nil
+}
+
+func parseSize(raw string, sizes []int) (int, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	size, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, ErrSizeNotAllowed
+	}
+	for _, allowed := range sizes {
+		if size == allowed {
+			return size, nil
+		}
+	}
+	return 0, ErrSizeNotAllowed
+}
+
+// Query is the canonical form of p: what gets signed and what appears in URLs
+func (p *Params) Query() url.Values {
+	values := url.Values{}
+	if p.Width > 0 {
+		values.Set("w", strconv.Itoa(p.Width))
+	}
+	if p.Height > 0 {
+		values.Set("h", strconv.Itoa(p.Height))
+	}
+	values.Set("fit", p.Fit)
+	if p.Format != "" {
+		values.Set("format", p.Format)
+	}
+	if p.Quality > 0 {
+		values.Set("q", strconv.Itoa(p.Quality))
+	}
+	return values
+}
+
+// Sign returns the hex HMAC-SHA256 authorising the variant p of upload id until expires
+func Sign(key []byte, id int64, p *Params, expires int64) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "transform:%d:%d:%s", id, expires, p.Query().Encode())
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// output resolves the format and quality actually produced for a source content type
+func (p *Params) output(contentType string) (string, int) {
+	format := p.Format
+	if format == "" {
+		format = FormatPNG
+		if contentType == "image/jpeg" || contentType == "image/jpg" {
+			format = FormatJPEG
+		}
+	}
+	if format != FormatJPEG {
+		return format, 0
+	}
+	if p.Quality > 0 {
+		return format, p.Quality
+	}
+	return format, DefaultQuality
+}
+
+// geometry works out the output size and the source rectangle to sample.
+// contain and cover never enlarge the source; fill always produces w x h.
+func (p *Params) geometry(src image.Rectangle) (int, int, image.Rectangle) {
+	sw, sh := float64(src.Dx()), float64(src.Dy())
+
+	switch p.Fit {
+	case FitFill:
+		return p.Width, p.Height, src
+
+	case FitCover:
+		scale := math.Min(math.Max(float64(p.Width)/sw, float64(p.Height)/sh), 1)
+		w := min(p.Width, scaled(sw, scale))
+		h := min(p.Height, scaled(sh, scale))
+		cw, ch := int(math.Round(float64(w)/scale)), int(math.Round(float64(h)/scale))
+		x0 := src.Min.X + (src.Dx()-cw)/2
+		y0 := src.Min.Y + (src.Dy()-ch)/2
+		return w, h, image.Rect(x0, y0, x0+cw, y0+ch).Intersect(src)
+
+	default:
+		scale := 1.0
+		if p.Width > 0 {
+			scale = math.Min(scale, float64(p.Width)/sw)
+		}
+		if p.Height > 0 {
+			scale = math.Min(scale, float64(p.Height)/sh)
+		}
+		return scaled(sw, scale), scaled(sh, scale), src
+	}
+}
+
+func scaled(length, scale float64) int {
+	return max(int(math.Round(length*scale)), 1)
+}
+
+// render resizes img and encodes it. JPEG has no alpha, so transparent areas are flattened onto white.
+func (p *Params) render(img image.Image, format string, quality int) ([]byte, error) {
+	w, h, crop := p.geometry(img.Bounds())
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	op := draw.Src
+	if format == FormatJPEG {
+		draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+		op = draw.Over
+	}
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, crop, op, nil)
+
+	var buf bytes.Buffer
+	var err error
+	if format == FormatJPEG {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: quality})
+	} else {
+		err = png.Encode(&buf, dst)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
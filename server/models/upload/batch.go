@@ -0,0 +1,142 @@
+package upload
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"elotus_test/server/models/audit"
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/events"
+	"elotus_test/server/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+type BatchResult struct {
+	Index            int                 `json:"index"`
+	OriginalFilename string              `json:"original_filename"`
+	Success          bool                `json:"success"`
+	Upload           echo.Map            `json:"upload,omitempty"`
+	Error            *response.ErrorInfo `json:"error,omitempty"`
+}
+
+// UploadBatch accepts several "data" parts in one request. Each file is validated
+// on its own so one bad file does not fail the others; metadata for the accepted
+// files is then inserted in a single transaction.
+func (h *Handler) UploadBatch(c echo.Context) error {
+	claims := c.Get("user").(*auth.TokenClaims)
+	req := c.Request()
+
+	progress, err := h.trackProgress(c, claims.UserID)
+	if err != nil {
+		return response.ValidationError(c, err.Error())
+	}
+
+	if req.ContentLength > MaxBatchSize {
+		message := fmt.Sprintf("%s (max: %d bytes, actual: %d bytes)", ErrRequestTooLarge.Error(), MaxBatchSize, req.ContentLength)
+		progress.fail(message)
+		return response.BadRequest(c, message)
+	}
+	req.Body = http.MaxBytesReader(c.Response(), progress.wrap(req.Body), MaxBatchSize)
+
+	reader, err := req.MultipartReader()
+	if err != nil {
+		progress.fail(ErrNoFileUploaded.Error())
+		return response.ValidationError(c, ErrNoFileUploaded.Error())
+	}
+
+	var (
+		results  []*BatchResult
+		records  []*FileUpload
+		ingested []*ingestedFile
+		// pending maps each record to its position in results
+		pending []int
+	)
+
+	fail := func(result *BatchResult, err error) {
+		_, result.Error = classifyUploadError(err)
+		results = append(results, result)
+	}
+
+	for {
+		part, err := nextFilePart(reader, "data")
+		if errors.Is(err, ErrNoFileUploaded) {
+			break
+		}
+		if err != nil {
+			// The body is unreadable past this point (usually the total size cap)
+			fail(&BatchResult{Index: len(results)}, err)
+			break
+		}
+
+		result := &BatchResult{Index: len(results), OriginalFilename: part.FileName()}
+		if len(results) >= MaxBatchFiles {
+			part.Close()
+			fail(result, ErrTooManyFiles)
+			continue
+		}
+
+		file, err := h.ingest(claims.UserID, part, part.FileName(), "data")
+		part.Close()
+		if err != nil {
+			fail(result, err)
+			if errors.Is(err, ErrRequestTooLarge) {
+				break
+			}
+			continue
+		}
+
+		pending = append(pending, len(results))
+		results = append(results, result)
+		records = append(records, h.newUploadRecord(c, claims.UserID, part.FileName(), file))
+		ingested = append(ingested, file)
+	}
+
+	if len(results) == 0 {
+		progress.fail(ErrNoFileUploaded.Error())
+		return response.ValidationError(c, ErrNoFileUploaded.Error())
+	}
+	progress.received()
+
+	var savedIDs []int64
+	if len(records) > 0 {
+		saved, err := h.uploadRepo.CreateFileUploads(records)
+		if err != nil {
+			for _, file := range ingested {
+				os.Remove(file.AbsolutePath)
+			}
+			progress.fail("Failed to save file metadata")
+			return response.InternalError(c, "Failed to save file metadata")
+		}
+
+		for i, savedUpload := range saved {
+			h.processUpload(req.Context(), savedUpload)
+			savedIDs = append(savedIDs, savedUpload.ID)
+
+			result := results[pending[i]]
+			result.Success = true
+			result.Upload = h.uploadResponse(savedUpload, ingested[i])
+		}
+
+		if h.redis != nil {
+			_ = h.redis.Delete(h.cacheKey(claims.UserID))
+		}
+		for _, savedUpload := range saved {
+			h.events.Publish(events.UploadCreated, claims.UserID, EventData(savedUpload))
+			h.auditUpload(c, audit.ActionUploadCreated, claims.UserID, savedUpload, "batch")
+		}
+	}
+
+	// Drain whatever is left so the client sees a response rather than a reset connection
+	_, _ = io.Copy(io.Discard, req.Body)
+	progress.complete(savedIDs...)
+
+	return response.Success(c, echo.Map{
+		"results":   results,
+		"succeeded": len(records),
+		"failed":    len(results) - len(records),
+	})
+}
@@ -0,0 +1,60 @@
+package upload
+
+import (
+	"io"
+	"os"
+
+	"elotus_test/server/envelope"
+)
+
+// Blob is an upload's stored content. For encrypted uploads reads and seeks
+// are over the decrypted bytes, so callers never see ciphertext.
+type Blob struct {
+	io.ReadSeeker
+	Size int64
+	file *os.File
+}
+
+func (b *Blob) Close() error {
+	return b.file.Close()
+}
+
+// OpenBlob opens an upload's file, decrypting it with keyring when the upload
+// has a wrapped data key. Plaintext uploads (stored before encryption was
+// enabled) open as-is and keyring may be nil.
+func OpenBlob(keyring *envelope.Keyring, upload *FileUpload) (*Blob, error) {
+	f, err := os.Open(upload.TempPath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if upload.EncryptedKey == "" {
+		return &Blob{ReadSeeker: f, Size: info.Size(), file: f}, nil
+	}
+	if keyring == nil {
+		f.Close()
+		return nil, envelope.ErrNotConfigured
+	}
+
+	dataKey, err := keyring.Unwrap(upload.EncryptionKeyID, upload.EncryptedKey)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	reader, err := envelope.NewReader(f, info.Size(), dataKey)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Blob{ReadSeeker: reader, Size: reader.Size(), file: f}, nil
+}
+
+// SetKeyring turns on envelope encryption for new uploads; existing plaintext files stay readable
+func (h *Handler) SetKeyring(keyring *envelope.Keyring) {
+	h.keyring = keyring
+}
@@ -0,0 +1,79 @@
+package upload
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"sync"
+)
+
+// bytesPerPixel is what the image package allocates for the widest decoded formats (RGBA64 aside)
+const bytesPerPixel = 4
+
+// MemoryBudget caps the decoded-pixel memory of every decode sharing it. Decoders
+// reserve the estimated size before allocating and release it when done, so one
+// budget per process bounds concurrent decodes rather than each one alone.
+type MemoryBudget struct {
+	mu    sync.Mutex
+	limit int64
+	used  int64
+}
+
+func NewMemoryBudget(limit int64) *MemoryBudget {
+	return &MemoryBudget{limit: limit}
+}
+
+func (b *MemoryBudget) Reserve(n int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.used+n > b.limit {
+		return ErrDecodeBudgetExceeded
+	}
+	b.used += n
+	return nil
+}
+
+func (b *MemoryBudget) Release(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.used -= n
+	if b.used < 0 {
+		b.used = 0
+	}
+}
+
+func estimateDecodeBytes(width, height, frames int) int64 {
+	if frames < 1 {
+		frames = 1
+	}
+	return int64(width) * int64(height) * bytesPerPixel * int64(frames)
+}
+
+// DecodeImage fully decodes src only after its header shows the result fits in
+// the budget. Animated images decode to their first frame, so one frame is
+// reserved. The returned release func must be called once the image is no longer used.
+func DecodeImage(src io.Reader, budget *MemoryBudget) (image.Image, string, func(), error) {
+	var consumed bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(io.LimitReader(src, maxHeaderBytes), &consumed))
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if err := checkDimensions(config.Width, config.Height); err != nil {
+		return nil, "", nil, err
+	}
+
+	cost := estimateDecodeBytes(config.Width, config.Height, 1)
+	if err := budget.Reserve(cost); err != nil {
+		return nil, "", nil, err
+	}
+
+	img, format, err := image.Decode(io.MultiReader(&consumed, src))
+	if err != nil {
+		budget.Release(cost)
+		return nil, "", nil, err
+	}
+
+	return img, format, func() { budget.Release(cost) }, nil
+}
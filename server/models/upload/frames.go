@@ -0,0 +1,116 @@
+package upload
+
+import "encoding/binary"
+
+// frameCounter walks the container structure of GIF and PNG files as they stream
+// to storage, counting frames without decoding any pixel data. It fails the write
+// as soon as the count exceeds max so oversized animations are aborted early.
+type frameCounter struct {
+	max    int
+	frames int
+
+	pending []byte
+	skip    int
+	want    int
+	next    func(f *frameCounter, b []byte)
+	done    bool
+}
+
+func newFrameCounter(format string, max int) *frameCounter {
+	f := &frameCounter{max: max, frames: 1}
+	switch format {
+	case "gif":
+		f.frames = 0
+		f.expect(0, 13, onGIFScreen)
+	case "png":
+		// Skip the 8-byte signature and read the first chunk header
+		f.expect(8, 8, onPNGChunk)
+	default:
+		f.done = true
+	}
+	return f
+}
+
+func (f *frameCounter) expect(skip, want int, next func(f *frameCounter, b []byte)) {
+	f.skip, f.want, f.next = skip, want, next
+	f.pending = f.pending[:0]
+}
+
+func (f *frameCounter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 && !f.done {
+		if f.skip > 0 {
+			k := min(f.skip, len(p))
+			f.skip -= k
+			p = p[k:]
+			continue
+		}
+
+		k := min(f.want-len(f.pending), len(p))
+		f.pending = append(f.pending, p[:k]...)
+		p = p[k:]
+		if len(f.pending) == f.want {
+			f.next(f, f.pending)
+		}
+
+		if f.frames > f.max {
+			return n, ErrImageTooManyFrames
+		}
+	}
+	return n, nil
+}
+
+// gifColorTableSize decodes the size field of a GIF packed byte
+func gifColorTableSize(packed byte) int {
+	if packed&0x80 == 0 {
+		return 0
+	}
+	return 3 * (1 << ((packed & 0x07) + 1))
+}
+
+func onGIFScreen(f *frameCounter, b []byte) {
+	f.expect(gifColorTableSize(b[10]), 1, onGIFBlock)
+}
+
+func onGIFBlock(f *frameCounter, b []byte) {
+	switch b[0] {
+	case 0x2C: // image descriptor
+		f.frames++
+		f.expect(0, 9, onGIFDescriptor)
+	case 0x21: // extension: skip the label, then its sub-blocks
+		f.expect(1, 1, onGIFSubBlock)
+	default: // trailer or garbage
+		f.done = true
+	}
+}
+
+func onGIFDescriptor(f *frameCounter, b []byte) {
+	// Local color table, then the LZW minimum code size byte
+	f.expect(gifColorTableSize(b[8])+1, 1, onGIFSubBlock)
+}
+
+func onGIFSubBlock(f *frameCounter, b []byte) {
+	if b[0] == 0 {
+		f.expect(0, 1, onGIFBlock)
+		return
+	}
+	f.expect(int(b[0]), 1, onGIFSubBlock)
+}
+
+func onPNGChunk(f *frameCounter, b []byte) {
+	length := int(binary.BigEndian.Uint32(b[0:4]))
+	switch string(b[4:8]) {
+	case "acTL":
+		f.expect(0, 4, onPNGAnimationControl)
+	case "IDAT", "IEND":
+		// acTL must precede the image data, so a plain PNG has exactly one frame
+		f.done = true
+	default:
+		f.expect(length+4, 8, onPNGChunk)
+	}
+}
+
+func onPNGAnimationControl(f *frameCounter, b []byte) {
+	f.frames = int(binary.BigEndian.Uint32(b))
+	f.done = true
+}
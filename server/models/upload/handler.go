@@ -1,11 +1,13 @@
 package upload
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"log"
-	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -15,7 +17,14 @@ import (
 	"elotus_test/server/bredis"
 	"elotus_test/server/bsql"
 	"elotus_test/server/cmd"
+	"elotus_test/server/env"
+	"elotus_test/server/envelope"
+	"elotus_test/server/models/audit"
 	"elotus_test/server/models/auth"
+	"elotus_test/server/models/events"
+	"elotus_test/server/models/jobs"
+	"elotus_test/server/models/stream"
+	"elotus_test/server/pagination"
 	"elotus_test/server/response"
 
 	"github.com/labstack/echo/v4"
@@ -27,6 +36,15 @@ type Handler struct {
 	db         *bsql.DB
 	uploadRepo Repository
 	redis      *bredis.Client
+	scanner    Scanner
+	jobQueue   *jobs.Queue
+	events     *events.Bus
+	keyring    *envelope.Keyring
+	progress   *ProgressTracker
+	stream     *stream.Broker
+	// budget is shared by every upload decode in flight
+	budget   *MemoryBudget
+	auditLog *audit.Log
 }
 
 func NewHandler(db *bsql.DB, uploadRepo Repository, redis *bredis.Client) *Handler {
@@ -34,215 +52,340 @@ func NewHandler(db *bsql.DB, uploadRepo Repository, redis *bredis.Client) *Handl
 		db:         db,
 		uploadRepo: uploadRepo,
 		redis:      redis,
+		progress:   NewProgressTracker(redis),
+		budget:     NewMemoryBudget(env.E.GetDecodeMemoryBudget()),
 	}
 }
 
+// SetScanner enables scanning of stored files; without one every upload is considered clean
+func (h *Handler) SetScanner(scanner Scanner) {
+	h.scanner = scanner
+}
+
+func (h *Handler) SetEventBus(bus *events.Bus) {
+	h.events = bus
+}
+
+// SetStreamBroker lets progress streams follow upload.progress events instead of the stored record
+func (h *Handler) SetStreamBroker(broker *stream.Broker) {
+	h.stream = broker
+}
+
+func (h *Handler) SetAuditLog(auditLog *audit.Log) {
+	h.auditLog = auditLog
+}
+
+// auditUpload records a created or deleted upload; source says which endpoint made it
+func (h *Handler) auditUpload(c echo.Context, action string, userID int64, upload *FileUpload, source string) {
+	metadata := map[string]interface{}{"filename": upload.OriginalFilename, "size": upload.FileSize}
+	if source != "" {
+		metadata["source"] = source
+	}
+	h.auditLog.Record(c, audit.Entry{
+		Action:     action,
+		ActorID:    userID,
+		TargetType: audit.TargetUpload,
+		TargetID:   audit.ID(upload.ID),
+		Metadata:   metadata,
+	})
+}
+
 func (h *Handler) cacheKey(userID int64) string {
 	return fmt.Sprintf("uploads:%d", userID)
 }
 
+// Forget drops the cached upload list of a deleted user
+func (h *Handler) Forget(userID int64) {
+	if h.redis != nil {
+		_ = h.redis.Delete(h.cacheKey(userID))
+	}
+}
+
 func (h *Handler) Upload(c echo.Context) error {
 	claims := c.Get("user").(*auth.TokenClaims)
+	req := c.Request()
 
-	fileHeader, err := c.FormFile("data")
-	validateErr := validateUploadFile(fileHeader, "data", err)
-	if validateErr != nil {
-		return response.ValidationError(c, validateErr.Error())
+	progress, err := h.trackProgress(c, claims.UserID)
+	if err != nil {
+		return response.ValidationError(c, err.Error())
 	}
 
-	if fileHeader.Size > MaxFileSize {
-		return response.BadRequest(c, fmt.Sprintf("%s (max: %d bytes, actual: %d bytes)",
-			ErrFileTooLarge.Error(), MaxFileSize, fileHeader.Size))
+	// Reject oversize bodies before reading anything when the client declares its length
+	if req.ContentLength > maxUploadBodySize {
+		message := fmt.Sprintf("%s (max: %d bytes, actual: %d bytes)", ErrFileTooLarge.Error(), MaxFileSize, req.ContentLength)
+		progress.fail(message)
+		return response.BadRequest(c, message)
 	}
+	req.Body = http.MaxBytesReader(c.Response(), progress.wrap(req.Body), maxUploadBodySize)
 
-	file, err := fileHeader.Open()
+	reader, err := req.MultipartReader()
 	if err != nil {
-		return response.InternalError(c, "Failed to open uploaded file")
-	}
-	defer file.Close()
-
-	// Extract extension from filename, fallback to content-type detection
-	ext := strings.TrimPrefix(filepath.Ext(fileHeader.Filename), ".")
-	if ext == "" {
-		contentType := detectContentType(fileHeader)
-		switch contentType {
-		case "image/jpeg":
-			ext = "jpg"
-		case "image/png":
-			ext = "png"
-		case "image/gif":
-			ext = "gif"
-		case "image/webp":
-			ext = "webp"
-		case "image/bmp":
-			ext = "bmp"
-		default:
-			ext = "bin"
-		}
+		progress.fail(ErrNoFileUploaded.Error())
+		return response.ValidationError(c, ErrNoFileUploaded.Error())
 	}
 
-	req := c.Request()
-	clientIP := c.RealIP()
-	userAgent := req.UserAgent()
-	requestHost := req.Host
-	requestURI := req.RequestURI
-
-	relativePath, absolutePath, err := h.saveMediaFile(claims.UserID, file, "tmp", "images", ext)
+	part, err := nextFilePart(reader, "data")
 	if err != nil {
-		log.Printf("[Upload] saveMediaFile error: %v", err)
-		return response.InternalError(c, "Failed to save file: "+err.Error())
+		return h.failUpload(c, progress, err)
 	}
+	defer part.Close()
 
-	uploadRecord := &FileUpload{
-		UserID:           claims.UserID,
-		Filename:         filepath.Base(absolutePath),
-		OriginalFilename: fileHeader.Filename,
-		ContentType:      detectContentType(fileHeader),
-		FileSize:         fileHeader.Size,
-		TempPath:         absolutePath,
-		ClientIP:         clientIP,
-		UserAgent:        userAgent,
-		RequestHost:      requestHost,
-		RequestURI:       requestURI,
+	ingested, err := h.ingest(claims.UserID, part, part.FileName(), "data")
+	if err != nil {
+		return h.failUpload(c, progress, err)
 	}
+	progress.received()
+
+	uploadRecord := h.newUploadRecord(c, claims.UserID, part.FileName(), ingested)
 
 	savedUpload, err := h.uploadRepo.CreateFileUpload(uploadRecord)
 	if err != nil {
-		os.Remove(absolutePath)
+		os.Remove(ingested.AbsolutePath)
+		progress.fail("Failed to save file metadata")
 		return response.InternalError(c, "Failed to save file metadata")
 	}
 
+	h.processUpload(req.Context(), savedUpload)
+	progress.complete(savedUpload.ID)
+
 	if h.redis != nil {
 		_ = h.redis.Delete(h.cacheKey(claims.UserID))
 	}
+	h.events.Publish(events.UploadCreated, claims.UserID, EventData(savedUpload))
+	h.auditUpload(c, audit.ActionUploadCreated, claims.UserID, savedUpload, "upload")
 
-	return response.Success(c, echo.Map{
+	return response.Success(c, h.uploadResponse(savedUpload, ingested))
+}
+
+func (h *Handler) newUploadRecord(c echo.Context, userID int64, originalFilename string, ingested *ingestedFile) *FileUpload {
+	req := c.Request()
+
+	// Files stay pending until the scanner has looked at them
+	status := StatusClean
+	if h.scanner != nil {
+		status = StatusPending
+	}
+
+	return &FileUpload{
+		UserID:           userID,
+		Filename:         filepath.Base(ingested.AbsolutePath),
+		OriginalFilename: originalFilename,
+		ContentType:      ingested.ContentType,
+		FileSize:         ingested.Size,
+		Checksum:         ingested.Checksum,
+		Status:           status,
+		ProcessingState:  h.initialProcessingState(),
+		TempPath:         ingested.AbsolutePath,
+		EncryptedKey:     ingested.EncryptedKey,
+		EncryptionKeyID:  ingested.KeyID,
+		ClientIP:         c.RealIP(),
+		UserAgent:        req.UserAgent(),
+		RequestHost:      req.Host,
+		RequestURI:       req.RequestURI,
+		Tags:             []string{},
+		Visibility:       VisibilityPrivate,
+		Version:          1,
+	}
+}
+
+func (h *Handler) uploadResponse(savedUpload *FileUpload, ingested *ingestedFile) echo.Map {
+	data := echo.Map{
 		"file_id":           savedUpload.ID,
 		"filename":          savedUpload.Filename,
 		"original_filename": savedUpload.OriginalFilename,
 		"content_type":      savedUpload.ContentType,
 		"file_size":         savedUpload.FileSize,
-		"temp_path":         absolutePath,
-		"relative_url":      relativePath,
+		"checksum":          savedUpload.Checksum,
+		"status":            savedUpload.Status,
+		"processing_state":  savedUpload.ProcessingState,
+		"relative_url":      ingested.RelativeURL,
 		"uploaded_at":       savedUpload.CreatedAt,
-	})
+	}
+	if savedUpload.SourceURL != "" {
+		data["source_url"] = savedUpload.SourceURL
+	}
+	// Queued uploads are hashed later and report duplicates on upload.processed
+	if savedUpload.ProcessingState == ProcessingCompleted {
+		h.duplicateData(data, savedUpload)
+	}
+	return data
 }
 
-func (h *Handler) saveMediaFile(userID int64, file multipart.File, savePath, fileTypeFolder, tail string) (relativeUrl, absoluteUrl string, err error) {
-	fileName := fmt.Sprintf("%d_%s.%s", userID, randSeq(20), tail)
-	baseFolder := cmd.ResolvePath(savePath)
-	fileFolder := filepath.Join(baseFolder, fileTypeFolder)
-
-	log.Printf("[Upload] Base folder: %s", baseFolder)
-	log.Printf("[Upload] File folder: %s", fileFolder)
+// rejectionCodes gives each image validation failure its own error code
+var rejectionCodes = map[error]string{
+	ErrInvalidContentType:    response.ErrCodeNotAnImage,
+	ErrContentTypeNotAllowed: response.ErrCodeContentTypeNotAllowed,
+	ErrMalformedImage:        response.ErrCodeMalformedImage,
+	ErrFormatMismatch:        response.ErrCodeFormatMismatch,
+	ErrExtensionMismatch:     response.ErrCodeExtensionMismatch,
+	ErrEmbeddedContent:       response.ErrCodeEmbeddedContent,
+	ErrImageTooLarge:         response.ErrCodeImageTooLarge,
+	ErrImageTooManyPixels:    response.ErrCodeImageTooManyPixels,
+	ErrImageTooManyFrames:    response.ErrCodeImageTooManyFrames,
+	ErrDecodeBudgetExceeded:  response.ErrCodeDecodeBudgetExceeded,
+}
 
-	if err := os.MkdirAll(fileFolder, 0755); err != nil {
-		log.Printf("[Upload] Error creating folder: %v", err)
-		return "", "", fmt.Errorf("failed to create folder: %w", err)
+func isRejection(err error) bool {
+	if errors.Is(err, ErrNoFileUploaded) {
+		return true
 	}
+	for sentinel := range rejectionCodes {
+		if errors.Is(err, sentinel) {
+			return true
+		}
+	}
+	return false
+}
 
-	filePath := filepath.Join(fileFolder, fileName)
-	log.Printf("[Upload] File path: %s", filePath)
-
-	out, err := os.Create(filePath)
-	if err != nil {
-		log.Printf("[Upload] Error creating file: %v", err)
-		return "", "", fmt.Errorf("failed to create file: %w", err)
+// classifyUploadError maps ingestion errors to an HTTP status and error info
+func classifyUploadError(err error) (int, *response.ErrorInfo) {
+	for sentinel, code := range rejectionCodes {
+		if errors.Is(err, sentinel) {
+			return http.StatusBadRequest, &response.ErrorInfo{Code: code, Message: sentinel.Error()}
+		}
 	}
-	defer out.Close()
 
-	written, err := io.Copy(out, file)
-	if err != nil {
-		log.Printf("[Upload] Error writing file: %v", err)
-		return "", "", fmt.Errorf("failed to write file: %w", err)
+	switch {
+	case errors.Is(err, ErrFileTooLarge):
+		return http.StatusBadRequest, &response.ErrorInfo{
+			Code:    response.ErrCodeBadRequest,
+			Message: fmt.Sprintf("%s (max: %d bytes)", ErrFileTooLarge.Error(), MaxFileSize),
+		}
+	case errors.Is(err, ErrRequestTooLarge):
+		return http.StatusBadRequest, &response.ErrorInfo{Code: response.ErrCodeBadRequest, Message: err.Error()}
+	case errors.Is(err, ErrNoFileUploaded), errors.Is(err, ErrTooManyFiles), errors.Is(err, ErrInvalidRemoteURL):
+		return http.StatusBadRequest, &response.ErrorInfo{Code: response.ErrCodeValidation, Message: err.Error()}
+	case errors.Is(err, ErrRemoteAddressBlocked), errors.Is(err, ErrTooManyRedirects):
+		return http.StatusBadRequest, &response.ErrorInfo{Code: response.ErrCodeBadRequest, Message: err.Error()}
+	case errors.Is(err, ErrRemoteFetchFailed):
+		return http.StatusBadGateway, &response.ErrorInfo{Code: response.ErrCodeBadRequest, Message: err.Error()}
+	default:
+		log.Printf("[Upload] ingest error: %v", err)
+		return http.StatusInternalServerError, &response.ErrorInfo{Code: response.ErrCodeInternalError, Message: "Failed to save file"}
 	}
-	log.Printf("[Upload] Written %d bytes to %s", written, filePath)
+}
 
-	relativeUrl = fmt.Sprintf("/media/%s/%s", strings.Trim(fileTypeFolder, "/"), fileName)
-	absoluteUrl = filePath
+func uploadError(c echo.Context, err error) error {
+	status, info := classifyUploadError(err)
+	return response.Error(c, status, info.Code, info.Message)
+}
 
-	return relativeUrl, absoluteUrl, nil
+// failUpload records the error on the request's progress before responding with it
+func (h *Handler) failUpload(c echo.Context, progress *progressReporter, err error) error {
+	status, info := classifyUploadError(err)
+	progress.fail(info.Message)
+	return response.Error(c, status, info.Code, info.Message)
 }
 
-func validateUploadFile(fileHeader *multipart.FileHeader, fileType string, err error) error {
+func (h *Handler) saveMediaFile(userID int64, src io.Reader, fileTypeFolder, tail string) (*storedFile, error) {
+	suffix, err := randSeq(20)
 	if err != nil {
-		if err == http.ErrMissingFile {
-			return ErrNoFileUploaded
-		}
-		return errors.New("failed to get uploaded file")
+		return nil, fmt.Errorf("failed to generate filename: %w", err)
 	}
+	fileName := fmt.Sprintf("%d_%s.%s", userID, suffix, tail)
+	baseFolder := cmd.ResolvePath(env.E.GetUploadStoragePath())
+	fileFolder := filepath.Join(baseFolder, fileTypeFolder)
 
-	if fileHeader == nil || fileHeader.Size == 0 {
-		return ErrNoFileUploaded
+	if err := os.MkdirAll(fileFolder, 0755); err != nil {
+		log.Printf("[Upload] Error creating folder: %v", err)
+		return nil, fmt.Errorf("failed to create folder: %w", err)
 	}
 
-	file, err := fileHeader.Open()
+	filePath := filepath.Join(fileFolder, fileName)
+
+	out, err := os.Create(filePath)
 	if err != nil {
-		return errors.New("failed to open file")
+		log.Printf("[Upload] Error creating file: %v", err)
+		return nil, fmt.Errorf("failed to create file: %w", err)
 	}
-	defer file.Close()
 
-	// Read first 512 bytes to detect content type via magic bytes
-	buff := make([]byte, 512)
-	n, err := file.Read(buff)
-	if err != nil && err != io.EOF {
-		return errors.New("failed to read file content")
+	stored := &storedFile{
+		RelativeURL:  fmt.Sprintf("/media/%s/%s", strings.Trim(fileTypeFolder, "/"), fileName),
+		AbsolutePath: filePath,
 	}
 
-	if fileType == "data" || fileType == "image" {
-		contentType := http.DetectContentType(buff[:n])
-		if !strings.HasPrefix(contentType, "image/") {
-			return ErrInvalidContentType
+	// With a keyring the file is encrypted on its way to disk; the checksum stays over the plaintext
+	var sink io.Writer = out
+	var encrypted *envelope.Writer
+	if h.keyring != nil {
+		dataKey, wrapped, err := h.keyring.NewDataKey()
+		if err == nil {
+			encrypted, err = envelope.NewWriter(out, dataKey)
+		}
+		if err != nil {
+			out.Close()
+			os.Remove(filePath)
+			log.Printf("[Upload] Error preparing encryption: %v", err)
+			return nil, fmt.Errorf("failed to encrypt file: %w", err)
 		}
+		sink = encrypted
+		stored.EncryptedKey = wrapped
+		stored.KeyID = h.keyring.PrimaryID()
 	}
 
-	_, err = file.Seek(0, 0)
-	if err != nil {
-		return errors.New("failed to process file")
+	// Read one byte past the limit so oversize files are detected without buffering them
+	limited := &io.LimitedReader{R: src, N: MaxFileSize + 1}
+	hasher := sha256.New()
+	written, err := io.Copy(io.MultiWriter(sink, hasher), limited)
+	if encrypted != nil && err == nil {
+		err = encrypted.Close()
 	}
+	closeErr := out.Close()
 
-	return nil
-}
-
-func detectContentType(fileHeader *multipart.FileHeader) string {
-	file, err := fileHeader.Open()
-	if err != nil {
-		return "application/octet-stream"
+	if err == nil && written > MaxFileSize {
+		err = ErrFileTooLarge
 	}
-	defer file.Close()
-
-	buff := make([]byte, 512)
-	n, err := file.Read(buff)
-	if err != nil && err != io.EOF {
-		return "application/octet-stream"
+	err = mapBodyError(err)
+	if err == nil {
+		err = closeErr
 	}
+	if err != nil {
+		os.Remove(filePath)
+		if errors.Is(err, ErrFileTooLarge) || errors.Is(err, ErrRequestTooLarge) {
+			return nil, err
+		}
+		log.Printf("[Upload] Error writing file: %v", err)
+		return nil, fmt.Errorf("failed to write file: %w", err)
+	}
+	log.Printf("[Upload] Written %d bytes to %s", written, filePath)
 
-	return http.DetectContentType(buff[:n])
+	stored.Size = written
+	stored.Checksum = hex.EncodeToString(hasher.Sum(nil))
+	return stored, nil
 }
 
-// randSeq generates a random string using Linear Congruential Generator
-func randSeq(n int) string {
+// randSeq generates a random alphanumeric string from crypto/rand, so stored
+// filenames cannot be guessed from the upload time
+func randSeq(n int) (string, error) {
 	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	b := make([]byte, n)
-	seed := uint64(timeNow().UnixNano())
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
 	for i := range b {
-		seed = seed*1103515245 + 12345
-		b[i] = letters[seed%uint64(len(letters))]
+		// 256 is not a multiple of 62, so the first letters are very slightly
+		// more likely; 20 letters still carry well over 100 bits
+		b[i] = letters[int(b[i])%len(letters)]
 	}
-	return string(b)
+	return string(b), nil
 }
 
 func (h *Handler) GetUserUploads(c echo.Context) error {
 	claims := c.Get("user").(*auth.TokenClaims)
 	cacheKey := h.cacheKey(claims.UserID)
 
+	page, err := pagination.FromRequest(c)
+	if err != nil {
+		return response.ValidationError(c, err.Error())
+	}
+
+	// The cache holds the full list; pages are cut from it
 	if h.redis != nil {
 		var cached []echo.Map
 		if h.redis.Get(cacheKey, &cached) == nil {
-			return response.SuccessWithMeta(c, cached, &response.Meta{
-				Total:  len(cached),
-				Cached: true,
-			})
+			meta := page.Meta(len(cached))
+			meta.Cached = true
+			return response.SuccessWithMeta(c, pagination.Slice(cached, page), meta)
 		}
 	}
 
@@ -253,24 +396,14 @@ func (h *Handler) GetUserUploads(c echo.Context) error {
 
 	uploadList := make([]echo.Map, 0, len(uploads))
 	for _, upload := range uploads {
-		uploadList = append(uploadList, echo.Map{
-			"id":                upload.ID,
-			"filename":          upload.Filename,
-			"original_filename": upload.OriginalFilename,
-			"content_type":      upload.ContentType,
-			"file_size":         upload.FileSize,
-			"file_path":         upload.TempPath,
-			"created_at":        upload.CreatedAt,
-		})
+		uploadList = append(uploadList, Details(upload))
 	}
 
 	if h.redis != nil {
 		_ = h.redis.Set(cacheKey, uploadList, 30*time.Minute)
 	}
 
-	return response.SuccessWithMeta(c, uploadList, &response.Meta{
-		Total: len(uploadList),
-	})
+	return response.SuccessWithMeta(c, pagination.Slice(uploadList, page), page.Meta(len(uploadList)))
 }
 
 func (h *Handler) GetUploadByID(c echo.Context) error {
@@ -285,17 +418,82 @@ func (h *Handler) GetUploadByID(c echo.Context) error {
 		return response.NotFound(c, "Upload not found")
 	}
 
-	if upload.UserID != claims.UserID {
+	if upload.UserID != claims.UserID && upload.Visibility != VisibilityPublic {
 		return response.Forbidden(c, "Access denied")
 	}
 
-	return response.Success(c, echo.Map{
+	c.Response().Header().Set("ETag", ETag(upload))
+	return response.Success(c, Details(upload))
+}
+
+// Details is the public representation of an upload used by list and detail responses
+func Details(upload *FileUpload) echo.Map {
+	return echo.Map{
 		"id":                upload.ID,
 		"filename":          upload.Filename,
 		"original_filename": upload.OriginalFilename,
+		"display_name":      upload.Name(),
+		"content_type":      upload.ContentType,
+		"file_size":         upload.FileSize,
+		"status":            upload.Status,
+		"processing_state":  upload.ProcessingState,
+		"caption":           upload.Caption,
+		"alt_text":          upload.AltText,
+		"tags":              upload.Tags,
+		"visibility":        upload.Visibility,
+		"version":           upload.Version,
+		"url":               MediaURL(upload),
+		"created_at":        upload.CreatedAt,
+		"updated_at":        upload.UpdatedAt,
+	}
+}
+
+// EventData is the payload of upload events. It reaches webhook endpoints and
+// event streams, so it leaves out storage details.
+func EventData(upload *FileUpload) echo.Map {
+	return echo.Map{
+		"id":                upload.ID,
+		"user_id":           upload.UserID,
+		"original_filename": upload.OriginalFilename,
+		"display_name":      upload.Name(),
 		"content_type":      upload.ContentType,
 		"file_size":         upload.FileSize,
-		"file_path":         upload.TempPath,
+		"status":            upload.Status,
+		"processing_state":  upload.ProcessingState,
+		"visibility":        upload.Visibility,
 		"created_at":        upload.CreatedAt,
+	}
+}
+
+func (h *Handler) DeleteUpload(c echo.Context) error {
+	claims := c.Get("user").(*auth.TokenClaims)
+
+	var id int64
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	upload, found := h.uploadRepo.GetFileUploadByID(id)
+	if !found {
+		return response.NotFound(c, "Upload not found")
+	}
+	if upload.UserID != claims.UserID {
+		return response.Forbidden(c, "Access denied")
+	}
+
+	if err := h.uploadRepo.DeleteFileUpload(upload.ID); err != nil {
+		return response.InternalError(c, "Failed to delete upload")
+	}
+	if err := os.Remove(upload.TempPath); err != nil && !os.IsNotExist(err) {
+		log.Printf("[Upload] Error removing file %s: %v", upload.TempPath, err)
+	}
+
+	if h.redis != nil {
+		_ = h.redis.Delete(h.cacheKey(claims.UserID))
+	}
+	h.events.Publish(events.UploadDeleted, claims.UserID, EventData(upload))
+	h.auditUpload(c, audit.ActionUploadDeleted, claims.UserID, upload, "")
+
+	return response.Success(c, echo.Map{
+		"message": "Upload deleted",
+		"id":      upload.ID,
 	})
 }
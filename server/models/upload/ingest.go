@@ -0,0 +1,127 @@
+package upload
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"elotus_test/server/env"
+)
+
+// sniffLen is the number of bytes http.DetectContentType looks at
+const sniffLen = 512
+
+// maxMultipartOverhead leaves room for boundaries and part headers on top of MaxFileSize
+const maxMultipartOverhead = 64 * 1024
+
+const maxUploadBodySize = MaxFileSize + maxMultipartOverhead
+
+type storedFile struct {
+	RelativeURL  string
+	AbsolutePath string
+	Size         int64
+	Checksum     string
+	// EncryptedKey is the wrapped data key when the file was written encrypted
+	EncryptedKey string
+	KeyID        string
+}
+
+type ingestedFile struct {
+	*storedFile
+	ContentType string
+}
+
+// nextFilePart advances the reader to the first file part named field,
+// discarding any other form fields sent before it.
+func nextFilePart(reader *multipart.Reader, field string) (*multipart.Part, error) {
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, ErrNoFileUploaded
+		}
+		if err != nil {
+			if err = mapBodyError(err); errors.Is(err, ErrRequestTooLarge) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("failed to read multipart body: %w", err)
+		}
+		if part.FormName() == field && part.FileName() != "" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+// ingest validates and stores src in a single pass: the image header is decoded
+// up front, then the consumed bytes are replayed in front of the rest of the
+// stream while it is hashed, scanned and written to storage.
+func (h *Handler) ingest(userID int64, src io.Reader, fileName, fileType string) (*ingestedFile, error) {
+	header, stream, err := validateUploadFile(src, fileName, fileType)
+	if err != nil {
+		if err = mapBodyError(err); errors.Is(err, ErrRequestTooLarge) || isRejection(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read file content: %w", err)
+	}
+
+	scanner := newTextScanner(header.Format)
+	frames := newFrameCounter(header.Format, env.E.GetMaxImageFrames())
+	stream = io.TeeReader(io.TeeReader(stream, scanner), frames)
+
+	stored, err := h.saveMediaFile(userID, stream, "images", fileExtension(fileName, header.ContentType))
+	if err != nil {
+		if errors.Is(err, ErrImageTooManyFrames) {
+			return nil, ErrImageTooManyFrames
+		}
+		return nil, err
+	}
+	if scanner.Found() {
+		os.Remove(stored.AbsolutePath)
+		return nil, ErrEmbeddedContent
+	}
+	// Validation assumed one frame; an animation must fit the budget with all of them
+	if estimateDecodeBytes(header.Width, header.Height, frames.frames) > env.E.GetDecodeMemoryBudget() {
+		os.Remove(stored.AbsolutePath)
+		return nil, ErrDecodeBudgetExceeded
+	}
+
+	return &ingestedFile{storedFile: stored, ContentType: header.ContentType}, nil
+}
+
+// mapBodyError turns the error raised by http.MaxBytesReader into ErrRequestTooLarge
+func mapBodyError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return ErrRequestTooLarge
+	}
+	return err
+}
+
+// fileExtension extracts the extension from the filename, falling back to content-type detection
+func fileExtension(fileName, contentType string) string {
+	if ext := strings.TrimPrefix(filepath.Ext(fileName), "."); ext != "" {
+		return ext
+	}
+
+	switch contentType {
+	case "image/jpeg":
+		return "jpg"
+	case "image/png":
+		return "png"
+	case "image/gif":
+		return "gif"
+	case "image/webp":
+		return "webp"
+	case "image/bmp":
+		return "bmp"
+	case "image/tiff":
+		return "tiff"
+	default:
+		return "bin"
+	}
+}
@@ -0,0 +1,102 @@
+package upload
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"elotus_test/server/cmd"
+	"elotus_test/server/env"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// publicCacheControl lets shared caches keep public uploads for good: a blob
+	// is never rewritten in place, so its URL always names the same bytes
+	publicCacheControl = "public, max-age=31536000, immutable"
+	// privateCacheControl keeps other uploads out of shared caches; the browser
+	// revalidates against the ETag on every use
+	privateCacheControl = "private, no-cache"
+)
+
+// ServeMedia serves stored files, but only those whose upload has been scanned clean
+func (h *Handler) ServeMedia(c echo.Context) error {
+	name := path.Clean("/" + c.Param("*"))
+	folder, filename := path.Split(strings.TrimPrefix(name, "/"))
+	if filename == "" || strings.Trim(folder, "/") == quarantineFolder {
+		return echo.ErrNotFound
+	}
+
+	upload, found := h.uploadRepo.GetFileUploadByFilename(filename)
+	if !found || upload.Status != StatusClean {
+		return echo.ErrNotFound
+	}
+
+	filePath := filepath.Join(cmd.ResolvePath(env.E.GetUploadStoragePath()), filepath.FromSlash(name))
+	if filepath.Clean(upload.TempPath) != filePath {
+		return echo.ErrNotFound
+	}
+
+	return h.writeMedia(c, upload)
+}
+
+// MediaURL is the /media path an upload is served from, or "" when its file
+// lives outside upload storage
+func MediaURL(upload *FileUpload) string {
+	rel, err := filepath.Rel(cmd.ResolvePath(env.E.GetUploadStoragePath()), upload.TempPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	return "/media/" + filepath.ToSlash(rel)
+}
+
+// writeMedia sends an upload's blob with its stored metadata. Content-Type comes
+// from the database rather than the extension, and the ETag is the content
+// checksum; http.ServeContent then handles Range, If-Range, If-None-Match and
+// If-Modified-Since against them. Encrypted files are decrypted chunk by chunk,
+// so a range request only decrypts the chunks it covers.
+func (h *Handler) writeMedia(c echo.Context, upload *FileUpload) error {
+	blob, err := OpenBlob(h.keyring, upload)
+	if os.IsNotExist(err) {
+		return echo.ErrNotFound
+	}
+	if err != nil {
+		log.Printf("[Upload] Error opening upload %d: %v", upload.ID, err)
+		return echo.ErrInternalServerError
+	}
+	defer blob.Close()
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, mediaContentType(upload.ContentType))
+	header.Set(echo.HeaderContentDisposition, mime.FormatMediaType("inline", map[string]string{"filename": upload.Name()}))
+	header.Set("X-Content-Type-Options", "nosniff")
+	if upload.Visibility == VisibilityPublic {
+		header.Set("Cache-Control", publicCacheControl)
+	} else {
+		header.Set("Cache-Control", privateCacheControl)
+	}
+	if upload.Checksum != "" {
+		header.Set("ETag", fmt.Sprintf(`"%s"`, upload.Checksum))
+	}
+
+	http.ServeContent(c.Response(), c.Request(), upload.Filename, upload.CreatedAt, blob)
+	return nil
+}
+
+// mediaContentType maps legacy aliases to their registered type
+func mediaContentType(contentType string) string {
+	switch contentType {
+	case "":
+		return "application/octet-stream"
+	case "image/jpg":
+		return "image/jpeg"
+	default:
+		return contentType
+	}
+}
@@ -0,0 +1,176 @@
+package upload
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"elotus_test/server/models/auth"
+	"elotus_test/server/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	VisibilityPrivate = "private"
+	// VisibilityPublic lets any signed-in user read the upload's details
+	VisibilityPublic = "public"
+)
+
+const (
+	MaxDisplayNameLength = 255
+	MaxAltTextLength     = 500
+)
+
+// MetadataUpdate holds the owner-editable fields; nil leaves a field unchanged
+// and an empty string clears it
+type MetadataUpdate struct {
+	DisplayName *string
+	Caption     *string
+	AltText     *string
+	Visibility  *string
+	// Tags replaces the tags, already normalized
+	Tags *[]string
+}
+
+func (u MetadataUpdate) Empty() bool {
+	return u.DisplayName == nil && u.Caption == nil && u.AltText == nil && u.Visibility == nil && u.Tags == nil
+}
+
+// ETag identifies the current version of an upload's metadata
+func ETag(upload *FileUpload) string {
+	return fmt.Sprintf(`"%d"`, upload.Version)
+}
+
+// parseIfMatch returns the version named by an If-Match header, or 0 for "*"
+func parseIfMatch(header string) (int, bool) {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return 0, true
+	}
+
+	header = strings.TrimPrefix(header, "W/")
+	if len(header) < 2 || header[0] != '"' || header[len(header)-1] != '"' {
+		return 0, false
+	}
+	version, err := strconv.Atoi(header[1 : len(header)-1])
+	if err != nil || version < 1 {
+		return 0, false
+	}
+	return version, true
+}
+
+type updateUploadRequest struct {
+	DisplayName *string `json:"display_name"`
+	Caption     *string `json:"caption"`
+	AltText     *string `json:"alt_text"`
+	Visibility  *string `json:"visibility"`
+}
+
+func (r *updateUploadRequest) validate() (MetadataUpdate, error) {
+	var update MetadataUpdate
+
+	if r.DisplayName != nil {
+		name := strings.TrimSpace(*r.DisplayName)
+		if utf8.RuneCountInString(name) > MaxDisplayNameLength {
+			return update, fmt.Errorf("display_name is too long (max: %d characters)", MaxDisplayNameLength)
+		}
+		if strings.ContainsAny(name, `/\`) || strings.IndexFunc(name, unicode.IsControl) >= 0 {
+			return update, errors.New("display_name must not contain slashes or control characters")
+		}
+		update.DisplayName = &name
+	}
+
+	if r.Caption != nil {
+		caption := strings.TrimSpace(*r.Caption)
+		if utf8.RuneCountInString(caption) > MaxCaptionLength {
+			return update, fmt.Errorf("%s (max: %d characters)", ErrCaptionTooLong.Error(), MaxCaptionLength)
+		}
+		update.Caption = &caption
+	}
+
+	if r.AltText != nil {
+		alt := strings.TrimSpace(*r.AltText)
+		if utf8.RuneCountInString(alt) > MaxAltTextLength {
+			return update, fmt.Errorf("alt_text is too long (max: %d characters)", MaxAltTextLength)
+		}
+		update.AltText = &alt
+	}
+
+	if r.Visibility != nil {
+		if *r.Visibility != VisibilityPrivate && *r.Visibility != VisibilityPublic {
+			return update, errors.New("visibility must be 'private' or 'public'")
+		}
+		update.Visibility = r.Visibility
+	}
+
+	if update.Empty() {
+		return update, errors.New("at least one of display_name, caption, alt_text or visibility is required")
+	}
+	return update, nil
+}
+
+// UpdateUpload edits the owner-editable fields. The request must carry the
+// upload's ETag in If-Match (or "*"); a stale tag gets 412 with the current
+// ETag so the client can refetch and retry.
+func (h *Handler) UpdateUpload(c echo.Context) error {
+	claims := c.Get("user").(*auth.TokenClaims)
+
+	upload, err := h.ownedUpload(c, claims.UserID)
+	if upload == nil {
+		return err
+	}
+
+	ifMatch := c.Request().Header.Get("If-Match")
+	if ifMatch == "" {
+		return response.Error(c, http.StatusPreconditionRequired, response.ErrCodePreconditionRequired,
+			"If-Match header is required")
+	}
+	expected, ok := parseIfMatch(ifMatch)
+	if !ok || (expected != 0 && expected != upload.Version) {
+		return h.versionConflict(c, upload)
+	}
+
+	var req updateUploadRequest
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+	update, err := req.validate()
+	if err != nil {
+		return response.ValidationError(c, err.Error())
+	}
+
+	return h.applyMetadata(c, upload, expected, update)
+}
+
+// applyMetadata writes only the fields in update, conditional on expected
+// unless it is 0, and answers with the upload as stored
+func (h *Handler) applyMetadata(c echo.Context, upload *FileUpload, expected int, update MetadataUpdate) error {
+	updated, err := h.uploadRepo.UpdateFileUploadMetadata(upload.ID, expected, update)
+	if errors.Is(err, ErrVersionConflict) {
+		if current, found := h.uploadRepo.GetFileUploadByID(upload.ID); found {
+			upload = current
+		}
+		return h.versionConflict(c, upload)
+	}
+	if err != nil {
+		return response.InternalError(c, "Failed to update upload")
+	}
+
+	if h.redis != nil {
+		_ = h.redis.Delete(h.cacheKey(upload.UserID))
+	}
+
+	c.Response().Header().Set("ETag", ETag(updated))
+	return response.Success(c, Details(updated))
+}
+
+func (h *Handler) versionConflict(c echo.Context, upload *FileUpload) error {
+	c.Response().Header().Set("ETag", ETag(upload))
+	return response.Error(c, http.StatusPreconditionFailed, response.ErrCodePreconditionFailed,
+		ErrVersionConflict.Error())
+}
@@ -2,9 +2,14 @@ package upload
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"elotus_test/server/bsql"
+
+	"github.com/lib/pq"
 )
 
 type PostgresRepository struct {
@@ -15,30 +20,48 @@ func NewPostgresRepository(db *bsql.DB) *PostgresRepository {
 	return &PostgresRepository{db: db}
 }
 
-func (r *PostgresRepository) CreateFileUpload(upload *FileUpload) (*FileUpload, error) {
-	query := `
+const insertFileUploadQuery = `
 		INSERT INTO file_uploads (
-			user_id, filename, original_filename, content_type, file_size, 
-			temp_path, client_ip, user_agent, request_host, request_uri, created_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-		RETURNING id, created_at`
+			user_id, filename, original_filename, content_type, file_size, checksum, status, processing_state,
+			temp_path, client_ip, user_agent, request_host, request_uri, source_url, created_at,
+			encrypted_key, encryption_key_id, perceptual_hash
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+		RETURNING id, visibility, version, created_at, updated_at`
 
-	now := time.Now()
-	err := r.db.QueryRow(
-		query,
+func insertFileUploadArgs(upload *FileUpload, now time.Time) []interface{} {
+	return []interface{}{
 		upload.UserID,
 		upload.Filename,
 		upload.OriginalFilename,
 		upload.ContentType,
 		upload.FileSize,
+		upload.Checksum,
+		upload.Status,
+		upload.ProcessingState,
 		upload.TempPath,
 		upload.ClientIP,
 		upload.UserAgent,
 		upload.RequestHost,
 		upload.RequestURI,
+		sql.NullString{String: upload.SourceURL, Valid: upload.SourceURL != ""},
 		now,
-	).Scan(&upload.ID, &upload.CreatedAt)
+		sql.NullString{String: upload.EncryptedKey, Valid: upload.EncryptedKey != ""},
+		sql.NullString{String: upload.EncryptionKeyID, Valid: upload.EncryptionKeyID != ""},
+		nullHash(upload.PerceptualHash),
+	}
+}
 
+// Hashes are stored as BIGINT; the cast keeps all 64 bits, so XOR distances are unchanged
+func nullHash(hash *uint64) sql.NullInt64 {
+	if hash == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(*hash), Valid: true}
+}
+
+func (r *PostgresRepository) CreateFileUpload(upload *FileUpload) (*FileUpload, error) {
+	err := r.db.QueryRow(insertFileUploadQuery, insertFileUploadArgs(upload, time.Now())...).
+		Scan(&upload.ID, &upload.Visibility, &upload.Version, &upload.CreatedAt, &upload.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -46,47 +69,120 @@ func (r *PostgresRepository) CreateFileUpload(upload *FileUpload) (*FileUpload,
 	return upload, nil
 }
 
-func (r *PostgresRepository) GetFileUploadByID(id int64) (*FileUpload, bool) {
-	query := `
-		SELECT id, user_id, filename, original_filename, content_type, file_size,
-			   temp_path, client_ip, user_agent, request_host, request_uri, created_at
-		FROM file_uploads
-		WHERE id = $1`
+// CreateFileUploads inserts all uploads in a single transaction: either every row is saved or none are
+func (r *PostgresRepository) CreateFileUploads(uploads []*FileUpload) ([]*FileUpload, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, upload := range uploads {
+		err := tx.QueryRow(insertFileUploadQuery, insertFileUploadArgs(upload, now)...).
+			Scan(&upload.ID, &upload.Visibility, &upload.Version, &upload.CreatedAt, &upload.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return uploads, nil
+}
+
+const fileUploadColumns = `
+		id, user_id, filename, original_filename, content_type, file_size, checksum, status, processing_state,
+		temp_path, client_ip, user_agent, request_host, request_uri, source_url, caption, tags,
+		display_name, alt_text, visibility, version, created_at, updated_at, encrypted_key, encryption_key_id,
+		perceptual_hash`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
 
+func scanFileUpload(row rowScanner) (*FileUpload, error) {
 	upload := &FileUpload{}
-	var clientIP, userAgent, requestHost, requestURI sql.NullString
+	var checksum, clientIP, userAgent, requestHost, requestURI, sourceURL, caption, displayName, altText sql.NullString
+	var encryptedKey, keyID sql.NullString
+	var updatedAt sql.NullTime
+	var perceptualHash sql.NullInt64
 
-	err := r.db.QueryRow(query, id).Scan(
+	err := row.Scan(
 		&upload.ID,
 		&upload.UserID,
 		&upload.Filename,
 		&upload.OriginalFilename,
 		&upload.ContentType,
 		&upload.FileSize,
+		&checksum,
+		&upload.Status,
+		&upload.ProcessingState,
 		&upload.TempPath,
 		&clientIP,
 		&userAgent,
 		&requestHost,
 		&requestURI,
+		&sourceURL,
+		&caption,
+		pq.Array(&upload.Tags),
+		&displayName,
+		&altText,
+		&upload.Visibility,
+		&upload.Version,
 		&upload.CreatedAt,
+		&updatedAt,
+		&encryptedKey,
+		&keyID,
+		&perceptualHash,
 	)
-
 	if err != nil {
-		return nil, false
+		return nil, err
 	}
 
+	upload.Checksum = checksum.String
 	upload.ClientIP = clientIP.String
 	upload.UserAgent = userAgent.String
 	upload.RequestHost = requestHost.String
 	upload.RequestURI = requestURI.String
+	upload.SourceURL = sourceURL.String
+	upload.Caption = caption.String
+	upload.DisplayName = displayName.String
+	upload.AltText = altText.String
+	upload.UpdatedAt = updatedAt.Time
+	upload.EncryptedKey = encryptedKey.String
+	upload.EncryptionKeyID = keyID.String
+	if perceptualHash.Valid {
+		hash := uint64(perceptualHash.Int64)
+		upload.PerceptualHash = &hash
+	}
+	if upload.Tags == nil {
+		upload.Tags = []string{}
+	}
+
+	return upload, nil
+}
+
+func (r *PostgresRepository) GetFileUploadByID(id int64) (*FileUpload, bool) {
+	upload, err := scanFileUpload(r.db.QueryRow(`SELECT `+fileUploadColumns+` FROM file_uploads WHERE id = $1`, id))
+	if err != nil {
+		return nil, false
+	}
+	return upload, true
+}
 
+func (r *PostgresRepository) GetFileUploadByFilename(filename string) (*FileUpload, bool) {
+	upload, err := scanFileUpload(r.db.QueryRow(`SELECT `+fileUploadColumns+` FROM file_uploads WHERE filename = $1`, filename))
+	if err != nil {
+		return nil, false
+	}
 	return upload, true
 }
 
 func (r *PostgresRepository) GetFileUploadsByUserID(userID int64) ([]*FileUpload, error) {
-	query := `
-		SELECT id, user_id, filename, original_filename, content_type, file_size,
-			   temp_path, client_ip, user_agent, request_host, request_uri, created_at
+	query := `SELECT ` + fileUploadColumns + `
 		FROM file_uploads
 		WHERE user_id = $1
 		ORDER BY created_at DESC`
@@ -99,34 +195,243 @@ func (r *PostgresRepository) GetFileUploadsByUserID(userID int64) ([]*FileUpload
 
 	var uploads []*FileUpload
 	for rows.Next() {
-		upload := &FileUpload{}
-		var clientIP, userAgent, requestHost, requestURI sql.NullString
-
-		err := rows.Scan(
-			&upload.ID,
-			&upload.UserID,
-			&upload.Filename,
-			&upload.OriginalFilename,
-			&upload.ContentType,
-			&upload.FileSize,
-			&upload.TempPath,
-			&clientIP,
-			&userAgent,
-			&requestHost,
-			&requestURI,
-			&upload.CreatedAt,
-		)
+		upload, err := scanFileUpload(rows)
 		if err != nil {
 			return nil, err
 		}
+		uploads = append(uploads, upload)
+	}
+
+	return uploads, rows.Err()
+}
+
+// GetFileUploadsByIDs returns the uploads that exist, in no particular order
+func (r *PostgresRepository) GetFileUploadsByIDs(ids []int64) ([]*FileUpload, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
 
-		upload.ClientIP = clientIP.String
-		upload.UserAgent = userAgent.String
-		upload.RequestHost = requestHost.String
-		upload.RequestURI = requestURI.String
+	rows, err := r.db.Query(`SELECT `+fileUploadColumns+` FROM file_uploads WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
+	var uploads []*FileUpload
+	for rows.Next() {
+		upload, err := scanFileUpload(rows)
+		if err != nil {
+			return nil, err
+		}
 		uploads = append(uploads, upload)
 	}
 
-	return uploads, nil
+	return uploads, rows.Err()
+}
+
+func (r *PostgresRepository) ListFileUploadsAfter(afterID int64, limit int) ([]*FileUpload, error) {
+	rows, err := r.db.Query(
+		`SELECT `+fileUploadColumns+` FROM file_uploads WHERE id > $1 ORDER BY id LIMIT $2`,
+		afterID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var uploads []*FileUpload
+	for rows.Next() {
+		upload, err := scanFileUpload(rows)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, upload)
+	}
+
+	return uploads, rows.Err()
+}
+
+func (r *PostgresRepository) UpdateFileUploadStatus(id int64, status, tempPath string) error {
+	_, err := r.db.Exec(
+		`UPDATE file_uploads SET status = $1, temp_path = $2 WHERE id = $3`,
+		status, tempPath, id,
+	)
+	return err
+}
+
+func (r *PostgresRepository) UpdateFileUploadProcessingState(id int64, state string) error {
+	_, err := r.db.Exec(`UPDATE file_uploads SET processing_state = $1 WHERE id = $2`, state, id)
+	return err
+}
+
+func (r *PostgresRepository) UpdateFileUploadPerceptualHash(id int64, hash uint64) error {
+	_, err := r.db.Exec(`UPDATE file_uploads SET perceptual_hash = $1 WHERE id = $2`, nullHash(&hash), id)
+	return err
+}
+
+// UpdateFileUploadKey stores a re-wrapped data key; the file itself is untouched
+func (r *PostgresRepository) UpdateFileUploadKey(id int64, encryptedKey, keyID string) error {
+	_, err := r.db.Exec(
+		`UPDATE file_uploads SET encrypted_key = $1, encryption_key_id = $2 WHERE id = $3`,
+		encryptedKey, keyID, id,
+	)
+	return err
+}
+
+func (r *PostgresRepository) DeleteFileUpload(id int64) error {
+	_, err := r.db.Exec(`DELETE FROM file_uploads WHERE id = $1`, id)
+	return err
+}
+
+// SearchFileUploads ranks matches with ts_rank_cd; tag facets are counted over
+// every match, not just the returned page
+func (r *PostgresRepository) SearchFileUploads(userID int64, query SearchQuery) (*SearchResult, error) {
+	where := `user_id = $1`
+	args := []interface{}{userID}
+	rank := `0`
+
+	if query.Text != "" {
+		args = append(args, query.Text)
+		tsquery := fmt.Sprintf(`websearch_to_tsquery('simple', $%d)`, len(args))
+		where += ` AND search_vector @@ ` + tsquery
+		rank = `ts_rank_cd(search_vector, ` + tsquery + `)`
+	}
+	if len(query.Tags) > 0 {
+		args = append(args, pq.Array(query.Tags))
+		where += fmt.Sprintf(` AND tags @> $%d`, len(args))
+	}
+
+	result := &SearchResult{}
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM file_uploads WHERE `+where, args...).Scan(&result.Total); err != nil {
+		return nil, err
+	}
+	if result.Total == 0 {
+		return result, nil
+	}
+
+	pageArgs := append(append([]interface{}{}, args...), query.Limit, query.Offset)
+	rows, err := r.db.Query(
+		`SELECT `+fileUploadColumns+` FROM file_uploads WHERE `+where+`
+		ORDER BY `+rank+` DESC, created_at DESC
+		LIMIT `+fmt.Sprintf(`$%d OFFSET $%d`, len(args)+1, len(args)+2),
+		pageArgs...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		upload, err := scanFileUpload(rows)
+		if err != nil {
+			return nil, err
+		}
+		result.Uploads = append(result.Uploads, upload)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	facetRows, err := r.db.Query(
+		`SELECT tag, COUNT(*) FROM file_uploads, unnest(tags) AS tag
+		WHERE `+where+`
+		GROUP BY tag
+		ORDER BY COUNT(*) DESC, tag
+		LIMIT `+fmt.Sprintf(`%d`, MaxTagFacets),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer facetRows.Close()
+
+	for facetRows.Next() {
+		var facet TagCount
+		if err := facetRows.Scan(&facet.Tag, &facet.Count); err != nil {
+			return nil, err
+		}
+		result.TagFacets = append(result.TagFacets, facet)
+	}
+
+	return result, facetRows.Err()
+}
+
+func (r *PostgresRepository) UpdateFileUploadMetadata(id int64, expectedVersion int, update MetadataUpdate) (*FileUpload, error) {
+	set := []string{`version = version + 1`, `updated_at = CURRENT_TIMESTAMP`}
+	args := []interface{}{id}
+
+	assign := func(column string, value *string) {
+		if value == nil {
+			return
+		}
+		args = append(args, sql.NullString{String: *value, Valid: *value != ""})
+		set = append(set, fmt.Sprintf(`%s = $%d`, column, len(args)))
+	}
+	assign("display_name", update.DisplayName)
+	assign("caption", update.Caption)
+	assign("alt_text", update.AltText)
+	assign("visibility", update.Visibility)
+	if update.Tags != nil {
+		tags := *update.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		args = append(args, pq.Array(tags))
+		set = append(set, fmt.Sprintf(`tags = $%d`, len(args)))
+	}
+
+	where := `id = $1`
+	if expectedVersion != 0 {
+		args = append(args, expectedVersion)
+		where += fmt.Sprintf(` AND version = $%d`, len(args))
+	}
+
+	upload, err := scanFileUpload(r.db.QueryRow(
+		`UPDATE file_uploads SET `+strings.Join(set, ", ")+` WHERE `+where+` RETURNING `+fileUploadColumns,
+		args...,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrVersionConflict
+	}
+	return upload, err
+}
+
+// distanceScanner appends the computed distance column to a file upload scan
+type distanceScanner struct {
+	rowScanner
+	distance *int
+}
+
+func (s distanceScanner) Scan(dest ...interface{}) error {
+	return s.rowScanner.Scan(append(dest, s.distance)...)
+}
+
+func (r *PostgresRepository) FindSimilarFileUploads(userID, excludeID int64, hash uint64, maxDistance, limit int) ([]*SimilarUpload, error) {
+	rows, err := r.db.Query(
+		`SELECT `+fileUploadColumns+`, distance FROM (
+			SELECT *, bit_count((perceptual_hash # $3)::bit(64)) AS distance
+			FROM file_uploads
+			WHERE user_id = $1 AND id <> $2 AND perceptual_hash IS NOT NULL
+				AND status NOT IN ($4, $5)
+		) AS hashed
+		WHERE distance <= $6
+		ORDER BY distance, created_at DESC
+		LIMIT $7`,
+		userID, excludeID, int64(hash), StatusInfected, StatusQuarantined, maxDistance, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []*SimilarUpload
+	for rows.Next() {
+		match := &SimilarUpload{}
+		if match.Upload, err = scanFileUpload(distanceScanner{rows, &match.Distance}); err != nil {
+			return nil, err
+		}
+		matches = append(matches, match)
+	}
+
+	return matches, rows.Err()
 }
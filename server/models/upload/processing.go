@@ -0,0 +1,112 @@
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"elotus_test/server/models/events"
+	"elotus_test/server/models/jobs"
+)
+
+const (
+	ProcessingQueued     = "queued"
+	ProcessingInProgress = "processing"
+	ProcessingCompleted  = "completed"
+	ProcessingFailed     = "failed"
+)
+
+// JobProcessUpload is the job kind for post-upload work such as scanning
+const JobProcessUpload = "upload.process"
+
+type processUploadPayload struct {
+	UploadID int64 `json:"upload_id"`
+}
+
+// SetJobQueue moves post-upload processing off the request path
+func (h *Handler) SetJobQueue(queue *jobs.Queue) {
+	h.jobQueue = queue
+	queue.Register(JobProcessUpload, h.ProcessUploadJob)
+}
+
+func (h *Handler) initialProcessingState() string {
+	if h.jobQueue != nil {
+		return ProcessingQueued
+	}
+	return ProcessingCompleted
+}
+
+// processUpload hands a saved upload to the job queue, or processes it inline when no queue is configured
+func (h *Handler) processUpload(ctx context.Context, upload *FileUpload) {
+	if h.jobQueue != nil {
+		_, err := h.jobQueue.Enqueue(JobProcessUpload, processUploadPayload{UploadID: upload.ID})
+		if err == nil {
+			return
+		}
+		log.Printf("[Upload] Error enqueueing upload %d, processing inline: %v", upload.ID, err)
+	}
+
+	if err := h.scanUpload(ctx, upload); err != nil {
+		log.Printf("[Upload] Processing failed for upload %d: %v", upload.ID, err)
+	}
+	h.hashForDuplicates(upload)
+	if upload.ProcessingState != ProcessingCompleted {
+		if err := h.uploadRepo.UpdateFileUploadProcessingState(upload.ID, ProcessingCompleted); err != nil {
+			log.Printf("[Upload] Error updating processing state for upload %d: %v", upload.ID, err)
+			return
+		}
+		upload.ProcessingState = ProcessingCompleted
+	}
+}
+
+// ProcessUploadJob is the queue handler for JobProcessUpload
+func (h *Handler) ProcessUploadJob(ctx context.Context, job *jobs.Job) error {
+	var payload processUploadPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+
+	upload, found := h.uploadRepo.GetFileUploadByID(payload.UploadID)
+	if !found {
+		// The upload was removed before we got to it; nothing left to do
+		return nil
+	}
+
+	if err := h.uploadRepo.UpdateFileUploadProcessingState(upload.ID, ProcessingInProgress); err != nil {
+		return err
+	}
+
+	state := ProcessingCompleted
+	err := h.scanUpload(ctx, upload)
+	if err != nil {
+		state = ProcessingQueued
+		if job.LastAttempt() {
+			state = ProcessingFailed
+		}
+	} else {
+		h.hashForDuplicates(upload)
+	}
+
+	if updateErr := h.uploadRepo.UpdateFileUploadProcessingState(upload.ID, state); updateErr != nil && err == nil {
+		err = updateErr
+	}
+	if h.redis != nil {
+		_ = h.redis.Delete(h.cacheKey(upload.UserID))
+	}
+	if state != ProcessingQueued {
+		upload.ProcessingState = state
+		h.events.Publish(events.UploadProcessed, upload.UserID, h.duplicateData(EventData(upload), upload))
+	}
+
+	return err
+}
+
+// hashForDuplicates computes the perceptual hash used for duplicate detection.
+// Header-valid images can still fail a full decode; they just never match as
+// duplicates, so the failure does not fail processing.
+func (h *Handler) hashForDuplicates(upload *FileUpload) {
+	if err := h.hashUpload(upload); err != nil {
+		log.Printf("[Upload] Error hashing upload %d: %v", upload.ID, err)
+	}
+}
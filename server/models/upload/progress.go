@@ -0,0 +1,374 @@
+package upload
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"elotus_test/server/bredis"
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/events"
+	"elotus_test/server/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	ProgressReceiving  = "receiving"
+	ProgressProcessing = "processing"
+	ProgressCompleted  = "completed"
+	ProgressFailed     = "failed"
+)
+
+const (
+	// progressTTL is how long a record outlives its last update
+	progressTTL = 15 * time.Minute
+	// progressInterval throttles writes while the body is being read
+	progressInterval = 250 * time.Millisecond
+	// progressWait is how long a progress stream waits for an upload that has not started
+	progressWait       = time.Minute
+	uploadIDHeader     = "X-Upload-ID"
+	uploadIDQueryParam = "upload_id"
+)
+
+var uploadIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{8,64}$`)
+
+// Progress is the state of one client-labelled upload request
+type Progress struct {
+	UploadID      string `json:"upload_id"`
+	State         string `json:"state"`
+	BytesReceived int64  `json:"bytes_received"`
+	// BytesExpected is the request Content-Length, nil for chunked bodies
+	BytesExpected *int64    `json:"bytes_expected"`
+	FileUploadIDs []int64   `json:"file_upload_ids,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func (p *Progress) Done() bool {
+	return p.State == ProgressCompleted || p.State == ProgressFailed
+}
+
+// ProgressTracker stores upload progress in Redis when it is configured, so a
+// poll answered by any replica sees the upload another replica is reading;
+// without Redis records are kept in memory.
+type ProgressTracker struct {
+	redis *bredis.Client
+
+	mu      sync.Mutex
+	records map[string]Progress
+}
+
+func NewProgressTracker(redis *bredis.Client) *ProgressTracker {
+	return &ProgressTracker{redis: redis, records: make(map[string]Progress)}
+}
+
+func progressKey(userID int64, uploadID string) string {
+	return fmt.Sprintf("upload_progress:%d:%s", userID, uploadID)
+}
+
+func (t *ProgressTracker) Get(userID int64, uploadID string) (*Progress, bool) {
+	key := progressKey(userID, uploadID)
+
+	if t.redis != nil {
+		var p Progress
+		if err := t.redis.Get(key, &p); err != nil {
+			return nil, false
+		}
+		return &p, true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.records[key]
+	if !ok || time.Since(p.UpdatedAt) > progressTTL {
+		return nil, false
+	}
+	return &p, true
+}
+
+// save stores the record and returns it as stored
+func (t *ProgressTracker) save(userID int64, p Progress) Progress {
+	p.UpdatedAt = time.Now().UTC()
+	key := progressKey(userID, p.UploadID)
+
+	if t.redis != nil {
+		if err := t.redis.Set(key, p, progressTTL); err != nil {
+			log.Printf("[Upload] Error saving progress for %s: %v", p.UploadID, err)
+		}
+		return p
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.records[key] = p
+	if p.Done() {
+		for k, record := range t.records {
+			if time.Since(record.UpdatedAt) > progressTTL {
+				delete(t.records, k)
+			}
+		}
+	}
+	return p
+}
+
+// progressReporter follows one request. A nil reporter, used when the client
+// sent no upload ID, ignores every call.
+type progressReporter struct {
+	tracker *ProgressTracker
+	events  *events.Bus
+	userID  int64
+
+	mu       sync.Mutex
+	progress Progress
+	lastSave time.Time
+	// pending saves the latest count once the throttle interval has passed,
+	// so a read blocked on a slow client does not hide the bytes before it
+	pending *time.Timer
+}
+
+// trackProgress starts a record when the request carries an upload ID in the
+// X-Upload-ID header or the upload_id query parameter
+func (h *Handler) trackProgress(c echo.Context, userID int64) (*progressReporter, error) {
+	req := c.Request()
+	uploadID := req.Header.Get(uploadIDHeader)
+	if uploadID == "" {
+		uploadID = c.QueryParam(uploadIDQueryParam)
+	}
+	if uploadID == "" {
+		return nil, nil
+	}
+	if !uploadIDPattern.MatchString(uploadID) {
+		return nil, ErrInvalidUploadID
+	}
+
+	r := &progressReporter{
+		tracker:  h.progress,
+		events:   h.events,
+		userID:   userID,
+		progress: Progress{UploadID: uploadID, State: ProgressReceiving},
+	}
+	if req.ContentLength >= 0 {
+		expected := req.ContentLength
+		r.progress.BytesExpected = &expected
+	}
+	r.save()
+	return r, nil
+}
+
+// save writes the current state and publishes it for progress streams; r.mu
+// must be held except during setup
+func (r *progressReporter) save() {
+	r.lastSave = time.Now()
+	saved := r.tracker.save(r.userID, r.progress)
+	r.events.Publish(events.UploadProgress, r.userID, saved)
+}
+
+// wrap counts bytes as the handler reads them from body
+func (r *progressReporter) wrap(body io.ReadCloser) io.ReadCloser {
+	if r == nil {
+		return body
+	}
+	return &progressBody{ReadCloser: body, reporter: r}
+}
+
+func (r *progressReporter) add(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.progress.BytesReceived += int64(n)
+	if since := time.Since(r.lastSave); since >= progressInterval {
+		r.save()
+	} else if r.pending == nil {
+		r.pending = time.AfterFunc(progressInterval-since, r.flush)
+	}
+}
+
+func (r *progressReporter) flush() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pending = nil
+	if !r.progress.Done() {
+		r.save()
+	}
+}
+
+func (r *progressReporter) setState(state, message string, ids []int64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pending != nil {
+		r.pending.Stop()
+		r.pending = nil
+	}
+	r.progress.State = state
+	r.progress.Error = message
+	r.progress.FileUploadIDs = ids
+	r.save()
+}
+
+// received marks the body as fully read while the upload is stored and processed
+func (r *progressReporter) received() {
+	r.setState(ProgressProcessing, "", nil)
+}
+
+func (r *progressReporter) complete(ids ...int64) {
+	r.setState(ProgressCompleted, "", ids)
+}
+
+func (r *progressReporter) fail(message string) {
+	r.setState(ProgressFailed, message, nil)
+}
+
+type progressBody struct {
+	io.ReadCloser
+	reporter *progressReporter
+}
+
+func (b *progressBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.reporter.add(n)
+	return n, err
+}
+
+// UploadProgress reports how much of a labelled upload has been received. With
+// Accept: text/event-stream the progress is streamed until the upload finishes;
+// the stream may be opened before the upload starts.
+func (h *Handler) UploadProgress(c echo.Context) error {
+	claims := c.Get("user").(*auth.TokenClaims)
+
+	uploadID := c.Param("uploadId")
+	if !uploadIDPattern.MatchString(uploadID) {
+		return response.ValidationError(c, ErrInvalidUploadID.Error())
+	}
+
+	if strings.Contains(c.Request().Header.Get(echo.HeaderAccept), "text/event-stream") {
+		return h.streamProgress(c, claims.UserID, uploadID)
+	}
+
+	p, found := h.progress.Get(claims.UserID, uploadID)
+	if !found {
+		return response.NotFound(c, "Upload progress not found")
+	}
+	return response.Success(c, p)
+}
+
+// streamProgress relays the upload's progress events from the stream broker,
+// which fans them out from whichever replica is reading the body. The stored
+// record is sent first, so a stream opened mid-upload starts from the current
+// count.
+func (h *Handler) streamProgress(c echo.Context, userID int64, uploadID string) error {
+	if h.stream == nil {
+		return response.Error(c, http.StatusServiceUnavailable, response.ErrCodeInternalError, "Progress streaming is not available")
+	}
+	// Subscribing before reading the record means no update falls in between
+	sub, err := h.stream.Subscribe(userID)
+	if err != nil {
+		return response.Error(c, http.StatusServiceUnavailable, response.ErrCodeInternalError, err.Error())
+	}
+	defer h.stream.Unsubscribe(sub)
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	var last Progress
+	send := func(p *Progress) (bool, error) {
+		if p.State == last.State && p.BytesReceived == last.BytesReceived {
+			return false, nil
+		}
+		last = *p
+		data, err := json.Marshal(p)
+		if err != nil {
+			return false, err
+		}
+		if _, err := fmt.Fprintf(res, "event: progress\ndata: %s\n\n", data); err != nil {
+			return false, err
+		}
+		res.Flush()
+		return p.Done(), nil
+	}
+
+	if p, found := h.progress.Get(userID, uploadID); found {
+		if done, err := send(p); done || err != nil {
+			return nil
+		}
+	}
+
+	wait := time.NewTimer(progressWait)
+	defer wait.Stop()
+	heartbeat := time.NewTicker(h.stream.Heartbeat())
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+
+		case event, ok := <-sub.Events():
+			if !ok {
+				// Dropped for falling behind, or the server is shutting down
+				return nil
+			}
+			if event.Type == events.TokensRevoked {
+				return nil
+			}
+			p, ok := progressFromEvent(event, uploadID)
+			if !ok {
+				continue
+			}
+			if done, err := send(p); done || err != nil {
+				return nil
+			}
+			wait.Reset(progressWait)
+
+		case <-wait.C:
+			// A stalled upload still has a record; only a missing one expires the stream
+			if _, found := h.progress.Get(userID, uploadID); found {
+				wait.Reset(progressWait)
+				continue
+			}
+			fmt.Fprint(res, "event: expired\ndata: {}\n\n")
+			res.Flush()
+			return nil
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(res, ": ping\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		}
+	}
+}
+
+// progressFromEvent returns the progress an upload.progress event carries for
+// uploadID. Events relayed through Redis arrive decoded as maps, so the data is
+// round-tripped through JSON either way.
+func progressFromEvent(event events.Event, uploadID string) (*Progress, bool) {
+	if event.Type != events.UploadProgress {
+		return nil, false
+	}
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return nil, false
+	}
+	var p Progress
+	if err := json.Unmarshal(data, &p); err != nil || p.UploadID != uploadID {
+		return nil, false
+	}
+	return &p, true
+}
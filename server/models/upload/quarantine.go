@@ -0,0 +1,74 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"elotus_test/server/cmd"
+	"elotus_test/server/env"
+)
+
+const quarantineFolder = "quarantine"
+
+// scanUpload runs the configured scanner over a stored file and moves infected files into quarantine.
+// Scanner failures leave the upload pending so it is never served unchecked.
+func (h *Handler) scanUpload(ctx context.Context, upload *FileUpload) error {
+	if h.scanner == nil || upload.Status != StatusPending {
+		return nil
+	}
+
+	blob, err := OpenBlob(h.keyring, upload)
+	if err != nil {
+		return fmt.Errorf("failed to open file for scanning: %w", err)
+	}
+	result, err := h.scanner.Scan(ctx, blob)
+	blob.Close()
+	if err != nil {
+		return fmt.Errorf("scan failed: %w", err)
+	}
+
+	if result.Clean {
+		if err := h.uploadRepo.UpdateFileUploadStatus(upload.ID, StatusClean, upload.TempPath); err != nil {
+			return fmt.Errorf("failed to update status: %w", err)
+		}
+		upload.Status = StatusClean
+		return nil
+	}
+
+	log.Printf("[Upload] Upload %d infected: %s", upload.ID, result.Signature)
+	if err := h.uploadRepo.UpdateFileUploadStatus(upload.ID, StatusInfected, upload.TempPath); err != nil {
+		return fmt.Errorf("failed to update status: %w", err)
+	}
+	upload.Status = StatusInfected
+
+	quarantinePath, err := quarantineFile(upload.TempPath)
+	if err != nil {
+		return err
+	}
+	if err := h.uploadRepo.UpdateFileUploadStatus(upload.ID, StatusQuarantined, quarantinePath); err != nil {
+		return fmt.Errorf("failed to update status: %w", err)
+	}
+	upload.Status = StatusQuarantined
+	upload.TempPath = quarantinePath
+	return nil
+}
+
+// quarantineFile moves a file out of the served media tree
+func quarantineFile(filePath string) (string, error) {
+	folder := filepath.Join(cmd.ResolvePath(env.E.GetUploadStoragePath()), quarantineFolder)
+	if err := os.MkdirAll(folder, 0700); err != nil {
+		return "", fmt.Errorf("failed to create quarantine folder: %w", err)
+	}
+
+	target := filepath.Join(folder, filepath.Base(filePath))
+	if err := os.Rename(filePath, target); err != nil {
+		return "", fmt.Errorf("failed to move file: %w", err)
+	}
+	if err := os.Chmod(target, 0600); err != nil {
+		log.Printf("[Upload] Error restricting quarantined file: %v", err)
+	}
+	return target, nil
+}
@@ -0,0 +1,260 @@
+package upload
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"elotus_test/server/cmd"
+	"elotus_test/server/env"
+	"elotus_test/server/models/events"
+)
+
+// MediaFolders are the storage subfolders that hold upload blobs; anything
+// else under the storage root (archives, temp files) is left alone
+var MediaFolders = []string{"images", quarantineFolder}
+
+const reconcileBatchSize = 500
+
+type ReconcileOptions struct {
+	// DryRun reports drift without deleting anything
+	DryRun bool
+	// VerifyChecksums re-hashes every file; sizes are always compared
+	VerifyChecksums bool
+	// GracePeriod skips files and rows younger than this, since an upload in
+	// flight has its file on disk before its row is inserted
+	GracePeriod time.Duration
+}
+
+type ReconcileReport struct {
+	DryRun       bool `json:"dry_run"`
+	RowsScanned  int  `json:"rows_scanned"`
+	FilesScanned int  `json:"files_scanned"`
+
+	// OrphanFiles exist on disk with no row pointing at them
+	OrphanFiles []string `json:"orphan_files"`
+	// MissingFiles are rows whose file is gone
+	MissingFiles       []int64 `json:"missing_files"`
+	SizeMismatches     []int64 `json:"size_mismatches"`
+	ChecksumMismatches []int64 `json:"checksum_mismatches"`
+
+	RemovedFiles int `json:"removed_files"`
+	RemovedRows  int `json:"removed_rows"`
+	Errors       int `json:"errors"`
+}
+
+// WriteSummary prints the report for the reconcile-uploads command
+func (r *ReconcileReport) WriteSummary(w io.Writer) {
+	mode := "fix"
+	if r.DryRun {
+		mode = "dry run"
+	}
+	fmt.Fprintf(w, "Upload reconciliation (%s)\n", mode)
+	fmt.Fprintf(w, "  Rows scanned:        %d\n", r.RowsScanned)
+	fmt.Fprintf(w, "  Files scanned:       %d\n", r.FilesScanned)
+	fmt.Fprintf(w, "  Orphan files:        %d (removed %d)\n", len(r.OrphanFiles), r.RemovedFiles)
+	fmt.Fprintf(w, "  Rows missing files:  %d (removed %d)\n", len(r.MissingFiles), r.RemovedRows)
+	fmt.Fprintf(w, "  Size mismatches:     %d\n", len(r.SizeMismatches))
+	fmt.Fprintf(w, "  Checksum mismatches: %d\n", len(r.ChecksumMismatches))
+	fmt.Fprintf(w, "  Errors:              %d\n", r.Errors)
+
+	for _, path := range r.OrphanFiles {
+		fmt.Fprintf(w, "  orphan file: %s\n", path)
+	}
+	for _, id := range r.MissingFiles {
+		fmt.Fprintf(w, "  missing file for upload %d\n", id)
+	}
+	for _, id := range r.SizeMismatches {
+		fmt.Fprintf(w, "  size mismatch for upload %d\n", id)
+	}
+	for _, id := range r.ChecksumMismatches {
+		fmt.Fprintf(w, "  checksum mismatch for upload %d\n", id)
+	}
+}
+
+// Drifted reports whether storage and the database disagree
+func (r *ReconcileReport) Drifted() bool {
+	return len(r.OrphanFiles)+len(r.MissingFiles)+len(r.SizeMismatches)+len(r.ChecksumMismatches) > 0
+}
+
+// ReconcileUploads compares file_uploads with the files in storage. Unless
+// DryRun is set, orphan files are deleted and rows whose file is gone are
+// removed; size and checksum mismatches are only reported since either side
+// could be the wrong one.
+func (h *Handler) ReconcileUploads(ctx context.Context, opts ReconcileOptions) (*ReconcileReport, error) {
+	report := &ReconcileReport{
+		DryRun:             opts.DryRun,
+		OrphanFiles:        []string{},
+		MissingFiles:       []int64{},
+		SizeMismatches:     []int64{},
+		ChecksumMismatches: []int64{},
+	}
+	cutoff := time.Now().Add(-opts.GracePeriod)
+	known := make(map[string]bool)
+	touchedUsers := make(map[int64]bool)
+
+	var afterID int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		uploads, err := h.uploadRepo.ListFileUploadsAfter(afterID, reconcileBatchSize)
+		if err != nil {
+			return report, err
+		}
+		if len(uploads) == 0 {
+			break
+		}
+		afterID = uploads[len(uploads)-1].ID
+
+		for _, upload := range uploads {
+			report.RowsScanned++
+			known[filepath.Clean(upload.TempPath)] = true
+			if upload.CreatedAt.After(cutoff) {
+				continue
+			}
+
+			if h.checkUploadFile(upload, opts, report) || opts.DryRun {
+				continue
+			}
+			if err := h.uploadRepo.DeleteFileUpload(upload.ID); err != nil {
+				log.Printf("[Reconcile] Error deleting upload %d: %v", upload.ID, err)
+				report.Errors++
+				continue
+			}
+			report.RemovedRows++
+			touchedUsers[upload.UserID] = true
+			h.events.Publish(events.UploadDeleted, upload.UserID, EventData(upload))
+		}
+	}
+
+	root := cmd.ResolvePath(env.E.GetUploadStoragePath())
+	for _, folder := range MediaFolders {
+		err := filepath.WalkDir(filepath.Join(root, folder), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() {
+				return ctx.Err()
+			}
+
+			report.FilesScanned++
+			if known[filepath.Clean(path)] {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil || info.ModTime().After(cutoff) {
+				return nil
+			}
+
+			report.OrphanFiles = append(report.OrphanFiles, path)
+			if opts.DryRun {
+				return nil
+			}
+			if err := os.Remove(path); err != nil {
+				log.Printf("[Reconcile] Error removing orphan %s: %v", path, err)
+				report.Errors++
+				return nil
+			}
+			report.RemovedFiles++
+			return nil
+		})
+		if err != nil {
+			return report, err
+		}
+	}
+
+	if h.redis != nil {
+		for userID := range touchedUsers {
+			_ = h.redis.Delete(h.cacheKey(userID))
+		}
+	}
+
+	return report, nil
+}
+
+// checkUploadFile records size and checksum drift for one row, comparing
+// against the decrypted content for encrypted files. It returns false only
+// when the file is missing.
+func (h *Handler) checkUploadFile(upload *FileUpload, opts ReconcileOptions, report *ReconcileReport) bool {
+	blob, err := OpenBlob(h.keyring, upload)
+	if errors.Is(err, fs.ErrNotExist) {
+		report.MissingFiles = append(report.MissingFiles, upload.ID)
+		return false
+	}
+	if err != nil {
+		log.Printf("[Reconcile] Error checking upload %d: %v", upload.ID, err)
+		report.Errors++
+		return true
+	}
+	defer blob.Close()
+
+	if blob.Size != upload.FileSize {
+		report.SizeMismatches = append(report.SizeMismatches, upload.ID)
+		return true
+	}
+
+	if opts.VerifyChecksums && upload.Checksum != "" {
+		sum, err := blobChecksum(blob)
+		if err != nil {
+			log.Printf("[Reconcile] Error hashing upload %d: %v", upload.ID, err)
+			report.Errors++
+			return true
+		}
+		if sum != upload.Checksum {
+			report.ChecksumMismatches = append(report.ChecksumMismatches, upload.ID)
+		}
+	}
+	return true
+}
+
+func blobChecksum(blob *Blob) (string, error) {
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, blob); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// RunPeriodicReconcile reconciles every interval until ctx is cancelled. The
+// returned channel is closed once the loop has stopped.
+func (h *Handler) RunPeriodicReconcile(ctx context.Context, interval time.Duration, opts ReconcileOptions) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			report, err := h.ReconcileUploads(ctx, opts)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("[Reconcile] Periodic run failed: %v", err)
+				continue
+			}
+			if report != nil && report.Drifted() {
+				log.Printf("[Reconcile] orphan files: %d (removed %d), rows missing files: %d (removed %d), size mismatches: %d, checksum mismatches: %d",
+					len(report.OrphanFiles), report.RemovedFiles, len(report.MissingFiles), report.RemovedRows,
+					len(report.SizeMismatches), len(report.ChecksumMismatches))
+			}
+		}
+	}()
+	return done
+}
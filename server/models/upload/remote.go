@@ -0,0 +1,157 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"elotus_test/server/env"
+	"elotus_test/server/models/audit"
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/events"
+	"elotus_test/server/netguard"
+	"elotus_test/server/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ImportURLRequest struct {
+	URL string `json:"url"`
+}
+
+// newRemoteClient builds an HTTP client that refuses to connect to private and
+// loopback addresses. The check runs in the dialer after DNS resolution, so a
+// hostname that later resolves to an internal address is blocked as well.
+func newRemoteClient() *http.Client {
+	timeout := env.E.GetRemoteFetchTimeout()
+	maxRedirects := env.E.GetRemoteMaxRedirects()
+	allowPrivate := env.E.AllowRemotePrivateIP()
+
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = netguard.Control(ErrRemoteAddressBlocked)
+	}
+
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 5 * time.Second,
+		MaxIdleConns:          1,
+		DisableKeepAlives:     true,
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return ErrTooManyRedirects
+			}
+			return validateRemoteURL(req.URL)
+		},
+	}
+}
+
+func validateRemoteURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ErrInvalidRemoteURL
+	}
+	if u.Hostname() == "" || u.User != nil {
+		return ErrInvalidRemoteURL
+	}
+	return nil
+}
+
+func remoteFilename(u *url.URL) string {
+	name := path.Base(u.Path)
+	if name == "." || name == "/" || name == "" {
+		return "download"
+	}
+	return name
+}
+
+func (h *Handler) ImportFromURL(c echo.Context) error {
+	claims := c.Get("user").(*auth.TokenClaims)
+
+	var req ImportURLRequest
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	sourceURL, err := url.Parse(strings.TrimSpace(req.URL))
+	if err != nil || validateRemoteURL(sourceURL) != nil {
+		return response.ValidationError(c, ErrInvalidRemoteURL.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), env.E.GetRemoteFetchTimeout())
+	defer cancel()
+
+	fetchReq, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL.String(), nil)
+	if err != nil {
+		return response.ValidationError(c, ErrInvalidRemoteURL.Error())
+	}
+	fetchReq.Header.Set("Accept", "image/*")
+
+	resp, err := newRemoteClient().Do(fetchReq)
+	if err != nil {
+		return uploadError(c, remoteFetchError(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return uploadError(c, fmt.Errorf("%w: status %d", ErrRemoteFetchFailed, resp.StatusCode))
+	}
+	if resp.ContentLength > MaxFileSize {
+		return uploadError(c, ErrFileTooLarge)
+	}
+
+	// Filename comes from the final URL so redirects to a CDN still produce a sensible name
+	originalFilename := remoteFilename(resp.Request.URL)
+	ingested, err := h.ingest(claims.UserID, resp.Body, originalFilename, "data")
+	if err != nil {
+		return uploadError(c, remoteFetchError(err))
+	}
+
+	uploadRecord := h.newUploadRecord(c, claims.UserID, originalFilename, ingested)
+	uploadRecord.SourceURL = sourceURL.String()
+
+	savedUpload, err := h.uploadRepo.CreateFileUpload(uploadRecord)
+	if err != nil {
+		os.Remove(ingested.AbsolutePath)
+		return response.InternalError(c, "Failed to save file metadata")
+	}
+
+	h.processUpload(c.Request().Context(), savedUpload)
+
+	if h.redis != nil {
+		_ = h.redis.Delete(h.cacheKey(claims.UserID))
+	}
+	h.events.Publish(events.UploadCreated, claims.UserID, EventData(savedUpload))
+	h.auditUpload(c, audit.ActionUploadCreated, claims.UserID, savedUpload, "url")
+
+	return response.Success(c, h.uploadResponse(savedUpload, ingested))
+}
+
+// remoteFetchError unwraps the url.Error returned by http.Client so our sentinel errors are classified correctly
+func remoteFetchError(err error) error {
+	for _, sentinel := range []error{ErrRemoteAddressBlocked, ErrTooManyRedirects, ErrInvalidRemoteURL} {
+		if errors.Is(err, sentinel) {
+			return sentinel
+		}
+	}
+
+	var urlErr *url.Error
+	var netErr net.Error
+	if errors.As(err, &urlErr) || errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %v", ErrRemoteFetchFailed, err)
+	}
+	return err
+}
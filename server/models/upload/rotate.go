@@ -0,0 +1,76 @@
+package upload
+
+import (
+	"context"
+	"log"
+
+	"elotus_test/server/envelope"
+)
+
+type RotationReport struct {
+	DryRun bool `json:"dry_run"`
+	// Rewrapped counts data keys moved to the primary master key (or that would be, in a dry run)
+	Rewrapped int `json:"rewrapped"`
+	Current   int `json:"current"`
+	Plaintext int `json:"plaintext"`
+	Errors    int `json:"errors"`
+}
+
+// RotateEncryptionKeys re-wraps every data key that is not under the primary
+// master key. Files are not rewritten: only the small wrapped key in the row
+// changes, so rotation is cheap and the old key can be retired afterwards.
+func (h *Handler) RotateEncryptionKeys(ctx context.Context, dryRun bool) (*RotationReport, error) {
+	if h.keyring == nil {
+		return nil, envelope.ErrNotConfigured
+	}
+
+	report := &RotationReport{DryRun: dryRun}
+	primary := h.keyring.PrimaryID()
+
+	var afterID int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		uploads, err := h.uploadRepo.ListFileUploadsAfter(afterID, reconcileBatchSize)
+		if err != nil {
+			return report, err
+		}
+		if len(uploads) == 0 {
+			return report, nil
+		}
+		afterID = uploads[len(uploads)-1].ID
+
+		for _, upload := range uploads {
+			switch {
+			case upload.EncryptedKey == "":
+				report.Plaintext++
+				continue
+			case upload.EncryptionKeyID == primary:
+				report.Current++
+				continue
+			}
+
+			dataKey, err := h.keyring.Unwrap(upload.EncryptionKeyID, upload.EncryptedKey)
+			if err != nil {
+				log.Printf("[Encryption] Error unwrapping key for upload %d: %v", upload.ID, err)
+				report.Errors++
+				continue
+			}
+			wrapped, err := h.keyring.Wrap(dataKey)
+			if err != nil {
+				return report, err
+			}
+
+			if !dryRun {
+				if err := h.uploadRepo.UpdateFileUploadKey(upload.ID, wrapped, primary); err != nil {
+					log.Printf("[Encryption] Error storing key for upload %d: %v", upload.ID, err)
+					report.Errors++
+					continue
+				}
+			}
+			report.Rewrapped++
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package upload
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	StatusPending     = "pending"
+	StatusClean       = "clean"
+	StatusInfected    = "infected"
+	StatusQuarantined = "quarantined"
+)
+
+type ScanResult struct {
+	Clean     bool
+	Signature string
+}
+
+// Scanner inspects a stored file for malware or unwanted content
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (*ScanResult, error)
+}
+
+const clamdChunkSize = 32 * 1024
+
+// ClamdScanner speaks the clamd INSTREAM protocol over TCP or a Unix socket
+type ClamdScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+func NewClamdScanner(network, address string, timeout time.Duration) *ClamdScanner {
+	return &ClamdScanner{network: network, address: address, timeout: timeout}
+}
+
+// ParseScannerAddress accepts "unix:///path/clamd.sock", "tcp://host:port" or a bare "host:port"
+func ParseScannerAddress(addr string) (network, address string) {
+	switch {
+	case strings.HasPrefix(addr, "unix://"):
+		return "unix", strings.TrimPrefix(addr, "unix://")
+	case strings.HasPrefix(addr, "unix:"):
+		return "unix", strings.TrimPrefix(addr, "unix:")
+	case strings.HasPrefix(addr, "tcp://"):
+		return "tcp", strings.TrimPrefix(addr, "tcp://")
+	default:
+		return "tcp", addr
+	}
+}
+
+func (s *ClamdScanner) Scan(ctx context.Context, r io.Reader) (*ScanResult, error) {
+	dialer := &net.Dialer{Timeout: s.timeout}
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+
+	// The "z" prefix selects null-terminated commands and replies
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return nil, fmt.Errorf("failed to send INSTREAM: %w", err)
+	}
+
+	// Each chunk is a 4-byte big-endian length followed by the data
+	chunk := make([]byte, 4+clamdChunkSize)
+	for {
+		n, readErr := r.Read(chunk[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(chunk[:4], uint32(n))
+			if _, err := conn.Write(chunk[:4+n]); err != nil {
+				return nil, fmt.Errorf("failed to stream to clamd: %w", err)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+
+	// A zero-length chunk terminates the stream
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return nil, fmt.Errorf("failed to finish stream: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !(errors.Is(err, io.EOF) && reply != "") {
+		return nil, fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+
+	return parseClamdReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// parseClamdReply understands "stream: OK", "stream: <signature> FOUND" and "<message> ERROR"
+func parseClamdReply(reply string) (*ScanResult, error) {
+	switch {
+	case strings.HasSuffix(reply, " OK"):
+		return &ScanResult{Clean: true}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		signature := strings.TrimSuffix(reply, " FOUND")
+		if i := strings.Index(signature, ": "); i >= 0 {
+			signature = signature[i+2:]
+		}
+		return &ScanResult{Clean: false, Signature: signature}, nil
+	default:
+		return nil, fmt.Errorf("clamd error: %s", reply)
+	}
+}
@@ -0,0 +1,221 @@
+package upload
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"elotus_test/server/models/auth"
+	"elotus_test/server/pagination"
+	"elotus_test/server/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	MaxTags          = 20
+	MaxTagLength     = 32
+	MaxCaptionLength = 1000
+
+	// MaxTagFacets bounds the facet list returned with search results
+	MaxTagFacets = 50
+)
+
+// SearchQuery filters a user's uploads. Text is matched against the original
+// filename, caption and tags; every tag in Tags must be present.
+type SearchQuery struct {
+	Text   string
+	Tags   []string
+	Limit  int
+	Offset int
+}
+
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// SearchResult holds one page of matches plus totals across all matches
+type SearchResult struct {
+	Uploads   []*FileUpload
+	Total     int
+	TagFacets []TagCount
+}
+
+// NormalizeTags lowercases, trims and de-duplicates tags, keeping their order
+func NormalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.Join(strings.Fields(tag), " "))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > MaxTagLength {
+			return nil, ErrTagTooLong
+		}
+		for _, r := range tag {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != ' ' && r != '-' && r != '_' {
+				return nil, ErrInvalidTag
+			}
+		}
+
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+
+	if len(normalized) > MaxTags {
+		return nil, ErrTooManyTags
+	}
+	return normalized, nil
+}
+
+// ownedUpload loads the upload named by :id, writing a response and returning
+// a nil upload when it is missing or belongs to someone else
+func (h *Handler) ownedUpload(c echo.Context, userID int64) (*FileUpload, error) {
+	var id int64
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	upload, found := h.uploadRepo.GetFileUploadByID(id)
+	if !found {
+		return nil, response.NotFound(c, "Upload not found")
+	}
+	if upload.UserID != userID {
+		return nil, response.Forbidden(c, "Access denied")
+	}
+	return upload, nil
+}
+
+type tagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// SetTags replaces the tags on an upload
+func (h *Handler) SetTags(c echo.Context) error {
+	claims := c.Get("user").(*auth.TokenClaims)
+
+	upload, err := h.ownedUpload(c, claims.UserID)
+	if upload == nil {
+		return err
+	}
+
+	var req tagsRequest
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	tags, err := NormalizeTags(req.Tags)
+	if err != nil {
+		return response.ValidationError(c, tagError(err))
+	}
+
+	return h.saveAnnotations(c, upload, MetadataUpdate{Tags: &tags})
+}
+
+type captionRequest struct {
+	Caption string `json:"caption"`
+}
+
+// SetCaption replaces the caption on an upload; an empty caption clears it
+func (h *Handler) SetCaption(c echo.Context) error {
+	claims := c.Get("user").(*auth.TokenClaims)
+
+	upload, err := h.ownedUpload(c, claims.UserID)
+	if upload == nil {
+		return err
+	}
+
+	var req captionRequest
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	caption := strings.TrimSpace(req.Caption)
+	if utf8.RuneCountInString(caption) > MaxCaptionLength {
+		return response.ValidationError(c, fmt.Sprintf("%s (max: %d characters)", ErrCaptionTooLong.Error(), MaxCaptionLength))
+	}
+
+	return h.saveAnnotations(c, upload, MetadataUpdate{Caption: &caption})
+}
+
+// saveAnnotations writes only the field the request sets, so a concurrent edit
+// of the other one is kept. If-Match is honoured as on PATCH /api/uploads/:id,
+// but not required.
+func (h *Handler) saveAnnotations(c echo.Context, upload *FileUpload, update MetadataUpdate) error {
+	expected := 0
+	if ifMatch := c.Request().Header.Get("If-Match"); ifMatch != "" {
+		version, ok := parseIfMatch(ifMatch)
+		if !ok || (version != 0 && version != upload.Version) {
+			return h.versionConflict(c, upload)
+		}
+		expected = version
+	}
+	return h.applyMetadata(c, upload, expected, update)
+}
+
+func tagError(err error) string {
+	switch {
+	case errors.Is(err, ErrTooManyTags):
+		return fmt.Sprintf("%s (max: %d)", err.Error(), MaxTags)
+	case errors.Is(err, ErrTagTooLong):
+		return fmt.Sprintf("%s (max: %d characters)", err.Error(), MaxTagLength)
+	default:
+		return err.Error()
+	}
+}
+
+// SearchUploads runs a full-text search over the caller's uploads. "q" accepts
+// web-search syntax (quoted phrases, "or", "-word"); "tag" may be repeated or
+// comma-separated and narrows results to uploads carrying every listed tag.
+func (h *Handler) SearchUploads(c echo.Context) error {
+	claims := c.Get("user").(*auth.TokenClaims)
+
+	page, err := pagination.FromRequest(c)
+	if err != nil {
+		return response.ValidationError(c, err.Error())
+	}
+
+	text := strings.TrimSpace(c.QueryParam("q"))
+	var rawTags []string
+	for _, value := range c.QueryParams()["tag"] {
+		rawTags = append(rawTags, strings.Split(value, ",")...)
+	}
+	tags, err := NormalizeTags(rawTags)
+	if err != nil {
+		return response.ValidationError(c, tagError(err))
+	}
+
+	if text == "" && len(tags) == 0 {
+		return response.ValidationError(c, "q or tag is required")
+	}
+	if utf8.RuneCountInString(text) > 256 {
+		return response.ValidationError(c, "q is too long (max: 256 characters)")
+	}
+
+	result, err := h.uploadRepo.SearchFileUploads(claims.UserID, SearchQuery{
+		Text:   text,
+		Tags:   tags,
+		Limit:  page.PerPage,
+		Offset: page.Offset(),
+	})
+	if err != nil {
+		return response.InternalError(c, "Failed to search uploads")
+	}
+
+	results := make([]echo.Map, 0, len(result.Uploads))
+	for _, upload := range result.Uploads {
+		results = append(results, Details(upload))
+	}
+	facets := result.TagFacets
+	if facets == nil {
+		facets = []TagCount{}
+	}
+
+	return response.SuccessWithMeta(c, echo.Map{
+		"results": results,
+		"facets":  echo.Map{"tags": facets},
+	}, page.Meta(result.Total))
+}
@@ -0,0 +1,184 @@
+package upload
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"math/bits"
+	"strconv"
+
+	"elotus_test/server/env"
+	"elotus_test/server/models/auth"
+	"elotus_test/server/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// MaxSimilarDistance bounds the max_distance query parameter; beyond it matches are noise
+	MaxSimilarDistance = 32
+	MaxSimilarResults  = 50
+
+	// maxDuplicateHints is how many near-duplicate ids an upload response lists
+	maxDuplicateHints = 5
+
+	// dhashSamples caps the pixels averaged per axis of each hash cell so huge images stay cheap
+	dhashSamples = 16
+)
+
+// SimilarUpload is a near-duplicate match and its Hamming distance from the query hash
+type SimilarUpload struct {
+	Upload   *FileUpload
+	Distance int
+}
+
+// PerceptualHash computes a 64-bit difference hash: the image is shrunk to 9x8
+// grayscale cells and each bit records whether a cell is brighter than its right
+// neighbour. Resizing and recompression barely move the gradients, so copies land
+// a few bits apart while unrelated images differ in about half of them.
+func PerceptualHash(img image.Image) uint64 {
+	const width, height = 9, 8
+	var cells [height][width]uint32
+
+	bounds := img.Bounds()
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := bounds.Min.Y + (y+1)*bounds.Dy()/height
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := bounds.Min.X + (x+1)*bounds.Dx()/width
+			cells[y][x] = averageLuma(img, x0, y0, x1, y1)
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < height; y++ {
+		for x := 0; x < width-1; x++ {
+			hash <<= 1
+			if cells[y][x] > cells[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// averageLuma averages the 16-bit luminance of up to dhashSamples² pixels spread over the cell
+func averageLuma(img image.Image, x0, y0, x1, y1 int) uint32 {
+	if x1 <= x0 {
+		x1 = x0 + 1
+	}
+	if y1 <= y0 {
+		y1 = y0 + 1
+	}
+	stepX := max((x1-x0)/dhashSamples, 1)
+	stepY := max((y1-y0)/dhashSamples, 1)
+
+	var sum, count uint64
+	for y := y0; y < y1; y += stepY {
+		for x := x0; x < x1; x += stepX {
+			r, g, b, _ := img.At(x, y).RGBA()
+			sum += uint64((19595*r + 38470*g + 7471*b + 1<<15) >> 16)
+			count++
+		}
+	}
+	return uint32(sum / count)
+}
+
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// hashUpload decodes an upload's image and stores its perceptual hash. It runs
+// as part of processing, so the full decode stays off the request path and
+// shares the decode budget with every other decode in flight. Quarantined and
+// infected files are never hashed.
+func (h *Handler) hashUpload(upload *FileUpload) error {
+	if upload.PerceptualHash != nil || upload.Status == StatusQuarantined || upload.Status == StatusInfected {
+		return nil
+	}
+
+	blob, err := OpenBlob(h.keyring, upload)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	img, _, release, err := DecodeImage(blob, h.budget)
+	if err != nil {
+		return err
+	}
+	hash := PerceptualHash(img)
+	release()
+
+	if err := h.uploadRepo.UpdateFileUploadPerceptualHash(upload.ID, hash); err != nil {
+		return fmt.Errorf("failed to store perceptual hash: %w", err)
+	}
+	upload.PerceptualHash = &hash
+	return nil
+}
+
+// duplicateData flags an upload whose perceptual hash matches another of the owner's uploads
+func (h *Handler) duplicateData(data echo.Map, upload *FileUpload) echo.Map {
+	duplicates := h.possibleDuplicates(upload)
+	data["possible_duplicate"] = len(duplicates) > 0
+	data["duplicate_of"] = duplicates
+	return data
+}
+
+// possibleDuplicates returns the ids of the owner's other uploads that look like this one
+func (h *Handler) possibleDuplicates(upload *FileUpload) []int64 {
+	ids := []int64{}
+	if upload.PerceptualHash == nil {
+		return ids
+	}
+
+	matches, err := h.uploadRepo.FindSimilarFileUploads(upload.UserID, upload.ID, *upload.PerceptualHash,
+		env.E.GetSimilarityThreshold(), maxDuplicateHints)
+	if err != nil {
+		log.Printf("[Upload] Error looking up duplicates of upload %d: %v", upload.ID, err)
+		return ids
+	}
+	for _, match := range matches {
+		ids = append(ids, match.Upload.ID)
+	}
+	return ids
+}
+
+// SimilarUploads lists the caller's uploads within max_distance bits of the
+// upload's perceptual hash, closest first
+func (h *Handler) SimilarUploads(c echo.Context) error {
+	claims := c.Get("user").(*auth.TokenClaims)
+
+	upload, err := h.ownedUpload(c, claims.UserID)
+	if upload == nil {
+		return err
+	}
+
+	maxDistance := env.E.GetSimilarityThreshold()
+	if raw := c.QueryParam("max_distance"); raw != "" {
+		maxDistance, err = strconv.Atoi(raw)
+		if err != nil || maxDistance < 0 || maxDistance > MaxSimilarDistance {
+			return response.ValidationError(c, fmt.Sprintf("max_distance must be between 0 and %d", MaxSimilarDistance))
+		}
+	}
+
+	results := []echo.Map{}
+	if upload.PerceptualHash == nil {
+		// Not an image we could decode, or stored before hashing existed
+		return response.Success(c, echo.Map{"results": results, "max_distance": maxDistance})
+	}
+
+	matches, err := h.uploadRepo.FindSimilarFileUploads(claims.UserID, upload.ID, *upload.PerceptualHash,
+		maxDistance, MaxSimilarResults)
+	if err != nil {
+		return response.InternalError(c, "Failed to find similar uploads")
+	}
+	for _, match := range matches {
+		details := Details(match.Upload)
+		details["distance"] = match.Distance
+		results = append(results, details)
+	}
+
+	return response.Success(c, echo.Map{"results": results, "max_distance": maxDistance})
+}
@@ -0,0 +1,322 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// markerScanner looks for embeddedMarkers across write boundaries
+type markerScanner struct {
+	tail  []byte
+	found bool
+}
+
+func (s *markerScanner) Write(p []byte) (int, error) {
+	if s.found {
+		return len(p), nil
+	}
+
+	window := make([]byte, 0, len(s.tail)+len(p))
+	window = append(window, s.tail...)
+	for _, b := range p {
+		if 'A' <= b && b <= 'Z' {
+			b += 'a' - 'A'
+		}
+		window = append(window, b)
+	}
+
+	for _, marker := range embeddedMarkers {
+		if bytes.Contains(window, marker) {
+			s.found = true
+			return len(p), nil
+		}
+	}
+
+	// Keep just enough bytes to catch a marker split across two writes
+	keep := 0
+	for _, marker := range embeddedMarkers {
+		if len(marker)-1 > keep {
+			keep = len(marker) - 1
+		}
+	}
+	if len(window) > keep {
+		window = window[len(window)-keep:]
+	}
+	s.tail = append(s.tail[:0], window...)
+
+	return len(p), nil
+}
+
+// reset forgets the tail so a marker is never matched across two separate regions
+func (s *markerScanner) reset() {
+	s.tail = s.tail[:0]
+}
+
+// textScanner walks the container structure of JPEG, PNG, GIF and WebP files as
+// they stream to storage and hands only the parts that can carry text to a
+// markerScanner: metadata and comment segments, and anything after the end of
+// the image. Compressed pixel data is skipped because random bytes match a
+// four-byte marker often enough to reject real photos. BMP and TIFF hold raw or
+// loosely structured pixel data and are not scanned.
+type textScanner struct {
+	markers markerScanner
+
+	pending []byte
+	skip    int
+	// scan feeds the skipped bytes to markers instead of dropping them
+	scan bool
+	want int
+	next func(s *textScanner, b []byte)
+
+	jpegSegment byte
+	// entropy is set inside JPEG scan data, which runs until the next marker
+	entropy bool
+	sawFF   bool
+	// gifText marks the sub-blocks of a GIF comment, plain text or application extension
+	gifText bool
+	// webpLeft counts the RIFF payload bytes not yet walked
+	webpLeft int
+	// trailing is set past the end of the image, where everything is scanned
+	trailing bool
+	done     bool
+}
+
+func newTextScanner(format string) *textScanner {
+	s := &textScanner{}
+	switch format {
+	case "jpeg":
+		// Skip SOI
+		s.expect(2, 1, onJPEGPrefix)
+	case "png":
+		s.expect(8, 8, onPNGTextChunk)
+	case "gif":
+		s.expect(0, 13, onGIFTextScreen)
+	case "webp":
+		s.expect(0, 12, onWebPHeader)
+	default:
+		s.done = true
+	}
+	return s
+}
+
+// Found reports whether an embedded marker was seen
+func (s *textScanner) Found() bool {
+	return s.markers.found
+}
+
+// expect drops skip bytes, then collects want bytes for next. A want of zero
+// calls next as soon as the skip is done.
+func (s *textScanner) expect(skip, want int, next func(s *textScanner, b []byte)) {
+	s.markers.reset()
+	s.skip, s.scan, s.want, s.next = skip, false, want, next
+	s.pending = s.pending[:0]
+}
+
+// inspect is expect with the skipped bytes scanned for markers
+func (s *textScanner) inspect(n, want int, next func(s *textScanner, b []byte)) {
+	s.skip, s.scan, s.want, s.next = n, true, want, next
+	s.pending = s.pending[:0]
+}
+
+func (s *textScanner) startTrailing() {
+	s.markers.reset()
+	s.trailing = true
+}
+
+func (s *textScanner) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 && !s.done && !s.markers.found {
+		switch {
+		case s.trailing:
+			s.markers.Write(p)
+			p = nil
+		case s.skip > 0:
+			k := min(s.skip, len(p))
+			if s.scan {
+				s.markers.Write(p[:k])
+			}
+			s.skip -= k
+			p = p[k:]
+		case s.entropy:
+			p = s.skipEntropy(p)
+		case s.want == 0:
+			s.next(s, nil)
+		default:
+			k := min(s.want-len(s.pending), len(p))
+			s.pending = append(s.pending, p[:k]...)
+			p = p[k:]
+			if len(s.pending) == s.want {
+				s.next(s, s.pending)
+			}
+		}
+	}
+	return n, nil
+}
+
+// skipEntropy passes over JPEG scan data up to the next marker, which is any
+// 0xFF not followed by a stuffed zero, a restart marker or another 0xFF
+func (s *textScanner) skipEntropy(p []byte) []byte {
+	for len(p) > 0 {
+		if !s.sawFF {
+			i := bytes.IndexByte(p, 0xFF)
+			if i < 0 {
+				return nil
+			}
+			s.sawFF = true
+			p = p[i+1:]
+			continue
+		}
+
+		b := p[0]
+		p = p[1:]
+		if b == 0xFF {
+			continue
+		}
+		s.sawFF = false
+		if b == 0x00 || (0xD0 <= b && b <= 0xD7) {
+			continue
+		}
+		s.entropy = false
+		s.jpegMarker(b)
+		return p
+	}
+	return nil
+}
+
+func onJPEGPrefix(s *textScanner, b []byte) {
+	if b[0] != 0xFF {
+		s.done = true
+		return
+	}
+	s.expect(0, 1, onJPEGCode)
+}
+
+func onJPEGCode(s *textScanner, b []byte) {
+	s.jpegMarker(b[0])
+}
+
+func (s *textScanner) jpegMarker(code byte) {
+	switch {
+	case code == 0xFF: // fill byte
+		s.expect(0, 1, onJPEGCode)
+	case code == 0xD8, code == 0x01, 0xD0 <= code && code <= 0xD7: // markers without a length
+		s.expect(0, 1, onJPEGPrefix)
+	case code == 0xD9: // EOI
+		s.startTrailing()
+	default:
+		s.jpegSegment = code
+		s.expect(0, 2, onJPEGSegment)
+	}
+}
+
+func onJPEGSegment(s *textScanner, b []byte) {
+	length := int(binary.BigEndian.Uint16(b)) - 2
+	if length < 0 {
+		s.done = true
+		return
+	}
+	switch code := s.jpegSegment; {
+	case 0xE0 <= code && code <= 0xEF, code == 0xFE: // APPn metadata and COM
+		s.inspect(length, 1, onJPEGPrefix)
+	case code == 0xDA: // SOS: scan data follows the header
+		s.expect(length, 0, onJPEGEntropy)
+	default:
+		s.expect(length, 1, onJPEGPrefix)
+	}
+}
+
+func onJPEGEntropy(s *textScanner, _ []byte) {
+	s.entropy = true
+	s.sawFF = false
+}
+
+func onPNGTextChunk(s *textScanner, b []byte) {
+	length := int(binary.BigEndian.Uint32(b[0:4]))
+	switch string(b[4:8]) {
+	case "tEXt", "iTXt", "zTXt":
+		s.inspect(length, 0, onPNGTextCRC)
+	case "IEND":
+		s.expect(length+4, 0, onTrailing)
+	default:
+		s.expect(length+4, 8, onPNGTextChunk)
+	}
+}
+
+func onPNGTextCRC(s *textScanner, _ []byte) {
+	s.expect(4, 8, onPNGTextChunk)
+}
+
+func onTrailing(s *textScanner, _ []byte) {
+	s.startTrailing()
+}
+
+func onGIFTextScreen(s *textScanner, b []byte) {
+	s.expect(gifColorTableSize(b[10]), 1, onGIFTextBlock)
+}
+
+func onGIFTextBlock(s *textScanner, b []byte) {
+	switch b[0] {
+	case 0x2C: // image descriptor
+		s.expect(0, 9, onGIFTextDescriptor)
+	case 0x21: // extension
+		s.expect(0, 1, onGIFTextLabel)
+	case 0x3B: // trailer
+		s.startTrailing()
+	default:
+		s.done = true
+	}
+}
+
+func onGIFTextDescriptor(s *textScanner, b []byte) {
+	s.gifText = false
+	// Local color table, then the LZW minimum code size byte
+	s.expect(gifColorTableSize(b[8])+1, 1, onGIFTextSubBlock)
+}
+
+func onGIFTextLabel(s *textScanner, b []byte) {
+	// Comment, plain text and application (XMP) extensions
+	s.gifText = b[0] == 0xFE || b[0] == 0x01 || b[0] == 0xFF
+	s.expect(0, 1, onGIFTextSubBlock)
+}
+
+func onGIFTextSubBlock(s *textScanner, b []byte) {
+	if b[0] == 0 {
+		s.expect(0, 1, onGIFTextBlock)
+		return
+	}
+	if s.gifText {
+		// Consecutive sub-blocks are scanned as one run of text
+		s.inspect(int(b[0]), 1, onGIFTextSubBlock)
+		return
+	}
+	s.expect(int(b[0]), 1, onGIFTextSubBlock)
+}
+
+func onWebPHeader(s *textScanner, b []byte) {
+	// The RIFF size counts from the "WEBP" tag on
+	s.webpLeft = int(binary.LittleEndian.Uint32(b[4:8])) - 4
+	onWebPNext(s, nil)
+}
+
+func onWebPNext(s *textScanner, _ []byte) {
+	if s.webpLeft <= 0 {
+		s.startTrailing()
+		return
+	}
+	s.expect(0, 8, onWebPChunk)
+}
+
+func onWebPChunk(s *textScanner, b []byte) {
+	length := int(binary.LittleEndian.Uint32(b[4:8]))
+	padding := length & 1
+	s.webpLeft -= 8 + length + padding
+
+	switch string(b[0:4]) {
+	case "EXIF", "XMP ":
+		s.inspect(length, 0, func(s *textScanner, _ []byte) {
+			s.expect(padding, 0, onWebPNext)
+		})
+	default:
+		s.expect(length+padding, 0, onWebPNext)
+	}
+}
@@ -12,18 +12,57 @@ type FileUpload struct {
 	OriginalFilename string    `json:"original_filename"`
 	ContentType      string    `json:"content_type"`
 	FileSize         int64     `json:"file_size"`
-	TempPath         string    `json:"temp_path"`
+	Checksum         string    `json:"checksum"`
+	Status           string    `json:"status"`
+	ProcessingState  string    `json:"processing_state"`
+	TempPath         string    `json:"-"`
+	EncryptedKey     string    `json:"-"`
+	EncryptionKeyID  string    `json:"-"`
+	PerceptualHash   *uint64   `json:"-"`
 	ClientIP         string    `json:"client_ip"`
 	UserAgent        string    `json:"user_agent"`
 	RequestHost      string    `json:"request_host"`
 	RequestURI       string    `json:"request_uri"`
+	SourceURL        string    `json:"source_url,omitempty"`
+	Caption          string    `json:"caption"`
+	Tags             []string  `json:"tags"`
+	DisplayName      string    `json:"display_name"`
+	AltText          string    `json:"alt_text"`
+	Visibility       string    `json:"visibility"`
+	Version          int       `json:"version"`
 	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// Name is the display name when one is set, otherwise the original filename
+func (u *FileUpload) Name() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	return u.OriginalFilename
 }
 
 type Repository interface {
 	CreateFileUpload(upload *FileUpload) (*FileUpload, error)
 	GetFileUploadByID(id int64) (*FileUpload, bool)
 	GetFileUploadsByUserID(userID int64) ([]*FileUpload, error)
+	GetFileUploadsByIDs(ids []int64) ([]*FileUpload, error)
+	// ListFileUploadsAfter pages through every upload in id order
+	ListFileUploadsAfter(afterID int64, limit int) ([]*FileUpload, error)
+	CreateFileUploads(uploads []*FileUpload) ([]*FileUpload, error)
+	GetFileUploadByFilename(filename string) (*FileUpload, bool)
+	UpdateFileUploadStatus(id int64, status, tempPath string) error
+	UpdateFileUploadProcessingState(id int64, state string) error
+	DeleteFileUpload(id int64) error
+	SearchFileUploads(userID int64, query SearchQuery) (*SearchResult, error)
+	// UpdateFileUploadMetadata applies the update only if the stored version still
+	// equals expectedVersion (0 skips the check), returning ErrVersionConflict otherwise
+	UpdateFileUploadMetadata(id int64, expectedVersion int, update MetadataUpdate) (*FileUpload, error)
+	UpdateFileUploadKey(id int64, encryptedKey, keyID string) error
+	UpdateFileUploadPerceptualHash(id int64, hash uint64) error
+	// FindSimilarFileUploads returns the user's other hashed uploads within maxDistance
+	// bits of hash, closest first; quarantined and infected files are never matched
+	FindSimilarFileUploads(userID, excludeID int64, hash uint64, maxDistance, limit int) ([]*SimilarUpload, error)
 }
 
 var AllowedImageTypes = map[string]bool{
@@ -38,8 +77,39 @@ var AllowedImageTypes = map[string]bool{
 
 const MaxFileSize = 8 * 1024 * 1024
 
+const (
+	MaxBatchSize  = 64 * 1024 * 1024
+	MaxBatchFiles = 50
+)
+
 var (
 	ErrInvalidContentType = errors.New("uploaded file must be an image")
 	ErrFileTooLarge       = errors.New("file size exceeds 8MB limit")
 	ErrNoFileUploaded     = errors.New("no file uploaded")
+	ErrRequestTooLarge    = errors.New("request body exceeds size limit")
+	ErrTooManyFiles       = errors.New("too many files in batch")
+
+	ErrContentTypeNotAllowed = errors.New("image type is not allowed")
+	ErrMalformedImage        = errors.New("image header could not be decoded")
+	ErrFormatMismatch        = errors.New("image format does not match its magic bytes")
+	ErrExtensionMismatch     = errors.New("file extension does not match image format")
+	ErrEmbeddedContent       = errors.New("image contains embedded script or markup")
+	ErrImageTooLarge         = errors.New("image width or height exceeds limit")
+	ErrImageTooManyPixels    = errors.New("image pixel count exceeds limit")
+	ErrImageTooManyFrames    = errors.New("image frame count exceeds limit")
+	ErrDecodeBudgetExceeded  = errors.New("image decoding exceeds memory budget")
+
+	ErrInvalidRemoteURL     = errors.New("url must be an absolute http or https URL")
+	ErrRemoteAddressBlocked = errors.New("url resolves to a private or loopback address")
+	ErrTooManyRedirects     = errors.New("too many redirects")
+	ErrRemoteFetchFailed    = errors.New("failed to fetch remote file")
+
+	ErrTooManyTags    = errors.New("too many tags")
+	ErrInvalidTag     = errors.New("tags may contain only letters, digits, spaces, '-' and '_'")
+	ErrTagTooLong     = errors.New("tag is too long")
+	ErrCaptionTooLong = errors.New("caption is too long")
+
+	ErrVersionConflict = errors.New("upload was modified by another request")
+
+	ErrInvalidUploadID = errors.New("upload ID must be 8-64 letters, digits, '-' or '_'")
 )
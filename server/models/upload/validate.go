@@ -0,0 +1,161 @@
+package upload
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"elotus_test/server/env"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// maxHeaderBytes bounds how much of the stream image.DecodeConfig may consume.
+// JPEG metadata segments (EXIF, ICC profiles) can push the frame header well past the first KB.
+const maxHeaderBytes = 256 * 1024
+
+// formatContentTypes maps the format names registered with the image package to their MIME type
+var formatContentTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+	"webp": "image/webp",
+	"bmp":  "image/bmp",
+	"tiff": "image/tiff",
+}
+
+var formatExtensions = map[string][]string{
+	"jpeg": {"jpg", "jpeg", "jpe", "jfif"},
+	"png":  {"png"},
+	"gif":  {"gif"},
+	"webp": {"webp"},
+	"bmp":  {"bmp"},
+	"tiff": {"tif", "tiff"},
+}
+
+// embeddedMarkers are sequences that have no business in image metadata or after the
+// end of an image and indicate a polyglot file
+var embeddedMarkers = [][]byte{
+	[]byte("<script"),
+	[]byte("<?php"),
+	[]byte("<html"),
+	[]byte("<svg"),
+	[]byte("<iframe"),
+}
+
+type imageHeader struct {
+	Format      string
+	ContentType string
+	Width       int
+	Height      int
+}
+
+func allowedContentTypes() map[string]bool {
+	configured := env.E.GetAllowedContentTypes()
+	if len(configured) == 0 {
+		return AllowedImageTypes
+	}
+	allowed := make(map[string]bool, len(configured))
+	for _, contentType := range configured {
+		allowed[strings.ToLower(strings.TrimSpace(contentType))] = true
+	}
+	return allowed
+}
+
+// validateUploadFile checks the sniffed magic bytes, decodes the image header and
+// verifies the format against the allowlist and the file extension. Everything it
+// consumes from src is replayed by the returned reader so the caller can store the
+// full file without reading it twice.
+func validateUploadFile(src io.Reader, fileName, fileType string) (*imageHeader, io.Reader, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(src, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, nil, err
+	}
+	head = head[:n]
+	if len(head) == 0 {
+		return nil, nil, ErrNoFileUploaded
+	}
+
+	stream := io.MultiReader(bytes.NewReader(head), src)
+	if fileType != "data" && fileType != "image" {
+		return &imageHeader{ContentType: http.DetectContentType(head)}, stream, nil
+	}
+
+	// DetectContentType does not know TIFF, so octet-stream is left for the decoder to decide
+	sniffed := http.DetectContentType(head)
+	if !strings.HasPrefix(sniffed, "image/") && sniffed != "application/octet-stream" {
+		return nil, nil, ErrInvalidContentType
+	}
+
+	var consumed bytes.Buffer
+	config, format, err := image.DecodeConfig(io.TeeReader(io.LimitReader(stream, maxHeaderBytes), &consumed))
+	replay := io.MultiReader(&consumed, stream)
+	if err != nil {
+		if err == image.ErrFormat || !strings.HasPrefix(sniffed, "image/") {
+			return nil, nil, ErrInvalidContentType
+		}
+		return nil, nil, ErrMalformedImage
+	}
+
+	contentType, known := formatContentTypes[format]
+	if !known {
+		return nil, nil, ErrInvalidContentType
+	}
+	if strings.HasPrefix(sniffed, "image/") && sniffed != contentType {
+		return nil, nil, ErrFormatMismatch
+	}
+	if !allowedContentTypes()[contentType] {
+		return nil, nil, ErrContentTypeNotAllowed
+	}
+	if !extensionMatches(fileName, format) {
+		return nil, nil, ErrExtensionMismatch
+	}
+	if err := checkDimensions(config.Width, config.Height); err != nil {
+		return nil, nil, err
+	}
+	// An image that could never be decoded within one request's budget is refused up front
+	if estimateDecodeBytes(config.Width, config.Height, 1) > env.E.GetDecodeMemoryBudget() {
+		return nil, nil, ErrDecodeBudgetExceeded
+	}
+
+	return &imageHeader{
+		Format:      format,
+		ContentType: contentType,
+		Width:       config.Width,
+		Height:      config.Height,
+	}, replay, nil
+}
+
+// checkDimensions enforces the configured pixel limits using only the decoded header
+func checkDimensions(width, height int) error {
+	if width > env.E.GetMaxImageWidth() || height > env.E.GetMaxImageHeight() {
+		return ErrImageTooLarge
+	}
+	if int64(width)*int64(height) > env.E.GetMaxImagePixels() {
+		return ErrImageTooManyPixels
+	}
+	return nil
+}
+
+// extensionMatches allows a missing extension (one is derived from the content type later)
+func extensionMatches(fileName, format string) bool {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(fileName), "."))
+	if ext == "" {
+		return true
+	}
+	for _, allowed := range formatExtensions[format] {
+		if ext == allowed {
+			return true
+		}
+	}
+	return false
+}
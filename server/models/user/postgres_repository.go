@@ -63,10 +63,11 @@ func (r *PostgresRepository) GetUserByUsername(username string) (*User, bool) {
 
 func (r *PostgresRepository) GetUserByID(id int64) (*User, bool) {
 	var user User
+	var lastLoginAt, lastRevokedTokenAt sql.NullTime
 	err := r.db.QueryRow(
-		`SELECT id, username, password, created_at FROM users WHERE id = $1`,
+		`SELECT id, username, password, created_at, last_login_at, last_revoked_token_at FROM users WHERE id = $1`,
 		id,
-	).Scan(&user.ID, &user.Username, &user.Password, &user.CreatedAt)
+	).Scan(&user.ID, &user.Username, &user.Password, &user.CreatedAt, &lastLoginAt, &lastRevokedTokenAt)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -75,6 +76,12 @@ func (r *PostgresRepository) GetUserByID(id int64) (*User, bool) {
 		return nil, false
 	}
 
+	if lastLoginAt.Valid {
+		user.LastLoginAt = &lastLoginAt.Time
+	}
+	if lastRevokedTokenAt.Valid {
+		user.LastRevokedTokenAt = &lastRevokedTokenAt.Time
+	}
 	return &user, true
 }
 
@@ -85,3 +92,43 @@ func (r *PostgresRepository) UpdateLastLogin(userID int64) error {
 	)
 	return err
 }
+
+func (r *PostgresRepository) DeleteUser(id int64) error {
+	_, err := r.db.Exec(`DELETE FROM users WHERE id = $1`, id)
+	return err
+}
+
+func (r *PostgresRepository) RecordLogin(userID int64, clientIP, userAgent string, success bool) error {
+	_, err := r.db.Exec(
+		`INSERT INTO login_events (user_id, client_ip, user_agent, success, created_at) VALUES ($1, $2, $3, $4, $5)`,
+		userID, clientIP, userAgent, success, time.Now(),
+	)
+	return err
+}
+
+func (r *PostgresRepository) ListLogins(userID int64) ([]*LoginEvent, error) {
+	rows, err := r.db.Query(`
+		SELECT id, user_id, client_ip, user_agent, success, created_at
+		FROM login_events
+		WHERE user_id = $1
+		ORDER BY created_at, id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*LoginEvent{}
+	for rows.Next() {
+		e := &LoginEvent{}
+		var clientIP, userAgent sql.NullString
+		if err := rows.Scan(&e.ID, &e.UserID, &clientIP, &userAgent, &e.Success, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.ClientIP = clientIP.String
+		e.UserAgent = userAgent.String
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -14,11 +14,27 @@ type User struct {
 	LastRevokedTokenAt *time.Time `json:"last_revoked_token_at,omitempty"`
 }
 
+// LoginEvent is one login attempt against an existing account
+type LoginEvent struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	ClientIP  string    `json:"client_ip"`
+	UserAgent string    `json:"user_agent"`
+	Success   bool      `json:"success"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 type Repository interface {
 	CreateUser(username, hashedPassword string) (*User, error)
 	GetUserByUsername(username string) (*User, bool)
 	GetUserByID(id int64) (*User, bool)
 	UpdateLastLogin(userID int64) error
+	// DeleteUser removes the user and, through foreign keys, every row they own;
+	// deleting a user that is already gone is not an error
+	DeleteUser(id int64) error
+	RecordLogin(userID int64, clientIP, userAgent string, success bool) error
+	// ListLogins returns the user's login history, oldest first
+	ListLogins(userID int64) ([]*LoginEvent, error)
 }
 
 var (
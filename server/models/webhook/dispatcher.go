@@ -0,0 +1,210 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"elotus_test/server/models/events"
+	"elotus_test/server/models/jobs"
+	"elotus_test/server/netguard"
+)
+
+// JobDeliver is the job kind for a single webhook delivery
+const JobDeliver = "webhook.deliver"
+
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+type deliverPayload struct {
+	DeliveryID int64 `json:"delivery_id"`
+}
+
+// Dispatcher records a delivery for every matching subscription and sends them through the job queue
+type Dispatcher struct {
+	repo   Repository
+	queue  *jobs.Queue
+	client *http.Client
+}
+
+// NewDispatcher registers the delivery handler on queue. Without a queue each
+// delivery is attempted once in the background and can be replayed manually.
+func NewDispatcher(repo Repository, queue *jobs.Queue, client *http.Client) *Dispatcher {
+	d := &Dispatcher{repo: repo, queue: queue, client: client}
+	if queue != nil {
+		queue.Register(JobDeliver, d.DeliverJob)
+	}
+	return d
+}
+
+// Sign computes the signature sent in X-Webhook-Signature: hex(HMAC-SHA256(secret, "<timestamp>.<body>"))
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// HandleEvent is subscribed to the event bus
+func (d *Dispatcher) HandleEvent(event events.Event) {
+	// Only the listed types can be subscribed to, so the rest skip the lookup
+	if !events.IsKnownType(event.Type) {
+		return
+	}
+
+	subs, err := d.repo.MatchSubscriptions(event.UserID, event.Type)
+	if err != nil {
+		log.Printf("[Webhook] Error matching subscriptions for %s: %v", event.Type, err)
+		return
+	}
+	if len(subs) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("[Webhook] Error encoding event %s: %v", event.ID, err)
+		return
+	}
+
+	for _, sub := range subs {
+		delivery, err := d.repo.CreateDelivery(&Delivery{
+			SubscriptionID: sub.ID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        payload,
+			Status:         DeliveryPending,
+		})
+		if err != nil {
+			log.Printf("[Webhook] Error recording delivery for subscription %d: %v", sub.ID, err)
+			continue
+		}
+		d.schedule(delivery.ID)
+	}
+}
+
+// Replay sends a failed delivery again with a fresh set of retries
+func (d *Dispatcher) Replay(delivery *Delivery) error {
+	if delivery.Status != DeliveryFailed {
+		return ErrDeliveryNotFailed
+	}
+	if err := d.repo.ResetDelivery(delivery.ID); err != nil {
+		return err
+	}
+	delivery.Status = DeliveryPending
+	d.schedule(delivery.ID)
+	return nil
+}
+
+func (d *Dispatcher) schedule(deliveryID int64) {
+	if d.queue != nil {
+		_, err := d.queue.Enqueue(JobDeliver, deliverPayload{DeliveryID: deliveryID})
+		if err == nil {
+			return
+		}
+		log.Printf("[Webhook] Error enqueueing delivery %d: %v", deliveryID, err)
+	}
+
+	go func() {
+		if err := d.attempt(context.Background(), deliveryID, true); err != nil {
+			log.Printf("[Webhook] Delivery %d failed: %v", deliveryID, err)
+		}
+	}()
+}
+
+// DeliverJob is the queue handler for JobDeliver; returning an error lets the queue retry with backoff
+func (d *Dispatcher) DeliverJob(ctx context.Context, job *jobs.Job) error {
+	var payload deliverPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	return d.attempt(ctx, payload.DeliveryID, job.LastAttempt())
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, deliveryID int64, lastAttempt bool) error {
+	delivery, found := d.repo.GetDelivery(deliveryID)
+	if !found {
+		return nil
+	}
+	sub, found := d.repo.GetSubscription(delivery.SubscriptionID)
+	if !found || !sub.Active {
+		return nil
+	}
+
+	statusCode, err := d.send(ctx, sub, delivery)
+	if err == nil {
+		return d.repo.RecordAttempt(delivery.ID, DeliverySucceeded, statusCode, "")
+	}
+
+	status := DeliveryPending
+	if lastAttempt {
+		status = DeliveryFailed
+	}
+	if recordErr := d.repo.RecordAttempt(delivery.ID, status, statusCode, err.Error()); recordErr != nil {
+		log.Printf("[Webhook] Error recording attempt for delivery %d: %v", delivery.ID, recordErr)
+	}
+	return err
+}
+
+func (d *Dispatcher) send(ctx context.Context, sub *Subscription, delivery *Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "elotus-webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// NewClient builds the delivery HTTP client. Unless allowPrivate is set, connections
+// to addresses netguard blocks are refused after DNS resolution.
+func NewClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = netguard.Control(ErrAddressBlocked)
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:       nil,
+			DialContext: dialer.DialContext,
+		},
+		// Redirects are not followed; the endpoint must answer directly
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
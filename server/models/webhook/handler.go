@@ -0,0 +1,191 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/events"
+	"elotus_test/server/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+const deliveryLogLimit = 100
+
+type Handler struct {
+	repo       Repository
+	dispatcher *Dispatcher
+}
+
+func NewHandler(repo Repository, dispatcher *Dispatcher) *Handler {
+	return &Handler{
+		repo:       repo,
+		dispatcher: dispatcher,
+	}
+}
+
+type CreateSubscriptionRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+func ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || u.User != nil {
+		return ErrInvalidURL
+	}
+	return nil
+}
+
+func ValidateEvents(eventTypes []string) error {
+	if len(eventTypes) == 0 {
+		return ErrInvalidEvents
+	}
+	for _, t := range eventTypes {
+		if t != AllEvents && !events.IsKnownType(t) {
+			return fmt.Errorf("%w: %s", ErrInvalidEvents, t)
+		}
+	}
+	return nil
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+func (h *Handler) CreateSubscription(c echo.Context) error {
+	claims := c.Get("user").(*auth.TokenClaims)
+
+	var req CreateSubscriptionRequest
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+	if err := ValidateURL(req.URL); err != nil {
+		return response.ValidationError(c, err.Error())
+	}
+	if err := ValidateEvents(req.Events); err != nil {
+		return response.ValidationError(c, err.Error())
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return response.InternalError(c, "Failed to generate secret")
+	}
+
+	userID := claims.UserID
+	sub, err := h.repo.CreateSubscription(&Subscription{
+		UserID: &userID,
+		URL:    req.URL,
+		Secret: secret,
+		Events: req.Events,
+		Active: true,
+	})
+	if err != nil {
+		return response.InternalError(c, "Failed to create webhook")
+	}
+
+	// The secret is only ever shown once
+	return response.Created(c, echo.Map{
+		"id":         sub.ID,
+		"url":        sub.URL,
+		"events":     sub.Events,
+		"active":     sub.Active,
+		"secret":     secret,
+		"created_at": sub.CreatedAt,
+	})
+}
+
+func (h *Handler) ListSubscriptions(c echo.Context) error {
+	claims := c.Get("user").(*auth.TokenClaims)
+
+	subs, err := h.repo.ListSubscriptions(claims.UserID)
+	if err != nil {
+		return response.InternalError(c, "Failed to get webhooks")
+	}
+	if subs == nil {
+		subs = []*Subscription{}
+	}
+
+	return response.SuccessWithMeta(c, subs, &response.Meta{Total: len(subs)})
+}
+
+func (h *Handler) DeleteSubscription(c echo.Context) error {
+	sub, err := h.ownedSubscription(c)
+	if sub == nil {
+		return err
+	}
+
+	if err := h.repo.DeleteSubscription(sub.ID); err != nil {
+		return response.InternalError(c, "Failed to delete webhook")
+	}
+
+	return response.Success(c, echo.Map{
+		"message": "Webhook deleted",
+	})
+}
+
+func (h *Handler) ListDeliveries(c echo.Context) error {
+	sub, err := h.ownedSubscription(c)
+	if sub == nil {
+		return err
+	}
+
+	deliveries, err := h.repo.ListDeliveries(sub.ID, deliveryLogLimit)
+	if err != nil {
+		return response.InternalError(c, "Failed to get deliveries")
+	}
+	if deliveries == nil {
+		deliveries = []*Delivery{}
+	}
+
+	return response.SuccessWithMeta(c, deliveries, &response.Meta{Total: len(deliveries)})
+}
+
+func (h *Handler) ReplayDelivery(c echo.Context) error {
+	sub, err := h.ownedSubscription(c)
+	if sub == nil {
+		return err
+	}
+
+	var deliveryID int64
+	fmt.Sscanf(c.Param("deliveryId"), "%d", &deliveryID)
+
+	delivery, found := h.repo.GetDelivery(deliveryID)
+	if !found || delivery.SubscriptionID != sub.ID {
+		return response.NotFound(c, "Delivery not found")
+	}
+
+	if err := h.dispatcher.Replay(delivery); err != nil {
+		if err == ErrDeliveryNotFailed {
+			return response.Conflict(c, err.Error())
+		}
+		return response.InternalError(c, "Failed to replay delivery")
+	}
+
+	return response.Success(c, delivery)
+}
+
+// ownedSubscription loads the :id subscription for the current user. A nil
+// subscription means the error response has already been written.
+func (h *Handler) ownedSubscription(c echo.Context) (*Subscription, error) {
+	claims := c.Get("user").(*auth.TokenClaims)
+
+	var id int64
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	sub, found := h.repo.GetSubscription(id)
+	if !found {
+		return nil, response.NotFound(c, "Webhook not found")
+	}
+	if sub.UserID == nil || *sub.UserID != claims.UserID {
+		return nil, response.Forbidden(c, "Access denied")
+	}
+	return sub, nil
+}
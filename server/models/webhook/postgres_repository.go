@@ -0,0 +1,209 @@
+package webhook
+
+import (
+	"database/sql"
+	"time"
+
+	"elotus_test/server/bsql"
+
+	"github.com/lib/pq"
+)
+
+type PostgresRepository struct {
+	db *bsql.DB
+}
+
+func NewPostgresRepository(db *bsql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+const subscriptionColumns = `id, user_id, url, secret, events, active, created_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSubscription(row rowScanner) (*Subscription, error) {
+	sub := &Subscription{}
+	var userID sql.NullInt64
+
+	err := row.Scan(&sub.ID, &userID, &sub.URL, &sub.Secret, pq.Array(&sub.Events), &sub.Active, &sub.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if userID.Valid {
+		sub.UserID = &userID.Int64
+	}
+	return sub, nil
+}
+
+func querySubscriptions(rows *sql.Rows, err error) ([]*Subscription, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []*Subscription
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+func (r *PostgresRepository) CreateSubscription(sub *Subscription) (*Subscription, error) {
+	err := r.db.QueryRow(`
+		INSERT INTO webhook_subscriptions (user_id, url, secret, events, active, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`,
+		sub.UserID, sub.URL, sub.Secret, pq.Array(sub.Events), sub.Active, time.Now(),
+	).Scan(&sub.ID, &sub.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (r *PostgresRepository) GetSubscription(id int64) (*Subscription, bool) {
+	sub, err := scanSubscription(r.db.QueryRow(`SELECT `+subscriptionColumns+` FROM webhook_subscriptions WHERE id = $1`, id))
+	if err != nil {
+		return nil, false
+	}
+	return sub, true
+}
+
+func (r *PostgresRepository) ListSubscriptions(userID int64) ([]*Subscription, error) {
+	return querySubscriptions(r.db.Query(`
+		SELECT `+subscriptionColumns+`
+		FROM webhook_subscriptions
+		WHERE user_id = $1
+		ORDER BY created_at DESC`, userID))
+}
+
+func (r *PostgresRepository) DeleteSubscription(id int64) error {
+	_, err := r.db.Exec(`DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	return err
+}
+
+func (r *PostgresRepository) MatchSubscriptions(userID int64, eventType string) ([]*Subscription, error) {
+	return querySubscriptions(r.db.Query(`
+		SELECT `+subscriptionColumns+`
+		FROM webhook_subscriptions
+		WHERE active
+			AND (user_id = $1 OR user_id IS NULL)
+			AND ($2 = ANY(events) OR $3 = ANY(events))`, userID, eventType, AllEvents))
+}
+
+func (r *PostgresRepository) SyncGlobalSubscription(sub *Subscription) error {
+	_, err := r.db.Exec(`
+		INSERT INTO webhook_subscriptions (user_id, url, secret, events, active, created_at)
+		VALUES (NULL, $1, $2, $3, TRUE, NOW())
+		ON CONFLICT (url) WHERE user_id IS NULL
+		DO UPDATE SET secret = EXCLUDED.secret, events = EXCLUDED.events, active = TRUE`,
+		sub.URL, sub.Secret, pq.Array(sub.Events),
+	)
+	return err
+}
+
+const deliveryColumns = `id, subscription_id, event_id, event_type, payload, status, attempts,
+		response_status, last_error, created_at, delivered_at`
+
+func scanDelivery(row rowScanner) (*Delivery, error) {
+	d := &Delivery{}
+	var payload []byte
+	var responseStatus sql.NullInt64
+	var lastError sql.NullString
+	var deliveredAt sql.NullTime
+
+	err := row.Scan(
+		&d.ID,
+		&d.SubscriptionID,
+		&d.EventID,
+		&d.EventType,
+		&payload,
+		&d.Status,
+		&d.Attempts,
+		&responseStatus,
+		&lastError,
+		&d.CreatedAt,
+		&deliveredAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	d.Payload = payload
+	d.ResponseStatus = int(responseStatus.Int64)
+	d.LastError = lastError.String
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+	return d, nil
+}
+
+func (r *PostgresRepository) CreateDelivery(d *Delivery) (*Delivery, error) {
+	err := r.db.QueryRow(`
+		INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`,
+		d.SubscriptionID, d.EventID, d.EventType, []byte(d.Payload), d.Status, time.Now(),
+	).Scan(&d.ID, &d.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (r *PostgresRepository) GetDelivery(id int64) (*Delivery, bool) {
+	d, err := scanDelivery(r.db.QueryRow(`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE id = $1`, id))
+	if err != nil {
+		return nil, false
+	}
+	return d, true
+}
+
+func (r *PostgresRepository) ListDeliveries(subscriptionID int64, limit int) ([]*Delivery, error) {
+	rows, err := r.db.Query(`
+		SELECT `+deliveryColumns+`
+		FROM webhook_deliveries
+		WHERE subscription_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2`, subscriptionID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*Delivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (r *PostgresRepository) RecordAttempt(id int64, status string, responseStatus int, lastError string) error {
+	_, err := r.db.Exec(`
+		UPDATE webhook_deliveries SET
+			status = $1,
+			attempts = attempts + 1,
+			response_status = NULLIF($2, 0),
+			last_error = NULLIF($3, ''),
+			delivered_at = CASE WHEN $1 = $4 THEN NOW() ELSE delivered_at END
+		WHERE id = $5`,
+		status, responseStatus, lastError, DeliverySucceeded, id,
+	)
+	return err
+}
+
+func (r *PostgresRepository) ResetDelivery(id int64) error {
+	_, err := r.db.Exec(`UPDATE webhook_deliveries SET status = $1 WHERE id = $2`, DeliveryPending, id)
+	return err
+}
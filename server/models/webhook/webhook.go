@@ -0,0 +1,74 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// AllEvents subscribes to every event type
+const AllEvents = "*"
+
+type Subscription struct {
+	ID        int64     `json:"id"`
+	UserID    *int64    `json:"user_id,omitempty"` // nil for global subscriptions
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Wants reports whether the subscription should receive an event type
+func (s *Subscription) Wants(eventType string) bool {
+	for _, e := range s.Events {
+		if e == eventType || e == AllEvents {
+			return true
+		}
+	}
+	return false
+}
+
+type Delivery struct {
+	ID             int64           `json:"id"`
+	SubscriptionID int64           `json:"subscription_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+type Repository interface {
+	CreateSubscription(sub *Subscription) (*Subscription, error)
+	GetSubscription(id int64) (*Subscription, bool)
+	ListSubscriptions(userID int64) ([]*Subscription, error)
+	DeleteSubscription(id int64) error
+	// MatchSubscriptions returns active subscriptions of the user plus global ones that want the event
+	MatchSubscriptions(userID int64, eventType string) ([]*Subscription, error)
+	// SyncGlobalSubscription creates or updates a global subscription identified by its URL
+	SyncGlobalSubscription(sub *Subscription) error
+
+	CreateDelivery(delivery *Delivery) (*Delivery, error)
+	GetDelivery(id int64) (*Delivery, bool)
+	ListDeliveries(subscriptionID int64, limit int) ([]*Delivery, error)
+	RecordAttempt(id int64, status string, responseStatus int, lastError string) error
+	ResetDelivery(id int64) error
+}
+
+var (
+	ErrInvalidURL        = errors.New("webhook URL must be an absolute http or https URL")
+	ErrInvalidEvents     = errors.New("unknown webhook event type")
+	ErrAddressBlocked    = errors.New("webhook address is not allowed")
+	ErrDeliveryNotFailed = errors.New("only failed deliveries can be replayed")
+)
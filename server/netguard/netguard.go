@@ -0,0 +1,66 @@
+// Package netguard keeps outbound requests made on behalf of users (remote
+// imports, webhook deliveries) away from internal networks. The check runs in
+// the dialer after DNS resolution, so a hostname that resolves to an internal
+// address is blocked as well.
+package netguard
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+var ErrBlocked = errors.New("address is not publicly routable")
+
+// blockedNetworks are ranges that are not covered by the net.IP helpers used in CheckIP
+var blockedNetworks = mustParseCIDRs(
+	"100.64.0.0/10", // carrier-grade NAT
+	"192.0.0.0/24",  // IETF protocol assignments
+	"198.18.0.0/15", // benchmarking
+	"240.0.0.0/4",   // reserved
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// CheckIP returns ErrBlocked for loopback, private, link-local, multicast and
+// reserved addresses
+func CheckIP(ip net.IP) error {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return ErrBlocked
+	}
+	for _, n := range blockedNetworks {
+		if n.Contains(ip) {
+			return ErrBlocked
+		}
+	}
+	return nil
+}
+
+// Control is a net.Dialer Control func that refuses to connect to blocked
+// addresses. blocked is returned instead of ErrBlocked so callers keep their
+// own sentinel error.
+func Control(blocked error) func(network, address string, _ syscall.RawConn) error {
+	return func(network, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		ip := net.ParseIP(host)
+		if ip == nil || CheckIP(ip) != nil {
+			return blocked
+		}
+		return nil
+	}
+}
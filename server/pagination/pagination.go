@@ -0,0 +1,69 @@
+package pagination
+
+import (
+	"fmt"
+	"strconv"
+
+	"elotus_test/server/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	DefaultPerPage = 50
+	MaxPerPage     = 100
+)
+
+type Params struct {
+	Page    int
+	PerPage int
+}
+
+// FromRequest reads ?page= and ?per_page=, defaulting to the first page of DefaultPerPage items
+func FromRequest(c echo.Context) (Params, error) {
+	p := Params{Page: 1, PerPage: DefaultPerPage}
+
+	if v := c.QueryParam("page"); v != "" {
+		page, err := strconv.Atoi(v)
+		if err != nil || page < 1 {
+			return p, fmt.Errorf("page must be a positive integer")
+		}
+		p.Page = page
+	}
+
+	if v := c.QueryParam("per_page"); v != "" {
+		perPage, err := strconv.Atoi(v)
+		if err != nil || perPage < 1 || perPage > MaxPerPage {
+			return p, fmt.Errorf("per_page must be between 1 and %d", MaxPerPage)
+		}
+		p.PerPage = perPage
+	}
+
+	return p, nil
+}
+
+func (p Params) Offset() int {
+	return (p.Page - 1) * p.PerPage
+}
+
+func (p Params) Meta(total int) *response.Meta {
+	return &response.Meta{
+		Total:      total,
+		Page:       p.Page,
+		PerPage:    p.PerPage,
+		TotalPages: (total + p.PerPage - 1) / p.PerPage,
+	}
+}
+
+// Slice returns the page of an already loaded list
+func Slice[T any](items []T, p Params) []T {
+	start := p.Offset()
+	if start >= len(items) {
+		return items[:0]
+	}
+	end := start + p.PerPage
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[start:end]
+}
@@ -19,8 +19,11 @@ type ErrorInfo struct {
 }
 
 type Meta struct {
-	Total  int  `json:"total,omitempty"`
-	Cached bool `json:"cached,omitempty"`
+	Total      int  `json:"total,omitempty"`
+	Cached     bool `json:"cached,omitempty"`
+	Page       int  `json:"page,omitempty"`
+	PerPage    int  `json:"per_page,omitempty"`
+	TotalPages int  `json:"total_pages,omitempty"`
 }
 
 const (
@@ -32,6 +35,33 @@ const (
 	ErrCodeTooManyRequests = "TOO_MANY_REQUESTS"
 	ErrCodeInternalError   = "INTERNAL_ERROR"
 	ErrCodeValidation      = "VALIDATION_ERROR"
+
+	ErrCodePreconditionFailed   = "PRECONDITION_FAILED"
+	ErrCodePreconditionRequired = "PRECONDITION_REQUIRED"
+
+	ErrCodeNotAnImage            = "NOT_AN_IMAGE"
+	ErrCodeContentTypeNotAllowed = "CONTENT_TYPE_NOT_ALLOWED"
+	ErrCodeMalformedImage        = "MALFORMED_IMAGE"
+	ErrCodeFormatMismatch        = "FORMAT_MISMATCH"
+	ErrCodeExtensionMismatch     = "EXTENSION_MISMATCH"
+	ErrCodeEmbeddedContent       = "EMBEDDED_CONTENT"
+	ErrCodeImageTooLarge         = "IMAGE_DIMENSIONS_TOO_LARGE"
+	ErrCodeImageTooManyPixels    = "IMAGE_TOO_MANY_PIXELS"
+	ErrCodeImageTooManyFrames    = "IMAGE_TOO_MANY_FRAMES"
+	ErrCodeDecodeBudgetExceeded  = "DECODE_BUDGET_EXCEEDED"
+
+	ErrCodeSharePasswordRequired = "SHARE_PASSWORD_REQUIRED"
+	ErrCodeSharePasswordInvalid  = "SHARE_PASSWORD_INVALID"
+	ErrCodeShareExpired          = "SHARE_EXPIRED"
+	ErrCodeShareRevoked          = "SHARE_REVOKED"
+	ErrCodeShareExhausted        = "SHARE_VIEW_LIMIT_REACHED"
+
+	ErrCodeArchiveTooLarge    = "ARCHIVE_TOO_LARGE"
+	ErrCodeArchiveLinkExpired = "ARCHIVE_LINK_EXPIRED"
+
+	ErrCodeExportLinkExpired = "EXPORT_LINK_EXPIRED"
+
+	ErrCodeTransformLinkExpired = "TRANSFORM_LINK_EXPIRED"
 )
 
 func Success(c echo.Context, data interface{}) error {
@@ -56,6 +86,13 @@ func Created(c echo.Context, data interface{}) error {
 	})
 }
 
+func Accepted(c echo.Context, data interface{}) error {
+	return c.JSON(http.StatusAccepted, Response{
+		Success: true,
+		Data:    data,
+	})
+}
+
 func Error(c echo.Context, statusCode int, code, message string) error {
 	return c.JSON(statusCode, Response{
 		Success: false,
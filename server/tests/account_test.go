@@ -0,0 +1,393 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"elotus_test/server/models/account"
+	"elotus_test/server/models/audit"
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/events"
+	"elotus_test/server/models/upload"
+	"elotus_test/server/models/user"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var _ account.Repository = (*MockDeletionRepository)(nil)
+
+type recordingRevoker struct {
+	mu      sync.Mutex
+	revoked []int64
+	err     error
+}
+
+func (r *recordingRevoker) RevokeUserTokens(userID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.revoked = append(r.revoked, userID)
+	return nil
+}
+
+type accountTest struct {
+	handler      *account.Handler
+	config       *account.Config
+	deletionRepo *MockDeletionRepository
+	userRepo     *MockUserRepository
+	revoker      *recordingRevoker
+	forgotten    []int64
+	published    []events.Event
+	files        map[string]string
+}
+
+// setupAccountTest gives users 1 and 2 the password "Password123", an upload
+// file each, and user 1 a built export
+func setupAccountTest(t *testing.T) *accountTest {
+	t.Helper()
+	dir := t.TempDir()
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("Password123"), bcrypt.MinCost)
+	userRepo := NewMockUserRepository()
+	userRepo.AddUser(&user.User{ID: 1, Username: "testuser", Password: string(hashed), CreatedAt: time.Now()})
+	userRepo.AddUser(&user.User{ID: 2, Username: "other", Password: string(hashed), CreatedAt: time.Now()})
+
+	test := &accountTest{
+		config:       &account.Config{Grace: 24 * time.Hour},
+		deletionRepo: NewMockDeletionRepository(),
+		userRepo:     userRepo,
+		revoker:      &recordingRevoker{},
+		files:        make(map[string]string),
+	}
+
+	write := func(name string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+		test.files[name] = path
+		return path
+	}
+	uploadRepo := NewMockUploadRepository()
+	uploadRepo.AddUpload(&upload.FileUpload{ID: 10, UserID: 1, Status: upload.StatusClean, TempPath: write("mine.png")})
+	uploadRepo.AddUpload(&upload.FileUpload{ID: 20, UserID: 2, Status: upload.StatusClean, TempPath: write("theirs.png")})
+	test.deletionRepo.AddExportFile(1, write("export-1.zip"))
+
+	bus := events.NewBus()
+	bus.Subscribe(func(event events.Event) { test.published = append(test.published, event) })
+
+	test.handler = account.NewHandler(test.config, test.deletionRepo, userRepo, uploadRepo, test.revoker)
+	test.handler.SetEventBus(bus)
+	test.handler.OnPurge(func(userID int64) { test.forgotten = append(test.forgotten, userID) })
+	return test
+}
+
+func TestAccount_DeleteRequiresPassword(t *testing.T) {
+	test := setupAccountTest(t)
+
+	rec := callAlbum(t, test.handler.DeleteAccount, http.MethodDelete, "/api/me", `{}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d without a password, got %d", http.StatusBadRequest, rec.Code)
+	}
+	rec = callAlbum(t, test.handler.DeleteAccount, http.MethodDelete, "/api/me", `{"password":"wrong"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for a wrong password, got %d", http.StatusForbidden, rec.Code)
+	}
+	if _, found := test.deletionRepo.ScheduledDeletion(1); found {
+		t.Error("Expected no deletion to be scheduled")
+	}
+}
+
+func TestAccount_ScheduleAndCancel(t *testing.T) {
+	test := setupAccountTest(t)
+	jobRepo := NewMockJobRepository()
+	test.handler.SetJobQueue(newTestQueue(jobRepo))
+
+	rec := callAlbum(t, test.handler.DeleteAccount, http.MethodDelete, "/api/me", `{"password":"Password123"}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusAccepted, rec.Code, rec.Body.String())
+	}
+	data := getDataMap(mustParse(t, rec))
+	if data["status"] != account.StatusScheduled || data["requested_by"] != float64(1) {
+		t.Fatalf("Unexpected deletion: %v", data)
+	}
+
+	d, _ := test.deletionRepo.ScheduledDeletion(1)
+	if until := time.Until(d.ScheduledFor); until < 23*time.Hour || until > 25*time.Hour {
+		t.Errorf("Expected the deletion to run after the grace period, got %v", d.ScheduledFor)
+	}
+	job := jobRepo.GetJob(1)
+	if job == nil || job.Kind != account.JobPurgeAccount || !job.RunAt.Equal(d.ScheduledFor) {
+		t.Fatalf("Expected a purge job at %v, got %+v", d.ScheduledFor, job)
+	}
+
+	// Asking again keeps the original schedule
+	rec = callAlbum(t, test.handler.DeleteAccount, http.MethodDelete, "/api/me", `{"password":"Password123"}`)
+	if data := getDataMap(mustParse(t, rec)); data["id"] != float64(d.ID) || jobRepo.GetJob(2) != nil {
+		t.Errorf("Expected deletion %d to be reused without a second job, got %v", d.ID, data)
+	}
+
+	if rec := callAlbum(t, test.handler.GetDeletion, http.MethodGet, "/api/me/deletion", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	rec = callAlbum(t, test.handler.CancelDeletion, http.MethodDelete, "/api/me/deletion", "")
+	if data := getDataMap(mustParse(t, rec)); data["status"] != account.StatusCancelled {
+		t.Fatalf("Expected cancelled deletion, got %v", data)
+	}
+	if rec := callAlbum(t, test.handler.GetDeletion, http.MethodGet, "/api/me/deletion", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d after cancelling, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	// The queued job finds the deletion cancelled and keeps the account
+	if err := test.handler.PurgeAccountJob(context.Background(), job); err != nil {
+		t.Fatalf("Purge job failed: %v", err)
+	}
+	if _, found := test.userRepo.GetUserByID(1); !found || len(test.revoker.revoked) != 0 {
+		t.Error("Expected a cancelled deletion to leave the account alone")
+	}
+}
+
+func TestAccount_PurgeRemovesEverything(t *testing.T) {
+	test := setupAccountTest(t)
+	jobRepo := NewMockJobRepository()
+	test.handler.SetJobQueue(newTestQueue(jobRepo))
+
+	callAlbum(t, test.handler.DeleteAccount, http.MethodDelete, "/api/me", `{"password":"Password123"}`)
+	if err := test.handler.PurgeAccountJob(context.Background(), jobRepo.GetJob(1)); err != nil {
+		t.Fatalf("Purge job failed: %v", err)
+	}
+
+	if _, found := test.userRepo.GetUserByID(1); found {
+		t.Error("Expected the user to be deleted")
+	}
+	for _, name := range []string{"mine.png", "export-1.zip"} {
+		if _, err := os.Stat(test.files[name]); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected %s to be removed, got %v", name, err)
+		}
+	}
+	if _, err := os.Stat(test.files["theirs.png"]); err != nil {
+		t.Errorf("Expected another user's file to be kept, got %v", err)
+	}
+
+	d, _ := test.deletionRepo.GetDeletion(1)
+	if d.Status != account.StatusCompleted || d.FilesRemoved != 2 || d.Username != "testuser" {
+		t.Errorf("Expected a completed record with 2 files removed, got %+v", d)
+	}
+	if len(test.revoker.revoked) != 1 || len(test.forgotten) != 1 || test.forgotten[0] != 1 {
+		t.Errorf("Expected tokens revoked and cached state dropped once, got %v and %v", test.revoker.revoked, test.forgotten)
+	}
+
+	var deleted *events.Event
+	for i := range test.published {
+		if test.published[i].Type == events.UserDeleted {
+			deleted = &test.published[i]
+		}
+	}
+	if deleted == nil {
+		t.Fatalf("Expected a %s event, got %v", events.UserDeleted, test.published)
+	}
+	if ids, _ := deleted.Data.(echo.Map)["upload_ids"].([]int64); len(ids) != 1 || ids[0] != 10 {
+		t.Errorf("Expected the purged upload IDs in the event, got %v", deleted.Data)
+	}
+
+	// Running the job again is harmless
+	if err := test.handler.PurgeAccountJob(context.Background(), jobRepo.GetJob(1)); err != nil {
+		t.Fatalf("Second run failed: %v", err)
+	}
+	if len(test.revoker.revoked) != 1 {
+		t.Errorf("Expected a completed deletion not to run again, got %v", test.revoker.revoked)
+	}
+}
+
+func TestAccount_AdminDeleteAndPurgeDue(t *testing.T) {
+	test := setupAccountTest(t)
+
+	rec := callAlbum(t, test.handler.AdminDeleteUser, http.MethodDelete, "/api/admin/users/2", `{}`, "id", "2")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusAccepted, rec.Code, rec.Body.String())
+	}
+	d, _ := test.deletionRepo.ScheduledDeletion(2)
+	if d.RequestedBy != 1 {
+		t.Errorf("Expected the admin to be recorded as requester, got %d", d.RequestedBy)
+	}
+
+	// Nothing is due yet
+	if purged, err := test.handler.PurgeDue(context.Background()); err != nil || purged != 0 {
+		t.Fatalf("Expected nothing to purge, got %d (%v)", purged, err)
+	}
+
+	rec = callAlbum(t, test.handler.AdminDeleteUser, http.MethodDelete, "/api/admin/users/2", `{"immediate":true}`, "id", "2")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if data := getDataMap(mustParse(t, rec)); data["status"] != account.StatusCompleted || data["id"] != float64(d.ID) {
+		t.Errorf("Expected the scheduled deletion to complete now, got %v", data)
+	}
+	if _, found := test.userRepo.GetUserByID(2); found {
+		t.Error("Expected user 2 to be deleted")
+	}
+
+	due, _ := test.deletionRepo.CreateDeletion(&account.Deletion{
+		UserID: 1, Username: "testuser", RequestedBy: 1,
+		Status: account.StatusScheduled, ScheduledFor: time.Now().Add(-time.Minute),
+	})
+	if purged, err := test.handler.PurgeDue(context.Background()); err != nil || purged != 1 {
+		t.Fatalf("Expected 1 account purged, got %d (%v)", purged, err)
+	}
+	if d, _ := test.deletionRepo.GetDeletion(due.ID); d.Status != account.StatusCompleted {
+		t.Errorf("Expected the due deletion to complete, got %s", d.Status)
+	}
+
+	rec = callAlbum(t, test.handler.AdminDeleteUser, http.MethodDelete, "/api/admin/users/99", `{}`, "id", "99")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an unknown user, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestAccount_PurgeClaimsDeletionOnce(t *testing.T) {
+	test := setupAccountTest(t)
+	callAlbum(t, test.handler.DeleteAccount, http.MethodDelete, "/api/me", `{"password":"Password123"}`)
+	d, _ := test.deletionRepo.ScheduledDeletion(1)
+
+	// A failed purge gives the deletion back so it can be retried
+	test.revoker.err = errors.New("revocation store offline")
+	if _, err := test.handler.Purge(context.Background(), d); err == nil {
+		t.Fatal("Expected the purge to fail")
+	}
+	if current, _ := test.deletionRepo.GetDeletion(d.ID); current.Status != account.StatusScheduled {
+		t.Fatalf("Expected a failed purge to release its claim, got %s", current.Status)
+	}
+	test.revoker.err = nil
+
+	// The job queue and -cmd purge-accounts racing for the same deletion purge once
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	results := map[error]int{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := test.handler.Purge(context.Background(), d)
+			mu.Lock()
+			results[err]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if results[nil] != 1 || results[account.ErrNotClaimed] != 4 || len(test.revoker.revoked) != 1 {
+		t.Errorf("Expected exactly one purge to run, got %v with %v revoked", results, test.revoker.revoked)
+	}
+
+	// A purge that claimed the deletion first cannot be cancelled
+	callAlbum(t, test.handler.AdminDeleteUser, http.MethodDelete, "/api/admin/users/2", `{}`, "id", "2")
+	other, _ := test.deletionRepo.ScheduledDeletion(2)
+	if _, claimed, _ := test.deletionRepo.ClaimDeletion(other.ID, time.Now().Add(-time.Hour)); !claimed {
+		t.Fatal("Expected to claim the scheduled deletion")
+	}
+	if err := test.deletionRepo.CancelDeletion(other.ID); err != account.ErrNoDeletion {
+		t.Errorf("Expected cancelling a claimed deletion to fail, got %v", err)
+	}
+	rec := callAlbum(t, test.handler.AdminCancelDeletion, http.MethodDelete, "/api/admin/users/2/deletion", "", "id", "2")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d while the purge runs, got %d", http.StatusNotFound, rec.Code)
+	}
+	if _, err := test.handler.Purge(context.Background(), other); err != account.ErrNotClaimed {
+		t.Errorf("Expected a claimed deletion not to be purged twice, got %v", err)
+	}
+}
+
+func TestAccount_PurgeTakesOverStaleClaim(t *testing.T) {
+	test := setupAccountTest(t)
+	auditRepo := NewMockAuditRepository()
+	test.handler.SetAuditLog(audit.NewLog(auditRepo))
+	jobRepo := NewMockJobRepository()
+	test.handler.SetJobQueue(newTestQueue(jobRepo))
+	callAlbum(t, test.handler.DeleteAccount, http.MethodDelete, "/api/me", `{"password":"Password123"}`)
+	d, _ := test.deletionRepo.ScheduledDeletion(1)
+
+	// A purge that dies after deleting the user leaves the deletion claimed
+	// and the files on disk
+	claimed, _, _ := test.deletionRepo.ClaimDeletion(d.ID, time.Now())
+	test.deletionRepo.RecordPurge(d.ID, []int64{10}, []string{test.files["mine.png"], test.files["export-1.zip"]})
+	test.userRepo.DeleteUser(1)
+
+	// A retry while the claim is fresh leaves it alone and checks back once it goes stale
+	if err := test.handler.PurgeAccountJob(context.Background(), jobRepo.GetJob(1)); err != nil {
+		t.Fatalf("Purge job failed: %v", err)
+	}
+	retry := jobRepo.GetJob(2)
+	if retry == nil || !retry.RunAt.Equal(claimed.ClaimedAt.Add(account.DefaultClaimTimeout)) {
+		t.Fatalf("Expected a retry when the claim goes stale, got %+v", retry)
+	}
+	if purged, err := test.handler.PurgeDue(context.Background()); err != nil || purged != 0 {
+		t.Fatalf("Expected a fresh claim not to be taken over, got %d (%v)", purged, err)
+	}
+
+	test.deletionRepo.Backdate(d.ID, account.DefaultClaimTimeout+time.Minute)
+	if purged, err := test.handler.PurgeDue(context.Background()); err != nil || purged != 1 {
+		t.Fatalf("Expected the stale deletion to be purged, got %d (%v)", purged, err)
+	}
+	for _, name := range []string{"mine.png", "export-1.zip"} {
+		if _, err := os.Stat(test.files[name]); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected %s to be removed, got %v", name, err)
+		}
+	}
+	if current, _ := test.deletionRepo.GetDeletion(d.ID); current.Status != account.StatusCompleted || current.FilesRemoved != 2 {
+		t.Errorf("Expected the taken-over deletion to complete, got %+v", current)
+	}
+	purged := listAudit(t, auditRepo)
+	if last := purged[len(purged)-1]; last.Action != audit.ActionAccountPurged || last.TargetID != "1" {
+		t.Errorf("Expected the purge to be audited, got %+v", last)
+	}
+
+	// A purge whose completion failed is taken over the same way
+	test.deletionRepo.completeErr = errors.New("connection reset")
+	rec := callAlbum(t, test.handler.AdminDeleteUser, http.MethodDelete, "/api/admin/users/2", `{"immediate":true}`, "id", "2")
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusInternalServerError, rec.Code, rec.Body.String())
+	}
+	test.deletionRepo.completeErr = nil
+	other, _ := test.deletionRepo.GetDeletion(d.ID + 1)
+	if other.Status != account.StatusPurging {
+		t.Fatalf("Expected the deletion to stay claimed, got %s", other.Status)
+	}
+	test.deletionRepo.Backdate(other.ID, account.DefaultClaimTimeout+time.Minute)
+	if _, err := test.handler.Purge(context.Background(), other); err != nil {
+		t.Fatalf("Expected the stale deletion to be taken over, got %v", err)
+	}
+	if current, _ := test.deletionRepo.GetDeletion(other.ID); current.Status != account.StatusCompleted {
+		t.Errorf("Expected the deletion to complete, got %s", current.Status)
+	}
+	if n := len(listAudit(t, auditRepo)); n != len(purged)+2 {
+		t.Errorf("Expected the request and the purge of user 2 to be audited, got %d new events", n-len(purged))
+	}
+}
+
+func TestAccount_RequireAdmin(t *testing.T) {
+	e := echo.New()
+	handler := auth.RequireAdmin(func(userID int64) bool { return userID == 7 })(func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	for userID, expected := range map[int64]int{7: http.StatusNoContent, 1: http.StatusForbidden} {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodDelete, "/api/admin/users/2", nil), rec)
+		c.Set("user", &auth.TokenClaims{UserID: userID})
+		if err := handler(c); err != nil {
+			t.Fatalf("Handler returned error: %v", err)
+		}
+		if rec.Code != expected {
+			t.Errorf("User %d: expected status %d, got %d", userID, expected, rec.Code)
+		}
+	}
+}
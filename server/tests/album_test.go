@@ -0,0 +1,196 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"elotus_test/server/models/album"
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/upload"
+
+	"github.com/labstack/echo/v4"
+)
+
+var _ album.Repository = (*MockAlbumRepository)(nil)
+
+func setupAlbumTest() (*album.Handler, *MockAlbumRepository, *MockUploadRepository) {
+	uploadRepo := NewMockUploadRepository()
+	for i := int64(1); i <= 3; i++ {
+		uploadRepo.AddUpload(&upload.FileUpload{ID: i, UserID: 1, Filename: fmt.Sprintf("%d.png", i)})
+	}
+	uploadRepo.AddUpload(&upload.FileUpload{ID: 4, UserID: 2, Filename: "4.png"})
+
+	albumRepo := NewMockAlbumRepository()
+	return album.NewHandler(albumRepo, uploadRepo), albumRepo, uploadRepo
+}
+
+// callAlbum runs an album handler as user 1; params are name/value pairs
+func callAlbum(t *testing.T, fn echo.HandlerFunc, method, target, body string, params ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	e := echo.New()
+	req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	var names, values []string
+	for i := 0; i+1 < len(params); i += 2 {
+		names = append(names, params[i])
+		values = append(values, params[i+1])
+	}
+	c.SetParamNames(names...)
+	c.SetParamValues(values...)
+	c.Set("user", &auth.TokenClaims{UserID: 1, Username: "testuser"})
+
+	if err := fn(c); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+	return rec
+}
+
+func itemUploadIDs(t *testing.T, rec *httptest.ResponseRecorder) []int64 {
+	t.Helper()
+	resp, _ := parseResponse(rec.Body.Bytes())
+	var ids []int64
+	for _, item := range getUploadDataList(resp) {
+		u := item.(map[string]interface{})["upload"].(map[string]interface{})
+		ids = append(ids, int64(u["id"].(float64)))
+	}
+	return ids
+}
+
+func TestAlbum_CreateAndList(t *testing.T) {
+	handler, _, _ := setupAlbumTest()
+
+	rec := callAlbum(t, handler.CreateAlbum, http.MethodPost, "/api/albums", `{"name":"Holiday","description":"Beach","cover_upload_id":1}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+	for i := 0; i < 2; i++ {
+		callAlbum(t, handler.CreateAlbum, http.MethodPost, "/api/albums", fmt.Sprintf(`{"name":"Album %d"}`, i))
+	}
+
+	rec = callAlbum(t, handler.ListAlbums, http.MethodGet, "/api/albums?page=2&per_page=2", "")
+	resp, _ := parseResponse(rec.Body.Bytes())
+	if len(getUploadDataList(resp)) != 1 {
+		t.Errorf("Expected 1 album on page 2, got %d", len(getUploadDataList(resp)))
+	}
+	if resp.Meta == nil || resp.Meta.Total != 3 || resp.Meta.Page != 2 || resp.Meta.PerPage != 2 || resp.Meta.TotalPages != 2 {
+		t.Errorf("Unexpected pagination meta: %+v", resp.Meta)
+	}
+}
+
+func TestAlbum_CreateValidation(t *testing.T) {
+	handler, _, _ := setupAlbumTest()
+
+	if rec := callAlbum(t, handler.CreateAlbum, http.MethodPost, "/api/albums", `{"name":"  "}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected blank name to be rejected, got %d", rec.Code)
+	}
+	if rec := callAlbum(t, handler.CreateAlbum, http.MethodPost, "/api/albums", `{"name":"x","cover_upload_id":4}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected another user's cover to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestAlbum_ItemsOrderingAndMembership(t *testing.T) {
+	handler, albumRepo, uploadRepo := setupAlbumTest()
+	callAlbum(t, handler.CreateAlbum, http.MethodPost, "/api/albums", `{"name":"Holiday"}`)
+
+	rec := callAlbum(t, handler.AddItems, http.MethodPost, "/api/albums/1/items", `{"upload_ids":[3,1,2,1]}`, "id", "1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("AddItems failed: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := callAlbum(t, handler.AddItems, http.MethodPost, "/api/albums/1/items", `{"upload_ids":[4]}`, "id", "1"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected another user's upload to be rejected, got %d", rec.Code)
+	}
+
+	rec = callAlbum(t, handler.ListItems, http.MethodGet, "/api/albums/1/items", "", "id", "1")
+	if got := itemUploadIDs(t, rec); fmt.Sprint(got) != "[3 1 2]" {
+		t.Errorf("Expected insertion order [3 1 2], got %v", got)
+	}
+
+	if rec := callAlbum(t, handler.ReorderItems, http.MethodPut, "/api/albums/1/items/order", `{"upload_ids":[1,2]}`, "id", "1"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected partial order to be rejected, got %d", rec.Code)
+	}
+	callAlbum(t, handler.ReorderItems, http.MethodPut, "/api/albums/1/items/order", `{"upload_ids":[2,3,1]}`, "id", "1")
+
+	rec = callAlbum(t, handler.ListItems, http.MethodGet, "/api/albums/1/items?per_page=2", "", "id", "1")
+	if got := itemUploadIDs(t, rec); fmt.Sprint(got) != "[2 3]" {
+		t.Errorf("Expected first page [2 3] after reorder, got %v", got)
+	}
+
+	callAlbum(t, handler.RemoveItem, http.MethodDelete, "/api/albums/1/items/3", "", "id", "1", "uploadId", "3")
+	if ids, _ := albumRepo.ItemIDs(1); fmt.Sprint(ids) != "[2 1]" {
+		t.Errorf("Expected [2 1] after removal, got %v", ids)
+	}
+	if _, found := uploadRepo.GetFileUploadByID(3); !found {
+		t.Error("Removing an item must not delete the upload")
+	}
+}
+
+func TestAlbum_DeleteKeepsUploads(t *testing.T) {
+	handler, _, uploadRepo := setupAlbumTest()
+	callAlbum(t, handler.CreateAlbum, http.MethodPost, "/api/albums", `{"name":"Holiday"}`)
+	callAlbum(t, handler.AddItems, http.MethodPost, "/api/albums/1/items", `{"upload_ids":[1,2]}`, "id", "1")
+
+	if rec := callAlbum(t, handler.DeleteAlbum, http.MethodDelete, "/api/albums/1", "", "id", "1"); rec.Code != http.StatusOK {
+		t.Fatalf("DeleteAlbum failed: %d", rec.Code)
+	}
+	if rec := callAlbum(t, handler.GetAlbum, http.MethodGet, "/api/albums/1", "", "id", "1"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected deleted album to be gone, got %d", rec.Code)
+	}
+	for _, id := range []int64{1, 2} {
+		if _, found := uploadRepo.GetFileUploadByID(id); !found {
+			t.Errorf("Upload %d was deleted with the album", id)
+		}
+	}
+}
+
+func TestAlbum_UpdateAndOwnership(t *testing.T) {
+	handler, albumRepo, _ := setupAlbumTest()
+	albumRepo.CreateAlbum(&album.Album{UserID: 2, Name: "Theirs"})
+	callAlbum(t, handler.CreateAlbum, http.MethodPost, "/api/albums", `{"name":"Mine","cover_upload_id":1}`)
+
+	if rec := callAlbum(t, handler.GetAlbum, http.MethodGet, "/api/albums/1", "", "id", "1"); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for another user's album, got %d", http.StatusForbidden, rec.Code)
+	}
+
+	rec := callAlbum(t, handler.UpdateAlbum, http.MethodPatch, "/api/albums/2", `{"description":"Updated","clear_cover":true}`, "id", "2")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("UpdateAlbum failed: %d %s", rec.Code, rec.Body.String())
+	}
+	stored, _ := albumRepo.GetAlbum(2)
+	if stored.Name != "Mine" || stored.Description != "Updated" || stored.CoverUploadID != nil {
+		t.Errorf("Unexpected album after update: %+v", stored)
+	}
+}
+
+func TestGetUserUploads_Pagination(t *testing.T) {
+	handler, mockRepo := setupUploadTestHandler()
+	for i := int64(1); i <= 5; i++ {
+		mockRepo.AddUpload(&upload.FileUpload{ID: i, UserID: 1, Filename: fmt.Sprintf("%d.png", i)})
+	}
+
+	e := echo.New()
+	c, rec := createUploadTestContext(e, http.MethodGet, "/api/uploads?page=3&per_page=2", nil, "")
+	c.Set("user", &auth.TokenClaims{UserID: 1, Username: "testuser"})
+	if err := handler.GetUserUploads(c); err != nil {
+		t.Fatalf("GetUserUploads returned error: %v", err)
+	}
+
+	resp, _ := parseUploadResponse(rec.Body.Bytes())
+	if len(getUploadDataList(resp)) != 1 {
+		t.Errorf("Expected 1 upload on the last page, got %d", len(getUploadDataList(resp)))
+	}
+	if resp.Meta.Total != 5 || resp.Meta.TotalPages != 3 {
+		t.Errorf("Unexpected meta: %+v", resp.Meta)
+	}
+
+	c, rec = createUploadTestContext(e, http.MethodGet, "/api/uploads?per_page=500", nil, "")
+	c.Set("user", &auth.TokenClaims{UserID: 1, Username: "testuser"})
+	handler.GetUserUploads(c)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected per_page over the maximum to be rejected, got %d", rec.Code)
+	}
+}
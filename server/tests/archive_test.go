@@ -0,0 +1,228 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"elotus_test/server/models/album"
+	"elotus_test/server/models/archive"
+	"elotus_test/server/models/upload"
+
+	"github.com/labstack/echo/v4"
+)
+
+var _ archive.Repository = (*MockArchiveRepository)(nil)
+
+type archiveTest struct {
+	handler     *archive.Handler
+	config      *archive.Config
+	archiveRepo *MockArchiveRepository
+	uploadRepo  *MockUploadRepository
+	albumRepo   *MockAlbumRepository
+}
+
+// setupArchiveTest stores four files for user 1 (two sharing a name up to case)
+// and one for user 2
+func setupArchiveTest(t *testing.T) *archiveTest {
+	t.Helper()
+	dir := t.TempDir()
+
+	uploadRepo := NewMockUploadRepository()
+	add := func(id, userID int64, name, content string) {
+		path := filepath.Join(dir, fmt.Sprintf("%d.bin", id))
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		uploadRepo.AddUpload(&upload.FileUpload{
+			ID: id, UserID: userID, Filename: fmt.Sprintf("%d.png", id), OriginalFilename: name,
+			FileSize: int64(len(content)), Status: upload.StatusClean, TempPath: path, Tags: []string{"trip"},
+		})
+	}
+	add(1, 1, "photo.jpg", "first")
+	add(2, 1, "PHOTO.jpg", "second")
+	add(3, 1, "../../etc/passwd", "third")
+	add(4, 1, "photo.jpg", "fourth")
+	add(5, 2, "theirs.jpg", "other")
+
+	config := archive.DefaultConfig()
+	config.StorageDir = filepath.Join(dir, "archives")
+	config.SigningKey = []byte("test-key")
+
+	test := &archiveTest{
+		config:      config,
+		archiveRepo: NewMockArchiveRepository(),
+		uploadRepo:  uploadRepo,
+		albumRepo:   NewMockAlbumRepository(),
+	}
+	test.handler = archive.NewHandler(config, test.archiveRepo, uploadRepo, test.albumRepo)
+	return test
+}
+
+func readZip(t *testing.T, body []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("Invalid zip: %v", err)
+	}
+
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+	return files
+}
+
+func TestArchive_StreamsSelectedIDs(t *testing.T) {
+	test := setupArchiveTest(t)
+
+	rec := callAlbum(t, test.handler.CreateArchive, http.MethodPost, "/api/uploads/archive", `{"ids":[1,2,3,4,1]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get(echo.HeaderContentType) != "application/zip" {
+		t.Errorf("Unexpected content type %q", rec.Header().Get(echo.HeaderContentType))
+	}
+
+	files := readZip(t, rec.Body.Bytes())
+	expected := map[string]string{
+		"photo.jpg":     "first",
+		"PHOTO (1).jpg": "second",
+		"passwd":        "third",
+		"photo (2).jpg": "fourth",
+	}
+	if len(files) != len(expected) {
+		t.Fatalf("Expected %d entries, got %v", len(expected), files)
+	}
+	for name, content := range expected {
+		if files[name] != content {
+			t.Errorf("Entry %q: expected %q, got %q", name, content, files[name])
+		}
+	}
+}
+
+func TestArchive_VerifiesOwnership(t *testing.T) {
+	test := setupArchiveTest(t)
+
+	rec := callAlbum(t, test.handler.CreateArchive, http.MethodPost, "/api/uploads/archive", `{"ids":[1,5]}`)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, rec.Code)
+	}
+
+	rec = callAlbum(t, test.handler.CreateArchive, http.MethodPost, "/api/uploads/archive", `{"ids":[1,99]}`)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	rec = callAlbum(t, test.handler.CreateArchive, http.MethodPost, "/api/uploads/archive", `{}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	rec = callAlbum(t, test.handler.CreateArchive, http.MethodPost, "/api/uploads/archive", `{"ids":[1],"album_id":1}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for mixed selection, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestArchive_AlbumAndFilterSelection(t *testing.T) {
+	test := setupArchiveTest(t)
+
+	a, _ := test.albumRepo.CreateAlbum(&album.Album{UserID: 1, Name: "Trip"})
+	test.albumRepo.AddItems(a.ID, []int64{4, 1})
+
+	rec := callAlbum(t, test.handler.CreateArchive, http.MethodPost, "/api/uploads/archive", fmt.Sprintf(`{"album_id":%d}`, a.ID))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	files := readZip(t, rec.Body.Bytes())
+	if files["photo.jpg"] != "fourth" || files["photo (1).jpg"] != "first" {
+		t.Errorf("Expected album order to drive naming, got %v", files)
+	}
+
+	rec = callAlbum(t, test.handler.CreateArchive, http.MethodPost, "/api/uploads/archive", `{"tags":["trip"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if files := readZip(t, rec.Body.Bytes()); len(files) != 4 {
+		t.Errorf("Expected only the caller's 4 uploads, got %v", files)
+	}
+}
+
+func TestArchive_SizeCap(t *testing.T) {
+	test := setupArchiveTest(t)
+	test.config.MaxBytes = 10
+
+	rec := callAlbum(t, test.handler.CreateArchive, http.MethodPost, "/api/uploads/archive", `{"ids":[1,2,3]}`)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestEntityTooLarge, rec.Code)
+	}
+}
+
+func TestArchive_AsyncBuildAndSignedDownload(t *testing.T) {
+	test := setupArchiveTest(t)
+	test.config.MaxSyncBytes = 5
+
+	rec := callAlbum(t, test.handler.CreateArchive, http.MethodPost, "/api/uploads/archive", `{"ids":[1,2]}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusAccepted, rec.Code, rec.Body.String())
+	}
+
+	// Without a job queue the archive is built inline
+	rec = callAlbum(t, test.handler.GetArchive, http.MethodGet, "/api/archives/1", "", "id", "1")
+	data := getDataMap(mustParse(t, rec))
+	if data["status"] != archive.StatusReady {
+		t.Fatalf("Expected ready archive, got %v", data)
+	}
+	link, _ := data["download_url"].(string)
+	if !strings.HasPrefix(link, "/archives/1/download?") {
+		t.Fatalf("Unexpected download link %q", link)
+	}
+
+	download := func(target string) *httptest.ResponseRecorder {
+		e := echo.New()
+		c, rec := createUploadTestContext(e, http.MethodGet, target, nil, "")
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+		if err := test.handler.Download(c); err != nil {
+			t.Fatalf("Handler returned error: %v", err)
+		}
+		return rec
+	}
+
+	rec = download(link)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if files := readZip(t, rec.Body.Bytes()); files["PHOTO (1).jpg"] != "second" {
+		t.Errorf("Unexpected archive contents: %v", files)
+	}
+
+	if rec := download(link + "00"); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected tampered link to be rejected, got %d", rec.Code)
+	}
+
+	past := time.Now().Add(-time.Minute).Unix()
+	expired := fmt.Sprintf("/archives/1/download?expires=%d&signature=%s", past, archive.Sign(test.config.SigningKey, 1, past))
+	if rec := download(expired); rec.Code != http.StatusGone {
+		t.Errorf("Expected expired link to be rejected, got %d", rec.Code)
+	}
+
+	if rec := callAlbum(t, test.handler.GetArchive, http.MethodGet, "/api/archives/1", "", "id", "2"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
@@ -0,0 +1,217 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"elotus_test/server/models/audit"
+	"elotus_test/server/models/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+var _ audit.Repository = (*MockAuditRepository)(nil)
+
+func listAudit(t *testing.T, repo *MockAuditRepository) []*audit.Event {
+	t.Helper()
+	events, _ := repo.EventsAfter(0, 1000)
+	return events
+}
+
+func verifyAudit(t *testing.T, repo *MockAuditRepository) *audit.VerifyReport {
+	t.Helper()
+	report, err := audit.Verify(context.Background(), repo)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	return report
+}
+
+func TestAudit_AuthHandlerEmitsEvents(t *testing.T) {
+	handler, _, _ := setupAuthTestHandler()
+	auditRepo := NewMockAuditRepository()
+	handler.SetAuditLog(audit.NewLog(auditRepo))
+
+	e := echo.New()
+	call := func(fn echo.HandlerFunc, target, body string) {
+		req := httptest.NewRequest(http.MethodPost, target, bytes.NewBufferString(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("User-Agent", "audit-test")
+		req.RemoteAddr = "203.0.113.7:5000"
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.Set("user", &auth.TokenClaims{UserID: 1, Username: "audited"})
+		if err := fn(c); err != nil {
+			t.Fatalf("Handler returned error: %v", err)
+		}
+	}
+
+	call(handler.Register, "/register", `{"username": "audited", "password": "Password123"}`)
+	call(handler.Login, "/login", `{"username": "audited", "password": "wrongpassword"}`)
+	call(handler.Login, "/login", `{"username": "nobody", "password": "Password123"}`)
+	call(handler.Login, "/login", `{"username": "audited", "password": "Password123"}`)
+	call(handler.RevokeToken, "/api/revoke", `{}`)
+
+	events := listAudit(t, auditRepo)
+	expected := []struct {
+		action  string
+		actorID int64
+		target  string
+	}{
+		{audit.ActionRegister, 1, "1"},
+		{audit.ActionLoginFailed, 0, "1"},
+		{audit.ActionLoginFailed, 0, ""},
+		{audit.ActionLogin, 1, "1"},
+		{audit.ActionTokensRevoked, 1, "1"},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d audit events, got %d", len(expected), len(events))
+	}
+	for i, want := range expected {
+		got := events[i]
+		if got.Action != want.action || got.ActorID != want.actorID || got.TargetID != want.target {
+			t.Errorf("Event %d: expected %s by %d on %q, got %s by %d on %q",
+				i, want.action, want.actorID, want.target, got.Action, got.ActorID, got.TargetID)
+		}
+		if got.ClientIP != "203.0.113.7" || got.UserAgent != "audit-test" {
+			t.Errorf("Event %d: expected request details, got %q and %q", i, got.ClientIP, got.UserAgent)
+		}
+	}
+
+	var metadata map[string]string
+	if err := json.Unmarshal(events[2].Metadata, &metadata); err != nil || metadata["username"] != "nobody" || metadata["reason"] != "unknown_user" {
+		t.Errorf("Expected the unknown username in the failed login, got %s", events[2].Metadata)
+	}
+
+	if report := verifyAudit(t, auditRepo); !report.OK() || report.Checked != 5 || report.Head != events[4].Hash {
+		t.Errorf("Expected an intact chain of 5 events, got %+v", report)
+	}
+}
+
+func TestAudit_AccountDeletionEmitsEvents(t *testing.T) {
+	test := setupAccountTest(t)
+	auditRepo := NewMockAuditRepository()
+	test.handler.SetAuditLog(audit.NewLog(auditRepo))
+
+	callAlbum(t, test.handler.DeleteAccount, http.MethodDelete, "/api/me", `{"password":"Password123"}`)
+	callAlbum(t, test.handler.CancelDeletion, http.MethodDelete, "/api/me/deletion", "")
+	callAlbum(t, test.handler.AdminDeleteUser, http.MethodDelete, "/api/admin/users/2", `{"immediate":true}`, "id", "2")
+
+	events := listAudit(t, auditRepo)
+	actions := make([]string, len(events))
+	for i, e := range events {
+		actions[i] = e.Action
+	}
+	want := []string{audit.ActionDeletionRequested, audit.ActionDeletionCancelled, audit.ActionDeletionRequested, audit.ActionAccountPurged}
+	if strings.Join(actions, ",") != strings.Join(want, ",") {
+		t.Fatalf("Expected %v, got %v", want, actions)
+	}
+
+	var metadata map[string]interface{}
+	json.Unmarshal(events[2].Metadata, &metadata)
+	if events[2].ActorID != 1 || events[2].TargetID != "2" || metadata["admin"] != true || metadata["immediate"] != true {
+		t.Errorf("Expected an immediate admin deletion of user 2, got %+v (%s)", events[2], events[2].Metadata)
+	}
+	if purged := events[3]; purged.ActorID != 0 || purged.TargetID != "2" {
+		t.Errorf("Expected the purge of user 2 without an actor, got %+v", purged)
+	}
+}
+
+func TestAudit_VerifyDetectsTampering(t *testing.T) {
+	setup := func() *MockAuditRepository {
+		repo := NewMockAuditRepository()
+		log := audit.NewLog(repo)
+		for i := int64(1); i <= 4; i++ {
+			log.Emit(audit.Entry{
+				Action:     audit.ActionUploadCreated,
+				ActorID:    1,
+				TargetType: audit.TargetUpload,
+				TargetID:   audit.ID(i),
+				Metadata:   map[string]interface{}{"size": i * 100},
+			})
+		}
+		if report := verifyAudit(t, repo); !report.OK() {
+			t.Fatalf("Expected an intact chain, got %+v", report.Breaks)
+		}
+		return repo
+	}
+
+	// An edited event no longer matches its hash
+	repo := setup()
+	repo.Tamper(2, func(e *audit.Event) { e.ActorID = 7 })
+	report := verifyAudit(t, repo)
+	if len(report.Breaks) != 1 || report.Breaks[0].ID != 2 || !strings.Contains(report.Breaks[0].Reason, "hash") {
+		t.Errorf("Expected event 2 to fail its hash, got %+v", report.Breaks)
+	}
+
+	// Rehashing the edited event breaks the link of the next one
+	repo = setup()
+	repo.Tamper(2, func(e *audit.Event) {
+		e.Metadata = json.RawMessage(`{"size":1}`)
+		e.Hash = e.ComputeHash()
+	})
+	report = verifyAudit(t, repo)
+	if len(report.Breaks) != 1 || report.Breaks[0].ID != 3 || !strings.Contains(report.Breaks[0].Reason, "prev_hash") {
+		t.Errorf("Expected event 3 to lose its link, got %+v", report.Breaks)
+	}
+
+	// So does removing an event
+	repo = setup()
+	repo.Remove(3)
+	report = verifyAudit(t, repo)
+	if len(report.Breaks) != 1 || report.Breaks[0].ID != 4 || report.Checked != 3 {
+		t.Errorf("Expected event 4 to lose its link, got %+v", report)
+	}
+}
+
+func TestAudit_AdminListFilters(t *testing.T) {
+	auditRepo := NewMockAuditRepository()
+	log := audit.NewLog(auditRepo)
+	handler := audit.NewHandler(auditRepo)
+
+	log.Emit(audit.Entry{Action: audit.ActionLogin, ActorID: 1, ClientIP: "198.51.100.1"})
+	log.Emit(audit.Entry{Action: audit.ActionLoginFailed, ClientIP: "198.51.100.2"})
+	log.Emit(audit.Entry{Action: audit.ActionLogin, ActorID: 2, ClientIP: "198.51.100.2"})
+
+	ids := func(rec *httptest.ResponseRecorder) []float64 {
+		t.Helper()
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+		var ids []float64
+		for _, item := range mustParse(t, rec).Data.([]interface{}) {
+			ids = append(ids, item.(map[string]interface{})["id"].(float64))
+		}
+		return ids
+	}
+
+	if got := ids(callAlbum(t, handler.ListEvents, http.MethodGet, "/api/admin/audit", "")); len(got) != 3 || got[0] != 3 {
+		t.Errorf("Expected all 3 events newest first, got %v", got)
+	}
+	if got := ids(callAlbum(t, handler.ListEvents, http.MethodGet, "/api/admin/audit?action=auth.login", "")); len(got) != 2 {
+		t.Errorf("Expected 2 successful logins, got %v", got)
+	}
+	if got := ids(callAlbum(t, handler.ListEvents, http.MethodGet, "/api/admin/audit?ip=198.51.100.2&actor_id=2", "")); len(got) != 1 || got[0] != 3 {
+		t.Errorf("Expected event 3, got %v", got)
+	}
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	if got := ids(callAlbum(t, handler.ListEvents, http.MethodGet, "/api/admin/audit?since="+future, "")); len(got) != 0 {
+		t.Errorf("Expected no events after %s, got %v", future, got)
+	}
+
+	rec := callAlbum(t, handler.ListEvents, http.MethodGet, "/api/admin/audit?per_page=2&page=2", "")
+	if got := ids(rec); len(got) != 1 || got[0] != 1 || mustParse(t, rec).Meta.Total != 3 {
+		t.Errorf("Expected the oldest event on page 2 of 3 events, got %v", got)
+	}
+
+	for _, query := range []string{"actor_id=abc", "since=yesterday"} {
+		if rec := callAlbum(t, handler.ListEvents, http.MethodGet, "/api/admin/audit?"+query, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %s, got %d", http.StatusBadRequest, query, rec.Code)
+		}
+	}
+}
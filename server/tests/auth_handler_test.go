@@ -327,6 +327,41 @@ func TestLogin_InvalidPassword(t *testing.T) {
 	}
 }
 
+func TestLogin_RecordsHistory(t *testing.T) {
+	handler, userRepo, _ := setupAuthTestHandler()
+
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("Password123"), bcrypt.DefaultCost)
+	userRepo.AddUser(&user.User{
+		ID:        1,
+		Username:  "testuser",
+		Password:  string(hashedPassword),
+		CreatedAt: time.Now(),
+	})
+
+	e := echo.New()
+	for _, password := range []string{"wrongpassword", "Password123"} {
+		reqBody := `{"username": "testuser", "password": "` + password + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("User-Agent", "history-test")
+		req.RemoteAddr = "203.0.113.7:5000"
+		if err := handler.Login(e.NewContext(req, httptest.NewRecorder())); err != nil {
+			t.Fatalf("Login returned error: %v", err)
+		}
+	}
+
+	logins, _ := userRepo.ListLogins(1)
+	if len(logins) != 2 {
+		t.Fatalf("Expected 2 login events, got %d", len(logins))
+	}
+	if logins[0].Success || !logins[1].Success {
+		t.Errorf("Expected a failed then a successful login, got %v and %v", logins[0].Success, logins[1].Success)
+	}
+	if logins[1].ClientIP != "203.0.113.7" || logins[1].UserAgent != "history-test" {
+		t.Errorf("Unexpected client details: %+v", logins[1])
+	}
+}
+
 func TestLogin_EmptyCredentials(t *testing.T) {
 	handler, _, _ := setupAuthTestHandler()
 
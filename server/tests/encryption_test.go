@@ -0,0 +1,236 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+
+	"elotus_test/server/envelope"
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/upload"
+
+	"github.com/labstack/echo/v4"
+)
+
+func testKeyring(t *testing.T, primary string, previous ...envelope.MasterKey) (*envelope.Keyring, envelope.MasterKey) {
+	t.Helper()
+	key := envelope.MasterKey{ID: primary, Key: make([]byte, envelope.KeySize)}
+	rand.Read(key.Key)
+	keyring, err := envelope.NewKeyring(key, previous...)
+	if err != nil {
+		t.Fatalf("NewKeyring failed: %v", err)
+	}
+	return keyring, key
+}
+
+func encrypt(t *testing.T, plain, dataKey []byte) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	w, err := envelope.NewWriter(&out, dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Uneven writes exercise the chunk buffering
+	for len(plain) > 0 {
+		n := 7919
+		if n > len(plain) {
+			n = len(plain)
+		}
+		w.Write(plain[:n])
+		plain = plain[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestEnvelope_RoundTripAndRanges(t *testing.T) {
+	dataKey := make([]byte, envelope.KeySize)
+	rand.Read(dataKey)
+
+	for _, size := range []int{0, 1, envelope.ChunkSize - 1, envelope.ChunkSize, envelope.ChunkSize + 1, 3*envelope.ChunkSize + 5} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+
+		sealed := encrypt(t, plain, dataKey)
+		if int64(len(sealed)) != envelope.EncryptedSize(int64(size)) {
+			t.Errorf("size %d: expected %d encrypted bytes, got %d", size, envelope.EncryptedSize(int64(size)), len(sealed))
+		}
+
+		r, err := envelope.NewReader(bytes.NewReader(sealed), int64(len(sealed)), dataKey)
+		if err != nil {
+			t.Fatalf("size %d: NewReader failed: %v", size, err)
+		}
+		if r.Size() != int64(size) {
+			t.Errorf("size %d: reader reports %d", size, r.Size())
+		}
+		got, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Errorf("size %d: round trip failed (err %v)", size, err)
+		}
+
+		// A range straddling a chunk boundary
+		if size > envelope.ChunkSize+10 {
+			r.Seek(int64(envelope.ChunkSize-10), io.SeekStart)
+			part := make([]byte, 20)
+			if _, err := io.ReadFull(r, part); err != nil || !bytes.Equal(part, plain[envelope.ChunkSize-10:envelope.ChunkSize+10]) {
+				t.Errorf("size %d: ranged read failed (err %v)", size, err)
+			}
+		}
+	}
+}
+
+func TestEnvelope_DetectsTampering(t *testing.T) {
+	dataKey := make([]byte, envelope.KeySize)
+	rand.Read(dataKey)
+	plain := make([]byte, 2*envelope.ChunkSize+100)
+	rand.Read(plain)
+	sealed := encrypt(t, plain, dataKey)
+
+	read := func(data []byte) error {
+		r, err := envelope.NewReader(bytes.NewReader(data), int64(len(data)), dataKey)
+		if err != nil {
+			return err
+		}
+		_, err = io.ReadAll(r)
+		return err
+	}
+
+	flipped := append([]byte{}, sealed...)
+	flipped[len(flipped)/2] ^= 1
+	if err := read(flipped); !errors.Is(err, envelope.ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt for a flipped bit, got %v", err)
+	}
+
+	// Dropping the final chunk leaves a well-formed prefix that must still fail
+	truncated := sealed[:len(sealed)-(100+16)]
+	if err := read(truncated); !errors.Is(err, envelope.ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt for a truncated file, got %v", err)
+	}
+}
+
+func TestKeyring_WrapUnwrap(t *testing.T) {
+	keyring, _ := testKeyring(t, "k1")
+
+	dataKey, wrapped, err := keyring.NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unwrapped, err := keyring.Unwrap("k1", wrapped)
+	if err != nil || !bytes.Equal(unwrapped, dataKey) {
+		t.Fatalf("Unwrap failed: %v", err)
+	}
+
+	if _, err := keyring.Unwrap("k0", wrapped); !errors.Is(err, envelope.ErrUnknownKey) {
+		t.Errorf("Expected ErrUnknownKey, got %v", err)
+	}
+
+	other, _ := testKeyring(t, "k1")
+	if _, err := other.Unwrap("k1", wrapped); !errors.Is(err, envelope.ErrUnwrapFailed) {
+		t.Errorf("Expected a different master key to fail, got %v", err)
+	}
+}
+
+func uploadEncrypted(t *testing.T, handler *upload.Handler) map[string]interface{} {
+	t.Helper()
+	body, contentType := createMultipartForm("data", "secret.png", createTestImageContent())
+	e := echo.New()
+	c, rec := createUploadTestContext(e, http.MethodPost, "/api/upload", body, contentType)
+	c.Set("user", &auth.TokenClaims{UserID: 1, Username: "testuser"})
+	if err := handler.Upload(c); err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	resp, _ := parseUploadResponse(rec.Body.Bytes())
+	return getUploadDataMap(resp)
+}
+
+func TestUpload_EncryptsAtRestAndServesPlaintext(t *testing.T) {
+	useUploadStorage(t, t.TempDir())
+	keyring, _ := testKeyring(t, "k1")
+	handler, repo := setupUploadTestHandler()
+	handler.SetKeyring(keyring)
+
+	uploadEncrypted(t, handler)
+	stored, _ := repo.GetFileUploadByID(1)
+	if stored.EncryptedKey == "" || stored.EncryptionKeyID != "k1" {
+		t.Fatalf("Expected a wrapped key under k1, got %q/%q", stored.EncryptedKey, stored.EncryptionKeyID)
+	}
+
+	plain := createTestImageContent()
+	onDisk, _ := os.ReadFile(stored.TempPath)
+	if bytes.Contains(onDisk, plain[:16]) {
+		t.Error("File on disk contains plaintext")
+	}
+	if stored.FileSize != int64(len(plain)) {
+		t.Errorf("Expected plaintext size %d to be recorded, got %d", len(plain), stored.FileSize)
+	}
+
+	e := echo.New()
+	c, rec := createUploadTestContext(e, http.MethodGet, "/media/images/"+stored.Filename, nil, "")
+	c.Request().Header.Set("Range", "bytes=1-3")
+	c.SetParamNames("*")
+	c.SetParamValues("images/" + stored.Filename)
+	if err := handler.ServeMedia(c); err != nil {
+		t.Fatalf("ServeMedia returned error: %v", err)
+	}
+	if rec.Code != http.StatusPartialContent || !bytes.Equal(rec.Body.Bytes(), plain[1:4]) {
+		t.Errorf("Expected decrypted bytes 1-3, got %d %q", rec.Code, rec.Body.Bytes())
+	}
+
+	report, err := handler.ReconcileUploads(context.Background(), upload.ReconcileOptions{DryRun: true, VerifyChecksums: true})
+	if err != nil || report.Drifted() {
+		t.Errorf("Expected encrypted upload to reconcile cleanly, got %+v (err %v)", report, err)
+	}
+}
+
+func TestRotateEncryptionKeys(t *testing.T) {
+	useUploadStorage(t, t.TempDir())
+	oldKeyring, oldKey := testKeyring(t, "k0")
+	handler, repo := setupUploadTestHandler()
+	handler.SetKeyring(oldKeyring)
+	uploadEncrypted(t, handler)
+	repo.AddUpload(&upload.FileUpload{ID: 2, UserID: 1, TempPath: "plain.png"})
+
+	newKeyring, newKey := testKeyring(t, "k1", oldKey)
+	handler.SetKeyring(newKeyring)
+
+	report, err := handler.RotateEncryptionKeys(context.Background(), true)
+	if err != nil || report.Rewrapped != 1 || report.Plaintext != 1 {
+		t.Fatalf("Unexpected dry run result %+v (err %v)", report, err)
+	}
+	if stored, _ := repo.GetFileUploadByID(1); stored.EncryptionKeyID != "k0" {
+		t.Fatal("Dry run must not change keys")
+	}
+
+	if _, err := handler.RotateEncryptionKeys(context.Background(), false); err != nil {
+		t.Fatalf("Rotation failed: %v", err)
+	}
+	stored, _ := repo.GetFileUploadByID(1)
+	if stored.EncryptionKeyID != "k1" {
+		t.Fatalf("Expected key to move to k1, got %q", stored.EncryptionKeyID)
+	}
+
+	// The old key can now be dropped entirely
+	retired, err := envelope.NewKeyring(newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, err := upload.OpenBlob(retired, stored)
+	if err != nil {
+		t.Fatalf("OpenBlob with only the new key failed: %v", err)
+	}
+	defer blob.Close()
+	got, _ := io.ReadAll(blob)
+	if !bytes.Equal(got, createTestImageContent()) {
+		t.Error("Decrypted content changed after rotation")
+	}
+}
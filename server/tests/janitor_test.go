@@ -0,0 +1,175 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"elotus_test/server/models/janitor"
+	"elotus_test/server/models/upload"
+)
+
+// setupJanitorTest lays out a storage root with one committed upload and a mix
+// of uncommitted files of different ages; it returns the root and a writer
+func setupJanitorTest(t *testing.T) (string, *MockUploadRepository, func(rel string, size int, age time.Duration) string) {
+	t.Helper()
+	root := t.TempDir()
+	repo := NewMockUploadRepository()
+
+	write := func(rel string, size int, age time.Duration) string {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		modified := time.Now().Add(-age)
+		os.Chtimes(path, modified, modified)
+		return path
+	}
+
+	committed := write("images/committed.png", 1000, 3*time.Hour)
+	repo.AddUpload(&upload.FileUpload{ID: 1, UserID: 1, Status: upload.StatusClean, TempPath: committed})
+	return root, repo, write
+}
+
+func newTestJanitor(root string, repo *MockUploadRepository, maxBytes int64) *janitor.Janitor {
+	return janitor.NewJanitor(&janitor.Config{
+		Root:     root,
+		MinAge:   10 * time.Minute,
+		MaxAge:   time.Hour,
+		MaxBytes: maxBytes,
+	}, repo)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestJanitor_RemovesExpiredUncommittedFiles(t *testing.T) {
+	root, repo, write := setupJanitorTest(t)
+	expired := write("images/abandoned.png", 300, 2*time.Hour)
+	recent := write("images/recent.png", 200, 20*time.Minute)
+	inFlight := write("images/in-flight.png", 100, time.Minute)
+	partial := write("archives/archive-9.zip.part", 50, 2*time.Hour)
+	archive := write("archives/archive-1.zip", 4000, 5*time.Hour)
+	variant := write("transforms/1/64x64_contain_q80.jpg", 10, 5*time.Hour)
+
+	report, err := newTestJanitor(root, repo, 1<<30).Run(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	for _, path := range []string{expired, partial} {
+		if exists(path) {
+			t.Errorf("Expected %s to be removed", path)
+		}
+	}
+	// Committed blobs, young files and files owned by other subsystems stay
+	for _, path := range []string{filepath.Join(root, "images/committed.png"), recent, inFlight, archive, variant} {
+		if !exists(path) {
+			t.Errorf("Expected %s to be kept", path)
+		}
+	}
+
+	if len(report.Removed) != 2 || report.ReclaimedBytes != 350 {
+		t.Errorf("Expected 2 files and 350 bytes reclaimed, got %d and %d", len(report.Removed), report.ReclaimedBytes)
+	}
+	for _, removed := range report.Removed {
+		if removed.Reason != janitor.ReasonExpired {
+			t.Errorf("Expected %s to be removed as expired, got %s", removed.Path, removed.Reason)
+		}
+	}
+	if report.TempFiles != 2 || report.TempBytes != 300 {
+		t.Errorf("Expected 2 uncommitted files (300 bytes) left, got %d (%d bytes)", report.TempFiles, report.TempBytes)
+	}
+}
+
+func TestJanitor_EnforcesSizeCapOldestFirst(t *testing.T) {
+	root, repo, write := setupJanitorTest(t)
+	oldest := write("images/a.png", 400, 50*time.Minute)
+	middle := write("images/b.png", 400, 40*time.Minute)
+	newest := write("images/c.png", 400, 30*time.Minute)
+	inFlight := write("quarantine/d.png", 400, time.Minute)
+
+	report, err := newTestJanitor(root, repo, 900).Run(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if exists(oldest) || exists(middle) {
+		t.Error("Expected the two oldest files to be removed to fit the cap")
+	}
+	if !exists(newest) || !exists(inFlight) {
+		t.Error("Expected the newest and in-flight files to be kept")
+	}
+	for _, removed := range report.Removed {
+		if removed.Reason != janitor.ReasonOverCap {
+			t.Errorf("Expected %s to be removed for the cap, got %s", removed.Path, removed.Reason)
+		}
+	}
+	if report.TempBytes != 800 {
+		t.Errorf("Expected 800 uncommitted bytes left, got %d", report.TempBytes)
+	}
+}
+
+func TestJanitor_DryRunAndStats(t *testing.T) {
+	root, repo, write := setupJanitorTest(t)
+	expired := write("images/abandoned.png", 300, 2*time.Hour)
+	j := newTestJanitor(root, repo, 1<<30)
+
+	report, err := j.Run(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if !exists(expired) || len(report.Removed) != 1 || report.ReclaimedBytes != 300 {
+		t.Errorf("Expected a dry run to report without removing, got %+v", report)
+	}
+	if stats := j.Stats(); stats.Runs != 0 {
+		t.Errorf("Expected dry runs to leave stats alone, got %+v", stats)
+	}
+
+	var summary strings.Builder
+	report.WriteSummary(&summary)
+	if !strings.Contains(summary.String(), "dry run") || !strings.Contains(summary.String(), expired) {
+		t.Errorf("Unexpected summary:\n%s", summary.String())
+	}
+
+	if _, err := j.Run(context.Background(), false); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if stats := j.Stats(); stats.Runs != 1 || stats.FilesReclaimed != 1 || stats.BytesReclaimed != 300 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	rec := callAlbum(t, janitor.NewHandler(j).GetStats, http.MethodGet, "/api/admin/janitor", "")
+	if data := getDataMap(mustParse(t, rec)); rec.Code != http.StatusOK || data["runs"] != float64(1) || data["bytes_reclaimed"] != float64(300) {
+		t.Errorf("Expected the stats from the admin endpoint, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestJanitor_StartStop(t *testing.T) {
+	root, repo, write := setupJanitorTest(t)
+	expired := write("images/abandoned.png", 300, 2*time.Hour)
+
+	j := janitor.NewJanitor(&janitor.Config{Root: root, Interval: 10 * time.Millisecond, MinAge: time.Minute, MaxAge: time.Hour}, repo)
+	j.Start()
+	deadline := time.Now().Add(2 * time.Second)
+	for exists(expired) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	j.Stop()
+
+	if exists(expired) {
+		t.Error("Expected the periodic janitor to remove the expired file")
+	}
+	if stats := j.Stats(); stats.BytesReclaimed != 300 {
+		t.Errorf("Expected 300 bytes reclaimed, got %+v", stats)
+	}
+}
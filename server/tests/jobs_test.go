@@ -0,0 +1,224 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/jobs"
+	"elotus_test/server/models/upload"
+
+	"github.com/labstack/echo/v4"
+)
+
+var _ jobs.Repository = (*MockJobRepository)(nil)
+
+func newTestQueue(repo jobs.Repository) *jobs.Queue {
+	return jobs.NewQueue(&jobs.Config{
+		Workers:      2,
+		PollInterval: 10 * time.Millisecond,
+		MaxAttempts:  3,
+		LockTimeout:  time.Minute,
+		BaseBackoff:  time.Millisecond,
+		MaxBackoff:   5 * time.Millisecond,
+	}, repo)
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("Condition not met before deadline")
+}
+
+func TestQueue_RunsJob(t *testing.T) {
+	repo := NewMockJobRepository()
+	queue := newTestQueue(repo)
+
+	var got string
+	done := make(chan struct{})
+	queue.Register("test.echo", func(ctx context.Context, job *jobs.Job) error {
+		got = string(job.Payload)
+		close(done)
+		return nil
+	})
+	queue.Start()
+	defer queue.Shutdown(context.Background())
+
+	job, err := queue.Enqueue("test.echo", map[string]int{"n": 1})
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Job was not processed")
+	}
+	waitFor(t, func() bool { return repo.GetJob(job.ID).Status == jobs.StatusDone })
+
+	if got != `{"n":1}` {
+		t.Errorf("Unexpected payload: %s", got)
+	}
+}
+
+func TestQueue_RetriesThenDeadLetters(t *testing.T) {
+	repo := NewMockJobRepository()
+	queue := newTestQueue(repo)
+
+	var calls int32
+	queue.Register("test.fail", func(ctx context.Context, job *jobs.Job) error {
+		atomic.AddInt32(&calls, 1)
+		return errors.New("boom")
+	})
+	queue.Start()
+	defer queue.Shutdown(context.Background())
+
+	job, _ := queue.Enqueue("test.fail", nil)
+	waitFor(t, func() bool { return repo.GetJob(job.ID).Status == jobs.StatusDead })
+
+	stored := repo.GetJob(job.ID)
+	if stored.Attempts != 3 || atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("Expected 3 attempts, got %d (handler calls %d)", stored.Attempts, calls)
+	}
+	if stored.LastError != "boom" {
+		t.Errorf("Expected last error to be recorded, got %q", stored.LastError)
+	}
+}
+
+func TestQueue_RecoversFromPanic(t *testing.T) {
+	repo := NewMockJobRepository()
+	queue := newTestQueue(repo)
+
+	var calls int32
+	queue.Register("test.panic", func(ctx context.Context, job *jobs.Job) error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			panic("unexpected")
+		}
+		return nil
+	})
+	queue.Start()
+	defer queue.Shutdown(context.Background())
+
+	job, _ := queue.Enqueue("test.panic", nil)
+	waitFor(t, func() bool { return repo.GetJob(job.ID).Status == jobs.StatusDone })
+}
+
+func TestQueue_ShutdownDrainsInFlightJobs(t *testing.T) {
+	repo := NewMockJobRepository()
+	queue := newTestQueue(repo)
+
+	started := make(chan struct{})
+	queue.Register("test.slow", func(ctx context.Context, job *jobs.Job) error {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+	queue.Start()
+
+	job, _ := queue.Enqueue("test.slow", nil)
+	<-started
+
+	if err := queue.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if status := repo.GetJob(job.ID).Status; status != jobs.StatusDone {
+		t.Errorf("Expected in-flight job to finish, got %s", status)
+	}
+
+	if _, err := queue.Enqueue("test.slow", nil); !errors.Is(err, jobs.ErrQueueStopped) {
+		t.Errorf("Expected ErrQueueStopped after shutdown, got %v", err)
+	}
+}
+
+func TestQueue_RejectsUnknownKind(t *testing.T) {
+	queue := newTestQueue(NewMockJobRepository())
+	if _, err := queue.Enqueue("test.missing", nil); !errors.Is(err, jobs.ErrUnknownKind) {
+		t.Errorf("Expected ErrUnknownKind, got %v", err)
+	}
+}
+
+type stubScanner struct {
+	err error
+}
+
+func (s *stubScanner) Scan(ctx context.Context, r io.Reader) (*upload.ScanResult, error) {
+	io.Copy(io.Discard, r)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &upload.ScanResult{Clean: true}, nil
+}
+
+func TestUpload_ProcessedByJobQueue(t *testing.T) {
+	useUploadStorage(t, t.TempDir())
+
+	handler, mockRepo := setupUploadTestHandler()
+	handler.SetScanner(&stubScanner{})
+	queue := newTestQueue(NewMockJobRepository())
+	handler.SetJobQueue(queue)
+	queue.Start()
+	defer queue.Shutdown(context.Background())
+
+	body, contentType := createMultipartForm("data", "test.png", createTestImageContent())
+	e := echo.New()
+	c, rec := createUploadTestContext(e, http.MethodPost, "/api/upload", body, contentType)
+	c.Set("user", &auth.TokenClaims{UserID: 1, Username: "testuser"})
+
+	if err := handler.Upload(c); err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+	resp, _ := parseUploadResponse(rec.Body.Bytes())
+	data := getUploadDataMap(resp)
+	if data["processing_state"] != upload.ProcessingQueued || data["status"] != upload.StatusPending {
+		t.Errorf("Expected queued/pending, got %v/%v", data["processing_state"], data["status"])
+	}
+
+	id := int64(data["file_id"].(float64))
+	waitFor(t, func() bool {
+		stored, _ := mockRepo.GetFileUploadByID(id)
+		return stored.ProcessingState == upload.ProcessingCompleted
+	})
+
+	stored, _ := mockRepo.GetFileUploadByID(id)
+	if stored.Status != upload.StatusClean {
+		t.Errorf("Expected status %s, got %s", upload.StatusClean, stored.Status)
+	}
+}
+
+func TestUpload_JobFailureMarksProcessingFailed(t *testing.T) {
+	useUploadStorage(t, t.TempDir())
+
+	handler, mockRepo := setupUploadTestHandler()
+	handler.SetScanner(&stubScanner{err: errors.New("scanner offline")})
+	jobRepo := NewMockJobRepository()
+	queue := newTestQueue(jobRepo)
+	handler.SetJobQueue(queue)
+	queue.Start()
+	defer queue.Shutdown(context.Background())
+
+	body, contentType := createMultipartForm("data", "test.png", createTestImageContent())
+	e := echo.New()
+	c, _ := createUploadTestContext(e, http.MethodPost, "/api/upload", body, contentType)
+	c.Set("user", &auth.TokenClaims{UserID: 1, Username: "testuser"})
+	if err := handler.Upload(c); err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+
+	waitFor(t, func() bool { return jobRepo.GetJob(1).Status == jobs.StatusDead })
+
+	stored, _ := mockRepo.GetFileUploadByID(1)
+	if stored.ProcessingState != upload.ProcessingFailed || stored.Status != upload.StatusPending {
+		t.Errorf("Expected failed/pending, got %s/%s", stored.ProcessingState, stored.Status)
+	}
+}
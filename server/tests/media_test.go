@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"elotus_test/server/models/upload"
+
+	"github.com/labstack/echo/v4"
+)
+
+const mediaContent = "0123456789abcdefghij"
+
+func setupMediaTest(t *testing.T, visibility string) *upload.Handler {
+	t.Helper()
+	dir := t.TempDir()
+	useUploadStorage(t, dir)
+
+	folder := filepath.Join(dir, "images")
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(folder, "abc123.jpg")
+	if err := os.WriteFile(path, []byte(mediaContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	handler, repo := setupUploadTestHandler()
+	repo.AddUpload(&upload.FileUpload{
+		ID: 1, UserID: 1, Filename: "abc123.jpg", OriginalFilename: "Café photo.jpg",
+		ContentType: "image/jpg", Checksum: "deadbeef", Status: upload.StatusClean, TempPath: path,
+		Visibility: visibility, CreatedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	})
+	return handler
+}
+
+func getMedia(t *testing.T, handler *upload.Handler, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	e := echo.New()
+	c, rec := createUploadTestContext(e, http.MethodGet, "/media/images/abc123.jpg", nil, "")
+	for name, value := range headers {
+		c.Request().Header.Set(name, value)
+	}
+	c.SetParamNames("*")
+	c.SetParamValues("images/abc123.jpg")
+	if err := handler.ServeMedia(c); err != nil {
+		t.Fatalf("ServeMedia returned error: %v", err)
+	}
+	return rec
+}
+
+func TestServeMedia_Headers(t *testing.T) {
+	handler := setupMediaTest(t, upload.VisibilityPrivate)
+
+	rec := getMedia(t, handler, nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != mediaContent {
+		t.Fatalf("Expected full content, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	expected := map[string]string{
+		"Content-Type":        "image/jpeg",
+		"ETag":                `"deadbeef"`,
+		"Last-Modified":       "Fri, 02 Jan 2026 03:04:05 GMT",
+		"Cache-Control":       "private, no-cache",
+		"Accept-Ranges":       "bytes",
+		"Content-Disposition": `inline; filename*=utf-8''Caf%C3%A9%20photo.jpg`,
+	}
+	for name, value := range expected {
+		if got := rec.Header().Get(name); got != value {
+			t.Errorf("%s: expected %q, got %q", name, value, got)
+		}
+	}
+}
+
+func TestServeMedia_PublicUploadsAreCachedForGood(t *testing.T) {
+	handler := setupMediaTest(t, upload.VisibilityPublic)
+
+	rec := getMedia(t, handler, nil)
+	if got := rec.Header().Get("Cache-Control"); got != "public, max-age=31536000, immutable" {
+		t.Errorf("Expected a public upload to be cached for good, got %q", got)
+	}
+}
+
+func TestServeMedia_ConditionalRequests(t *testing.T) {
+	handler := setupMediaTest(t, upload.VisibilityPrivate)
+
+	rec := getMedia(t, handler, map[string]string{"If-None-Match": `"deadbeef"`})
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("Expected 304 with empty body, got %d (%d bytes)", rec.Code, rec.Body.Len())
+	}
+
+	rec = getMedia(t, handler, map[string]string{"If-Modified-Since": "Sat, 03 Jan 2026 00:00:00 GMT"})
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for If-Modified-Since, got %d", rec.Code)
+	}
+
+	rec = getMedia(t, handler, map[string]string{"If-None-Match": `"other"`})
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 for a different ETag, got %d", rec.Code)
+	}
+}
+
+func TestServeMedia_Ranges(t *testing.T) {
+	handler := setupMediaTest(t, upload.VisibilityPrivate)
+
+	rec := getMedia(t, handler, map[string]string{"Range": "bytes=5-9"})
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "56789" {
+		t.Fatalf("Expected 206 with bytes 5-9, got %d %q", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Range"); got != "bytes 5-9/20" {
+		t.Errorf("Unexpected Content-Range %q", got)
+	}
+
+	// A stale If-Range falls back to the whole file
+	rec = getMedia(t, handler, map[string]string{"Range": "bytes=0-3", "If-Range": `"stale"`})
+	if rec.Code != http.StatusOK || rec.Body.String() != mediaContent {
+		t.Errorf("Expected full content for stale If-Range, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = getMedia(t, handler, map[string]string{"Range": "bytes=50-60"})
+	if rec.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("Expected 416, got %d", rec.Code)
+	}
+}
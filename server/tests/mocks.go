@@ -1,17 +1,29 @@
 package tests
 
 import (
+	"errors"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"elotus_test/server/models/account"
+	"elotus_test/server/models/album"
+	"elotus_test/server/models/archive"
+	"elotus_test/server/models/audit"
+	"elotus_test/server/models/jobs"
+	"elotus_test/server/models/share"
+	"elotus_test/server/models/takeout"
 	"elotus_test/server/models/upload"
 	"elotus_test/server/models/user"
+	"elotus_test/server/models/webhook"
 )
 
 type MockUserRepository struct {
 	mu              sync.RWMutex
 	users           map[int64]*user.User
 	byName          map[string]*user.User
+	logins          []*user.LoginEvent
 	nextID          int64
 	CreateUserError error
 }
@@ -77,12 +89,53 @@ func (r *MockUserRepository) UpdateLastLogin(userID int64) error {
 	return nil
 }
 
+func (r *MockUserRepository) DeleteUser(id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if u, exists := r.users[id]; exists {
+		delete(r.byName, u.Username)
+		delete(r.users, id)
+	}
+	return nil
+}
+
+func (r *MockUserRepository) RecordLogin(userID int64, clientIP, userAgent string, success bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.logins = append(r.logins, &user.LoginEvent{
+		ID:        int64(len(r.logins) + 1),
+		UserID:    userID,
+		ClientIP:  clientIP,
+		UserAgent: userAgent,
+		Success:   success,
+		CreatedAt: time.Now(),
+	})
+	return nil
+}
+
+func (r *MockUserRepository) ListLogins(userID int64) ([]*user.LoginEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	events := []*user.LoginEvent{}
+	for _, e := range r.logins {
+		if e.UserID == userID {
+			copied := *e
+			events = append(events, &copied)
+		}
+	}
+	return events, nil
+}
+
 func (r *MockUserRepository) Reset() {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	r.users = make(map[int64]*user.User)
 	r.byName = make(map[string]*user.User)
+	r.logins = nil
 	r.nextID = 1
 	r.CreateUserError = nil
 }
@@ -99,11 +152,13 @@ func (r *MockUserRepository) AddUser(u *user.User) {
 }
 
 type MockUploadRepository struct {
-	mu          sync.RWMutex
-	uploads     map[int64]*upload.FileUpload
-	nextID      int64
-	CreateError error
-	GetError    error
+	mu               sync.RWMutex
+	uploads          map[int64]*upload.FileUpload
+	nextID           int64
+	CreateError      error
+	CreateBatchError error
+	GetError         error
+	BatchCalls       int
 }
 
 func NewMockUploadRepository() *MockUploadRepository {
@@ -123,6 +178,7 @@ func (r *MockUploadRepository) CreateFileUpload(u *upload.FileUpload) (*upload.F
 
 	u.ID = r.nextID
 	u.CreatedAt = time.Now()
+	u.UpdatedAt = u.CreatedAt
 	r.nextID++
 
 	stored := *u
@@ -131,6 +187,29 @@ func (r *MockUploadRepository) CreateFileUpload(u *upload.FileUpload) (*upload.F
 	return u, nil
 }
 
+func (r *MockUploadRepository) CreateFileUploads(uploads []*upload.FileUpload) ([]*upload.FileUpload, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.BatchCalls++
+	if r.CreateBatchError != nil {
+		return nil, r.CreateBatchError
+	}
+
+	now := time.Now()
+	for _, u := range uploads {
+		u.ID = r.nextID
+		u.CreatedAt = now
+		u.UpdatedAt = now
+		r.nextID++
+
+		stored := *u
+		r.uploads[u.ID] = &stored
+	}
+
+	return uploads, nil
+}
+
 func (r *MockUploadRepository) GetFileUploadByID(id int64) (*upload.FileUpload, bool) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -144,6 +223,239 @@ func (r *MockUploadRepository) GetFileUploadByID(id int64) (*upload.FileUpload,
 	return &result, true
 }
 
+func (r *MockUploadRepository) GetFileUploadByFilename(filename string) (*upload.FileUpload, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, u := range r.uploads {
+		if u.Filename == filename {
+			result := *u
+			return &result, true
+		}
+	}
+	return nil, false
+}
+
+func (r *MockUploadRepository) UpdateFileUploadStatus(id int64, status, tempPath string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, exists := r.uploads[id]
+	if !exists {
+		return errors.New("upload not found")
+	}
+	u.Status = status
+	u.TempPath = tempPath
+	return nil
+}
+
+func (r *MockUploadRepository) UpdateFileUploadProcessingState(id int64, state string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, exists := r.uploads[id]
+	if !exists {
+		return errors.New("upload not found")
+	}
+	u.ProcessingState = state
+	return nil
+}
+
+func (r *MockUploadRepository) UpdateFileUploadPerceptualHash(id int64, hash uint64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, exists := r.uploads[id]
+	if !exists {
+		return errors.New("upload not found")
+	}
+	u.PerceptualHash = &hash
+	return nil
+}
+
+func (r *MockUploadRepository) GetFileUploadsByIDs(ids []int64) ([]*upload.FileUpload, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var result []*upload.FileUpload
+	for _, id := range ids {
+		if u, exists := r.uploads[id]; exists {
+			copied := *u
+			result = append(result, &copied)
+		}
+	}
+	return result, nil
+}
+
+func (r *MockUploadRepository) ListFileUploadsAfter(afterID int64, limit int) ([]*upload.FileUpload, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var result []*upload.FileUpload
+	for _, u := range r.uploads {
+		if u.ID > afterID {
+			copied := *u
+			result = append(result, &copied)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func (r *MockUploadRepository) UpdateFileUploadKey(id int64, encryptedKey, keyID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.uploads[id]
+	if !ok {
+		return errors.New("upload not found")
+	}
+	u.EncryptedKey = encryptedKey
+	u.EncryptionKeyID = keyID
+	return nil
+}
+
+func (r *MockUploadRepository) FindSimilarFileUploads(userID, excludeID int64, hash uint64, maxDistance, limit int) ([]*upload.SimilarUpload, error) {
+	if r.GetError != nil {
+		return nil, r.GetError
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var matches []*upload.SimilarUpload
+	for _, u := range r.uploads {
+		if u.UserID != userID || u.ID == excludeID || u.PerceptualHash == nil ||
+			u.Status == upload.StatusInfected || u.Status == upload.StatusQuarantined {
+			continue
+		}
+		if distance := upload.HammingDistance(hash, *u.PerceptualHash); distance <= maxDistance {
+			copied := *u
+			matches = append(matches, &upload.SimilarUpload{Upload: &copied, Distance: distance})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Distance != matches[j].Distance {
+			return matches[i].Distance < matches[j].Distance
+		}
+		return matches[i].Upload.ID > matches[j].Upload.ID
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+func (r *MockUploadRepository) DeleteFileUpload(id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.uploads, id)
+	return nil
+}
+
+func (r *MockUploadRepository) UpdateFileUploadMetadata(id int64, expectedVersion int, update upload.MetadataUpdate) (*upload.FileUpload, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.uploads[id]
+	if !ok || (expectedVersion != 0 && u.Version != expectedVersion) {
+		return nil, upload.ErrVersionConflict
+	}
+
+	if update.DisplayName != nil {
+		u.DisplayName = *update.DisplayName
+	}
+	if update.Caption != nil {
+		u.Caption = *update.Caption
+	}
+	if update.AltText != nil {
+		u.AltText = *update.AltText
+	}
+	if update.Visibility != nil {
+		u.Visibility = *update.Visibility
+	}
+	if update.Tags != nil {
+		u.Tags = append([]string{}, *update.Tags...)
+	}
+	u.Version++
+	u.UpdatedAt = time.Now()
+
+	copied := *u
+	return &copied, nil
+}
+
+// SearchFileUploads approximates the Postgres search: every word in the text
+// must appear in the filename, caption or tags; results are newest first
+func (r *MockUploadRepository) SearchFileUploads(userID int64, query upload.SearchQuery) (*upload.SearchResult, error) {
+	if r.GetError != nil {
+		return nil, r.GetError
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	words := strings.Fields(strings.ToLower(query.Text))
+	var matches []*upload.FileUpload
+	for _, u := range r.uploads {
+		if u.UserID != userID {
+			continue
+		}
+
+		haystack := strings.ToLower(u.Name() + " " + u.Caption + " " + u.AltText + " " + strings.Join(u.Tags, " "))
+		matched := true
+		for _, word := range words {
+			if !strings.Contains(haystack, word) {
+				matched = false
+			}
+		}
+		for _, tag := range query.Tags {
+			found := false
+			for _, t := range u.Tags {
+				found = found || t == tag
+			}
+			matched = matched && found
+		}
+
+		if matched {
+			copied := *u
+			matches = append(matches, &copied)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].CreatedAt.After(matches[j].CreatedAt)
+	})
+
+	counts := make(map[string]int)
+	for _, u := range matches {
+		for _, tag := range u.Tags {
+			counts[tag]++
+		}
+	}
+	result := &upload.SearchResult{Total: len(matches)}
+	for tag, count := range counts {
+		result.TagFacets = append(result.TagFacets, upload.TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(result.TagFacets, func(i, j int) bool {
+		a, b := result.TagFacets[i], result.TagFacets[j]
+		return a.Count > b.Count || (a.Count == b.Count && a.Tag < b.Tag)
+	})
+
+	if query.Offset < len(matches) {
+		end := query.Offset + query.Limit
+		if end > len(matches) {
+			end = len(matches)
+		}
+		result.Uploads = matches[query.Offset:end]
+	}
+
+	return result, nil
+}
+
 func (r *MockUploadRepository) GetFileUploadsByUserID(userID int64) ([]*upload.FileUpload, error) {
 	if r.GetError != nil {
 		return nil, r.GetError
@@ -170,7 +482,9 @@ func (r *MockUploadRepository) Reset() {
 	r.uploads = make(map[int64]*upload.FileUpload)
 	r.nextID = 1
 	r.CreateError = nil
+	r.CreateBatchError = nil
 	r.GetError = nil
+	r.BatchCalls = 0
 }
 
 func (r *MockUploadRepository) AddUpload(u *upload.FileUpload) {
@@ -184,6 +498,12 @@ func (r *MockUploadRepository) AddUpload(u *upload.FileUpload) {
 	if u.CreatedAt.IsZero() {
 		u.CreatedAt = time.Now()
 	}
+	if u.Version == 0 {
+		u.Version = 1
+	}
+	if u.Visibility == "" {
+		u.Visibility = upload.VisibilityPrivate
+	}
 
 	stored := *u
 	r.uploads[u.ID] = &stored
@@ -192,3 +512,991 @@ func (r *MockUploadRepository) AddUpload(u *upload.FileUpload) {
 		r.nextID = u.ID + 1
 	}
 }
+
+type MockJobRepository struct {
+	mu     sync.Mutex
+	jobs   map[int64]*jobs.Job
+	nextID int64
+}
+
+func NewMockJobRepository() *MockJobRepository {
+	return &MockJobRepository{
+		jobs:   make(map[int64]*jobs.Job),
+		nextID: 1,
+	}
+}
+
+func (r *MockJobRepository) Enqueue(kind string, payload []byte, maxAttempts int, runAt time.Time) (*jobs.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job := &jobs.Job{
+		ID:          r.nextID,
+		Kind:        kind,
+		Payload:     payload,
+		Status:      jobs.StatusQueued,
+		MaxAttempts: maxAttempts,
+		RunAt:       runAt,
+		CreatedAt:   time.Now(),
+	}
+	r.nextID++
+	r.jobs[job.ID] = job
+
+	copied := *job
+	return &copied, nil
+}
+
+func (r *MockJobRepository) Claim(staleAfter time.Duration) (*jobs.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var next *jobs.Job
+	now := time.Now()
+	for _, job := range r.jobs {
+		if job.Status != jobs.StatusQueued || job.RunAt.After(now) {
+			continue
+		}
+		if next == nil || job.RunAt.Before(next.RunAt) || (job.RunAt.Equal(next.RunAt) && job.ID < next.ID) {
+			next = job
+		}
+	}
+	if next == nil {
+		return nil, nil
+	}
+
+	next.Status = jobs.StatusRunning
+	next.Attempts++
+	copied := *next
+	return &copied, nil
+}
+
+func (r *MockJobRepository) Complete(id int64) error {
+	return r.update(id, func(job *jobs.Job) {
+		job.Status = jobs.StatusDone
+	})
+}
+
+func (r *MockJobRepository) Retry(id int64, runAt time.Time, lastError string) error {
+	return r.update(id, func(job *jobs.Job) {
+		job.Status = jobs.StatusQueued
+		job.RunAt = runAt
+		job.LastError = lastError
+	})
+}
+
+func (r *MockJobRepository) Bury(id int64, lastError string) error {
+	return r.update(id, func(job *jobs.Job) {
+		job.Status = jobs.StatusDead
+		job.LastError = lastError
+	})
+}
+
+func (r *MockJobRepository) update(id int64, fn func(job *jobs.Job)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, exists := r.jobs[id]
+	if !exists {
+		return errors.New("job not found")
+	}
+	fn(job)
+	return nil
+}
+
+func (r *MockJobRepository) GetJob(id int64) *jobs.Job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, exists := r.jobs[id]
+	if !exists {
+		return nil
+	}
+	copied := *job
+	return &copied
+}
+
+type MockWebhookRepository struct {
+	mu            sync.Mutex
+	subscriptions map[int64]*webhook.Subscription
+	deliveries    map[int64]*webhook.Delivery
+	nextID        int64
+}
+
+func NewMockWebhookRepository() *MockWebhookRepository {
+	return &MockWebhookRepository{
+		subscriptions: make(map[int64]*webhook.Subscription),
+		deliveries:    make(map[int64]*webhook.Delivery),
+		nextID:        1,
+	}
+}
+
+func (r *MockWebhookRepository) CreateSubscription(sub *webhook.Subscription) (*webhook.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sub.ID = r.nextID
+	sub.CreatedAt = time.Now()
+	r.nextID++
+
+	stored := *sub
+	r.subscriptions[sub.ID] = &stored
+	return sub, nil
+}
+
+func (r *MockWebhookRepository) GetSubscription(id int64) (*webhook.Subscription, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sub, exists := r.subscriptions[id]
+	if !exists {
+		return nil, false
+	}
+	copied := *sub
+	return &copied, true
+}
+
+func (r *MockWebhookRepository) ListSubscriptions(userID int64) ([]*webhook.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var result []*webhook.Subscription
+	for _, sub := range r.subscriptions {
+		if sub.UserID != nil && *sub.UserID == userID {
+			copied := *sub
+			result = append(result, &copied)
+		}
+	}
+	return result, nil
+}
+
+func (r *MockWebhookRepository) DeleteSubscription(id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.subscriptions, id)
+	return nil
+}
+
+func (r *MockWebhookRepository) MatchSubscriptions(userID int64, eventType string) ([]*webhook.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var result []*webhook.Subscription
+	for _, sub := range r.subscriptions {
+		if !sub.Active || !sub.Wants(eventType) {
+			continue
+		}
+		if sub.UserID == nil || *sub.UserID == userID {
+			copied := *sub
+			result = append(result, &copied)
+		}
+	}
+	return result, nil
+}
+
+func (r *MockWebhookRepository) SyncGlobalSubscription(sub *webhook.Subscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.subscriptions {
+		if existing.UserID == nil && existing.URL == sub.URL {
+			existing.Secret = sub.Secret
+			existing.Events = sub.Events
+			existing.Active = true
+			return nil
+		}
+	}
+
+	stored := *sub
+	stored.ID = r.nextID
+	stored.Active = true
+	r.nextID++
+	r.subscriptions[stored.ID] = &stored
+	return nil
+}
+
+func (r *MockWebhookRepository) CreateDelivery(d *webhook.Delivery) (*webhook.Delivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d.ID = r.nextID
+	d.CreatedAt = time.Now()
+	r.nextID++
+
+	stored := *d
+	r.deliveries[d.ID] = &stored
+	return d, nil
+}
+
+func (r *MockWebhookRepository) GetDelivery(id int64) (*webhook.Delivery, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, exists := r.deliveries[id]
+	if !exists {
+		return nil, false
+	}
+	copied := *d
+	return &copied, true
+}
+
+func (r *MockWebhookRepository) ListDeliveries(subscriptionID int64, limit int) ([]*webhook.Delivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var result []*webhook.Delivery
+	for _, d := range r.deliveries {
+		if d.SubscriptionID == subscriptionID && len(result) < limit {
+			copied := *d
+			result = append(result, &copied)
+		}
+	}
+	return result, nil
+}
+
+func (r *MockWebhookRepository) RecordAttempt(id int64, status string, responseStatus int, lastError string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, exists := r.deliveries[id]
+	if !exists {
+		return errors.New("delivery not found")
+	}
+	d.Status = status
+	d.Attempts++
+	d.ResponseStatus = responseStatus
+	d.LastError = lastError
+	if status == webhook.DeliverySucceeded {
+		now := time.Now()
+		d.DeliveredAt = &now
+	}
+	return nil
+}
+
+func (r *MockWebhookRepository) ResetDelivery(id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, exists := r.deliveries[id]
+	if !exists {
+		return errors.New("delivery not found")
+	}
+	d.Status = webhook.DeliveryPending
+	return nil
+}
+
+// Deliveries returns every recorded delivery, for assertions
+func (r *MockWebhookRepository) Deliveries() []*webhook.Delivery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var result []*webhook.Delivery
+	for _, d := range r.deliveries {
+		copied := *d
+		result = append(result, &copied)
+	}
+	return result
+}
+
+type MockShareRepository struct {
+	mu     sync.Mutex
+	shares map[int64]*share.Share
+	nextID int64
+}
+
+func NewMockShareRepository() *MockShareRepository {
+	return &MockShareRepository{
+		shares: make(map[int64]*share.Share),
+		nextID: 1,
+	}
+}
+
+func (r *MockShareRepository) CreateShare(s *share.Share) (*share.Share, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s.ID = r.nextID
+	s.CreatedAt = time.Now()
+	r.nextID++
+
+	stored := *s
+	r.shares[s.ID] = &stored
+	return s, nil
+}
+
+func (r *MockShareRepository) GetShareByID(id int64) (*share.Share, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, exists := r.shares[id]
+	if !exists {
+		return nil, false
+	}
+	copied := *s
+	return &copied, true
+}
+
+func (r *MockShareRepository) GetShareByTokenHash(tokenHash string) (*share.Share, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range r.shares {
+		if s.TokenHash == tokenHash {
+			copied := *s
+			return &copied, true
+		}
+	}
+	return nil, false
+}
+
+func (r *MockShareRepository) ListSharesByUpload(uploadID int64) ([]*share.Share, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var result []*share.Share
+	for _, s := range r.shares {
+		if s.UploadID == uploadID {
+			copied := *s
+			result = append(result, &copied)
+		}
+	}
+	return result, nil
+}
+
+func (r *MockShareRepository) RevokeShare(id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s, exists := r.shares[id]; exists && s.RevokedAt == nil {
+		now := time.Now()
+		s.RevokedAt = &now
+	}
+	return nil
+}
+
+func (r *MockShareRepository) RecordView(id int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, exists := r.shares[id]
+	if !exists || s.Check(time.Now()) != nil {
+		return false, nil
+	}
+	now := time.Now()
+	s.ViewCount++
+	s.LastViewedAt = &now
+	return true, nil
+}
+
+type MockAlbumRepository struct {
+	mu     sync.Mutex
+	albums map[int64]*album.Album
+	items  map[int64][]*album.Item
+	nextID int64
+}
+
+func NewMockAlbumRepository() *MockAlbumRepository {
+	return &MockAlbumRepository{
+		albums: make(map[int64]*album.Album),
+		items:  make(map[int64][]*album.Item),
+		nextID: 1,
+	}
+}
+
+func (r *MockAlbumRepository) CreateAlbum(a *album.Album) (*album.Album, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a.ID = r.nextID
+	a.CreatedAt = time.Now()
+	a.UpdatedAt = a.CreatedAt
+	r.nextID++
+
+	stored := *a
+	r.albums[a.ID] = &stored
+	return a, nil
+}
+
+func (r *MockAlbumRepository) GetAlbum(id int64) (*album.Album, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a, exists := r.albums[id]
+	if !exists {
+		return nil, false
+	}
+	copied := *a
+	copied.ItemCount = len(r.items[id])
+	return &copied, true
+}
+
+func (r *MockAlbumRepository) ListAlbumsByUser(userID int64, limit, offset int) ([]*album.Album, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var all []*album.Album
+	for _, a := range r.albums {
+		if a.UserID == userID {
+			copied := *a
+			copied.ItemCount = len(r.items[a.ID])
+			all = append(all, &copied)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].ID > all[j].ID })
+
+	if offset >= len(all) {
+		return nil, len(all), nil
+	}
+	end := offset + limit
+	if end > len(all) {
+		end = len(all)
+	}
+	return all[offset:end], len(all), nil
+}
+
+func (r *MockAlbumRepository) UpdateAlbum(a *album.Album) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a.UpdatedAt = time.Now()
+	stored := *a
+	r.albums[a.ID] = &stored
+	return nil
+}
+
+func (r *MockAlbumRepository) DeleteAlbum(id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.albums, id)
+	delete(r.items, id)
+	return nil
+}
+
+func (r *MockAlbumRepository) AddItems(albumID int64, uploadIDs []int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing := make(map[int64]bool)
+	next := 0
+	for _, item := range r.items[albumID] {
+		existing[item.UploadID] = true
+		if item.Position >= next {
+			next = item.Position + 1
+		}
+	}
+	for _, id := range uploadIDs {
+		if existing[id] {
+			continue
+		}
+		existing[id] = true
+		r.items[albumID] = append(r.items[albumID], &album.Item{UploadID: id, Position: next, AddedAt: time.Now()})
+		next++
+	}
+	return nil
+}
+
+func (r *MockAlbumRepository) RemoveItem(albumID, uploadID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	items := r.items[albumID][:0]
+	for _, item := range r.items[albumID] {
+		if item.UploadID != uploadID {
+			items = append(items, item)
+		}
+	}
+	r.items[albumID] = items
+	return nil
+}
+
+func (r *MockAlbumRepository) sortedItems(albumID int64) []*album.Item {
+	items := append([]*album.Item(nil), r.items[albumID]...)
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Position < items[j].Position })
+	return items
+}
+
+func (r *MockAlbumRepository) ListItems(albumID int64, limit, offset int) ([]*album.Item, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	items := r.sortedItems(albumID)
+	if offset >= len(items) {
+		return nil, len(items), nil
+	}
+	end := offset + limit
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[offset:end], len(items), nil
+}
+
+func (r *MockAlbumRepository) ItemIDs(albumID int64) ([]int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ids []int64
+	for _, item := range r.sortedItems(albumID) {
+		ids = append(ids, item.UploadID)
+	}
+	return ids, nil
+}
+
+func (r *MockAlbumRepository) ReorderItems(albumID int64, uploadIDs []int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	positions := make(map[int64]int, len(uploadIDs))
+	for i, id := range uploadIDs {
+		positions[id] = i
+	}
+	for _, item := range r.items[albumID] {
+		item.Position = positions[item.UploadID]
+	}
+	return nil
+}
+
+type MockArchiveRepository struct {
+	mu       sync.Mutex
+	archives map[int64]*archive.Archive
+	nextID   int64
+}
+
+func NewMockArchiveRepository() *MockArchiveRepository {
+	return &MockArchiveRepository{
+		archives: make(map[int64]*archive.Archive),
+		nextID:   1,
+	}
+}
+
+func (r *MockArchiveRepository) CreateArchive(a *archive.Archive) (*archive.Archive, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a.ID = r.nextID
+	a.CreatedAt = time.Now()
+	r.nextID++
+
+	stored := *a
+	r.archives[a.ID] = &stored
+	return a, nil
+}
+
+func (r *MockArchiveRepository) GetArchive(id int64) (*archive.Archive, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a, exists := r.archives[id]
+	if !exists {
+		return nil, false
+	}
+	copied := *a
+	return &copied, true
+}
+
+func (r *MockArchiveRepository) UpdateArchiveStatus(id int64, status string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if a, exists := r.archives[id]; exists {
+		a.Status = status
+	}
+	return nil
+}
+
+func (r *MockArchiveRepository) MarkArchiveReady(id int64, filePath string, fileSize int64, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if a, exists := r.archives[id]; exists {
+		now := time.Now()
+		a.Status = archive.StatusReady
+		a.FilePath = filePath
+		a.FileSize = fileSize
+		a.Error = ""
+		a.CompletedAt = &now
+		a.ExpiresAt = &expiresAt
+	}
+	return nil
+}
+
+func (r *MockArchiveRepository) MarkArchiveFailed(id int64, reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if a, exists := r.archives[id]; exists {
+		now := time.Now()
+		a.Status = archive.StatusFailed
+		a.Error = reason
+		a.CompletedAt = &now
+	}
+	return nil
+}
+
+type MockExportRepository struct {
+	mu      sync.Mutex
+	exports map[int64]*takeout.Export
+	nextID  int64
+}
+
+func NewMockExportRepository() *MockExportRepository {
+	return &MockExportRepository{
+		exports: make(map[int64]*takeout.Export),
+		nextID:  1,
+	}
+}
+
+func (r *MockExportRepository) CreateExport(e *takeout.Export) (*takeout.Export, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e.ID = r.nextID
+	e.CreatedAt = time.Now()
+	r.nextID++
+
+	stored := *e
+	r.exports[e.ID] = &stored
+	return e, nil
+}
+
+func (r *MockExportRepository) GetExport(id int64) (*takeout.Export, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, exists := r.exports[id]
+	if !exists {
+		return nil, false
+	}
+	copied := *e
+	return &copied, true
+}
+
+func (r *MockExportRepository) LatestExport(userID int64) (*takeout.Export, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var latest *takeout.Export
+	for _, e := range r.exports {
+		if e.UserID == userID && (latest == nil || e.ID > latest.ID) {
+			latest = e
+		}
+	}
+	if latest == nil {
+		return nil, false
+	}
+	copied := *latest
+	return &copied, true
+}
+
+func (r *MockExportRepository) UpdateExportStatus(id int64, status string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e, exists := r.exports[id]; exists {
+		e.Status = status
+	}
+	return nil
+}
+
+func (r *MockExportRepository) MarkExportReady(id int64, filePath string, fileSize int64, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e, exists := r.exports[id]; exists {
+		now := time.Now()
+		e.Status = takeout.StatusReady
+		e.FilePath = filePath
+		e.FileSize = fileSize
+		e.Error = ""
+		e.CompletedAt = &now
+		e.ExpiresAt = &expiresAt
+	}
+	return nil
+}
+
+func (r *MockExportRepository) MarkExportFailed(id int64, reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e, exists := r.exports[id]; exists {
+		now := time.Now()
+		e.Status = takeout.StatusFailed
+		e.Error = reason
+		e.CompletedAt = &now
+	}
+	return nil
+}
+
+func (r *MockExportRepository) MarkExportExpired(id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e, exists := r.exports[id]; exists {
+		e.Status = takeout.StatusExpired
+		e.FilePath = ""
+	}
+	return nil
+}
+
+type MockDeletionRepository struct {
+	mu          sync.Mutex
+	deletions   map[int64]*account.Deletion
+	exportFiles map[int64][]string
+	nextID      int64
+	// completeErr fails CompleteDeletion, as if the database went away mid-purge
+	completeErr error
+}
+
+func NewMockDeletionRepository() *MockDeletionRepository {
+	return &MockDeletionRepository{
+		deletions:   make(map[int64]*account.Deletion),
+		exportFiles: make(map[int64][]string),
+		nextID:      1,
+	}
+}
+
+func (r *MockDeletionRepository) CreateDeletion(d *account.Deletion) (*account.Deletion, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d.ID = r.nextID
+	d.CreatedAt = time.Now()
+	r.nextID++
+
+	stored := *d
+	r.deletions[d.ID] = &stored
+	return d, nil
+}
+
+func (r *MockDeletionRepository) GetDeletion(id int64) (*account.Deletion, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, exists := r.deletions[id]
+	if !exists {
+		return nil, false
+	}
+	copied := *d
+	return &copied, true
+}
+
+func (r *MockDeletionRepository) ScheduledDeletion(userID int64) (*account.Deletion, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, d := range r.deletions {
+		if d.UserID == userID && d.Status == account.StatusScheduled {
+			copied := *d
+			return &copied, true
+		}
+	}
+	return nil, false
+}
+
+func (r *MockDeletionRepository) DueDeletions(now, staleBefore time.Time) ([]*account.Deletion, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var due []*account.Deletion
+	for _, d := range r.deletions {
+		if (d.Status == account.StatusScheduled && !d.ScheduledFor.After(now)) || staleClaim(d, staleBefore) {
+			copied := *d
+			due = append(due, &copied)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].ID < due[j].ID })
+	return due, nil
+}
+
+func (r *MockDeletionRepository) CancelDeletion(id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, exists := r.deletions[id]
+	if !exists || d.Status != account.StatusScheduled {
+		return account.ErrNoDeletion
+	}
+	now := time.Now()
+	d.Status = account.StatusCancelled
+	d.CancelledAt = &now
+	return nil
+}
+
+func staleClaim(d *account.Deletion, staleBefore time.Time) bool {
+	return d.Status == account.StatusPurging && d.ClaimedAt != nil && d.ClaimedAt.Before(staleBefore)
+}
+
+func (r *MockDeletionRepository) ClaimDeletion(id int64, staleBefore time.Time) (*account.Deletion, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, exists := r.deletions[id]
+	if !exists || (d.Status != account.StatusScheduled && !staleClaim(d, staleBefore)) {
+		return nil, false, nil
+	}
+	now := time.Now()
+	d.Status = account.StatusPurging
+	d.ClaimedAt = &now
+	copied := *d
+	return &copied, true, nil
+}
+
+func (r *MockDeletionRepository) RecordPurge(id int64, uploadIDs []int64, files []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if d, exists := r.deletions[id]; exists && d.Status == account.StatusPurging {
+		d.UploadIDs = append([]int64{}, uploadIDs...)
+		d.PurgeFiles = append([]string{}, files...)
+	}
+	return nil
+}
+
+func (r *MockDeletionRepository) ReleaseDeletion(id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if d, exists := r.deletions[id]; exists && d.Status == account.StatusPurging {
+		d.Status = account.StatusScheduled
+		d.ClaimedAt, d.UploadIDs, d.PurgeFiles = nil, nil, nil
+	}
+	return nil
+}
+
+// Backdate makes a claimed deletion look like its purge died that long ago
+func (r *MockDeletionRepository) Backdate(id int64, age time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if d, exists := r.deletions[id]; exists && d.ClaimedAt != nil {
+		claimedAt := d.ClaimedAt.Add(-age)
+		d.ClaimedAt = &claimedAt
+	}
+}
+
+func (r *MockDeletionRepository) CompleteDeletion(id int64, filesRemoved int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.completeErr != nil {
+		return r.completeErr
+	}
+	if d, exists := r.deletions[id]; exists && d.Status == account.StatusPurging {
+		now := time.Now()
+		d.Status = account.StatusCompleted
+		d.FilesRemoved = filesRemoved
+		d.CompletedAt = &now
+	}
+	return nil
+}
+
+func (r *MockDeletionRepository) ListExportFiles(userID int64) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.exportFiles[userID]...), nil
+}
+
+func (r *MockDeletionRepository) AddExportFile(userID int64, path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.exportFiles[userID] = append(r.exportFiles[userID], path)
+}
+
+type MockAuditRepository struct {
+	mu     sync.Mutex
+	events []*audit.Event
+	nextID int64
+}
+
+func NewMockAuditRepository() *MockAuditRepository {
+	return &MockAuditRepository{nextID: 1}
+}
+
+func (r *MockAuditRepository) Append(e *audit.Event) (*audit.Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prevHash := audit.GenesisHash
+	if len(r.events) > 0 {
+		prevHash = r.events[len(r.events)-1].Hash
+	}
+	e.Seal(prevHash)
+	e.ID = r.nextID
+	r.nextID++
+
+	stored := *e
+	r.events = append(r.events, &stored)
+	return e, nil
+}
+
+func (r *MockAuditRepository) ListEvents(filter audit.Filter, limit, offset int) ([]*audit.Event, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var matched []*audit.Event
+	for i := len(r.events) - 1; i >= 0; i-- {
+		e := r.events[i]
+		if (filter.Action != "" && e.Action != filter.Action) ||
+			(filter.ActorID != 0 && e.ActorID != filter.ActorID) ||
+			(filter.TargetType != "" && e.TargetType != filter.TargetType) ||
+			(filter.TargetID != "" && e.TargetID != filter.TargetID) ||
+			(filter.ClientIP != "" && e.ClientIP != filter.ClientIP) ||
+			(filter.Since != nil && e.CreatedAt.Before(*filter.Since)) ||
+			(filter.Until != nil && !e.CreatedAt.Before(*filter.Until)) {
+			continue
+		}
+		copied := *e
+		matched = append(matched, &copied)
+	}
+
+	total := len(matched)
+	if offset >= total {
+		return nil, total, nil
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	return matched[offset:end], total, nil
+}
+
+func (r *MockAuditRepository) EventsAfter(afterID int64, limit int) ([]*audit.Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var events []*audit.Event
+	for _, e := range r.events {
+		if e.ID > afterID && len(events) < limit {
+			copied := *e
+			events = append(events, &copied)
+		}
+	}
+	return events, nil
+}
+
+// Tamper edits a stored event in place, as someone with database access could
+func (r *MockAuditRepository) Tamper(id int64, edit func(e *audit.Event)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, e := range r.events {
+		if e.ID == id {
+			edit(e)
+		}
+	}
+}
+
+// Remove drops a stored event
+func (r *MockAuditRepository) Remove(id int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, e := range r.events {
+		if e.ID == id {
+			r.events = append(r.events[:i], r.events[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/upload"
+
+	"github.com/labstack/echo/v4"
+)
+
+// startProgressServer serves the upload and progress routes; X-Test-User picks the caller
+func startProgressServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	useUploadStorage(t, t.TempDir())
+	handler, _ := setupUploadTestHandler()
+	bus, broker := newStreamBus()
+	handler.SetEventBus(bus)
+	handler.SetStreamBroker(broker)
+
+	e := echo.New()
+	api := e.Group("/api", func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var userID int64 = 1
+			fmt.Sscanf(c.Request().Header.Get("X-Test-User"), "%d", &userID)
+			c.Set("user", &auth.TokenClaims{UserID: userID, Username: "testuser"})
+			return next(c)
+		}
+	})
+	api.POST("/upload", handler.Upload)
+	api.POST("/uploads/batch", handler.UploadBatch)
+	api.GET("/uploads/progress/:uploadId", handler.UploadProgress)
+
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func postUpload(t *testing.T, server *httptest.Server, path, uploadID string, body io.Reader, contentType string, length int64) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, server.URL+path, body)
+	req.Header.Set(echo.HeaderContentType, contentType)
+	req.Header.Set("X-Upload-ID", uploadID)
+	req.ContentLength = length
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Upload request failed: %v", err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func getProgress(t *testing.T, server *httptest.Server, userID int64, uploadID string) (int, map[string]interface{}) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/uploads/progress/"+uploadID, nil)
+	req.Header.Set("X-Test-User", fmt.Sprint(userID))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Progress request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	parsed, err := parseUploadResponse(body)
+	if err != nil {
+		t.Fatalf("Invalid progress response: %s", body)
+	}
+	return resp.StatusCode, getUploadDataMap(parsed)
+}
+
+func TestUploadProgress_CompletedUpload(t *testing.T) {
+	server := startProgressServer(t)
+	body, contentType := createMultipartForm("data", "photo.png", encodePNG(patternImage(1, 64, 64)))
+	length := int64(body.Len())
+
+	if resp := postUpload(t, server, "/api/upload", "upload-0001", body, contentType, length); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected upload to succeed, got %d", resp.StatusCode)
+	}
+
+	status, progress := getProgress(t, server, 1, "upload-0001")
+	if status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if progress["state"] != upload.ProgressCompleted {
+		t.Errorf("Expected completed, got %v", progress["state"])
+	}
+	if progress["bytes_received"] != float64(length) || progress["bytes_expected"] != float64(length) {
+		t.Errorf("Expected %d of %d bytes, got %v of %v", length, length, progress["bytes_received"], progress["bytes_expected"])
+	}
+	if ids, _ := progress["file_upload_ids"].([]interface{}); len(ids) != 1 {
+		t.Errorf("Expected the created upload ID, got %v", progress["file_upload_ids"])
+	}
+
+	// Progress is private to the uploader
+	if status, _ := getProgress(t, server, 2, "upload-0001"); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for another user, got %d", status)
+	}
+	if status, _ := getProgress(t, server, 1, "bad"); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid ID, got %d", status)
+	}
+}
+
+func TestUploadProgress_ReportsBytesWhileReading(t *testing.T) {
+	server := startProgressServer(t)
+	body, contentType := createMultipartForm("data", "photo.png", encodePNG(patternImage(2, 256, 256)))
+	data := body.Bytes()
+	half := len(data) / 2
+
+	pr, pw := io.Pipe()
+	done := make(chan *http.Response)
+	go func() {
+		done <- postUpload(t, server, "/api/upload", "upload-slow", pr, contentType, int64(len(data)))
+	}()
+	if _, err := pw.Write(data[:half]); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	var progress map[string]interface{}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		_, progress = getProgress(t, server, 1, "upload-slow")
+		if received, _ := progress["bytes_received"].(float64); received >= float64(half) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if progress["state"] != upload.ProgressReceiving {
+		t.Errorf("Expected receiving mid-upload, got %v", progress["state"])
+	}
+	if received, _ := progress["bytes_received"].(float64); received < float64(half) || received >= float64(len(data)) {
+		t.Errorf("Expected partial progress of at least %d bytes, got %v", half, progress["bytes_received"])
+	}
+
+	pw.Write(data[half:])
+	pw.Close()
+	if resp := <-done; resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected upload to succeed, got %d", resp.StatusCode)
+	}
+	if _, progress = getProgress(t, server, 1, "upload-slow"); progress["state"] != upload.ProgressCompleted {
+		t.Errorf("Expected completed, got %v", progress["state"])
+	}
+}
+
+func TestUploadProgress_RecordsFailure(t *testing.T) {
+	server := startProgressServer(t)
+	body, contentType := createMultipartForm("data", "notes.png", []byte("not an image at all"))
+
+	if resp := postUpload(t, server, "/api/upload", "upload-fail", body, contentType, int64(body.Len())); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected upload to be rejected, got %d", resp.StatusCode)
+	}
+	_, progress := getProgress(t, server, 1, "upload-fail")
+	if progress["state"] != upload.ProgressFailed || progress["error"] == "" {
+		t.Errorf("Expected failed state with an error, got %v", progress)
+	}
+}
+
+func TestUploadProgress_Batch(t *testing.T) {
+	server := startProgressServer(t)
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for i := 0; i < 2; i++ {
+		part, _ := writer.CreateFormFile("data", fmt.Sprintf("photo%d.png", i))
+		part.Write(encodePNG(patternImage(10+i, 64, 64)))
+	}
+	writer.Close()
+
+	if resp := postUpload(t, server, "/api/uploads/batch", "batch-0001", body, writer.FormDataContentType(), int64(body.Len())); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected batch to succeed, got %d", resp.StatusCode)
+	}
+	_, progress := getProgress(t, server, 1, "batch-0001")
+	if ids, _ := progress["file_upload_ids"].([]interface{}); progress["state"] != upload.ProgressCompleted || len(ids) != 2 {
+		t.Errorf("Expected completed with 2 uploads, got %v", progress)
+	}
+}
+
+func TestUploadProgress_StreamsUntilComplete(t *testing.T) {
+	server := startProgressServer(t)
+
+	// The stream is opened before the upload starts
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/uploads/progress/upload-sse1", nil)
+	req.Header.Set(echo.HeaderAccept, "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get(echo.HeaderContentType) != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %q", resp.Header.Get(echo.HeaderContentType))
+	}
+
+	body, contentType := createMultipartForm("data", "photo.png", encodePNG(patternImage(3, 64, 64)))
+	if resp := postUpload(t, server, "/api/upload", "upload-sse1", body, contentType, int64(body.Len())); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected upload to succeed, got %d", resp.StatusCode)
+	}
+
+	timer := time.AfterFunc(3*time.Second, func() { resp.Body.Close() })
+	defer timer.Stop()
+
+	var states []string
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+		if data, ok := strings.CutPrefix(strings.TrimSuffix(line, "\n"), "data: "); ok {
+			var progress upload.Progress
+			if err := json.Unmarshal([]byte(data), &progress); err != nil {
+				t.Fatalf("Invalid progress event: %s", data)
+			}
+			states = append(states, progress.State)
+		}
+	}
+
+	if len(states) == 0 || states[len(states)-1] != upload.ProgressCompleted {
+		t.Errorf("Expected the stream to end with completed, got %v", states)
+	}
+}
@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"elotus_test/server/models/upload"
+)
+
+const checksumOfHello = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+// setupReconcileTest stores one healthy upload, one whose file was deleted,
+// one with the wrong size, one with the wrong checksum and one orphan file
+func setupReconcileTest(t *testing.T) (*upload.Handler, *MockUploadRepository, string) {
+	t.Helper()
+	dir := t.TempDir()
+	useUploadStorage(t, dir)
+	images := filepath.Join(dir, "images")
+	if err := os.MkdirAll(images, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	write := func(name, content string) string {
+		path := filepath.Join(images, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, old, old)
+		return path
+	}
+
+	handler, repo := setupUploadTestHandler()
+	add := func(id int64, path string, size int64, checksum string) {
+		repo.AddUpload(&upload.FileUpload{
+			ID: id, UserID: 1, Filename: filepath.Base(path), FileSize: size, Checksum: checksum,
+			Status: upload.StatusClean, TempPath: path, CreatedAt: old,
+		})
+	}
+	add(1, write("ok.png", "hello"), 5, checksumOfHello)
+	add(2, filepath.Join(images, "gone.png"), 5, checksumOfHello)
+	add(3, write("short.png", "hell"), 5, checksumOfHello)
+	add(4, write("changed.png", "jello"), 5, checksumOfHello)
+	write("orphan.png", "nobody")
+
+	// Archives live under storage too but are not upload blobs
+	os.MkdirAll(filepath.Join(dir, "archives"), 0755)
+	os.WriteFile(filepath.Join(dir, "archives", "archive-1.zip"), []byte("zip"), 0600)
+
+	return handler, repo, dir
+}
+
+func TestReconcileUploads_DryRun(t *testing.T) {
+	handler, repo, dir := setupReconcileTest(t)
+
+	report, err := handler.ReconcileUploads(context.Background(), upload.ReconcileOptions{DryRun: true, VerifyChecksums: true})
+	if err != nil {
+		t.Fatalf("ReconcileUploads failed: %v", err)
+	}
+
+	if report.RowsScanned != 4 || report.FilesScanned != 4 {
+		t.Errorf("Expected 4 rows and 4 files scanned, got %d and %d", report.RowsScanned, report.FilesScanned)
+	}
+	if len(report.OrphanFiles) != 1 || filepath.Base(report.OrphanFiles[0]) != "orphan.png" {
+		t.Errorf("Expected orphan.png as the only orphan, got %v", report.OrphanFiles)
+	}
+	if len(report.MissingFiles) != 1 || report.MissingFiles[0] != 2 {
+		t.Errorf("Expected upload 2 to be missing its file, got %v", report.MissingFiles)
+	}
+	if len(report.SizeMismatches) != 1 || report.SizeMismatches[0] != 3 {
+		t.Errorf("Expected a size mismatch for upload 3, got %v", report.SizeMismatches)
+	}
+	if len(report.ChecksumMismatches) != 1 || report.ChecksumMismatches[0] != 4 {
+		t.Errorf("Expected a checksum mismatch for upload 4, got %v", report.ChecksumMismatches)
+	}
+
+	if report.RemovedFiles != 0 || report.RemovedRows != 0 {
+		t.Errorf("Dry run must not change anything, got %+v", report)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "images", "orphan.png")); err != nil {
+		t.Errorf("Dry run removed the orphan file: %v", err)
+	}
+	if _, found := repo.GetFileUploadByID(2); !found {
+		t.Error("Dry run removed the dangling row")
+	}
+
+	var out bytes.Buffer
+	report.WriteSummary(&out)
+	if !strings.Contains(out.String(), "dry run") || !strings.Contains(out.String(), "missing file for upload 2") {
+		t.Errorf("Unexpected summary:\n%s", out.String())
+	}
+}
+
+func TestReconcileUploads_Fix(t *testing.T) {
+	handler, repo, dir := setupReconcileTest(t)
+
+	report, err := handler.ReconcileUploads(context.Background(), upload.ReconcileOptions{})
+	if err != nil {
+		t.Fatalf("ReconcileUploads failed: %v", err)
+	}
+	if report.RemovedFiles != 1 || report.RemovedRows != 1 {
+		t.Errorf("Expected 1 file and 1 row removed, got %+v", report)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "images", "orphan.png")); !os.IsNotExist(err) {
+		t.Error("Expected orphan file to be removed")
+	}
+	if _, found := repo.GetFileUploadByID(2); found {
+		t.Error("Expected dangling row to be removed")
+	}
+	// Mismatches are reported, never fixed
+	for _, id := range []int64{1, 3, 4} {
+		if _, found := repo.GetFileUploadByID(id); !found {
+			t.Errorf("Upload %d should have been kept", id)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "archives", "archive-1.zip")); err != nil {
+		t.Errorf("Files outside media folders must be left alone: %v", err)
+	}
+}
+
+func TestReconcileUploads_GracePeriod(t *testing.T) {
+	handler, repo, dir := setupReconcileTest(t)
+
+	fresh := filepath.Join(dir, "images", "in-flight.png")
+	os.WriteFile(fresh, []byte("uploading"), 0644)
+	repo.AddUpload(&upload.FileUpload{ID: 5, UserID: 1, TempPath: filepath.Join(dir, "images", "moving.png"), CreatedAt: time.Now()})
+
+	report, err := handler.ReconcileUploads(context.Background(), upload.ReconcileOptions{GracePeriod: time.Hour})
+	if err != nil {
+		t.Fatalf("ReconcileUploads failed: %v", err)
+	}
+
+	if _, err := os.Stat(fresh); err != nil {
+		t.Error("A file younger than the grace period must not be treated as an orphan")
+	}
+	if _, found := repo.GetFileUploadByID(5); !found {
+		t.Error("A row younger than the grace period must not be removed")
+	}
+	if report.RemovedFiles != 1 || report.RemovedRows != 1 {
+		t.Errorf("Expected only the old drift to be fixed, got %+v", report)
+	}
+}
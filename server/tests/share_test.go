@@ -0,0 +1,217 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/share"
+	"elotus_test/server/models/upload"
+	"elotus_test/server/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+var _ share.Repository = (*MockShareRepository)(nil)
+
+func setupShareTest(t *testing.T) (*share.Handler, *MockShareRepository, *MockUploadRepository) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "photo.png")
+	if err := os.WriteFile(filePath, createTestImageContent(), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	uploadRepo := NewMockUploadRepository()
+	file := &upload.FileUpload{
+		ID:               1,
+		UserID:           1,
+		Filename:         "photo.png",
+		OriginalFilename: "holiday.png",
+		ContentType:      "image/png",
+		Status:           upload.StatusClean,
+		TempPath:         filePath,
+	}
+	uploadRepo.AddUpload(file)
+
+	shareRepo := NewMockShareRepository()
+	return share.NewHandler(shareRepo, uploadRepo), shareRepo, uploadRepo
+}
+
+func createShare(t *testing.T, handler *share.Handler, userID int64, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/api/uploads/1/shares", bytes.NewBufferString(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	c.Set("user", &auth.TokenClaims{UserID: userID, Username: "testuser"})
+
+	if err := handler.CreateShare(c); err != nil {
+		t.Fatalf("CreateShare returned error: %v", err)
+	}
+	resp, _ := parseResponse(rec.Body.Bytes())
+	return rec, getDataMap(resp)
+}
+
+func openShare(t *testing.T, handler *share.Handler, token, password string) *httptest.ResponseRecorder {
+	t.Helper()
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/s/"+token, nil)
+	if password != "" {
+		req.Header.Set(share.HeaderPassword, password)
+	}
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("token")
+	c.SetParamValues(token)
+
+	if err := handler.Serve(c); err != nil {
+		t.Fatalf("Serve returned error: %v", err)
+	}
+	return rec
+}
+
+func expectShareError(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	if rec.Code != status {
+		t.Errorf("Expected status %d, got %d", status, rec.Code)
+	}
+	resp, _ := parseResponse(rec.Body.Bytes())
+	if resp == nil || resp.Error == nil || resp.Error.Code != code {
+		t.Errorf("Expected error code %s, got %s", code, rec.Body.String())
+	}
+}
+
+func TestShare_CreateAndServe(t *testing.T) {
+	handler, shareRepo, _ := setupShareTest(t)
+
+	rec, data := createShare(t, handler, 1, `{}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+	token, _ := data["token"].(string)
+	if len(token) < 40 || data["url"] != "/s/"+token {
+		t.Fatalf("Expected an unguessable token and URL, got %v", data)
+	}
+
+	// Only the hash is stored
+	stored, _ := shareRepo.GetShareByID(1)
+	if stored.TokenHash == token || stored.TokenHash != share.HashToken(token) {
+		t.Error("Expected the token to be stored hashed")
+	}
+
+	served := openShare(t, handler, token, "")
+	if served.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, served.Code)
+	}
+	if !bytes.Equal(served.Body.Bytes(), createTestImageContent()) {
+		t.Error("Served content does not match the upload")
+	}
+	if served.Header().Get("Cache-Control") != "private, no-store" {
+		t.Errorf("Unexpected Cache-Control: %s", served.Header().Get("Cache-Control"))
+	}
+
+	stored, _ = shareRepo.GetShareByID(1)
+	if stored.ViewCount != 1 {
+		t.Errorf("Expected view count 1, got %d", stored.ViewCount)
+	}
+}
+
+func TestShare_MaxViews(t *testing.T) {
+	handler, _, _ := setupShareTest(t)
+
+	_, data := createShare(t, handler, 1, `{"max_views": 2}`)
+	token := data["token"].(string)
+
+	for i := 0; i < 2; i++ {
+		if rec := openShare(t, handler, token, ""); rec.Code != http.StatusOK {
+			t.Fatalf("View %d: expected status %d, got %d", i+1, http.StatusOK, rec.Code)
+		}
+	}
+	expectShareError(t, openShare(t, handler, token, ""), http.StatusGone, response.ErrCodeShareExhausted)
+}
+
+func TestShare_Password(t *testing.T) {
+	handler, _, _ := setupShareTest(t)
+
+	_, data := createShare(t, handler, 1, `{"password": "open-sesame"}`)
+	token := data["token"].(string)
+	if data["has_password"] != true {
+		t.Error("Expected has_password to be true")
+	}
+
+	expectShareError(t, openShare(t, handler, token, ""), http.StatusUnauthorized, response.ErrCodeSharePasswordRequired)
+	expectShareError(t, openShare(t, handler, token, "wrong"), http.StatusUnauthorized, response.ErrCodeSharePasswordInvalid)
+
+	if rec := openShare(t, handler, token, "open-sesame"); rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d with the right password, got %d", http.StatusOK, rec.Code)
+	}
+}
+
+func TestShare_ExpiredAndRevoked(t *testing.T) {
+	handler, shareRepo, _ := setupShareTest(t)
+
+	_, data := createShare(t, handler, 1, `{"expires_in": 3600}`)
+	token := data["token"].(string)
+
+	past := time.Now().Add(-time.Minute)
+	shareRepo.mu.Lock()
+	shareRepo.shares[1].ExpiresAt = &past
+	shareRepo.mu.Unlock()
+	expectShareError(t, openShare(t, handler, token, ""), http.StatusGone, response.ErrCodeShareExpired)
+
+	_, data = createShare(t, handler, 1, `{}`)
+	token = data["token"].(string)
+	id := int64(data["id"].(float64))
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodDelete, "/", nil), rec)
+	c.SetParamNames("id", "shareId")
+	c.SetParamValues("1", fmt.Sprint(id))
+	c.Set("user", &auth.TokenClaims{UserID: 1, Username: "testuser"})
+	if err := handler.RevokeShare(c); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("RevokeShare failed: %v (status %d)", err, rec.Code)
+	}
+
+	expectShareError(t, openShare(t, handler, token, ""), http.StatusGone, response.ErrCodeShareRevoked)
+}
+
+func TestShare_Validation(t *testing.T) {
+	handler, _, _ := setupShareTest(t)
+
+	if rec, _ := createShare(t, handler, 2, `{}`); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected non-owner to get %d, got %d", http.StatusForbidden, rec.Code)
+	}
+	if rec, _ := createShare(t, handler, 1, `{"max_views": 0}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected max_views 0 to be rejected, got %d", rec.Code)
+	}
+	if rec, _ := createShare(t, handler, 1, `{"expires_at": "2000-01-01T00:00:00Z"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected past expiry to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestShare_UnknownToken(t *testing.T) {
+	handler, _, _ := setupShareTest(t)
+	expectShareError(t, openShare(t, handler, "does-not-exist", ""), http.StatusNotFound, response.ErrCodeNotFound)
+}
+
+func TestShare_HidesQuarantinedUpload(t *testing.T) {
+	handler, _, uploadRepo := setupShareTest(t)
+
+	_, data := createShare(t, handler, 1, `{}`)
+	token := data["token"].(string)
+
+	stored, _ := uploadRepo.GetFileUploadByID(1)
+	uploadRepo.UpdateFileUploadStatus(1, upload.StatusQuarantined, stored.TempPath)
+
+	expectShareError(t, openShare(t, handler, token, ""), http.StatusNotFound, response.ErrCodeNotFound)
+}
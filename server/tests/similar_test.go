@@ -0,0 +1,215 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"testing"
+	"time"
+
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/events"
+	"elotus_test/server/models/upload"
+
+	"github.com/labstack/echo/v4"
+)
+
+var _ upload.Repository = (*MockUploadRepository)(nil)
+
+// patternImage draws a few overlapping blocks on a gradient; seed changes their layout
+func patternImage(seed, width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8((x*255/width + y*seed*40/height) % 256)
+			for i := 0; i < 4; i++ {
+				cx := ((seed*37 + i*71) % 90) * width / 100
+				cy := ((seed*53 + i*29) % 90) * height / 100
+				if x >= cx && x < cx+width/5 && y >= cy && y < cy+height/4 {
+					v = uint8(255 - (i*60+seed*25)%200)
+				}
+			}
+			img.Set(x, y, color.RGBA{v, v / 2, 255 - v, 255})
+		}
+	}
+	return img
+}
+
+func encodePNG(img image.Image) []byte {
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+func encodeJPEG(img image.Image, quality int) []byte {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	return buf.Bytes()
+}
+
+func decodeBytes(t *testing.T, data []byte) image.Image {
+	t.Helper()
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	return img
+}
+
+func TestPerceptualHash_ToleratesResizeAndRecompression(t *testing.T) {
+	original := upload.PerceptualHash(patternImage(1, 320, 240))
+	resized := upload.PerceptualHash(decodeBytes(t, encodeJPEG(patternImage(1, 160, 120), 40)))
+	different := upload.PerceptualHash(patternImage(3, 320, 240))
+
+	if d := upload.HammingDistance(original, resized); d > 6 {
+		t.Errorf("Expected a resized, recompressed copy within 6 bits, got %d", d)
+	}
+	if d := upload.HammingDistance(original, different); d <= 10 {
+		t.Errorf("Expected unrelated images to differ by more than 10 bits, got %d", d)
+	}
+}
+
+func uploadImage(t *testing.T, handler *upload.Handler, userID int64, name string, content []byte) map[string]interface{} {
+	t.Helper()
+	body, contentType := createMultipartForm("data", name, content)
+	c, rec := createUploadTestContext(echo.New(), http.MethodPost, "/api/upload", body, contentType)
+	c.Set("user", &auth.TokenClaims{UserID: userID, Username: "testuser"})
+	if err := handler.Upload(c); err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	return getUploadDataMap(mustParse(t, rec))
+}
+
+func getSimilar(t *testing.T, handler *upload.Handler, userID int64, id, query string) (int, map[string]interface{}) {
+	t.Helper()
+	c, rec := createUploadTestContext(echo.New(), http.MethodGet, "/api/uploads/"+id+"/similar"+query, nil, "")
+	c.Set("user", &auth.TokenClaims{UserID: userID, Username: "testuser"})
+	c.SetParamNames("id")
+	c.SetParamValues(id)
+	if err := handler.SimilarUploads(c); err != nil {
+		t.Fatalf("SimilarUploads returned error: %v", err)
+	}
+	return rec.Code, getUploadDataMap(mustParse(t, rec))
+}
+
+func TestUpload_FlagsPossibleDuplicates(t *testing.T) {
+	useUploadStorage(t, t.TempDir())
+	handler, repo := setupUploadTestHandler()
+
+	first := uploadImage(t, handler, 1, "beach.png", encodePNG(patternImage(1, 320, 240)))
+	if first["possible_duplicate"] != false {
+		t.Errorf("First upload must not be flagged, got %v", first["possible_duplicate"])
+	}
+	if stored, _ := repo.GetFileUploadByID(1); stored.PerceptualHash == nil {
+		t.Fatal("Expected a perceptual hash to be stored")
+	}
+
+	copy := uploadImage(t, handler, 1, "beach-small.jpg", encodeJPEG(patternImage(1, 160, 120), 50))
+	if copy["possible_duplicate"] != true {
+		t.Errorf("Expected resized copy to be flagged, got %v", copy["possible_duplicate"])
+	}
+	if ids, _ := copy["duplicate_of"].([]interface{}); len(ids) != 1 || ids[0] != float64(1) {
+		t.Errorf("Expected duplicate_of [1], got %v", copy["duplicate_of"])
+	}
+
+	other := uploadImage(t, handler, 1, "city.png", encodePNG(patternImage(3, 320, 240)))
+	if other["possible_duplicate"] != false {
+		t.Error("Unrelated image must not be flagged")
+	}
+
+	// Another user's identical image is never a match
+	theirs := uploadImage(t, handler, 2, "beach.png", encodePNG(patternImage(1, 320, 240)))
+	if theirs["possible_duplicate"] != false {
+		t.Error("Duplicates must not be matched across users")
+	}
+}
+
+func TestUpload_QueuedUploadFlaggedWhenProcessed(t *testing.T) {
+	useUploadStorage(t, t.TempDir())
+	handler, repo := setupUploadTestHandler()
+	uploadImage(t, handler, 1, "beach.png", encodePNG(patternImage(1, 320, 240)))
+
+	processed := make(chan events.Event, 1)
+	bus := events.NewBus()
+	bus.Subscribe(func(event events.Event) {
+		if event.Type == events.UploadProcessed {
+			processed <- event
+		}
+	})
+	handler.SetEventBus(bus)
+	queue := newTestQueue(NewMockJobRepository())
+	handler.SetJobQueue(queue)
+	queue.Start()
+	defer queue.Shutdown(context.Background())
+
+	copy := uploadImage(t, handler, 1, "beach-small.jpg", encodeJPEG(patternImage(1, 160, 120), 50))
+	if _, ok := copy["possible_duplicate"]; ok {
+		t.Error("Queued uploads are not hashed yet and must not report duplicates")
+	}
+
+	select {
+	case event := <-processed:
+		data := event.Data.(echo.Map)
+		if data["possible_duplicate"] != true || fmt.Sprint(data["duplicate_of"]) != "[1]" {
+			t.Errorf("Expected upload.processed to flag a duplicate of 1, got %v", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected an upload.processed event")
+	}
+	if stored, _ := repo.GetFileUploadByID(2); stored.PerceptualHash == nil {
+		t.Error("Expected the job to store a perceptual hash")
+	}
+}
+
+func TestSimilarUploads(t *testing.T) {
+	useUploadStorage(t, t.TempDir())
+	handler, repo := setupUploadTestHandler()
+
+	uploadImage(t, handler, 1, "beach.png", encodePNG(patternImage(1, 320, 240)))
+	uploadImage(t, handler, 1, "beach-small.jpg", encodeJPEG(patternImage(1, 160, 120), 50))
+	uploadImage(t, handler, 1, "city.png", encodePNG(patternImage(3, 320, 240)))
+
+	code, data := getSimilar(t, handler, 1, "1", "")
+	if code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, code)
+	}
+	results, _ := data["results"].([]interface{})
+	if len(results) != 1 || results[0].(map[string]interface{})["id"] != float64(2) {
+		t.Fatalf("Expected only upload 2, got %v", results)
+	}
+	if _, ok := results[0].(map[string]interface{})["distance"]; !ok {
+		t.Error("Expected distance in results")
+	}
+
+	_, data = getSimilar(t, handler, 1, "1", "?max_distance=32")
+	if results, _ := data["results"].([]interface{}); len(results) < 1 {
+		t.Errorf("Expected at least one match at the widest threshold, got %v", results)
+	}
+
+	// Quarantined copies are not offered as matches
+	repo.UpdateFileUploadStatus(2, upload.StatusQuarantined, "")
+	_, data = getSimilar(t, handler, 1, "1", "")
+	if results, _ := data["results"].([]interface{}); len(results) != 0 {
+		t.Errorf("Expected quarantined upload to be excluded, got %v", results)
+	}
+
+	for _, query := range []string{"?max_distance=33", "?max_distance=-1", "?max_distance=abc"} {
+		if code, _ := getSimilar(t, handler, 1, "1", query); code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", query, http.StatusBadRequest, code)
+		}
+	}
+	if code, _ := getSimilar(t, handler, 2, "1", ""); code != http.StatusForbidden {
+		t.Errorf("Expected status %d for another user's upload, got %d", http.StatusForbidden, code)
+	}
+	if code, _ := getSimilar(t, handler, 1, fmt.Sprint(99), ""); code != http.StatusNotFound {
+		t.Errorf("Expected status %d for a missing upload, got %d", http.StatusNotFound, code)
+	}
+}
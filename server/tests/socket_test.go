@@ -0,0 +1,288 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"elotus_test/server/middleware"
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/events"
+	"elotus_test/server/models/socket"
+	"elotus_test/server/models/stream"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/websocket"
+)
+
+// fakeTokens accepts "user-<id>" tokens until that user is revoked
+type fakeTokens struct {
+	mu      sync.Mutex
+	revoked map[int64]bool
+}
+
+func (f *fakeTokens) revoke(userID int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.revoked[userID] = true
+}
+
+func (f *fakeTokens) validate(token string) (*auth.TokenClaims, error) {
+	var userID int64
+	if _, err := fmt.Sscanf(token, "user-%d", &userID); err != nil {
+		return nil, errors.New("invalid token")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.revoked[userID] {
+		return nil, errors.New("token has been revoked")
+	}
+	return &auth.TokenClaims{UserID: userID, Username: "testuser"}, nil
+}
+
+type socketTest struct {
+	url    string
+	broker *stream.Broker
+	hub    *socket.Hub
+	tokens *fakeTokens
+}
+
+func setupSocketTest(t *testing.T) *socketTest {
+	t.Helper()
+	tokens := &fakeTokens{revoked: make(map[int64]bool)}
+	broker := stream.NewBroker(nil, nil)
+	hub := socket.NewHub(nil, broker, tokens.validate)
+
+	e := echo.New()
+	jwtMiddleware := middleware.JWTMiddleware(func(token string) (interface{}, error) {
+		return tokens.validate(token)
+	})
+	e.GET("/ws", hub.Connect, middleware.TokenFromQuery("token"), jwtMiddleware)
+	server := httptest.NewServer(e)
+	t.Cleanup(func() {
+		hub.Close()
+		server.Close()
+	})
+
+	return &socketTest{url: server.URL, broker: broker, hub: hub, tokens: tokens}
+}
+
+func (s *socketTest) dial(t *testing.T, query, authorization string) *websocket.Conn {
+	t.Helper()
+	config, err := websocket.NewConfig("ws"+strings.TrimPrefix(s.url, "http")+"/ws"+query, s.url)
+	if err != nil {
+		t.Fatalf("Invalid config: %v", err)
+	}
+	if authorization != "" {
+		config.Header.Set("Authorization", authorization)
+	}
+	ws, err := websocket.DialConfig(config)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+// receive returns the next message, skipping heartbeats; ok is false once the socket is closed
+func receive(t *testing.T, ws *websocket.Conn) (socket.Message, bool) {
+	t.Helper()
+	_ = ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var msg socket.Message
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			return msg, false
+		}
+		if msg.Type != socket.MessageHeartbeat {
+			return msg, true
+		}
+	}
+}
+
+func publishUploadEvent(broker *stream.Broker, userID, uploadID int64) events.Event {
+	event := events.Event{
+		ID:         fmt.Sprintf("evt_%d_%d", userID, uploadID),
+		Type:       events.UploadCreated,
+		UserID:     userID,
+		Data:       echo.Map{"id": uploadID},
+		OccurredAt: time.Now().UTC(),
+	}
+	broker.HandleEvent(event)
+	return event
+}
+
+func TestSocket_RequiresValidToken(t *testing.T) {
+	s := setupSocketTest(t)
+
+	for _, url := range []string{s.url + "/ws", s.url + "/ws?token=garbage"} {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for %s, got %d", url, resp.StatusCode)
+		}
+	}
+}
+
+func TestSocket_DeliversOwnEvents(t *testing.T) {
+	s := setupSocketTest(t)
+	ws := s.dial(t, "?token=user-1", "")
+
+	publishUploadEvent(s.broker, 2, 20)
+	sent := publishUploadEvent(s.broker, 1, 10)
+
+	msg, ok := receive(t, ws)
+	if !ok {
+		t.Fatal("Socket closed before the event arrived")
+	}
+	if msg.Type != socket.MessageEvent || msg.ID != sent.ID {
+		t.Fatalf("Expected event %s, got %+v", sent.ID, msg)
+	}
+	data := msg.Data.(map[string]interface{})
+	if data["type"] != events.UploadCreated || data["user_id"] != float64(1) {
+		t.Errorf("Unexpected event payload: %v", data)
+	}
+}
+
+func TestSocket_AuthorizationHeader(t *testing.T) {
+	s := setupSocketTest(t)
+	ws := s.dial(t, "", "Bearer user-3")
+
+	sent := publishUploadEvent(s.broker, 3, 30)
+	if msg, ok := receive(t, ws); !ok || msg.ID != sent.ID {
+		t.Fatalf("Expected event %s, got %+v (open: %v)", sent.ID, msg, ok)
+	}
+}
+
+func TestSocket_PingPong(t *testing.T) {
+	s := setupSocketTest(t)
+	ws := s.dial(t, "?token=user-1", "")
+
+	if err := websocket.JSON.Send(ws, socket.Message{Type: socket.MessagePing, ID: "p1"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	msg, ok := receive(t, ws)
+	if !ok || msg.Type != socket.MessagePong || msg.ID != "p1" {
+		t.Fatalf("Expected pong p1, got %+v (open: %v)", msg, ok)
+	}
+
+	if err := websocket.Message.Send(ws, "not json"); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if msg, ok := receive(t, ws); !ok || msg.Type != socket.MessageError {
+		t.Fatalf("Expected error for malformed message, got %+v (open: %v)", msg, ok)
+	}
+
+	if err := websocket.JSON.Send(ws, socket.Message{Type: "subscribe", ID: "s1"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if msg, ok := receive(t, ws); !ok || msg.Type != socket.MessageError || msg.ID != "s1" {
+		t.Fatalf("Expected error for unknown type, got %+v (open: %v)", msg, ok)
+	}
+
+	// The socket survives client mistakes
+	if err := websocket.JSON.Send(ws, socket.Message{Type: socket.MessagePing, ID: "p2"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if msg, ok := receive(t, ws); !ok || msg.ID != "p2" {
+		t.Fatalf("Expected pong p2, got %+v (open: %v)", msg, ok)
+	}
+}
+
+func TestSocket_ClosedWhenTokensRevoked(t *testing.T) {
+	s := setupSocketTest(t)
+	ws := s.dial(t, "?token=user-1", "")
+	other := s.dial(t, "?token=user-2", "")
+
+	s.tokens.revoke(1)
+	s.hub.RevokeUser(1)
+
+	msg, ok := receive(t, ws)
+	if !ok || msg.Type != socket.MessageRevoked {
+		t.Fatalf("Expected revoked message, got %+v (open: %v)", msg, ok)
+	}
+	if _, ok := receive(t, ws); ok {
+		t.Fatal("Expected the socket to be closed after revocation")
+	}
+
+	// Other users keep their sockets
+	if err := websocket.JSON.Send(other, socket.Message{Type: socket.MessagePing, ID: "p1"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if msg, ok := receive(t, other); !ok || msg.Type != socket.MessagePong {
+		t.Fatalf("Expected pong for unrevoked user, got %+v (open: %v)", msg, ok)
+	}
+}
+
+func TestSocket_RecheckKeepsValidToken(t *testing.T) {
+	s := setupSocketTest(t)
+	ws := s.dial(t, "?token=user-1", "")
+
+	// Tokens issued after the revocation cutoff still validate
+	s.hub.RevokeUser(1)
+
+	if err := websocket.JSON.Send(ws, socket.Message{Type: socket.MessagePing, ID: "p1"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if msg, ok := receive(t, ws); !ok || msg.Type != socket.MessagePong {
+		t.Fatalf("Expected socket to stay open, got %+v (open: %v)", msg, ok)
+	}
+}
+
+func TestSocket_RevokedEventRechecksToken(t *testing.T) {
+	s := setupSocketTest(t)
+	ws := s.dial(t, "?token=user-1", "")
+
+	// A revocation on another replica only shows up as an event
+	s.tokens.revoke(1)
+	s.broker.HandleEvent(events.Event{ID: "evt_revoked", Type: events.TokensRevoked, UserID: 1, OccurredAt: time.Now().UTC()})
+
+	if msg, ok := receive(t, ws); !ok || msg.Type != socket.MessageEvent || msg.ID != "evt_revoked" {
+		t.Fatalf("Expected the revocation event, got %+v (open: %v)", msg, ok)
+	}
+	if msg, ok := receive(t, ws); !ok || msg.Type != socket.MessageRevoked {
+		t.Fatalf("Expected revoked message, got %+v (open: %v)", msg, ok)
+	}
+	if _, ok := receive(t, ws); ok {
+		t.Fatal("Expected the socket to be closed")
+	}
+}
+
+func TestSocket_CloseEndsConnections(t *testing.T) {
+	s := setupSocketTest(t)
+	ws := s.dial(t, "?token=user-1", "")
+
+	done := make(chan struct{})
+	go func() {
+		s.hub.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close did not return while a socket was open")
+	}
+
+	if _, ok := receive(t, ws); ok {
+		t.Fatal("Expected the socket to be closed")
+	}
+	if n := s.hub.Connections(1); n != 0 {
+		t.Errorf("Expected no connections after close, got %d", n)
+	}
+
+	resp, err := http.Get(s.url + "/ws?token=user-1")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 after close, got %d", resp.StatusCode)
+	}
+}
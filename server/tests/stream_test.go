@@ -0,0 +1,228 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/events"
+	"elotus_test/server/models/jobs"
+	"elotus_test/server/models/stream"
+	"elotus_test/server/models/upload"
+
+	"github.com/labstack/echo/v4"
+)
+
+type sseEvent struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+type sseClient struct {
+	t      *testing.T
+	body   *bufio.Reader
+	cancel context.CancelFunc
+}
+
+// startStream serves /api/events for userID and connects to it. The handler
+// subscribes before sending headers, so events published after this returns are delivered.
+func startStream(t *testing.T, broker *stream.Broker, userID int64, lastEventID string) *sseClient {
+	t.Helper()
+	e := echo.New()
+	e.GET("/api/events", stream.NewHandler(broker).Events, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("user", &auth.TokenClaims{UserID: userID, Username: "testuser"})
+			return next(c)
+		}
+	})
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/events", nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Unexpected response %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return &sseClient{t: t, body: bufio.NewReader(resp.Body), cancel: cancel}
+}
+
+// next returns the next event, skipping retry hints and comments; ok is false at end of stream
+func (s *sseClient) next() (sseEvent, bool) {
+	s.t.Helper()
+	timer := time.AfterFunc(2*time.Second, s.cancel)
+	defer timer.Stop()
+
+	var event sseEvent
+	for {
+		line, err := s.body.ReadString('\n')
+		if err != nil {
+			return event, false
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if event.Event != "" {
+				return event, true
+			}
+		case strings.HasPrefix(line, "id: "):
+			event.ID = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.Event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.Data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func newStreamBus() (*events.Bus, *stream.Broker) {
+	broker := stream.NewBroker(nil, nil)
+	bus := events.NewBus()
+	bus.Subscribe(broker.HandleEvent)
+	return bus, broker
+}
+
+func TestEventStream_DeliversOwnEventsOnly(t *testing.T) {
+	bus, broker := newStreamBus()
+	client := startStream(t, broker, 1, "")
+
+	bus.Publish(events.UploadCreated, 2, echo.Map{"id": 99})
+	bus.Publish(events.UserRegistered, 1, echo.Map{"username": "x"})
+	bus.Publish(events.UploadCreated, 1, echo.Map{"id": 7})
+
+	event, ok := client.next()
+	if !ok || event.Event != events.UploadCreated || event.ID == "" {
+		t.Fatalf("Expected upload.created, got %+v", event)
+	}
+	var payload events.Event
+	if err := json.Unmarshal([]byte(event.Data), &payload); err != nil {
+		t.Fatalf("Invalid data: %v", err)
+	}
+	if payload.UserID != 1 || payload.ID != event.ID || payload.Data.(map[string]interface{})["id"] != float64(7) {
+		t.Errorf("Unexpected payload %+v", payload)
+	}
+}
+
+func TestEventStream_ResumesFromLastEventID(t *testing.T) {
+	bus, broker := newStreamBus()
+	var ids []string
+	bus.Subscribe(func(event events.Event) { ids = append(ids, event.ID) })
+	for i := 1; i <= 3; i++ {
+		bus.Publish(events.UploadCreated, 1, echo.Map{"id": i})
+	}
+
+	client := startStream(t, broker, 1, ids[0])
+	for _, want := range ids[1:] {
+		if event, ok := client.next(); !ok || event.ID != want {
+			t.Fatalf("Expected replay of %s, got %+v", want, event)
+		}
+	}
+
+	// Live events continue after the replay
+	bus.Publish(events.UploadDeleted, 1, echo.Map{"id": 1})
+	if event, ok := client.next(); !ok || event.Event != events.UploadDeleted {
+		t.Errorf("Expected live upload.deleted, got %+v", event)
+	}
+
+	stale := startStream(t, broker, 1, "evt_unknown")
+	if event, ok := stale.next(); !ok || event.Event != "reset" {
+		t.Errorf("Expected a reset event for an unknown id, got %+v", event)
+	}
+}
+
+func TestEventStream_DoesNotReplayLiveEvents(t *testing.T) {
+	bus, broker := newStreamBus()
+	var ids []string
+	bus.Subscribe(func(event events.Event) { ids = append(ids, event.ID) })
+	bus.Publish(events.UploadCreated, 1, echo.Map{"id": 1})
+	bus.Publish(events.UploadProgress, 1, upload.Progress{UploadID: "upload-0001"})
+	bus.Publish(events.UploadDeleted, 1, echo.Map{"id": 1})
+
+	client := startStream(t, broker, 1, ids[0])
+	if event, ok := client.next(); !ok || event.Event != events.UploadDeleted {
+		t.Fatalf("Expected the replay to skip upload.progress, got %+v", event)
+	}
+
+	// Progress is still delivered live
+	bus.Publish(events.UploadProgress, 1, upload.Progress{UploadID: "upload-0001"})
+	if event, ok := client.next(); !ok || event.Event != events.UploadProgress {
+		t.Errorf("Expected live upload.progress, got %+v", event)
+	}
+}
+
+func TestEventStream_EndsOnRevocationAndShutdown(t *testing.T) {
+	bus, broker := newStreamBus()
+
+	client := startStream(t, broker, 1, "")
+	bus.Publish(events.TokensRevoked, 1, echo.Map{"user_id": 1})
+	if event, ok := client.next(); !ok || event.Event != events.TokensRevoked {
+		t.Fatalf("Expected tokens.revoked, got %+v", event)
+	}
+	if _, ok := client.next(); ok {
+		t.Error("Expected the stream to end after a revocation")
+	}
+
+	client = startStream(t, broker, 1, "")
+	broker.Close()
+	if _, ok := client.next(); ok {
+		t.Error("Expected the stream to end when the broker closes")
+	}
+	if _, err := broker.Subscribe(1); err != stream.ErrBrokerClosed {
+		t.Errorf("Expected ErrBrokerClosed, got %v", err)
+	}
+}
+
+func TestBroker_DropsSlowSubscribers(t *testing.T) {
+	bus, broker := newStreamBus()
+	sub, _ := broker.Subscribe(1)
+
+	for i := 0; i < 100; i++ {
+		bus.Publish(events.UploadCreated, 1, echo.Map{"id": i})
+	}
+
+	received := 0
+	for range sub.Events() {
+		received++
+	}
+	if received == 0 || received >= 100 {
+		t.Errorf("Expected a partial buffer before the subscriber was dropped, got %d events", received)
+	}
+}
+
+func TestProcessUploadJob_PublishesProcessedEvent(t *testing.T) {
+	useUploadStorage(t, t.TempDir())
+	handler, repo := setupUploadTestHandler()
+	bus := events.NewBus()
+	var published []events.Event
+	bus.Subscribe(func(event events.Event) { published = append(published, event) })
+	handler.SetEventBus(bus)
+
+	repo.AddUpload(&upload.FileUpload{ID: 3, UserID: 1, Status: upload.StatusClean, ProcessingState: upload.ProcessingQueued})
+	payload, _ := json.Marshal(map[string]int64{"upload_id": 3})
+	if err := handler.ProcessUploadJob(context.Background(), &jobs.Job{Payload: payload, MaxAttempts: 3, Attempts: 1}); err != nil {
+		t.Fatalf("ProcessUploadJob failed: %v", err)
+	}
+
+	if len(published) != 1 || published[0].Type != events.UploadProcessed {
+		t.Fatalf("Expected one upload.processed event, got %+v", published)
+	}
+	if state := published[0].Data.(echo.Map)["processing_state"]; state != upload.ProcessingCompleted {
+		t.Errorf("Expected processing_state completed, got %v", state)
+	}
+}
@@ -0,0 +1,242 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"elotus_test/server/models/takeout"
+	"elotus_test/server/models/upload"
+	"elotus_test/server/models/user"
+
+	"github.com/labstack/echo/v4"
+)
+
+var _ takeout.Repository = (*MockExportRepository)(nil)
+
+type takeoutTest struct {
+	handler    *takeout.Handler
+	config     *takeout.Config
+	exportRepo *MockExportRepository
+	userRepo   *MockUserRepository
+}
+
+// setupTakeoutTest gives user 1 a login history and three uploads: one clean,
+// one infected and one whose file is gone. User 2 owns one clean upload.
+func setupTakeoutTest(t *testing.T) *takeoutTest {
+	t.Helper()
+	dir := t.TempDir()
+
+	userRepo := NewMockUserRepository()
+	userRepo.AddUser(&user.User{ID: 1, Username: "testuser", Password: "secret-hash", CreatedAt: time.Now()})
+	userRepo.AddUser(&user.User{ID: 2, Username: "other", Password: "other-hash", CreatedAt: time.Now()})
+	userRepo.RecordLogin(1, "198.51.100.4", "login-agent", false)
+	userRepo.RecordLogin(1, "198.51.100.4", "login-agent", true)
+	userRepo.RecordLogin(2, "192.0.2.9", "other-agent", true)
+
+	uploadRepo := NewMockUploadRepository()
+	add := func(id, userID int64, status, content string) {
+		path := filepath.Join(dir, fmt.Sprintf("%d.png", id))
+		if content != "" {
+			if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		uploadRepo.AddUpload(&upload.FileUpload{
+			ID: id, UserID: userID, Filename: fmt.Sprintf("%d.png", id), OriginalFilename: "photo.png",
+			FileSize: int64(len(content)), Status: status, TempPath: path,
+			ClientIP: "203.0.113.5", UserAgent: "upload-agent",
+		})
+	}
+	add(1, 1, upload.StatusClean, "first")
+	add(2, 1, upload.StatusInfected, "eicar")
+	add(3, 1, upload.StatusClean, "")
+	add(4, 2, upload.StatusClean, "theirs")
+
+	config := takeout.DefaultConfig()
+	config.StorageDir = filepath.Join(dir, "exports")
+	config.SigningKey = []byte("test-key")
+
+	test := &takeoutTest{config: config, exportRepo: NewMockExportRepository(), userRepo: userRepo}
+	test.handler = takeout.NewHandler(config, test.exportRepo, userRepo, uploadRepo)
+	return test
+}
+
+func (test *takeoutTest) download(t *testing.T, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	e := echo.New()
+	c, rec := createUploadTestContext(e, http.MethodGet, target, nil, "")
+	c.SetParamNames("id")
+	c.SetParamValues(strings.Split(strings.TrimPrefix(target, "/exports/"), "/")[0])
+	if err := test.handler.Download(c); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+	return rec
+}
+
+func TestTakeout_BuildsExportWithSignedLink(t *testing.T) {
+	test := setupTakeoutTest(t)
+
+	rec := callAlbum(t, test.handler.RequestExport, http.MethodPost, "/api/me/export", "")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusAccepted, rec.Code, rec.Body.String())
+	}
+
+	// Without a job queue the export is built inline
+	rec = callAlbum(t, test.handler.GetExport, http.MethodGet, "/api/me/exports/1", "", "id", "1")
+	data := getDataMap(mustParse(t, rec))
+	if data["status"] != takeout.StatusReady {
+		t.Fatalf("Expected ready export, got %v", data)
+	}
+	link, _ := data["download_url"].(string)
+	if !strings.HasPrefix(link, "/exports/1/download?") {
+		t.Fatalf("Unexpected download link %q", link)
+	}
+
+	rec = test.download(t, link)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	files := readZip(t, rec.Body.Bytes())
+
+	if !strings.Contains(files["profile.json"], `"username": "testuser"`) || strings.Contains(files["profile.json"], "secret-hash") {
+		t.Errorf("Unexpected profile: %s", files["profile.json"])
+	}
+
+	var logins []user.LoginEvent
+	if err := json.Unmarshal([]byte(files["logins.json"]), &logins); err != nil || len(logins) != 2 {
+		t.Fatalf("Expected the caller's 2 logins, got %s", files["logins.json"])
+	}
+	if logins[0].Success || logins[0].ClientIP != "198.51.100.4" || logins[0].UserAgent != "login-agent" {
+		t.Errorf("Unexpected login event: %+v", logins[0])
+	}
+
+	var uploads []map[string]interface{}
+	if err := json.Unmarshal([]byte(files["uploads.json"]), &uploads); err != nil || len(uploads) != 3 {
+		t.Fatalf("Expected the caller's 3 uploads, got %s", files["uploads.json"])
+	}
+	byID := make(map[float64]map[string]interface{})
+	for _, u := range uploads {
+		if u["client_ip"] != "203.0.113.5" || u["user_agent"] != "upload-agent" {
+			t.Errorf("Expected recorded request details, got %v", u)
+		}
+		if _, leaked := u["temp_path"]; leaked {
+			t.Errorf("Expected the storage path to stay out of the export, got %v", u)
+		}
+		byID[u["id"].(float64)] = u
+	}
+	if byID[1]["export_file"] != "files/1-1.png" || files["files/1-1.png"] != "first" {
+		t.Errorf("Expected the clean file in the export, got %v", byID[1])
+	}
+	if byID[2]["export_file"] != nil || byID[2]["export_note"] == nil {
+		t.Errorf("Expected the infected file to be withheld, got %v", byID[2])
+	}
+	if byID[3]["export_file"] != nil || byID[3]["export_note"] == nil {
+		t.Errorf("Expected the missing file to be noted, got %v", byID[3])
+	}
+	if len(files) != 5 {
+		t.Errorf("Expected 4 JSON entries and 1 file, got %d entries", len(files))
+	}
+
+	if rec := test.download(t, link+"00"); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected tampered link to be rejected, got %d", rec.Code)
+	}
+	past := time.Now().Add(-time.Minute).Unix()
+	expired := fmt.Sprintf("/exports/1/download?expires=%d&signature=%s", past, takeout.Sign(test.config.SigningKey, 1, past))
+	if rec := test.download(t, expired); rec.Code != http.StatusGone {
+		t.Errorf("Expected expired link to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestTakeout_ReusesExportInProgress(t *testing.T) {
+	test := setupTakeoutTest(t)
+	pending, _ := test.exportRepo.CreateExport(&takeout.Export{UserID: 1, Status: takeout.StatusBuilding})
+	theirs, _ := test.exportRepo.CreateExport(&takeout.Export{UserID: 2, Status: takeout.StatusPending})
+
+	rec := callAlbum(t, test.handler.RequestExport, http.MethodPost, "/api/me/export", "")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d", http.StatusAccepted, rec.Code)
+	}
+	if data := getDataMap(mustParse(t, rec)); data["id"] != float64(pending.ID) {
+		t.Errorf("Expected export %d to be reused, got %v", pending.ID, data["id"])
+	}
+
+	rec = callAlbum(t, test.handler.GetExport, http.MethodGet, "/api/me/exports/2", "", "id", fmt.Sprint(theirs.ID))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for another user's export, got %d", http.StatusForbidden, rec.Code)
+	}
+}
+
+func TestTakeout_JobBuildsAndPurges(t *testing.T) {
+	test := setupTakeoutTest(t)
+	jobRepo := NewMockJobRepository()
+	test.handler.SetJobQueue(newTestQueue(jobRepo))
+
+	rec := callAlbum(t, test.handler.RequestExport, http.MethodPost, "/api/me/export", "")
+	if data := getDataMap(mustParse(t, rec)); data["status"] != takeout.StatusPending {
+		t.Fatalf("Expected a pending export while the job is queued, got %v", data)
+	}
+
+	build := jobRepo.GetJob(1)
+	if build == nil || build.Kind != takeout.JobBuildExport {
+		t.Fatalf("Expected a build job, got %+v", build)
+	}
+	if err := test.handler.BuildExportJob(context.Background(), build); err != nil {
+		t.Fatalf("Build job failed: %v", err)
+	}
+	e, _ := test.exportRepo.GetExport(1)
+	if e.Status != takeout.StatusReady {
+		t.Fatalf("Expected ready export, got %s", e.Status)
+	}
+
+	purge := jobRepo.GetJob(2)
+	if purge == nil || purge.Kind != takeout.JobPurgeExport || !purge.RunAt.After(*e.ExpiresAt) {
+		t.Fatalf("Expected a purge job after the export expires, got %+v", purge)
+	}
+	if err := test.handler.PurgeExportJob(context.Background(), purge); err != nil {
+		t.Fatalf("Purge job failed: %v", err)
+	}
+	if _, err := os.Stat(e.FilePath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the export file to be removed, got %v", err)
+	}
+	e, _ = test.exportRepo.GetExport(1)
+	if e.Status != takeout.StatusExpired {
+		t.Errorf("Expected expired export, got %s", e.Status)
+	}
+
+	expires := time.Now().Add(time.Hour).Unix()
+	link := fmt.Sprintf("/exports/1/download?expires=%d&signature=%s", expires, takeout.Sign(test.config.SigningKey, 1, expires))
+	if rec := test.download(t, link); rec.Code != http.StatusGone {
+		t.Errorf("Expected a purged export to be gone, got %d", rec.Code)
+	}
+}
+
+func TestTakeout_WriteExportFile(t *testing.T) {
+	test := setupTakeoutTest(t)
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "user-2.zip")
+	if err := test.handler.WriteExportFile(context.Background(), path, 2); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	body, _ := os.ReadFile(path)
+	if files := readZip(t, body); files["files/4-4.png"] != "theirs" {
+		t.Errorf("Expected user 2's file, got %v", files)
+	}
+
+	missing := filepath.Join(dir, "user-99.zip")
+	if err := test.handler.WriteExportFile(context.Background(), missing, 99); !errors.Is(err, user.ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected a failed export to leave nothing behind, got %d files", len(entries))
+	}
+}
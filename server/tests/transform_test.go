@@ -0,0 +1,256 @@
+package tests
+
+import (
+	"bytes"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/events"
+	"elotus_test/server/models/transform"
+	"elotus_test/server/models/upload"
+
+	"github.com/labstack/echo/v4"
+)
+
+func setupTransformTest(t *testing.T) (*transform.Handler, *upload.Handler, *MockUploadRepository, string) {
+	t.Helper()
+	dir := t.TempDir()
+	useUploadStorage(t, dir)
+
+	uploadHandler, repo := setupUploadTestHandler()
+	config := transform.DefaultConfig()
+	config.StorageDir = filepath.Join(dir, "transforms")
+	config.SigningKey = []byte("test-signing-key")
+	return transform.NewHandler(config, repo), uploadHandler, repo, config.StorageDir
+}
+
+func signTransform(t *testing.T, handler *transform.Handler, userID int64, id, body string) (int, string) {
+	t.Helper()
+	c, rec := createUploadTestContext(echo.New(), http.MethodPost, "/api/uploads/"+id+"/transform-url",
+		strings.NewReader(body), echo.MIMEApplicationJSON)
+	c.Set("user", &auth.TokenClaims{UserID: userID, Username: "testuser"})
+	c.SetParamNames("id")
+	c.SetParamValues(id)
+	if err := handler.SignURL(c); err != nil {
+		t.Fatalf("SignURL returned error: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		return rec.Code, ""
+	}
+	return rec.Code, getUploadDataMap(mustParse(t, rec))["url"].(string)
+}
+
+func getTransform(t *testing.T, handler *transform.Handler, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	parsed, _ := url.Parse(target)
+	id := strings.Split(parsed.Path, "/")[3]
+
+	c, rec := createUploadTestContext(echo.New(), http.MethodGet, target, nil, "")
+	c.SetParamNames("id")
+	c.SetParamValues(id)
+	if err := handler.Serve(c); err != nil {
+		t.Fatalf("Serve returned error: %v", err)
+	}
+	return rec
+}
+
+func decodedSize(t *testing.T, body []byte) (string, int, int) {
+	t.Helper()
+	config, format, err := image.DecodeConfig(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Variant is not an image: %v", err)
+	}
+	return format, config.Width, config.Height
+}
+
+func TestTransformParams_Validation(t *testing.T) {
+	sizes := transform.DefaultConfig().Sizes
+	tests := []struct {
+		query string
+		err   error
+	}{
+		{"w=256", nil},
+		{"w=256&h=128&fit=cover&format=jpg&q=70", nil},
+		{"", transform.ErrNoDimensions},
+		{"w=300", transform.ErrSizeNotAllowed},
+		{"w=abc", transform.ErrSizeNotAllowed},
+		{"w=256&fit=stretch", transform.ErrInvalidFit},
+		{"w=256&fit=cover", transform.ErrFitNeedsBoth},
+		{"w=256&format=webp", transform.ErrInvalidFormat},
+		{"w=256&q=0", transform.ErrInvalidQuality},
+		{"w=256&format=png&q=80", transform.ErrQualityNotApplied},
+	}
+
+	for _, tt := range tests {
+		values, _ := url.ParseQuery(tt.query)
+		_, err := transform.ParseParams(values, sizes)
+		if err != tt.err {
+			t.Errorf("%q: expected %v, got %v", tt.query, tt.err, err)
+		}
+	}
+}
+
+func TestTransform_ResizesAndCaches(t *testing.T) {
+	handler, uploadHandler, _, _ := setupTransformTest(t)
+	uploadImage(t, uploadHandler, 1, "photo.png", encodePNG(patternImage(1, 400, 300)))
+
+	_, signed := signTransform(t, handler, 1, "1", `{"w": 256}`)
+	rec := getTransform(t, handler, signed)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if format, w, h := decodedSize(t, rec.Body.Bytes()); format != "png" || w != 256 || h != 192 {
+		t.Errorf("Expected 256x192 png, got %dx%d %s", w, h, format)
+	}
+	if rec.Header().Get(echo.HeaderContentType) != "image/png" {
+		t.Errorf("Unexpected content type %q", rec.Header().Get(echo.HeaderContentType))
+	}
+	if cc := rec.Header().Get("Cache-Control"); !strings.HasPrefix(cc, "private, max-age=") || rec.Header().Get("ETag") == "" {
+		t.Errorf("Expected a privately cacheable response with an ETag, got %q", cc)
+	}
+
+	again := getTransform(t, handler, signed)
+	if !bytes.Equal(again.Body.Bytes(), rec.Body.Bytes()) || handler.Renders() != 1 {
+		t.Errorf("Expected second request to be served from cache, renders: %d", handler.Renders())
+	}
+
+	_, signed = signTransform(t, handler, 1, "1", `{"w": 128, "h": 128, "fit": "cover", "format": "jpeg", "q": 60}`)
+	rec = getTransform(t, handler, signed)
+	if format, w, h := decodedSize(t, rec.Body.Bytes()); format != "jpeg" || w != 128 || h != 128 {
+		t.Errorf("Expected 128x128 jpeg, got %dx%d %s", w, h, format)
+	}
+
+	// contain never enlarges the source
+	_, signed = signTransform(t, handler, 1, "1", `{"w": 2048}`)
+	rec = getTransform(t, handler, signed)
+	if _, w, h := decodedSize(t, rec.Body.Bytes()); w != 400 || h != 300 {
+		t.Errorf("Expected source size 400x300, got %dx%d", w, h)
+	}
+}
+
+func TestTransform_RequiresValidSignature(t *testing.T) {
+	handler, uploadHandler, _, _ := setupTransformTest(t)
+	uploadImage(t, uploadHandler, 1, "photo.png", encodePNG(patternImage(1, 400, 300)))
+
+	_, signed := signTransform(t, handler, 1, "1", `{"w": 256}`)
+
+	for _, target := range []string{
+		strings.Replace(signed, "w=256", "w=640", 1),
+		strings.Replace(signed, "/uploads/1/", "/uploads/2/", 1),
+		strings.Replace(signed, "signature=", "signature=00", 1),
+		strings.Replace(signed, "expires=", "expires=9", 1),
+		"/api/uploads/1/transform?w=256",
+	} {
+		if rec := getTransform(t, handler, target); rec.Code != http.StatusForbidden {
+			t.Errorf("%s: expected status %d, got %d", target, http.StatusForbidden, rec.Code)
+		}
+	}
+	if handler.Renders() != 0 {
+		t.Error("Nothing should be rendered for a bad signature")
+	}
+
+	if code, _ := signTransform(t, handler, 2, "1", `{"w": 256}`); code != http.StatusForbidden {
+		t.Errorf("Expected status %d signing another user's upload, got %d", http.StatusForbidden, code)
+	}
+	if code, _ := signTransform(t, handler, 1, "1", `{"w": 300}`); code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a size outside the allowlist, got %d", http.StatusBadRequest, code)
+	}
+}
+
+func TestTransform_LinksExpireAndPublicVariantsAreShared(t *testing.T) {
+	handler, uploadHandler, repo, _ := setupTransformTest(t)
+	uploadImage(t, uploadHandler, 1, "photo.png", encodePNG(patternImage(1, 400, 300)))
+	public := upload.VisibilityPublic
+	repo.UpdateFileUploadMetadata(1, 0, upload.MetadataUpdate{Visibility: &public})
+
+	_, signed := signTransform(t, handler, 1, "1", `{"w": 256}`)
+	if !strings.Contains(signed, "expires=") {
+		t.Fatalf("Expected the URL to carry its expiry, got %s", signed)
+	}
+	rec := getTransform(t, handler, signed)
+	if cc := rec.Header().Get("Cache-Control"); !strings.HasPrefix(cc, "public, max-age=") || !strings.HasSuffix(cc, ", immutable") {
+		t.Errorf("Expected a public upload's variant to be shared until the link expires, got %q", cc)
+	}
+
+	config := transform.DefaultConfig()
+	config.StorageDir = t.TempDir()
+	config.SigningKey = []byte("test-signing-key")
+	config.LinkTTL = -time.Minute
+	expired := transform.NewHandler(config, repo)
+	_, signed = signTransform(t, expired, 1, "1", `{"w": 256}`)
+	if rec := getTransform(t, expired, signed); rec.Code != http.StatusGone {
+		t.Errorf("Expected status %d for an expired link, got %d", http.StatusGone, rec.Code)
+	}
+	if expired.Renders() != 0 {
+		t.Error("Nothing should be rendered for an expired link")
+	}
+}
+
+func TestTransform_DeduplicatesConcurrentRequests(t *testing.T) {
+	handler, uploadHandler, _, _ := setupTransformTest(t)
+	uploadImage(t, uploadHandler, 1, "photo.png", encodePNG(patternImage(1, 1600, 1200)))
+	_, signed := signTransform(t, handler, 1, "1", `{"w": 640, "h": 640, "fit": "cover"}`)
+
+	var wg sync.WaitGroup
+	codes := make([]int, 8)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = getTransform(t, handler, signed).Code
+		}(i)
+	}
+	wg.Wait()
+
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("Request %d: expected status %d, got %d", i, http.StatusOK, code)
+		}
+	}
+	if handler.Renders() != 1 {
+		t.Errorf("Expected a single render, got %d", handler.Renders())
+	}
+}
+
+func TestTransform_EncryptedCacheAndCleanup(t *testing.T) {
+	handler, uploadHandler, repo, cacheDir := setupTransformTest(t)
+	keyring, _ := testKeyring(t, "k1")
+	uploadHandler.SetKeyring(keyring)
+	handler.SetKeyring(keyring)
+	uploadImage(t, uploadHandler, 1, "photo.png", encodePNG(patternImage(1, 400, 300)))
+
+	_, signed := signTransform(t, handler, 1, "1", `{"w": 128}`)
+	rec := getTransform(t, handler, signed)
+	if _, w, _ := decodedSize(t, rec.Body.Bytes()); w != 128 {
+		t.Fatalf("Expected a 128px variant, got %d", w)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(cacheDir, "1", "*"))
+	if len(files) != 1 {
+		t.Fatalf("Expected one cached variant, got %v", files)
+	}
+	onDisk, _ := os.ReadFile(files[0])
+	if !bytes.HasPrefix(onDisk, []byte("ENVK k1 ")) || bytes.Contains(onDisk, rec.Body.Bytes()[:16]) {
+		t.Error("Cached variant must be encrypted at rest")
+	}
+
+	// Quarantined uploads are not served even with a valid signature
+	repo.UpdateFileUploadStatus(1, upload.StatusQuarantined, "")
+	if rec := getTransform(t, handler, signed); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for a quarantined upload, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	handler.HandleEvent(events.Event{Type: events.UploadDeleted, Data: echo.Map{"id": int64(1)}})
+	if _, err := os.Stat(filepath.Join(cacheDir, "1")); !os.IsNotExist(err) {
+		t.Error("Expected cached variants to be removed with the upload")
+	}
+}
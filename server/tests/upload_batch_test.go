@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/upload"
+
+	"github.com/labstack/echo/v4"
+)
+
+type batchFile struct {
+	name    string
+	content []byte
+}
+
+func createBatchForm(files []batchFile) (*bytes.Buffer, string) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for _, f := range files {
+		part, _ := writer.CreateFormFile("data", f.name)
+		part.Write(f.content)
+	}
+	writer.Close()
+	return body, writer.FormDataContentType()
+}
+
+func runBatchUpload(t *testing.T, handler *upload.Handler, files []batchFile) (map[string]interface{}, int) {
+	body, contentType := createBatchForm(files)
+
+	e := echo.New()
+	c, rec := createUploadTestContext(e, http.MethodPost, "/api/uploads/batch", body, contentType)
+	c.Set("user", &auth.TokenClaims{UserID: 1, Username: "testuser"})
+
+	if err := handler.UploadBatch(c); err != nil {
+		t.Fatalf("UploadBatch returned error: %v", err)
+	}
+
+	resp, _ := parseUploadResponse(rec.Body.Bytes())
+	return getUploadDataMap(resp), rec.Code
+}
+
+func TestUploadBatch_PartialSuccess(t *testing.T) {
+	useUploadStorage(t, t.TempDir())
+
+	handler, mockRepo := setupUploadTestHandler()
+	data, code := runBatchUpload(t, handler, []batchFile{
+		{name: "a.png", content: createTestImageContent()},
+		{name: "notes.txt", content: []byte("This is not an image")},
+		{name: "b.png", content: createTestImageContent()},
+	})
+
+	if code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, code)
+	}
+	if data["succeeded"] != float64(2) || data["failed"] != float64(1) {
+		t.Errorf("Expected 2 succeeded and 1 failed, got %v/%v", data["succeeded"], data["failed"])
+	}
+
+	results, _ := data["results"].([]interface{})
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	second := results[1].(map[string]interface{})
+	if second["success"] != false || second["original_filename"] != "notes.txt" {
+		t.Errorf("Expected second file to fail, got %v", second)
+	}
+	if errInfo, _ := second["error"].(map[string]interface{}); errInfo["message"] != upload.ErrInvalidContentType.Error() {
+		t.Errorf("Expected invalid content type error, got %v", second["error"])
+	}
+
+	if mockRepo.BatchCalls != 1 {
+		t.Errorf("Expected a single batch insert, got %d", mockRepo.BatchCalls)
+	}
+	if uploads, _ := mockRepo.GetFileUploadsByUserID(1); len(uploads) != 2 {
+		t.Errorf("Expected 2 uploads saved, got %d", len(uploads))
+	}
+}
+
+func TestUploadBatch_NoFiles(t *testing.T) {
+	useUploadStorage(t, t.TempDir())
+
+	handler, _ := setupUploadTestHandler()
+	_, code := runBatchUpload(t, handler, nil)
+
+	if code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, code)
+	}
+}
+
+func TestUploadBatch_TransactionFailureRemovesFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	useUploadStorage(t, tempDir)
+
+	handler, mockRepo := setupUploadTestHandler()
+	mockRepo.CreateBatchError = errors.New("db down")
+
+	_, code := runBatchUpload(t, handler, []batchFile{
+		{name: "a.png", content: createTestImageContent()},
+		{name: "b.png", content: createTestImageContent()},
+	})
+
+	if code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, code)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(tempDir, "images")); len(entries) != 0 {
+		t.Errorf("Expected stored files to be removed, got %d", len(entries))
+	}
+}
+
+func TestUploadBatch_RejectsOversizeRequest(t *testing.T) {
+	useUploadStorage(t, t.TempDir())
+
+	handler, _ := setupUploadTestHandler()
+	body, contentType := createBatchForm([]batchFile{{name: "a.png", content: createTestImageContent()}})
+
+	e := echo.New()
+	c, rec := createUploadTestContext(e, http.MethodPost, "/api/uploads/batch", body, contentType)
+	c.Request().ContentLength = upload.MaxBatchSize + 1
+	c.Set("user", &auth.TokenClaims{UserID: 1, Username: "testuser"})
+
+	_ = handler.UploadBatch(c)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"net/http"
+	"testing"
+
+	"elotus_test/server/env"
+	"elotus_test/server/models/upload"
+	"elotus_test/server/response"
+)
+
+func useUploadLimits(t *testing.T, limits env.Upload) {
+	previous := env.E
+	limits.StoragePath = t.TempDir()
+	env.E = &env.ENV{Upload: &limits}
+	t.Cleanup(func() { env.E = previous })
+}
+
+// createPNGHeader builds a PNG whose IHDR declares the given size but carries no pixel data
+func createPNGHeader(width, height uint32) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A})
+
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:4], width)
+	binary.BigEndian.PutUint32(ihdr[4:8], height)
+	ihdr[8] = 8 // bit depth
+	ihdr[9] = 2 // RGB
+
+	binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)))
+	chunk := append([]byte("IHDR"), ihdr...)
+	buf.Write(chunk)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+	return buf.Bytes()
+}
+
+func createAnimatedGIF(t *testing.T, frames int) []byte {
+	return createSizedGIF(t, frames, 4)
+}
+
+func createSizedGIF(t *testing.T, frames, size int) []byte {
+	palette := color.Palette{color.Black, color.White}
+	anim := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, size, size), palette)
+		frame.SetColorIndex(i%4, 0, 1)
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 10)
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatalf("Failed to encode gif: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestUploadLimits_RejectsDeclaredHugeDimensions(t *testing.T) {
+	useUploadLimits(t, env.Upload{})
+
+	rec := runSingleUpload(t, "bomb.png", createPNGHeader(100000, 100000))
+
+	expectUploadErrorCode(t, rec, response.ErrCodeImageTooLarge)
+}
+
+func TestUploadLimits_RejectsWidthOverConfiguredMax(t *testing.T) {
+	useUploadLimits(t, env.Upload{MaxImageWidth: 32})
+
+	rec := runSingleUpload(t, "wide.png", encodeTestImage(t, "png", 64, 8))
+
+	expectUploadErrorCode(t, rec, response.ErrCodeImageTooLarge)
+}
+
+func TestUploadLimits_RejectsTooManyPixels(t *testing.T) {
+	useUploadLimits(t, env.Upload{MaxImageMegapixels: 0.0001})
+
+	rec := runSingleUpload(t, "square.png", encodeTestImage(t, "png", 20, 20))
+
+	expectUploadErrorCode(t, rec, response.ErrCodeImageTooManyPixels)
+}
+
+func TestUploadLimits_RejectsOverDecodeBudget(t *testing.T) {
+	useUploadLimits(t, env.Upload{MaxImageWidth: 100000, MaxImageHeight: 100000, MaxImageMegapixels: 10000, DecodeMemoryMB: 1})
+
+	rec := runSingleUpload(t, "large.png", createPNGHeader(1000, 1000))
+
+	expectUploadErrorCode(t, rec, response.ErrCodeDecodeBudgetExceeded)
+}
+
+func TestUploadLimits_FrameCount(t *testing.T) {
+	useUploadLimits(t, env.Upload{MaxImageFrames: 3})
+
+	rec := runSingleUpload(t, "anim.gif", createAnimatedGIF(t, 5))
+	expectUploadErrorCode(t, rec, response.ErrCodeImageTooManyFrames)
+
+	rec = runSingleUpload(t, "anim.gif", createAnimatedGIF(t, 3))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d for 3 frames, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+}
+
+func TestUploadLimits_DecodeBudgetCountsFrames(t *testing.T) {
+	useUploadLimits(t, env.Upload{DecodeMemoryMB: 1})
+
+	// Each 300x300 frame decodes to 360 KB, so two fit in 1 MB and three do not
+	rec := runSingleUpload(t, "anim.gif", createSizedGIF(t, 2, 300))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d for 2 frames, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	rec = runSingleUpload(t, "anim.gif", createSizedGIF(t, 3, 300))
+	expectUploadErrorCode(t, rec, response.ErrCodeDecodeBudgetExceeded)
+}
+
+func TestMemoryBudget_ReserveAndRelease(t *testing.T) {
+	budget := upload.NewMemoryBudget(100)
+
+	if err := budget.Reserve(60); err != nil {
+		t.Fatalf("Expected first reservation to succeed: %v", err)
+	}
+	if err := budget.Reserve(60); err != upload.ErrDecodeBudgetExceeded {
+		t.Errorf("Expected budget exceeded, got %v", err)
+	}
+
+	budget.Release(60)
+	if err := budget.Reserve(100); err != nil {
+		t.Errorf("Expected reservation after release to succeed: %v", err)
+	}
+}
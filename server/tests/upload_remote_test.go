@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"elotus_test/server/env"
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/upload"
+
+	"github.com/labstack/echo/v4"
+)
+
+func useRemoteImport(t *testing.T, allowPrivateIP bool) {
+	previous := env.E
+	env.E = &env.ENV{Upload: &env.Upload{
+		StoragePath:          t.TempDir(),
+		RemoteMaxRedirects:   2,
+		RemoteAllowPrivateIP: allowPrivateIP,
+	}}
+	t.Cleanup(func() { env.E = previous })
+}
+
+func runImportFromURL(t *testing.T, handler *upload.Handler, url string) *httptest.ResponseRecorder {
+	e := echo.New()
+	body := strings.NewReader(`{"url":"` + url + `"}`)
+	c, rec := createUploadTestContext(e, http.MethodPost, "/api/uploads/from-url", body, echo.MIMEApplicationJSON)
+	c.Set("user", &auth.TokenClaims{UserID: 1, Username: "testuser"})
+
+	if err := handler.ImportFromURL(c); err != nil {
+		t.Fatalf("ImportFromURL returned error: %v", err)
+	}
+	return rec
+}
+
+func newImageServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cat.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(createTestImageContent())
+	})
+	mux.HandleFunc("/notes.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("This is not an image"))
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/big.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "99999999")
+		w.Write(createTestImageContent())
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestImportFromURL_Success(t *testing.T) {
+	useRemoteImport(t, true)
+	server := newImageServer()
+	defer server.Close()
+
+	handler, mockRepo := setupUploadTestHandler()
+	rec := runImportFromURL(t, handler, server.URL+"/cat.png")
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	stored, found := mockRepo.GetFileUploadByID(1)
+	if !found {
+		t.Fatal("Expected upload metadata to be saved")
+	}
+	if stored.SourceURL != server.URL+"/cat.png" {
+		t.Errorf("Expected source URL to be recorded, got %q", stored.SourceURL)
+	}
+	if stored.OriginalFilename != "cat.png" {
+		t.Errorf("Expected original filename 'cat.png', got %q", stored.OriginalFilename)
+	}
+}
+
+func TestImportFromURL_BlocksLoopback(t *testing.T) {
+	useRemoteImport(t, false)
+	server := newImageServer()
+	defer server.Close()
+
+	handler, mockRepo := setupUploadTestHandler()
+	rec := runImportFromURL(t, handler, server.URL+"/cat.png")
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	resp, _ := parseUploadResponse(rec.Body.Bytes())
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "private or loopback") {
+		t.Errorf("Expected SSRF error, got %v", resp.Error)
+	}
+	if uploads, _ := mockRepo.GetFileUploadsByUserID(1); len(uploads) != 0 {
+		t.Errorf("Expected no uploads, got %d", len(uploads))
+	}
+}
+
+func TestImportFromURL_RejectsInvalidScheme(t *testing.T) {
+	useRemoteImport(t, true)
+
+	handler, _ := setupUploadTestHandler()
+	rec := runImportFromURL(t, handler, "file:///etc/passwd")
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestImportFromURL_RedirectLimit(t *testing.T) {
+	useRemoteImport(t, true)
+	server := newImageServer()
+	defer server.Close()
+
+	handler, _ := setupUploadTestHandler()
+	rec := runImportFromURL(t, handler, server.URL+"/loop")
+
+	resp, _ := parseUploadResponse(rec.Body.Bytes())
+	if rec.Code != http.StatusBadRequest || resp.Error == nil || resp.Error.Message != upload.ErrTooManyRedirects.Error() {
+		t.Errorf("Expected redirect limit error, got %d %v", rec.Code, resp.Error)
+	}
+}
+
+func TestImportFromURL_RejectsNonImage(t *testing.T) {
+	useRemoteImport(t, true)
+	server := newImageServer()
+	defer server.Close()
+
+	handler, _ := setupUploadTestHandler()
+	rec := runImportFromURL(t, handler, server.URL+"/notes.txt")
+
+	resp, _ := parseUploadResponse(rec.Body.Bytes())
+	if rec.Code != http.StatusBadRequest || resp.Error == nil || resp.Error.Message != upload.ErrInvalidContentType.Error() {
+		t.Errorf("Expected content type error, got %d %v", rec.Code, resp.Error)
+	}
+}
+
+func TestImportFromURL_RejectsDeclaredOversize(t *testing.T) {
+	useRemoteImport(t, true)
+	server := newImageServer()
+	defer server.Close()
+
+	handler, _ := setupUploadTestHandler()
+	rec := runImportFromURL(t, handler, server.URL+"/big.png")
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
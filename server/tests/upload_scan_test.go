@@ -0,0 +1,204 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/upload"
+
+	"github.com/labstack/echo/v4"
+)
+
+// startFakeClamd answers INSTREAM requests with the given reply and reports the bytes it received
+func startFakeClamd(t *testing.T, network, address, reply string) (net.Listener, <-chan []byte) {
+	t.Helper()
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		cmd, err := r.ReadString(0)
+		if err != nil || cmd != "zINSTREAM\x00" {
+			conn.Write([]byte("UNKNOWN COMMAND ERROR\x00"))
+			return
+		}
+
+		var data []byte
+		for {
+			var size uint32
+			if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+				return
+			}
+			if size == 0 {
+				break
+			}
+			chunk := make([]byte, size)
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				return
+			}
+			data = append(data, chunk...)
+		}
+		received <- data
+		conn.Write([]byte(reply + "\x00"))
+	}()
+
+	return ln, received
+}
+
+func uploadWithScanner(t *testing.T, scanner upload.Scanner) (*upload.Handler, *MockUploadRepository, map[string]interface{}) {
+	t.Helper()
+	handler, mockRepo := setupUploadTestHandler()
+	handler.SetScanner(scanner)
+
+	body, contentType := createMultipartForm("data", "test.png", createTestImageContent())
+	e := echo.New()
+	c, rec := createUploadTestContext(e, http.MethodPost, "/api/upload", body, contentType)
+	c.Set("user", &auth.TokenClaims{UserID: 1, Username: "testuser"})
+
+	if err := handler.Upload(c); err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	resp, _ := parseUploadResponse(rec.Body.Bytes())
+	return handler, mockRepo, getUploadDataMap(resp)
+}
+
+func serveMedia(handler *upload.Handler, name string) error {
+	e := echo.New()
+	c, _ := createUploadTestContext(e, http.MethodGet, "/media/"+name, nil, "")
+	c.SetParamNames("*")
+	c.SetParamValues(name)
+	return handler.ServeMedia(c)
+}
+
+func TestClamdScanner_StreamsOverTCP(t *testing.T) {
+	ln, received := startFakeClamd(t, "tcp", "127.0.0.1:0", "stream: OK")
+
+	scanner := upload.NewClamdScanner("tcp", ln.Addr().String(), 5*time.Second)
+	content := strings.Repeat("a", 100*1024)
+	result, err := scanner.Scan(context.Background(), strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if !result.Clean {
+		t.Error("Expected clean result")
+	}
+	if data := <-received; string(data) != content {
+		t.Errorf("Expected clamd to receive %d bytes, got %d", len(content), len(data))
+	}
+}
+
+func TestClamdScanner_ReportsSignature(t *testing.T) {
+	ln, _ := startFakeClamd(t, "tcp", "127.0.0.1:0", "stream: Eicar-Signature FOUND")
+
+	scanner := upload.NewClamdScanner("tcp", ln.Addr().String(), 5*time.Second)
+	result, err := scanner.Scan(context.Background(), strings.NewReader("data"))
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if result.Clean || result.Signature != "Eicar-Signature" {
+		t.Errorf("Expected Eicar-Signature, got %+v", result)
+	}
+}
+
+func TestParseScannerAddress(t *testing.T) {
+	tests := []struct {
+		addr    string
+		network string
+		address string
+	}{
+		{"unix:///var/run/clamd.sock", "unix", "/var/run/clamd.sock"},
+		{"tcp://clamav:3310", "tcp", "clamav:3310"},
+		{"localhost:3310", "tcp", "localhost:3310"},
+	}
+
+	for _, tt := range tests {
+		network, address := upload.ParseScannerAddress(tt.addr)
+		if network != tt.network || address != tt.address {
+			t.Errorf("ParseScannerAddress(%q) = %s %s, want %s %s", tt.addr, network, address, tt.network, tt.address)
+		}
+	}
+}
+
+func TestUploadScan_CleanFileIsServed(t *testing.T) {
+	tempDir := t.TempDir()
+	useUploadStorage(t, tempDir)
+
+	socket := filepath.Join(tempDir, "clamd.sock")
+	startFakeClamd(t, "unix", socket, "stream: OK")
+
+	handler, _, data := uploadWithScanner(t, upload.NewClamdScanner("unix", socket, 5*time.Second))
+	if data["status"] != upload.StatusClean {
+		t.Errorf("Expected status %s, got %v", upload.StatusClean, data["status"])
+	}
+
+	if err := serveMedia(handler, "images/"+data["filename"].(string)); err != nil {
+		t.Errorf("Expected clean file to be served, got %v", err)
+	}
+}
+
+func TestUploadScan_InfectedFileIsQuarantined(t *testing.T) {
+	tempDir := t.TempDir()
+	useUploadStorage(t, tempDir)
+
+	ln, _ := startFakeClamd(t, "tcp", "127.0.0.1:0", "stream: Eicar-Signature FOUND")
+
+	handler, mockRepo, data := uploadWithScanner(t, upload.NewClamdScanner("tcp", ln.Addr().String(), 5*time.Second))
+	if data["status"] != upload.StatusQuarantined {
+		t.Errorf("Expected status %s, got %v", upload.StatusQuarantined, data["status"])
+	}
+
+	filename := data["filename"].(string)
+	if _, err := os.Stat(filepath.Join(tempDir, "images", filename)); !os.IsNotExist(err) {
+		t.Error("Infected file should have been moved out of the media folder")
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "quarantine", filename)); err != nil {
+		t.Errorf("Expected file in quarantine: %v", err)
+	}
+
+	stored, _ := mockRepo.GetFileUploadByFilename(filename)
+	if stored.Status != upload.StatusQuarantined {
+		t.Errorf("Expected stored status %s, got %s", upload.StatusQuarantined, stored.Status)
+	}
+
+	if err := serveMedia(handler, "quarantine/"+filename); err != echo.ErrNotFound {
+		t.Errorf("Expected quarantined file to be hidden, got %v", err)
+	}
+}
+
+func TestUploadScan_ScannerUnavailableLeavesPending(t *testing.T) {
+	tempDir := t.TempDir()
+	useUploadStorage(t, tempDir)
+
+	socket := filepath.Join(tempDir, "missing.sock")
+	handler, _, data := uploadWithScanner(t, upload.NewClamdScanner("unix", socket, time.Second))
+	if data["status"] != upload.StatusPending {
+		t.Errorf("Expected status %s, got %v", upload.StatusPending, data["status"])
+	}
+
+	if err := serveMedia(handler, "images/"+data["filename"].(string)); err != echo.ErrNotFound {
+		t.Errorf("Expected pending file to be hidden, got %v", err)
+	}
+}
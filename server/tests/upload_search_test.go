@@ -0,0 +1,203 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/upload"
+
+	"github.com/labstack/echo/v4"
+)
+
+func setupSearchTest() (*upload.Handler, *MockUploadRepository) {
+	handler, repo := setupUploadTestHandler()
+	now := time.Now()
+	repo.AddUpload(&upload.FileUpload{ID: 1, UserID: 1, OriginalFilename: "beach-sunset.png", Caption: "Evening at the coast", Tags: []string{"holiday", "beach"}, CreatedAt: now.Add(-3 * time.Hour)})
+	repo.AddUpload(&upload.FileUpload{ID: 2, UserID: 1, OriginalFilename: "mountain.jpg", Tags: []string{"holiday", "hiking"}, CreatedAt: now.Add(-2 * time.Hour)})
+	repo.AddUpload(&upload.FileUpload{ID: 3, UserID: 1, OriginalFilename: "receipt.png", Tags: []string{}, CreatedAt: now.Add(-time.Hour)})
+	repo.AddUpload(&upload.FileUpload{ID: 4, UserID: 2, OriginalFilename: "beach.png", Tags: []string{"holiday"}, CreatedAt: now})
+	return handler, repo
+}
+
+func TestNormalizeTags(t *testing.T) {
+	tags, err := upload.NormalizeTags([]string{" Holiday ", "holiday", "Road  Trip", "", "2024"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Join(tags, ",") != "holiday,road trip,2024" {
+		t.Errorf("Unexpected tags: %v", tags)
+	}
+
+	if _, err := upload.NormalizeTags([]string{"<script>"}); err != upload.ErrInvalidTag {
+		t.Errorf("Expected ErrInvalidTag, got %v", err)
+	}
+	if _, err := upload.NormalizeTags([]string{strings.Repeat("a", upload.MaxTagLength+1)}); err != upload.ErrTagTooLong {
+		t.Errorf("Expected ErrTagTooLong, got %v", err)
+	}
+	many := make([]string, upload.MaxTags+1)
+	for i := range many {
+		many[i] = strings.Repeat("t", i+1)
+	}
+	if _, err := upload.NormalizeTags(many); err != upload.ErrTooManyTags {
+		t.Errorf("Expected ErrTooManyTags, got %v", err)
+	}
+}
+
+func TestSearchUploads_TextAndFacets(t *testing.T) {
+	handler, _ := setupSearchTest()
+
+	rec := callAlbum(t, handler.SearchUploads, http.MethodGet, "/api/uploads/search?q=beach", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	resp, _ := parseResponse(rec.Body.Bytes())
+	data := getDataMap(resp)
+	results := data["results"].([]interface{})
+	if len(results) != 1 || results[0].(map[string]interface{})["id"].(float64) != 1 {
+		t.Fatalf("Expected only the caller's beach upload, got %v", results)
+	}
+	if resp.Meta == nil || resp.Meta.Total != 1 {
+		t.Errorf("Expected total 1, got %+v", resp.Meta)
+	}
+
+	facets := data["facets"].(map[string]interface{})["tags"].([]interface{})
+	if len(facets) != 2 {
+		t.Fatalf("Expected 2 tag facets, got %v", facets)
+	}
+}
+
+func TestSearchUploads_TagFilter(t *testing.T) {
+	handler, _ := setupSearchTest()
+
+	rec := callAlbum(t, handler.SearchUploads, http.MethodGet, "/api/uploads/search?tag=Holiday&per_page=1", "")
+	resp, _ := parseResponse(rec.Body.Bytes())
+	data := getDataMap(resp)
+
+	results := data["results"].([]interface{})
+	if len(results) != 1 || results[0].(map[string]interface{})["id"].(float64) != 2 {
+		t.Fatalf("Expected newest holiday upload first, got %v", results)
+	}
+	if resp.Meta.Total != 2 || resp.Meta.TotalPages != 2 {
+		t.Errorf("Expected 2 matches over 2 pages, got %+v", resp.Meta)
+	}
+
+	facets := data["facets"].(map[string]interface{})["tags"].([]interface{})
+	top := facets[0].(map[string]interface{})
+	if top["tag"] != "holiday" || top["count"].(float64) != 2 {
+		t.Errorf("Expected holiday facet with count 2 first, got %v", top)
+	}
+
+	rec = callAlbum(t, handler.SearchUploads, http.MethodGet, "/api/uploads/search?tag=holiday,hiking", "")
+	resp, _ = parseResponse(rec.Body.Bytes())
+	if resp.Meta.Total != 1 {
+		t.Errorf("Expected every tag to be required, got %d matches", resp.Meta.Total)
+	}
+}
+
+func TestSearchUploads_RequiresQuery(t *testing.T) {
+	handler, _ := setupSearchTest()
+
+	rec := callAlbum(t, handler.SearchUploads, http.MethodGet, "/api/uploads/search", "")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestSetTagsAndCaption(t *testing.T) {
+	handler, repo := setupSearchTest()
+
+	rec := callAlbum(t, handler.SetTags, http.MethodPut, "/api/uploads/3/tags", `{"tags":["Receipts","Tax 2024","receipts"]}`, "id", "3")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	rec = callAlbum(t, handler.SetCaption, http.MethodPut, "/api/uploads/3/caption", `{"caption":"  Dinner receipt  "}`, "id", "3")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	stored, _ := repo.GetFileUploadByID(3)
+	if strings.Join(stored.Tags, ",") != "receipts,tax 2024" || stored.Caption != "Dinner receipt" {
+		t.Errorf("Unexpected annotations: tags=%v caption=%q", stored.Tags, stored.Caption)
+	}
+
+	rec = callAlbum(t, handler.SearchUploads, http.MethodGet, "/api/uploads/search?q=dinner", "")
+	resp, _ := parseResponse(rec.Body.Bytes())
+	if resp.Meta.Total != 1 {
+		t.Errorf("Expected caption to be searchable, got %d matches", resp.Meta.Total)
+	}
+}
+
+func TestSetTags_Validation(t *testing.T) {
+	handler, _ := setupSearchTest()
+
+	rec := callAlbum(t, handler.SetTags, http.MethodPut, "/api/uploads/4/tags", `{"tags":["mine"]}`, "id", "4")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, rec.Code)
+	}
+
+	rec = callAlbum(t, handler.SetTags, http.MethodPut, "/api/uploads/1/tags", `{"tags":["a/b"]}`, "id", "1")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	rec = callAlbum(t, handler.SetCaption, http.MethodPut, "/api/uploads/1/caption", `{"caption":"`+strings.Repeat("x", upload.MaxCaptionLength+1)+`"}`, "id", "1")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+// staleReadRepository hands out the upload as it was before a concurrent edit
+type staleReadRepository struct {
+	*MockUploadRepository
+	stale *upload.FileUpload
+}
+
+func (r *staleReadRepository) GetFileUploadByID(id int64) (*upload.FileUpload, bool) {
+	copied := *r.stale
+	return &copied, true
+}
+
+func TestSetTags_KeepsConcurrentCaption(t *testing.T) {
+	_, repo := setupSearchTest()
+	stale, _ := repo.GetFileUploadByID(1)
+	caption := "Edited in another tab"
+	repo.UpdateFileUploadMetadata(1, 0, upload.MetadataUpdate{Caption: &caption})
+	handler := upload.NewHandler(nil, &staleReadRepository{MockUploadRepository: repo, stale: stale}, nil)
+
+	rec := callAlbum(t, handler.SetTags, http.MethodPut, "/api/uploads/1/tags", `{"tags":["sea"]}`, "id", "1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	stored, _ := repo.GetFileUploadByID(1)
+	if stored.Caption != caption || strings.Join(stored.Tags, ",") != "sea" || stored.Version != 3 {
+		t.Errorf("Expected only the tags to change, got caption=%q tags=%v version=%d", stored.Caption, stored.Tags, stored.Version)
+	}
+	if data := getDataMap(mustParse(t, rec)); data["caption"] != caption || rec.Header().Get("ETag") != `"3"` {
+		t.Errorf("Expected the stored upload in the response, got %v with ETag %s", data, rec.Header().Get("ETag"))
+	}
+
+	// With If-Match a write based on the stale copy is refused
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPut, "/api/uploads/1/caption", strings.NewReader(`{"caption":"Old"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("If-Match", upload.ETag(stale))
+	rec = httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	c.Set("user", &auth.TokenClaims{UserID: 1, Username: "testuser"})
+	if err := handler.SetCaption(c); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected status %d, got %d", http.StatusPreconditionFailed, rec.Code)
+	}
+	if stored, _ := repo.GetFileUploadByID(1); stored.Caption != caption {
+		t.Errorf("Expected the caption to be kept, got %q", stored.Caption)
+	}
+}
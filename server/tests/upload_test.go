@@ -2,6 +2,8 @@ package tests
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"io"
 	"mime/multipart"
@@ -12,6 +14,7 @@ import (
 	"testing"
 	"time"
 
+	"elotus_test/server/env"
 	"elotus_test/server/models/auth"
 	"elotus_test/server/models/upload"
 	"elotus_test/server/response"
@@ -396,8 +399,15 @@ func TestUploadMockRepository_Reset(t *testing.T) {
 	}
 }
 
+func useUploadStorage(t *testing.T, dir string) {
+	previous := env.E
+	env.E = &env.ENV{Upload: &env.Upload{StoragePath: dir}}
+	t.Cleanup(func() { env.E = previous })
+}
+
 func TestUpload_ValidImage(t *testing.T) {
 	tempDir := t.TempDir()
+	useUploadStorage(t, tempDir)
 
 	handler, _ := setupUploadTestHandler()
 
@@ -447,6 +457,170 @@ func TestValidateUploadFile_InvalidContentType(t *testing.T) {
 	_ = fileHeader
 }
 
+func TestUpload_StreamsAndHashes(t *testing.T) {
+	tempDir := t.TempDir()
+	useUploadStorage(t, tempDir)
+
+	handler, mockRepo := setupUploadTestHandler()
+	imgContent := createTestImageContent()
+	body, contentType := createMultipartForm("data", "test.png", imgContent)
+
+	e := echo.New()
+	c, rec := createUploadTestContext(e, http.MethodPost, "/api/upload", body, contentType)
+	c.Set("user", &auth.TokenClaims{UserID: 1, Username: "testuser"})
+
+	if err := handler.Upload(c); err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	sum := sha256.Sum256(imgContent)
+	expectedChecksum := hex.EncodeToString(sum[:])
+
+	resp, _ := parseUploadResponse(rec.Body.Bytes())
+	data := getUploadDataMap(resp)
+	if data["checksum"] != expectedChecksum {
+		t.Errorf("Expected checksum %s, got %v", expectedChecksum, data["checksum"])
+	}
+	if data["content_type"] != "image/png" {
+		t.Errorf("Expected content_type image/png, got %v", data["content_type"])
+	}
+	if _, leaked := data["temp_path"]; leaked {
+		t.Errorf("Expected the storage path to stay out of the response, got %v", data)
+	}
+
+	stored, found := mockRepo.GetFileUploadByID(1)
+	if !found {
+		t.Fatal("Expected upload metadata to be saved")
+	}
+	if stored.FileSize != int64(len(imgContent)) {
+		t.Errorf("Expected file size %d, got %d", len(imgContent), stored.FileSize)
+	}
+
+	written, err := os.ReadFile(stored.TempPath)
+	if err != nil {
+		t.Fatalf("Expected stored file: %v", err)
+	}
+	if !bytes.Equal(written, imgContent) {
+		t.Error("Stored file content does not match upload")
+	}
+}
+
+func TestUpload_SkipsOtherFieldsBeforeData(t *testing.T) {
+	useUploadStorage(t, t.TempDir())
+
+	handler, _ := setupUploadTestHandler()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("caption", "hello")
+	part, _ := writer.CreateFormFile("data", "test.png")
+	part.Write(createTestImageContent())
+	writer.Close()
+
+	e := echo.New()
+	c, rec := createUploadTestContext(e, http.MethodPost, "/api/upload", body, writer.FormDataContentType())
+	c.Set("user", &auth.TokenClaims{UserID: 1, Username: "testuser"})
+
+	_ = handler.Upload(c)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+}
+
+func TestUpload_MissingDataField(t *testing.T) {
+	useUploadStorage(t, t.TempDir())
+
+	handler, _ := setupUploadTestHandler()
+	body, contentType := createMultipartForm("other", "test.png", createTestImageContent())
+
+	e := echo.New()
+	c, rec := createUploadTestContext(e, http.MethodPost, "/api/upload", body, contentType)
+	c.Set("user", &auth.TokenClaims{UserID: 1, Username: "testuser"})
+
+	_ = handler.Upload(c)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	resp, _ := parseUploadResponse(rec.Body.Bytes())
+	if resp.Error == nil || resp.Error.Message != upload.ErrNoFileUploaded.Error() {
+		t.Errorf("Expected no file error, got %v", resp.Error)
+	}
+}
+
+func TestUpload_RejectsNonImage(t *testing.T) {
+	tempDir := t.TempDir()
+	useUploadStorage(t, tempDir)
+
+	handler, mockRepo := setupUploadTestHandler()
+	body, contentType := createMultipartForm("data", "test.txt", []byte("This is not an image"))
+
+	e := echo.New()
+	c, rec := createUploadTestContext(e, http.MethodPost, "/api/upload", body, contentType)
+	c.Set("user", &auth.TokenClaims{UserID: 1, Username: "testuser"})
+
+	_ = handler.Upload(c)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if uploads, _ := mockRepo.GetFileUploadsByUserID(1); len(uploads) != 0 {
+		t.Errorf("Expected no uploads to be saved, got %d", len(uploads))
+	}
+	if entries, _ := os.ReadDir(filepath.Join(tempDir, "images")); len(entries) != 0 {
+		t.Errorf("Expected no files on disk, got %d", len(entries))
+	}
+}
+
+func TestUpload_RejectsOversizeContentLength(t *testing.T) {
+	useUploadStorage(t, t.TempDir())
+
+	handler, _ := setupUploadTestHandler()
+	body, contentType := createMultipartForm("data", "test.png", createTestImageContent())
+
+	e := echo.New()
+	c, rec := createUploadTestContext(e, http.MethodPost, "/api/upload", body, contentType)
+	c.Request().ContentLength = upload.MaxFileSize * 2
+	c.Set("user", &auth.TokenClaims{UserID: 1, Username: "testuser"})
+
+	_ = handler.Upload(c)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestUpload_RejectsOversizeStream(t *testing.T) {
+	tempDir := t.TempDir()
+	useUploadStorage(t, tempDir)
+
+	handler, mockRepo := setupUploadTestHandler()
+	content := append(createTestImageContent(), make([]byte, upload.MaxFileSize)...)
+	body, contentType := createMultipartForm("data", "big.png", content)
+
+	e := echo.New()
+	c, rec := createUploadTestContext(e, http.MethodPost, "/api/upload", body, contentType)
+	// Simulate a chunked request where the size is unknown up front
+	c.Request().ContentLength = -1
+	c.Set("user", &auth.TokenClaims{UserID: 1, Username: "testuser"})
+
+	_ = handler.Upload(c)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if uploads, _ := mockRepo.GetFileUploadsByUserID(1); len(uploads) != 0 {
+		t.Errorf("Expected no uploads to be saved, got %d", len(uploads))
+	}
+	if entries, _ := os.ReadDir(filepath.Join(tempDir, "images")); len(entries) != 0 {
+		t.Errorf("Expected partial file to be removed, got %d files", len(entries))
+	}
+}
+
 func BenchmarkGetUserUploads(b *testing.B) {
 	handler, mockRepo := setupUploadTestHandler()
 
@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/upload"
+	"elotus_test/server/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+func patchUpload(t *testing.T, handler *upload.Handler, userID int64, id, ifMatch, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPatch, "/api/uploads/"+id, bytes.NewBufferString(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues(id)
+	c.Set("user", &auth.TokenClaims{UserID: userID, Username: "testuser"})
+
+	if err := handler.UpdateUpload(c); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+	return rec
+}
+
+func setupUpdateTest() (*upload.Handler, *MockUploadRepository) {
+	handler, repo := setupUploadTestHandler()
+	repo.AddUpload(&upload.FileUpload{ID: 1, UserID: 1, OriginalFilename: "IMG_0001.jpg"})
+	return handler, repo
+}
+
+func TestUpdateUpload_Success(t *testing.T) {
+	handler, repo := setupUpdateTest()
+
+	rec := patchUpload(t, handler, 1, "1", `"1"`, `{"display_name":" Sunset ","alt_text":"Orange sky over the sea","visibility":"public"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("ETag") != `"2"` {
+		t.Errorf("Expected ETag \"2\", got %q", rec.Header().Get("ETag"))
+	}
+
+	data := getDataMap(mustParse(t, rec))
+	if data["display_name"] != "Sunset" || data["original_filename"] != "IMG_0001.jpg" || data["visibility"] != "public" {
+		t.Errorf("Unexpected response: %v", data)
+	}
+
+	stored, _ := repo.GetFileUploadByID(1)
+	if stored.AltText != "Orange sky over the sea" || stored.Version != 2 {
+		t.Errorf("Expected update to be stored, got %+v", stored)
+	}
+
+	// An empty string clears the display name back to the original filename
+	rec = patchUpload(t, handler, 1, "1", `W/"2"`, `{"display_name":""}`)
+	if data := getDataMap(mustParse(t, rec)); data["display_name"] != "IMG_0001.jpg" {
+		t.Errorf("Expected display name to fall back to original filename, got %v", data["display_name"])
+	}
+}
+
+func TestUpdateUpload_RequiresIfMatch(t *testing.T) {
+	handler, _ := setupUpdateTest()
+
+	rec := patchUpload(t, handler, 1, "1", "", `{"caption":"hi"}`)
+	if rec.Code != http.StatusPreconditionRequired {
+		t.Errorf("Expected status %d, got %d", http.StatusPreconditionRequired, rec.Code)
+	}
+
+	rec = patchUpload(t, handler, 1, "1", "*", `{"caption":"hi"}`)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected wildcard If-Match to succeed, got %d", rec.Code)
+	}
+}
+
+func TestUpdateUpload_StaleVersion(t *testing.T) {
+	handler, repo := setupUpdateTest()
+
+	patchUpload(t, handler, 1, "1", `"1"`, `{"caption":"first"}`)
+	rec := patchUpload(t, handler, 1, "1", `"1"`, `{"caption":"second"}`)
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("Expected status %d, got %d", http.StatusPreconditionFailed, rec.Code)
+	}
+	if rec.Header().Get("ETag") != `"2"` {
+		t.Errorf("Expected current ETag in conflict response, got %q", rec.Header().Get("ETag"))
+	}
+
+	stored, _ := repo.GetFileUploadByID(1)
+	if stored.Caption != "first" {
+		t.Errorf("Expected stale write to be rejected, caption is %q", stored.Caption)
+	}
+}
+
+func TestUpdateUpload_Validation(t *testing.T) {
+	handler, _ := setupUpdateTest()
+
+	cases := []string{
+		`{}`,
+		`{"visibility":"friends"}`,
+		`{"display_name":"../etc/passwd"}`,
+	}
+	for _, body := range cases {
+		if rec := patchUpload(t, handler, 1, "1", "*", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", body, http.StatusBadRequest, rec.Code)
+		}
+	}
+
+	if rec := patchUpload(t, handler, 2, "1", "*", `{"caption":"mine now"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for non-owner, got %d", http.StatusForbidden, rec.Code)
+	}
+}
+
+func TestGetUploadByID_PublicVisibility(t *testing.T) {
+	tempDir := t.TempDir()
+	useUploadStorage(t, tempDir)
+	handler, repo := setupUploadTestHandler()
+	repo.AddUpload(&upload.FileUpload{ID: 1, UserID: 1, OriginalFilename: "IMG_0001.jpg", TempPath: filepath.Join(tempDir, "images", "1_abc.jpg")})
+
+	get := func() *httptest.ResponseRecorder {
+		e := echo.New()
+		c, rec := createUploadTestContext(e, http.MethodGet, "/api/uploads/1", nil, "")
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+		c.Set("user", &auth.TokenClaims{UserID: 2, Username: "other"})
+		handler.GetUploadByID(c)
+		return rec
+	}
+
+	if rec := get(); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected private upload to be hidden, got %d", rec.Code)
+	}
+	patchUpload(t, handler, 1, "1", "*", `{"visibility":"public"}`)
+	rec := get()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected public upload to be readable, got %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), tempDir) {
+		t.Errorf("Expected no storage path in the public view, got %s", rec.Body.String())
+	}
+	if data := getDataMap(mustParse(t, rec)); data["url"] != "/media/images/1_abc.jpg" {
+		t.Errorf("Expected the media URL, got %v", data["url"])
+	}
+}
+
+func mustParse(t *testing.T, rec *httptest.ResponseRecorder) *response.Response {
+	t.Helper()
+	resp, err := parseResponse(rec.Body.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	return resp
+}
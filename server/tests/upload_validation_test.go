@@ -0,0 +1,178 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"elotus_test/server/env"
+	"elotus_test/server/models/auth"
+	"elotus_test/server/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+func encodeTestImage(t *testing.T, format string, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		img.Set(x, 0, color.RGBA{R: uint8(x), A: 255})
+	}
+
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	default:
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		t.Fatalf("Failed to encode %s: %v", format, err)
+	}
+	return buf.Bytes()
+}
+
+func runSingleUpload(t *testing.T, fileName string, content []byte) *httptest.ResponseRecorder {
+	handler, _ := setupUploadTestHandler()
+	body, contentType := createMultipartForm("data", fileName, content)
+
+	e := echo.New()
+	c, rec := createUploadTestContext(e, http.MethodPost, "/api/upload", body, contentType)
+	c.Set("user", &auth.TokenClaims{UserID: 1, Username: "testuser"})
+
+	if err := handler.Upload(c); err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+	return rec
+}
+
+func expectUploadErrorCode(t *testing.T, rec *httptest.ResponseRecorder, code string) {
+	t.Helper()
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	resp, _ := parseUploadResponse(rec.Body.Bytes())
+	if resp.Error == nil || resp.Error.Code != code {
+		t.Errorf("Expected error code %s, got %v", code, resp.Error)
+	}
+}
+
+func TestUploadValidation_AcceptsJPEG(t *testing.T) {
+	useUploadStorage(t, t.TempDir())
+
+	rec := runSingleUpload(t, "photo.jpeg", encodeTestImage(t, "jpeg", 16, 16))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	resp, _ := parseUploadResponse(rec.Body.Bytes())
+	if data := getUploadDataMap(resp); data["content_type"] != "image/jpeg" {
+		t.Errorf("Expected image/jpeg, got %v", data["content_type"])
+	}
+}
+
+func TestUploadValidation_RejectsSVG(t *testing.T) {
+	useUploadStorage(t, t.TempDir())
+
+	svg := []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`)
+	rec := runSingleUpload(t, "logo.svg", svg)
+
+	expectUploadErrorCode(t, rec, response.ErrCodeNotAnImage)
+}
+
+func TestUploadValidation_RejectsExtensionMismatch(t *testing.T) {
+	useUploadStorage(t, t.TempDir())
+
+	rec := runSingleUpload(t, "photo.jpg", encodeTestImage(t, "png", 4, 4))
+
+	expectUploadErrorCode(t, rec, response.ErrCodeExtensionMismatch)
+}
+
+func TestUploadValidation_RejectsTypeOutsideAllowlist(t *testing.T) {
+	previous := env.E
+	env.E = &env.ENV{Upload: &env.Upload{
+		StoragePath:         t.TempDir(),
+		AllowedContentTypes: []string{"image/jpeg"},
+	}}
+	t.Cleanup(func() { env.E = previous })
+
+	rec := runSingleUpload(t, "image.png", encodeTestImage(t, "png", 4, 4))
+
+	expectUploadErrorCode(t, rec, response.ErrCodeContentTypeNotAllowed)
+}
+
+func TestUploadValidation_RejectsMalformedHeader(t *testing.T) {
+	useUploadStorage(t, t.TempDir())
+
+	content := append([]byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A}, []byte("garbage-not-an-ihdr-chunk")...)
+	rec := runSingleUpload(t, "broken.png", content)
+
+	expectUploadErrorCode(t, rec, response.ErrCodeMalformedImage)
+}
+
+func TestUploadValidation_RejectsPolyglot(t *testing.T) {
+	tempDir := t.TempDir()
+	useUploadStorage(t, tempDir)
+
+	content := append(encodeTestImage(t, "png", 4, 4), []byte("<SCRIPT>alert(document.cookie)</SCRIPT>")...)
+	rec := runSingleUpload(t, "image.png", content)
+
+	expectUploadErrorCode(t, rec, response.ErrCodeEmbeddedContent)
+}
+
+// withPNGChunk inserts a chunk right after IHDR
+func withPNGChunk(content []byte, chunkType string, data []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, data...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	// 8-byte signature, then IHDR: length, type, 13 bytes of data and the CRC
+	at := 8 + 8 + 13 + 4
+	return append(append(append([]byte{}, content[:at]...), chunk...), content[at:]...)
+}
+
+func TestUploadValidation_RejectsMarkupInMetadata(t *testing.T) {
+	useUploadStorage(t, t.TempDir())
+
+	png := withPNGChunk(encodeTestImage(t, "png", 4, 4), "tEXt", []byte("Comment\x00<script>alert(1)</script>"))
+	expectUploadErrorCode(t, runSingleUpload(t, "image.png", png), response.ErrCodeEmbeddedContent)
+
+	// A JPEG comment segment right after SOI
+	jpg := encodeTestImage(t, "jpeg", 8, 8)
+	comment := []byte("<?php system($_GET['c']); ?>")
+	segment := append([]byte{0xFF, 0xFE}, binary.BigEndian.AppendUint16(nil, uint16(len(comment)+2))...)
+	jpg = append(append(append([]byte{}, jpg[:2]...), append(segment, comment...)...), jpg[2:]...)
+	expectUploadErrorCode(t, runSingleUpload(t, "photo.jpg", jpg), response.ErrCodeEmbeddedContent)
+
+	trailing := append(encodeTestImage(t, "jpeg", 8, 8), []byte("<html><body>hi</body></html>")...)
+	expectUploadErrorCode(t, runSingleUpload(t, "photo.jpg", trailing), response.ErrCodeEmbeddedContent)
+}
+
+func TestUploadValidation_IgnoresMarkersInPixelData(t *testing.T) {
+	useUploadStorage(t, t.TempDir())
+
+	// Uncompressed, unfiltered NRGBA rows store these bytes verbatim in IDAT
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{R: '<', G: 's', B: 'v', A: 'g'})
+	img.SetNRGBA(1, 0, color.NRGBA{R: '<', G: 'S', B: 'V', A: 'G'})
+	var buf bytes.Buffer
+	if err := (&png.Encoder{CompressionLevel: png.NoCompression}).Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("<svg")) {
+		t.Fatal("Expected the marker bytes in the encoded pixel data")
+	}
+
+	rec := runSingleUpload(t, "pixels.png", buf.Bytes())
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+}
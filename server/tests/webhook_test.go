@@ -0,0 +1,327 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"elotus_test/server/models/auth"
+	"elotus_test/server/models/events"
+	"elotus_test/server/models/upload"
+	"elotus_test/server/models/webhook"
+	"elotus_test/server/netguard"
+
+	"github.com/labstack/echo/v4"
+)
+
+var _ webhook.Repository = (*MockWebhookRepository)(nil)
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+// newWebhookReceiver records requests and answers with the given status codes in order, then 200
+func newWebhookReceiver(t *testing.T, statuses ...int) (*httptest.Server, func() []receivedWebhook) {
+	var mu sync.Mutex
+	var received []receivedWebhook
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		mu.Lock()
+		received = append(received, receivedWebhook{header: r.Header.Clone(), body: body})
+		n := len(received)
+		mu.Unlock()
+
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []receivedWebhook {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]receivedWebhook(nil), received...)
+	}
+}
+
+func setupWebhooks(t *testing.T) (*events.Bus, *MockWebhookRepository, *webhook.Dispatcher) {
+	repo := NewMockWebhookRepository()
+	queue := newTestQueue(NewMockJobRepository())
+	dispatcher := webhook.NewDispatcher(repo, queue, webhook.NewClient(time.Second, true))
+	queue.Start()
+	t.Cleanup(func() { queue.Shutdown(context.Background()) })
+
+	bus := events.NewBus()
+	bus.Subscribe(dispatcher.HandleEvent)
+	return bus, repo, dispatcher
+}
+
+func addSubscription(repo *MockWebhookRepository, userID *int64, url string, eventTypes ...string) *webhook.Subscription {
+	sub, _ := repo.CreateSubscription(&webhook.Subscription{
+		UserID: userID,
+		URL:    url,
+		Secret: "test-secret",
+		Events: eventTypes,
+		Active: true,
+	})
+	return sub
+}
+
+func TestWebhook_DeliversSignedPayload(t *testing.T) {
+	server, received := newWebhookReceiver(t)
+	bus, repo, _ := setupWebhooks(t)
+
+	userID := int64(1)
+	addSubscription(repo, &userID, server.URL, events.UploadCreated)
+
+	bus.Publish(events.UploadCreated, userID, map[string]interface{}{"id": 42})
+	waitFor(t, func() bool { return len(received()) == 1 })
+
+	req := received()[0]
+	timestamp, _ := strconv.ParseInt(req.header.Get(webhook.HeaderTimestamp), 10, 64)
+	if got, want := req.header.Get(webhook.HeaderSignature), webhook.Sign("test-secret", timestamp, req.body); got != want {
+		t.Errorf("Signature mismatch: got %s, want %s", got, want)
+	}
+	if req.header.Get(webhook.HeaderEvent) != events.UploadCreated {
+		t.Errorf("Expected event header %s, got %s", events.UploadCreated, req.header.Get(webhook.HeaderEvent))
+	}
+
+	var event events.Event
+	if err := json.Unmarshal(req.body, &event); err != nil {
+		t.Fatalf("Invalid payload: %v", err)
+	}
+	if event.Type != events.UploadCreated || event.UserID != userID || event.ID == "" {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+
+	waitFor(t, func() bool {
+		deliveries := repo.Deliveries()
+		return len(deliveries) == 1 && deliveries[0].Status == webhook.DeliverySucceeded
+	})
+}
+
+func TestWebhook_OnlyMatchingSubscriptionsReceive(t *testing.T) {
+	mine, receivedMine := newWebhookReceiver(t)
+	other, receivedOther := newWebhookReceiver(t)
+	global, receivedGlobal := newWebhookReceiver(t)
+	bus, repo, _ := setupWebhooks(t)
+
+	userID, otherID := int64(1), int64(2)
+	addSubscription(repo, &userID, mine.URL, events.TokensRevoked)
+	addSubscription(repo, &otherID, other.URL, webhook.AllEvents)
+	addSubscription(repo, nil, global.URL, webhook.AllEvents)
+
+	bus.Publish(events.TokensRevoked, userID, nil)
+	bus.Publish(events.UploadDeleted, userID, nil)
+	waitFor(t, func() bool { return len(receivedMine()) == 1 && len(receivedGlobal()) == 2 })
+
+	time.Sleep(20 * time.Millisecond)
+	if n := len(receivedOther()); n != 0 {
+		t.Errorf("Another user's subscription received %d events", n)
+	}
+	if n := len(receivedMine()); n != 1 {
+		t.Errorf("Expected 1 delivery for the filtered subscription, got %d", n)
+	}
+}
+
+func TestWebhook_RetriesThenFailsAndReplays(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	bus, repo, dispatcher := setupWebhooks(t)
+	userID := int64(1)
+	addSubscription(repo, &userID, server.URL, events.UploadCreated)
+
+	bus.Publish(events.UploadCreated, userID, nil)
+	waitFor(t, func() bool {
+		deliveries := repo.Deliveries()
+		return len(deliveries) == 1 && deliveries[0].Status == webhook.DeliveryFailed
+	})
+
+	delivery := repo.Deliveries()[0]
+	if delivery.Attempts != 3 || delivery.ResponseStatus != http.StatusInternalServerError {
+		t.Errorf("Expected 3 attempts ending in 500, got %d attempts, status %d", delivery.Attempts, delivery.ResponseStatus)
+	}
+
+	failing.Store(false)
+	if err := dispatcher.Replay(delivery); err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	waitFor(t, func() bool { return repo.Deliveries()[0].Status == webhook.DeliverySucceeded })
+
+	if err := dispatcher.Replay(repo.Deliveries()[0]); err != webhook.ErrDeliveryNotFailed {
+		t.Errorf("Expected ErrDeliveryNotFailed, got %v", err)
+	}
+}
+
+func TestWebhook_ClientBlocksPrivateAddresses(t *testing.T) {
+	server, received := newWebhookReceiver(t)
+
+	client := webhook.NewClient(time.Second, false)
+	resp, err := client.Post(server.URL, "application/json", bytes.NewReader([]byte("{}")))
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("Expected loopback delivery to be blocked")
+	}
+	if len(received()) != 0 {
+		t.Error("Blocked request reached the server")
+	}
+}
+
+func TestNetguard_BlocksInternalRanges(t *testing.T) {
+	for _, ip := range []string{
+		"127.0.0.1", "10.1.2.3", "169.254.169.254", "100.64.0.1", "198.18.0.1",
+		"240.0.0.1", "224.0.0.1", "0.0.0.0", "::1", "fe80::1", "fd00::1",
+	} {
+		if err := netguard.CheckIP(net.ParseIP(ip)); err != netguard.ErrBlocked {
+			t.Errorf("Expected %s to be blocked, got %v", ip, err)
+		}
+	}
+	for _, ip := range []string{"93.184.216.34", "2606:4700::1111"} {
+		if err := netguard.CheckIP(net.ParseIP(ip)); err != nil {
+			t.Errorf("Expected %s to be allowed, got %v", ip, err)
+		}
+	}
+}
+
+func TestWebhookHandler_CreateValidates(t *testing.T) {
+	handler := webhook.NewHandler(NewMockWebhookRepository(), nil)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"valid", `{"url":"https://example.com/hook","events":["upload.created"]}`, http.StatusCreated},
+		{"bad scheme", `{"url":"ftp://example.com/hook","events":["upload.created"]}`, http.StatusBadRequest},
+		{"no events", `{"url":"https://example.com/hook","events":[]}`, http.StatusBadRequest},
+		{"unknown event", `{"url":"https://example.com/hook","events":["upload.renamed"]}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/api/webhooks", bytes.NewBufferString(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("user", &auth.TokenClaims{UserID: 1, Username: "testuser"})
+
+			if err := handler.CreateSubscription(c); err != nil {
+				t.Fatalf("CreateSubscription returned error: %v", err)
+			}
+			if rec.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+			if tt.status == http.StatusCreated {
+				resp, _ := parseResponse(rec.Body.Bytes())
+				if secret, _ := getDataMap(resp)["secret"].(string); secret == "" {
+					t.Error("Expected the signing secret in the create response")
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookHandler_DeliveriesRequireOwnership(t *testing.T) {
+	repo := NewMockWebhookRepository()
+	handler := webhook.NewHandler(repo, nil)
+	owner := int64(1)
+	sub := addSubscription(repo, &owner, "https://example.com/hook", events.UploadCreated)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/webhooks/1/deliveries", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues(strconv.FormatInt(sub.ID, 10))
+	c.Set("user", &auth.TokenClaims{UserID: 2, Username: "intruder"})
+
+	if err := handler.ListDeliveries(c); err != nil {
+		t.Fatalf("ListDeliveries returned error: %v", err)
+	}
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, rec.Code)
+	}
+}
+
+func TestDeleteUpload_PublishesEvent(t *testing.T) {
+	tempDir := t.TempDir()
+	useUploadStorage(t, tempDir)
+
+	handler, mockRepo := setupUploadTestHandler()
+	bus := events.NewBus()
+	var published []events.Event
+	bus.Subscribe(func(event events.Event) { published = append(published, event) })
+	handler.SetEventBus(bus)
+
+	mockRepo.AddUpload(&upload.FileUpload{ID: 7, UserID: 1, Filename: "a.png", TempPath: tempDir + "/a.png"})
+
+	e := echo.New()
+	c, rec := createUploadTestContext(e, http.MethodDelete, "/api/uploads/7", nil, "")
+	c.SetParamNames("id")
+	c.SetParamValues("7")
+	c.Set("user", &auth.TokenClaims{UserID: 1, Username: "testuser"})
+
+	if err := handler.DeleteUpload(c); err != nil {
+		t.Fatalf("DeleteUpload returned error: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if _, found := mockRepo.GetFileUploadByID(7); found {
+		t.Error("Upload should have been deleted")
+	}
+	if len(published) != 1 || published[0].Type != events.UploadDeleted || published[0].UserID != 1 {
+		t.Fatalf("Expected one upload.deleted event, got %+v", published)
+	}
+	payload, _ := json.Marshal(published[0].Data)
+	if bytes.Contains(payload, []byte(tempDir)) || bytes.Contains(payload, []byte("file_path")) {
+		t.Errorf("Expected no storage path in the event payload, got %s", payload)
+	}
+}
+
+func TestRegister_PublishesEvent(t *testing.T) {
+	handler, _, _ := setupAuthTestHandler()
+	bus := events.NewBus()
+	var published []events.Event
+	bus.Subscribe(func(event events.Event) { published = append(published, event) })
+	handler.SetEventBus(bus)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewBufferString(`{"username":"newuser","password":"Password123"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	if err := handler.Register(c); err != nil {
+		t.Fatalf("Register returned error: %v", err)
+	}
+	if len(published) != 1 || published[0].Type != events.UserRegistered {
+		t.Errorf("Expected one user.registered event, got %+v", published)
+	}
+}